@@ -2,13 +2,18 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/kenelite/smartstore/internal/app"
 	"github.com/kenelite/smartstore/internal/config"
 )
 
 func main() {
-	cfg, err := config.Load("config.yaml")
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
+	cfg, err := config.Load(configPath())
 	if err != nil {
 		log.Fatalf("load config: %v", err)
 	}
@@ -20,3 +25,10 @@ func main() {
 		log.Fatalf("server error: %v", err)
 	}
 }
+
+func configPath() string {
+	if p := os.Getenv("CONFIG_PATH"); p != "" {
+		return p
+	}
+	return "config.yaml"
+}
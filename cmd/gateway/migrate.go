@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/migrate"
+)
+
+// runMigrate implements `gateway migrate [-dsn url] up|down [n]|status`.
+// The config is only loaded when -dsn is not given, so hosts without one
+// can migrate.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dsn := fs.String("dsn", "", "database connection string (defaults to db.dsn of the config)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gateway migrate [-dsn url] up | down [n] | status")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *dsn == "" {
+		cfg, err := config.Load(configPath())
+		if err != nil {
+			log.Printf("load config: %v", err)
+			return 1
+		}
+		*dsn = cfg.DB.DSN
+	}
+	if *dsn == "" {
+		fs.Usage()
+		return 2
+	}
+
+	ctx := context.Background()
+	connCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	conn, err := pgx.Connect(connCtx, *dsn)
+	cancel()
+	if err != nil {
+		log.Printf("connect DB: %v", err)
+		return 1
+	}
+	defer conn.Close(ctx)
+
+	m, err := migrate.New(conn)
+	if err != nil {
+		log.Printf("load migrations: %v", err)
+		return 1
+	}
+
+	switch fs.Arg(0) {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			log.Printf("migrate up: %v", err)
+			return 1
+		}
+		log.Printf("applied %d migration(s)", n)
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			if steps, err = strconv.Atoi(fs.Arg(1)); err != nil || steps < 1 {
+				log.Printf("invalid step count %q", fs.Arg(1))
+				return 2
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			log.Printf("migrate down: %v", err)
+			return 1
+		}
+		log.Printf("rolled back %d migration(s)", n)
+	case "status":
+		st, err := m.Status(ctx)
+		if err != nil {
+			log.Printf("migrate status: %v", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range st {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		_ = tw.Flush()
+	default:
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kenelite/smartstore/pkg/client"
+)
+
+// splitObjectPath splits "bucket/key" into its parts. The key may be empty
+// when allowEmptyKey is set.
+func splitObjectPath(p string, allowEmptyKey bool) (bucket, key string, err error) {
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	if bucket == "" || (key == "" && !allowEmptyKey) {
+		return "", "", fmt.Errorf("invalid object path %q, want <bucket>/<key>", p)
+	}
+	return bucket, key, nil
+}
+
+func parseFlags(name string, args []string, define func(fs *flag.FlagSet)) ([]string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if define != nil {
+		define(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return fs.Args(), nil
+}
+
+func cmdPut(ctx context.Context, c *cli, args []string) error {
+	var contentType, class, tagging string
+	args, err := parseFlags("put", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&contentType, "content-type", "", "object content type")
+		fs.StringVar(&class, "class", "", "storage class (HOT/COLD/ARCHIVE)")
+		fs.StringVar(&tagging, "tags", "", "object tags, e.g. team=web&tier=logs")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return errors.New("usage: put [-content-type t] [-class c] [-tags k=v&...] <file|-> <bucket>/<key>")
+	}
+	tags, err := parseTags(tagging)
+	if err != nil {
+		return err
+	}
+	bucket, key, err := splitObjectPath(args[1], false)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader = os.Stdin
+	size := int64(-1)
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		body, size = f, st.Size()
+	}
+
+	res, err := c.client.Put(ctx, bucket, key, body, size, &client.PutOptions{
+		ContentType:  contentType,
+		StorageClass: class,
+		Tags:         tags,
+	})
+	if err != nil {
+		return err
+	}
+	return c.out.print(res, []string{"ETAG", "BACKEND", "SIZE"}, [][]string{
+		{res.ETag, res.Backend, strconv.FormatInt(res.Size, 10)},
+	})
+}
+
+func cmdGet(ctx context.Context, c *cli, args []string) error {
+	var versionID string
+	args, err := parseFlags("get", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&versionID, "version", "", "version ID (default: latest)")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: get [-version id] <bucket>/<key> [file|-]")
+	}
+	bucket, key, err := splitObjectPath(args[0], false)
+	if err != nil {
+		return err
+	}
+	obj, err := c.client.GetVersion(ctx, bucket, key, versionID)
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	if len(args) == 1 || args[1] == "-" {
+		_, err = io.Copy(os.Stdout, obj.Body)
+		return err
+	}
+	return writeFileAtomic(args[1], obj.Body)
+}
+
+// writeFileAtomic streams r into a temp file next to path and renames it
+// into place, so an interrupted download never leaves a partial file.
+func writeFileAtomic(path string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".smartctl-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func cmdList(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: ls <bucket>[/<prefix>]")
+	}
+	bucket, prefix, err := splitObjectPath(args[0], true)
+	if err != nil {
+		return err
+	}
+
+	var objects []*client.ObjectInfo
+	err = c.client.ListAll(ctx, bucket, prefix, func(o *client.ObjectInfo) error {
+		objects = append(objects, o)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(objects))
+	for _, o := range objects {
+		rows = append(rows, []string{
+			o.Key,
+			strconv.FormatInt(o.Size, 10),
+			o.StorageClass,
+			o.LastModified.Local().Format(time.DateTime),
+		})
+	}
+	return c.out.print(objects, []string{"KEY", "SIZE", "CLASS", "LAST MODIFIED"}, rows)
+}
+
+func cmdRemove(ctx context.Context, c *cli, args []string) error {
+	var versionID string
+	var bypass bool
+	args, err := parseFlags("rm", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&versionID, "version", "", "delete this version for good")
+		fs.BoolVar(&bypass, "bypass-governance", false, "delete past governance retention (admin token)")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || (versionID != "" && len(args) != 1) {
+		return errors.New("usage: rm [-bypass-governance] <bucket>/<key>... | rm -version id <bucket>/<key>")
+	}
+	del := c.client.DeleteVersion
+	if bypass {
+		del = c.client.DeleteLocked
+	}
+	for _, arg := range args {
+		bucket, key, err := splitObjectPath(arg, false)
+		if err != nil {
+			return err
+		}
+		if _, err := del(ctx, bucket, key, versionID); err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+	}
+	return nil
+}
+
+func cmdCopy(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: cp <bucket>/<key> <bucket>/<key>")
+	}
+	srcBucket, srcKey, err := splitObjectPath(args[0], false)
+	if err != nil {
+		return err
+	}
+	dstBucket, dstKey, err := splitObjectPath(args[1], false)
+	if err != nil {
+		return err
+	}
+	res, err := c.client.Copy(ctx, srcBucket, srcKey, dstBucket, dstKey, nil)
+	if err != nil {
+		return err
+	}
+	return c.out.print(res, []string{"ETAG", "BACKEND", "SIZE"}, [][]string{
+		{res.ETag, res.Backend, strconv.FormatInt(res.Size, 10)},
+	})
+}
+
+func cmdStat(ctx context.Context, c *cli, args []string) error {
+	var versionID string
+	args, err := parseFlags("stat", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&versionID, "version", "", "version ID (default: latest)")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("usage: stat [-version id] <bucket>/<key>")
+	}
+	bucket, key, err := splitObjectPath(args[0], false)
+	if err != nil {
+		return err
+	}
+	info, err := c.client.HeadVersion(ctx, bucket, key, versionID)
+	if err != nil {
+		return err
+	}
+	fields := [][2]string{
+		{"Key", info.Key},
+		{"Size", strconv.FormatInt(info.Size, 10)},
+		{"Content-Type", info.ContentType},
+		{"Storage-Class", info.StorageClass},
+		{"ETag", info.ETag},
+		{"Version", strconv.FormatInt(info.Version, 10)},
+		{"Version-Id", info.VersionID},
+		{"Last-Modified", info.LastModified.Local().Format(time.DateTime)},
+	}
+	if l := info.Lock; l != nil {
+		if l.Mode != "" {
+			fields = append(fields, [2]string{"Retention", l.Mode + " until " + l.RetainUntil.Local().Format(time.DateTime)})
+		}
+		fields = append(fields, [2]string{"Legal-Hold", strconv.FormatBool(l.LegalHold)})
+	}
+	if len(info.Tags) > 0 {
+		fields = append(fields, [2]string{"Tags", formatTags(info.Tags)})
+	}
+	return c.out.printFields(info, fields)
+}
+
+func cmdLock(ctx context.Context, c *cli, args []string) error {
+	const usage = "usage: lock retention [-version id] [-bypass-governance] <bucket>/<key> <GOVERNANCE|COMPLIANCE|none> [until]\n" +
+		"       lock hold [-version id] <bucket>/<key> on|off"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	var versionID string
+	var bypass bool
+	rest, err := parseFlags("lock "+args[0], args[1:], func(fs *flag.FlagSet) {
+		fs.StringVar(&versionID, "version", "", "version ID (default: latest)")
+		if args[0] == "retention" {
+			fs.BoolVar(&bypass, "bypass-governance", false, "shorten or remove governance retention (admin token)")
+		}
+	})
+	if err != nil {
+		return err
+	}
+	var lock *client.ObjectLock
+	switch {
+	case args[0] == "retention" && (len(rest) == 2 || len(rest) == 3):
+		bucket, key, err := splitObjectPath(rest[0], false)
+		if err != nil {
+			return err
+		}
+		opts := &client.RetentionOptions{VersionID: versionID, BypassGovernance: bypass}
+		if !strings.EqualFold(rest[1], "none") {
+			if len(rest) != 3 {
+				return errors.New(usage)
+			}
+			opts.Mode = strings.ToUpper(rest[1])
+			if opts.RetainUntil, err = parseUntil(rest[2]); err != nil {
+				return err
+			}
+		}
+		if lock, err = c.client.SetRetention(ctx, bucket, key, opts); err != nil {
+			return err
+		}
+	case args[0] == "hold" && len(rest) == 2 && (rest[1] == "on" || rest[1] == "off"):
+		bucket, key, err := splitObjectPath(rest[0], false)
+		if err != nil {
+			return err
+		}
+		if lock, err = c.client.SetLegalHold(ctx, bucket, key, versionID, rest[1] == "on"); err != nil {
+			return err
+		}
+	default:
+		return errors.New(usage)
+	}
+	until := ""
+	if lock.Mode != "" {
+		until = lock.RetainUntil.Local().Format(time.DateTime)
+	}
+	return c.out.printFields(lock, [][2]string{
+		{"Mode", lock.Mode},
+		{"Retain-Until", until},
+		{"Legal-Hold", strconv.FormatBool(lock.LegalHold)},
+	})
+}
+
+// parseUntil reads an RFC 3339 date or a duration from now, e.g. 720h.
+func parseUntil(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, want RFC 3339 or a duration like 720h", s)
+	}
+	return t, nil
+}
+
+func cmdVersions(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: versions <bucket>[/<prefix>]")
+	}
+	bucket, prefix, err := splitObjectPath(args[0], true)
+	if err != nil {
+		return err
+	}
+	var versions []*client.ObjectVersion
+	opts := &client.VersionListOptions{Prefix: prefix}
+	for {
+		page, err := c.client.ListVersions(ctx, bucket, opts)
+		if err != nil {
+			return err
+		}
+		versions = append(versions, page.Versions...)
+		if !page.IsTruncated {
+			break
+		}
+		opts.Marker, opts.VersionIDMarker = page.NextMarker, page.NextVersionIDMarker
+	}
+	rows := make([][]string, 0, len(versions))
+	for _, v := range versions {
+		size := strconv.FormatInt(v.Size, 10)
+		if v.DeleteMarker {
+			size = "(delete marker)"
+		}
+		latest := ""
+		if v.IsLatest {
+			latest = "*"
+		}
+		rows = append(rows, []string{
+			v.Key,
+			v.VersionID,
+			latest,
+			size,
+			v.LastModified.Local().Format(time.DateTime),
+		})
+	}
+	return c.out.print(versions, []string{"KEY", "VERSION ID", "LATEST", "SIZE", "LAST MODIFIED"}, rows)
+}
+
+func cmdRoutes(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 5 || args[0] != "resolve" {
+		return errors.New("usage: routes resolve <env> <region> <bucket> <class>")
+	}
+	route, err := c.client.ResolveRoute(ctx, args[1], args[2], args[3], args[4])
+	if err != nil {
+		return err
+	}
+	return c.out.printFields(route, [][2]string{
+		{"Provider", route.ProviderName},
+		{"Type", route.ProviderType},
+		{"Region", route.ProviderRegion},
+		{"Bucket", route.ProviderBucket},
+	})
+}
+
+func cmdCache(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 2 || args[0] != "purge" {
+		return errors.New("usage: cache purge <bucket>/<key>")
+	}
+	bucket, key, err := splitObjectPath(args[1], false)
+	if err != nil {
+		return err
+	}
+	return c.client.PurgeCache(ctx, bucket, key)
+}
+
+func cmdTrash(ctx context.Context, c *cli, args []string) error {
+	const usage = "usage: trash ls <bucket>[/<prefix>] | trash restore <bucket>/<key> [id] | trash purge"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch {
+	case args[0] == "ls" && len(args) == 2:
+		bucket, prefix, err := splitObjectPath(args[1], true)
+		if err != nil {
+			return err
+		}
+		var entries []*client.TrashEntry
+		opts := &client.TrashListOptions{Prefix: prefix}
+		for {
+			page, err := c.client.ListTrash(ctx, bucket, opts)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, page.Entries...)
+			if !page.IsTruncated {
+				break
+			}
+			opts.Marker, opts.IDMarker = page.NextMarker, page.NextIDMarker
+		}
+		rows := make([][]string, 0, len(entries))
+		for _, e := range entries {
+			rows = append(rows, []string{
+				strconv.FormatInt(e.ID, 10),
+				e.Key,
+				strconv.FormatInt(e.Size, 10),
+				e.DeletedAt.Local().Format(time.DateTime),
+				e.PurgeAt.Local().Format(time.DateTime),
+			})
+		}
+		return c.out.print(entries, []string{"ID", "KEY", "SIZE", "DELETED", "PURGE AT"}, rows)
+	case args[0] == "restore" && (len(args) == 2 || len(args) == 3):
+		bucket, key, err := splitObjectPath(args[1], false)
+		if err != nil {
+			return err
+		}
+		var id int64
+		if len(args) == 3 {
+			if id, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+				return fmt.Errorf("invalid id %q", args[2])
+			}
+		}
+		info, err := c.client.Restore(ctx, bucket, key, id)
+		if err != nil {
+			return err
+		}
+		return c.out.printFields(info, [][2]string{
+			{"Key", info.Key},
+			{"Size", strconv.FormatInt(info.Size, 10)},
+			{"ETag", info.ETag},
+		})
+	case args[0] == "purge" && len(args) == 1:
+		n, err := c.client.PurgeTrash(ctx)
+		if err != nil {
+			return err
+		}
+		return c.out.printFields(map[string]int{"purged": n}, [][2]string{{"Purged", strconv.Itoa(n)}})
+	}
+	return errors.New(usage)
+}
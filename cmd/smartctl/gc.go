@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func cmdGC(ctx context.Context, c *cli, args []string) error {
+	const usage = "usage: gc orphans [-dry-run]"
+	if len(args) == 0 || args[0] != "orphans" {
+		return errors.New(usage)
+	}
+	var dryRun bool
+	rest, err := parseFlags("gc orphans", args[1:], func(fs *flag.FlagSet) {
+		fs.BoolVar(&dryRun, "dry-run", false, "only report orphans")
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New(usage)
+	}
+	report, err := c.client.CollectOrphans(ctx, dryRun)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(report.Entries))
+	for _, e := range report.Entries {
+		rows = append(rows, []string{
+			e.Provider + "/" + e.ProviderBucket,
+			e.PhysicalKey,
+			strconv.FormatInt(e.Size, 10),
+			e.LastModified.Local().Format(time.DateTime),
+			e.Error,
+		})
+	}
+	if err := c.out.print(report, []string{"PROVIDER", "KEY", "SIZE", "MODIFIED", "ERROR"}, rows); err != nil {
+		return err
+	}
+	if c.out.format == outputJSON {
+		return nil
+	}
+	summary := fmt.Sprintf("listed %d, orphans %d (%d bytes), deleted %d, failed %d",
+		report.Listed, report.Orphans, report.OrphanBytes, report.Deleted, report.Failed)
+	if report.DryRun {
+		summary += " (dry run)"
+	}
+	if report.Truncated {
+		summary += "; more orphans than listed"
+	}
+	_, err = fmt.Fprintln(c.out.w, summary)
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+)
+
+// parseTags reads tags written as a query string: "k=v&k2=v2".
+func parseTags(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	q, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tags %q: %v", s, err)
+	}
+	tags := make(map[string]string, len(q))
+	for k := range q {
+		tags[k] = q.Get(k)
+	}
+	return tags, nil
+}
+
+func formatTags(tags map[string]string) string {
+	q := make(url.Values, len(tags))
+	for k, v := range tags {
+		q.Set(k, v)
+	}
+	s, _ := url.QueryUnescape(q.Encode())
+	return s
+}
+
+func cmdLifecycle(ctx context.Context, c *cli, args []string) error {
+	const usage = "usage: lifecycle run [-dry-run]"
+	if len(args) == 0 || args[0] != "run" {
+		return errors.New(usage)
+	}
+	var dryRun bool
+	rest, err := parseFlags("lifecycle run", args[1:], func(fs *flag.FlagSet) {
+		fs.BoolVar(&dryRun, "dry-run", false, "only report what the rules would do")
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New(usage)
+	}
+	report, err := c.client.RunLifecycle(ctx, dryRun)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(report.Actions))
+	for _, a := range report.Actions {
+		change := a.To
+		if a.Action == "transition" {
+			change = a.From + " -> " + a.To
+		}
+		rows = append(rows, []string{a.Bucket, a.Key, a.Rule, a.Action, change, a.Error})
+	}
+	if err := c.out.print(report, []string{"BUCKET", "KEY", "RULE", "ACTION", "CLASS", "ERROR"}, rows); err != nil {
+		return err
+	}
+	if c.out.format == outputJSON {
+		return nil
+	}
+	summary := fmt.Sprintf("scanned %d, transitioned %d, expired %d, failed %d",
+		report.Scanned, report.Transitioned, report.Expired, report.Failed)
+	if report.DryRun {
+		summary += " (dry run)"
+	}
+	if report.Truncated {
+		summary += "; more actions than listed"
+	}
+	_, err = fmt.Fprintln(c.out.w, summary)
+	return err
+}
@@ -0,0 +1,138 @@
+// Command smartctl is the operator CLI for the SmartStore gateway.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/kenelite/smartstore/pkg/client"
+)
+
+const usage = `usage: smartctl [flags] <command> [args]
+
+Commands:
+  put <file|-> <bucket>/<key>       upload a file (- reads stdin)
+  get <bucket>/<key> [file|-]       download an object (default: stdout)
+  ls <bucket>[/<prefix>]            list objects
+  rm <bucket>/<key>...              delete objects
+  cp <bucket>/<key> <bucket>/<key>  copy an object
+  stat <bucket>/<key>               show object metadata
+                                    (get, rm and stat take -version id)
+  versions <bucket>[/<prefix>]      list object versions and delete markers
+  lock retention <bucket>/<key> <GOVERNANCE|COMPLIANCE|none> [until]
+                                    set retention (until: RFC 3339 or e.g. 720h)
+  lock hold <bucket>/<key> on|off   place or lift a legal hold (off needs the admin token)
+  routes resolve <env> <region> <bucket> <class>
+                                    show the provider route the gateway picks
+  cache purge <bucket>/<key>        evict an object from the gateway cache
+  trash ls <bucket>[/<prefix>]      list deleted objects that can be restored
+  trash restore <bucket>/<key> [id] restore a deleted object (default: latest)
+  trash purge                       purge expired trash entries now
+  lifecycle run [-dry-run]          apply the buckets' lifecycle rules now
+  gc orphans [-dry-run]             delete provider objects no metadata points to
+  scrub run [-verify] [-repair]     compare metadata with provider objects now
+  scrub findings [-limit n]         list recorded scrub findings
+  replicas <bucket>/<key>           show the replication status of an object
+  rebalance run [-dry-run]          move objects written to fallbacks back now
+  packs compact [-dry-run]          delete and rewrite packs of deleted objects now
+  sync up <dir> <bucket>[/<prefix>]
+  sync down <bucket>[/<prefix>] <dir>
+                                    mirror a directory and a prefix; flags:
+                                    -delete -dry-run -parallel n
+                                    -include glob -exclude glob
+
+Flags:
+`
+
+// cli carries the state shared by all commands.
+type cli struct {
+	profile *Profile
+	client  *client.Client
+	out     *printer
+}
+
+type command func(ctx context.Context, c *cli, args []string) error
+
+var commands = map[string]command{
+	"put":       cmdPut,
+	"get":       cmdGet,
+	"ls":        cmdList,
+	"rm":        cmdRemove,
+	"cp":        cmdCopy,
+	"stat":      cmdStat,
+	"versions":  cmdVersions,
+	"lock":      cmdLock,
+	"routes":    cmdRoutes,
+	"cache":     cmdCache,
+	"sync":      cmdSync,
+	"trash":     cmdTrash,
+	"lifecycle": cmdLifecycle,
+	"gc":        cmdGC,
+	"scrub":     cmdScrub,
+	"replicas":  cmdReplicas,
+	"rebalance": cmdRebalance,
+	"packs":     cmdPacks,
+}
+
+func main() {
+	fs := flag.NewFlagSet("smartctl", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	profileName := fs.String("profile", envOr("SMARTCTL_PROFILE", "default"), "profile name")
+	profilesPath := fs.String("profiles", defaultProfilesPath(), "path to the profiles file")
+	format := fs.String("o", string(outputTable), "output format: table or json")
+	_ = fs.Parse(os.Args[1:])
+
+	args := fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "smartctl: unknown command %q\n\n", args[0])
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format != string(outputTable) && *format != string(outputJSON) {
+		fatalf("invalid output format %q", *format)
+	}
+
+	profile, err := loadProfile(*profilesPath, *profileName)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	cl, err := profile.client()
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := &cli{
+		profile: profile,
+		client:  cl,
+		out:     &printer{w: os.Stdout, format: outputFormat(*format)},
+	}
+	if err := cmd(ctx, c, args[1:]); err != nil {
+		fatalf("%s: %v", args[0], err)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "smartctl: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+func cmdPacks(ctx context.Context, c *cli, args []string) error {
+	const usage = "usage: packs compact [-dry-run]"
+	if len(args) == 0 || args[0] != "compact" {
+		return errors.New(usage)
+	}
+	var dryRun bool
+	rest, err := parseFlags("packs compact", args[1:], func(fs *flag.FlagSet) {
+		fs.BoolVar(&dryRun, "dry-run", false, "only report what would be compacted")
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New(usage)
+	}
+	report, err := c.client.CompactPacks(ctx, dryRun)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(report.Packs))
+	for _, p := range report.Packs {
+		rows = append(rows, []string{
+			strconv.FormatInt(p.ID, 10),
+			p.Bucket,
+			p.Action,
+			strconv.FormatInt(p.SizeBytes, 10),
+			strconv.FormatInt(p.LiveBytes, 10),
+			p.Error,
+		})
+	}
+	if err := c.out.print(report, []string{"PACK", "BUCKET", "ACTION", "SIZE", "LIVE", "ERROR"}, rows); err != nil {
+		return err
+	}
+	if c.out.format == outputJSON {
+		return nil
+	}
+	summary := fmt.Sprintf("scanned %d packs, deleted %d, rewrote %d, failed %d, reclaimed %d bytes",
+		report.Scanned, report.Deleted, report.Rewritten, report.Failed, report.ReclaimedBytes)
+	if report.DryRun {
+		summary += " (dry run)"
+	}
+	if report.Truncated {
+		summary += "; more packs than listed"
+	}
+	_, err = fmt.Fprintln(c.out.w, summary)
+	return err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kenelite/smartstore/pkg/client"
+)
+
+// Profile holds the gateway endpoint and credentials for one environment.
+// Profiles live in a YAML file keyed by profile name:
+//
+//	default:
+//	  endpoint: http://localhost:8080
+//	  env: prod
+//	  region: ap-sg
+//	  admin_token: ...
+type Profile struct {
+	Endpoint      string `yaml:"endpoint"`
+	Env           string `yaml:"env"`
+	Region        string `yaml:"region"`
+	AdminToken    string `yaml:"admin_token,omitempty"`
+	PresignSecret string `yaml:"presign_secret,omitempty"`
+}
+
+func defaultProfilesPath() string {
+	if p := os.Getenv("SMARTCTL_PROFILES"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".smartstore/profiles.yaml"
+	}
+	return filepath.Join(home, ".smartstore", "profiles.yaml")
+}
+
+func loadProfile(path, name string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read profiles: %w", err)
+	}
+	var profiles map[string]Profile
+	if err := yaml.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("parse profiles %s: %w", path, err)
+	}
+	p, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found in %s", name, path)
+	}
+	if p.Endpoint == "" {
+		return nil, fmt.Errorf("profile %q has no endpoint", name)
+	}
+	return &p, nil
+}
+
+func (p *Profile) client() (*client.Client, error) {
+	return client.New(p.Endpoint, p.Env, p.Region,
+		client.WithAdminToken(p.AdminToken),
+		client.WithPresignSecret(p.PresignSecret),
+	)
+}
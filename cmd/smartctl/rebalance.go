@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+)
+
+func cmdRebalance(ctx context.Context, c *cli, args []string) error {
+	const usage = "usage: rebalance run [-dry-run]"
+	if len(args) == 0 || args[0] != "run" {
+		return errors.New(usage)
+	}
+	var dryRun bool
+	rest, err := parseFlags("rebalance run", args[1:], func(fs *flag.FlagSet) {
+		fs.BoolVar(&dryRun, "dry-run", false, "only report what would move")
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New(usage)
+	}
+	report, err := c.client.Rebalance(ctx, dryRun)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(report.Moves))
+	for _, m := range report.Moves {
+		rows = append(rows, []string{m.Bucket, m.Key, m.VersionID, m.From + " -> " + m.To, m.Error})
+	}
+	if err := c.out.print(report, []string{"BUCKET", "KEY", "VERSION", "MOVE", "ERROR"}, rows); err != nil {
+		return err
+	}
+	if c.out.format == outputJSON {
+		return nil
+	}
+	summary := fmt.Sprintf("found %d at fallbacks, moved %d, skipped %d, failed %d",
+		report.Found, report.Moved, report.Skipped, report.Failed)
+	if report.DryRun {
+		summary += " (dry run)"
+	}
+	if report.Truncated {
+		summary += "; more moves than listed"
+	}
+	_, err = fmt.Fprintln(c.out.w, summary)
+	return err
+}
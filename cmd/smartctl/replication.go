@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strconv"
+	"time"
+)
+
+func cmdReplicas(ctx context.Context, c *cli, args []string) error {
+	var versionID string
+	args, err := parseFlags("replicas", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&versionID, "version", "", "version ID (default: latest)")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("usage: replicas [-version id] <bucket>/<key>")
+	}
+	bucket, key, err := splitObjectPath(args[0], false)
+	if err != nil {
+		return err
+	}
+	reps, err := c.client.ListReplicas(ctx, bucket, key, versionID)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(reps))
+	for _, r := range reps {
+		replicated := ""
+		if !r.ReplicatedAt.IsZero() {
+			replicated = r.ReplicatedAt.Local().Format(time.DateTime)
+		}
+		rows = append(rows, []string{
+			r.TargetProvider,
+			r.TargetBucket,
+			r.Status,
+			strconv.Itoa(r.Attempts),
+			replicated,
+			r.LastError,
+		})
+	}
+	return c.out.print(reps, []string{"PROVIDER", "BUCKET", "STATUS", "ATTEMPTS", "REPLICATED", "ERROR"}, rows)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kenelite/smartstore/pkg/client"
+)
+
+func cmdScrub(ctx context.Context, c *cli, args []string) error {
+	const usage = "usage: scrub run [-verify] [-repair] | scrub findings [-limit n]"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "run":
+		var opts client.ScrubOptions
+		rest, err := parseFlags("scrub run", args[1:], func(fs *flag.FlagSet) {
+			fs.BoolVar(&opts.Verify, "verify", false, "re-read content and check recorded checksums")
+			fs.BoolVar(&opts.Repair, "repair", false, "rewrite damaged objects from a healthy copy")
+		})
+		if err != nil {
+			return err
+		}
+		if len(rest) != 0 {
+			return errors.New(usage)
+		}
+		report, err := c.client.Scrub(ctx, &opts)
+		if err != nil {
+			return err
+		}
+		if err := c.out.print(report, findingHeader, findingRows(report.Entries)); err != nil {
+			return err
+		}
+		if c.out.format == outputJSON {
+			return nil
+		}
+		kinds := make([]string, 0, len(report.Findings))
+		for k, n := range report.Findings {
+			kinds = append(kinds, k+"="+strconv.Itoa(n))
+		}
+		sort.Strings(kinds)
+		summary := fmt.Sprintf("checked %d, findings [%s], repaired %d, errors %d",
+			report.Checked, strings.Join(kinds, " "), report.Repaired, report.Errors)
+		if report.Truncated {
+			summary += "; more findings than listed"
+		}
+		_, err = fmt.Fprintln(c.out.w, summary)
+		return err
+	case "findings":
+		var limit int
+		rest, err := parseFlags("scrub findings", args[1:], func(fs *flag.FlagSet) {
+			fs.IntVar(&limit, "limit", 100, "number of findings, newest first")
+		})
+		if err != nil {
+			return err
+		}
+		if len(rest) != 0 {
+			return errors.New(usage)
+		}
+		page, err := c.client.ListScrubFindings(ctx, 0, limit)
+		if err != nil {
+			return err
+		}
+		return c.out.print(page.Findings, findingHeader, findingRows(page.Findings))
+	}
+	return errors.New(usage)
+}
+
+var findingHeader = []string{"DETECTED", "KIND", "BUCKET", "KEY", "VERSION", "EXPECTED", "ACTUAL", "REPAIRED"}
+
+func findingRows(findings []*client.ScrubFinding) [][]string {
+	rows := make([][]string, 0, len(findings))
+	for _, f := range findings {
+		rows = append(rows, []string{
+			f.DetectedAt.Local().Format(time.DateTime),
+			f.Kind,
+			f.Bucket,
+			f.Key,
+			f.VersionID,
+			f.Expected,
+			f.Actual,
+			strconv.FormatBool(f.Repaired),
+		})
+	}
+	return rows
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kenelite/smartstore/pkg/client"
+)
+
+type syncDirection string
+
+const (
+	syncUp   syncDirection = "up"
+	syncDown syncDirection = "down"
+)
+
+type syncAction string
+
+const (
+	actionUpload   syncAction = "upload"
+	actionDownload syncAction = "download"
+	actionDelete   syncAction = "delete"
+)
+
+type syncOptions struct {
+	direction syncDirection
+	localDir  string
+	bucket    string
+	prefix    string // empty or ending in "/"
+	delete    bool
+	dryRun    bool
+	parallel  int
+	includes  []string
+	excludes  []string
+}
+
+// syncOp is one planned change. Path is relative to the local directory and
+// the remote prefix, always with forward slashes.
+type syncOp struct {
+	Action syncAction `json:"action"`
+	Path   string     `json:"path"`
+	Size   int64      `json:"size"`
+	Reason string     `json:"reason"`
+	Error  string     `json:"error,omitempty"`
+}
+
+type localFile struct {
+	abs   string
+	size  int64
+	mtime time.Time
+}
+
+type multiFlag []string
+
+func (m *multiFlag) String() string     { return strings.Join(*m, ",") }
+func (m *multiFlag) Set(v string) error { *m = append(*m, v); return nil }
+
+// cmdSync mirrors a local directory and a bucket prefix in either direction:
+//
+//	sync up <dir> <bucket>[/<prefix>]
+//	sync down <bucket>[/<prefix>] <dir>
+//
+// Files are compared by size, then by MD5 when the gateway ETag is a plain
+// MD5 (single-part S3/R2 uploads), otherwise by modification time. Local MD5s
+// are kept in a checkpoint file so an interrupted sync resumes without
+// re-hashing or re-transferring finished files.
+func cmdSync(ctx context.Context, c *cli, args []string) error {
+	var includes, excludes multiFlag
+	opts := syncOptions{}
+	args, err := parseFlags("sync", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&opts.delete, "delete", false, "delete destination files missing from the source")
+		fs.BoolVar(&opts.dryRun, "dry-run", false, "print planned changes without applying them")
+		fs.IntVar(&opts.parallel, "parallel", 4, "number of concurrent transfers")
+		fs.Var(&includes, "include", "only sync paths matching this glob (repeatable)")
+		fs.Var(&excludes, "exclude", "skip paths matching this glob (repeatable)")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) != 3 || (args[0] != string(syncUp) && args[0] != string(syncDown)) {
+		return errors.New("usage: sync [flags] up <dir> <bucket>[/<prefix>] | sync [flags] down <bucket>[/<prefix>] <dir>")
+	}
+	opts.direction = syncDirection(args[0])
+	opts.includes, opts.excludes = includes, excludes
+	if opts.parallel < 1 {
+		opts.parallel = 1
+	}
+	remote := args[2]
+	opts.localDir = args[1]
+	if opts.direction == syncDown {
+		remote, opts.localDir = args[1], args[2]
+	}
+	if opts.bucket, opts.prefix, err = splitObjectPath(remote, true); err != nil {
+		return err
+	}
+	if opts.prefix != "" && !strings.HasSuffix(opts.prefix, "/") {
+		opts.prefix += "/"
+	}
+	for _, g := range append(append([]string{}, includes...), excludes...) {
+		if _, err := path.Match(g, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", g, err)
+		}
+	}
+
+	if opts.direction == syncDown {
+		if err := os.MkdirAll(opts.localDir, 0o755); err != nil {
+			return err
+		}
+	}
+	locals, err := scanLocal(opts)
+	if err != nil {
+		return err
+	}
+	remotes, err := scanRemote(ctx, c.client, opts)
+	if err != nil {
+		return err
+	}
+
+	cp, err := openCheckpoint(c.profile, opts)
+	if err != nil {
+		return err
+	}
+	ops, err := planSync(opts, locals, remotes, cp)
+	if err != nil {
+		return err
+	}
+	if !opts.dryRun {
+		runSync(ctx, c.client, opts, locals, remotes, ops, cp)
+		if err := cp.save(); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	rows := make([][]string, 0, len(ops))
+	for _, op := range ops {
+		status := "ok"
+		switch {
+		case opts.dryRun:
+			status = "planned"
+		case op.Error != "":
+			status = op.Error
+			failed++
+		}
+		rows = append(rows, []string{string(op.Action), op.Path, strconv.FormatInt(op.Size, 10), op.Reason, status})
+	}
+	if err := c.out.print(ops, []string{"ACTION", "PATH", "SIZE", "REASON", "STATUS"}, rows); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d operations failed; re-run to resume", failed, len(ops))
+	}
+	return nil
+}
+
+func (o syncOptions) matches(rel string) bool {
+	match := func(globs []string) bool {
+		for _, g := range globs {
+			if ok, _ := path.Match(g, rel); ok {
+				return true
+			}
+			if ok, _ := path.Match(g, path.Base(rel)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(o.includes) > 0 && !match(o.includes) {
+		return false
+	}
+	return !match(o.excludes)
+}
+
+func scanLocal(opts syncOptions) (map[string]localFile, error) {
+	out := map[string]localFile{}
+	err := filepath.WalkDir(opts.localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || isTempDownload(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(opts.localDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !opts.matches(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out[rel] = localFile{abs: p, size: info.Size(), mtime: info.ModTime()}
+		return nil
+	})
+	return out, err
+}
+
+func scanRemote(ctx context.Context, cl *client.Client, opts syncOptions) (map[string]*client.ObjectInfo, error) {
+	out := map[string]*client.ObjectInfo{}
+	err := cl.ListAll(ctx, opts.bucket, opts.prefix, func(o *client.ObjectInfo) error {
+		rel := strings.TrimPrefix(o.Key, opts.prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") || !opts.matches(rel) {
+			return nil
+		}
+		out[rel] = o
+		return nil
+	})
+	return out, err
+}
+
+var md5ETag = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// remoteMD5 returns the object's MD5 if its ETag is one.
+func remoteMD5(o *client.ObjectInfo) (string, bool) {
+	etag := strings.ToLower(strings.Trim(o.ETag, `"`))
+	return etag, md5ETag.MatchString(etag)
+}
+
+func planSync(opts syncOptions, locals map[string]localFile, remotes map[string]*client.ObjectInfo, cp *checkpoint) ([]syncOp, error) {
+	var ops []syncOp
+	for rel, lf := range locals {
+		ro, ok := remotes[rel]
+		reason := ""
+		switch {
+		case !ok:
+			reason = "missing"
+		case ro.Size != lf.size:
+			reason = "size"
+		default:
+			if sum, ok := remoteMD5(ro); ok {
+				local, err := cp.localMD5(rel, lf)
+				if err != nil {
+					return nil, err
+				}
+				if local != sum {
+					reason = "checksum"
+				}
+			} else if opts.direction == syncUp && lf.mtime.After(ro.LastModified) {
+				reason = "newer"
+			} else if opts.direction == syncDown && ro.LastModified.After(lf.mtime) {
+				reason = "newer"
+			}
+		}
+
+		switch {
+		case reason == "":
+		case opts.direction == syncUp:
+			ops = append(ops, syncOp{Action: actionUpload, Path: rel, Size: lf.size, Reason: reason})
+		case ok:
+			ops = append(ops, syncOp{Action: actionDownload, Path: rel, Size: ro.Size, Reason: reason})
+		}
+		if !ok && opts.direction == syncDown && opts.delete {
+			ops = append(ops, syncOp{Action: actionDelete, Path: rel, Size: lf.size, Reason: "extraneous"})
+		}
+	}
+	for rel, ro := range remotes {
+		if _, ok := locals[rel]; ok {
+			continue
+		}
+		if opts.direction == syncDown {
+			ops = append(ops, syncOp{Action: actionDownload, Path: rel, Size: ro.Size, Reason: "missing"})
+		} else if opts.delete {
+			ops = append(ops, syncOp{Action: actionDelete, Path: rel, Size: ro.Size, Reason: "extraneous"})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Path < ops[j].Path })
+	return ops, nil
+}
+
+func runSync(ctx context.Context, cl *client.Client, opts syncOptions, locals map[string]localFile, remotes map[string]*client.ObjectInfo, ops []syncOp, cp *checkpoint) {
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range work {
+				op := &ops[idx]
+				var err error
+				switch op.Action {
+				case actionUpload:
+					err = syncUpload(ctx, cl, opts, op.Path, locals[op.Path], cp)
+				case actionDownload:
+					err = syncDownload(ctx, cl, opts, op.Path, remotes[op.Path], cp)
+				case actionDelete:
+					if opts.direction == syncUp {
+						err = cl.Delete(ctx, opts.bucket, opts.prefix+op.Path)
+					} else {
+						err = os.Remove(locals[op.Path].abs)
+					}
+				}
+				if err != nil {
+					op.Error = err.Error()
+				}
+			}
+		}()
+	}
+	for i := range ops {
+		if ctx.Err() != nil {
+			ops[i].Error = ctx.Err().Error()
+			continue
+		}
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+func syncUpload(ctx context.Context, cl *client.Client, opts syncOptions, rel string, lf localFile, cp *checkpoint) error {
+	f, err := os.Open(lf.abs)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := cl.Put(ctx, opts.bucket, opts.prefix+rel, f, lf.size, nil); err != nil {
+		return err
+	}
+	// hash after the upload so the checkpoint covers exactly what was sent
+	_, err = cp.localMD5(rel, lf)
+	return err
+}
+
+func syncDownload(ctx context.Context, cl *client.Client, opts syncOptions, rel string, ro *client.ObjectInfo, cp *checkpoint) error {
+	// keys come from the gateway; one like "../x" must not escape localDir
+	local := filepath.FromSlash(rel)
+	if !filepath.IsLocal(local) {
+		return fmt.Errorf("key %q does not map to a path under %s", opts.prefix+rel, opts.localDir)
+	}
+	dst := filepath.Join(opts.localDir, local)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	obj, err := cl.Get(ctx, opts.bucket, opts.prefix+rel)
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	h := md5.New()
+	if err := writeFileAtomic(dst, io.TeeReader(obj.Body, h)); err != nil {
+		return err
+	}
+	if !ro.LastModified.IsZero() {
+		_ = os.Chtimes(dst, ro.LastModified, ro.LastModified)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+	cp.record(rel, localFile{abs: dst, size: info.Size(), mtime: info.ModTime()}, hex.EncodeToString(h.Sum(nil)))
+	return nil
+}
+
+func isTempDownload(name string) bool {
+	return strings.HasPrefix(name, ".smartctl-")
+}
+
+// checkpoint caches local MD5s keyed by path, size and mtime. It is stored
+// per sync pair under ~/.smartstore/sync and saved after every run,
+// including failed ones, so the next run picks up where this one stopped.
+type checkpoint struct {
+	path    string
+	mu      sync.Mutex
+	Entries map[string]checkpointEntry `json:"entries"`
+	dirty   int
+}
+
+type checkpointEntry struct {
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"`
+	MD5   string `json:"md5"`
+}
+
+func openCheckpoint(p *Profile, opts syncOptions) (*checkpoint, error) {
+	abs, err := filepath.Abs(opts.localDir)
+	if err != nil {
+		return nil, err
+	}
+	id := sha1.Sum([]byte(strings.Join([]string{p.Endpoint, p.Env, p.Region, opts.bucket, opts.prefix, abs}, "|")))
+	cp := &checkpoint{
+		path:    filepath.Join(filepath.Dir(defaultProfilesPath()), "sync", hex.EncodeToString(id[:])+".json"),
+		Entries: map[string]checkpointEntry{},
+	}
+	data, err := os.ReadFile(cp.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil || cp.Entries == nil {
+		// a corrupt checkpoint only costs re-hashing
+		cp.Entries = map[string]checkpointEntry{}
+	}
+	return cp, nil
+}
+
+func (cp *checkpoint) localMD5(rel string, lf localFile) (string, error) {
+	cp.mu.Lock()
+	e, ok := cp.Entries[rel]
+	cp.mu.Unlock()
+	if ok && e.Size == lf.size && e.MTime == lf.mtime.UnixNano() {
+		return e.MD5, nil
+	}
+
+	f, err := os.Open(lf.abs)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	cp.record(rel, lf, sum)
+	return sum, nil
+}
+
+func (cp *checkpoint) record(rel string, lf localFile, sum string) {
+	cp.mu.Lock()
+	cp.Entries[rel] = checkpointEntry{Size: lf.size, MTime: lf.mtime.UnixNano(), MD5: sum}
+	cp.dirty++
+	flush := cp.dirty >= 100
+	cp.mu.Unlock()
+	if flush {
+		_ = cp.save()
+	}
+}
+
+func (cp *checkpoint) save() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.path), 0o700); err != nil {
+		return err
+	}
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	cp.dirty = 0
+	return os.Rename(tmp, cp.path)
+}
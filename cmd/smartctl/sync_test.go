@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kenelite/smartstore/pkg/client"
+)
+
+var syncEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// syncFile is one path on either side of a sync. Empty content means the
+// side does not have it.
+type syncFile struct {
+	path      string
+	local     string
+	remote    string
+	multipart bool          // the remote ETag is no MD5
+	age       time.Duration // how much older the local copy is than the remote
+}
+
+func md5Of(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// syncSides writes the local files under dir and describes the remote ones.
+func syncSides(t *testing.T, dir string, files []syncFile) (map[string]localFile, map[string]*client.ObjectInfo) {
+	t.Helper()
+	locals, remotes := map[string]localFile{}, map[string]*client.ObjectInfo{}
+	for _, f := range files {
+		if f.local != "" {
+			abs := filepath.Join(dir, filepath.FromSlash(f.path))
+			mtime := syncEpoch.Add(-f.age)
+			if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(abs, []byte(f.local), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(abs, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+			locals[f.path] = localFile{abs: abs, size: int64(len(f.local)), mtime: mtime}
+		}
+		if f.remote != "" {
+			etag := `"` + md5Of(f.remote) + `"`
+			if f.multipart {
+				etag = `"` + md5Of(f.remote) + `-2"`
+			}
+			remotes[f.path] = &client.ObjectInfo{Key: f.path, Size: int64(len(f.remote)), ETag: etag, LastModified: syncEpoch}
+		}
+	}
+	return locals, remotes
+}
+
+func newTestCheckpoint(t *testing.T) *checkpoint {
+	t.Helper()
+	return &checkpoint{path: filepath.Join(t.TempDir(), "checkpoint.json"), Entries: map[string]checkpointEntry{}}
+}
+
+func TestPlanSync(t *testing.T) {
+	const hour = time.Hour
+	files := []syncFile{
+		{path: "same", local: "abc", remote: "abc"},
+		{path: "local-only", local: "abc"},
+		{path: "dir/remote-only", remote: "abc"},
+		{path: "resized", local: "abc", remote: "abcd"},
+		{path: "edited", local: "abc", remote: "xyz"},
+		// without an MD5 to compare, the newer side wins
+		{path: "multipart-local-newer", local: "abc", remote: "xyz", multipart: true, age: -hour},
+		{path: "multipart-remote-newer", local: "abc", remote: "xyz", multipart: true, age: hour},
+		{path: "multipart-same-time", local: "abc", remote: "xyz", multipart: true},
+		// an MD5 match beats any difference in time
+		{path: "older-but-equal", local: "abc", remote: "abc", age: hour},
+	}
+	tests := []struct {
+		name      string
+		direction syncDirection
+		delete    bool
+		want      []syncOp
+	}{
+		{
+			name:      "up",
+			direction: syncUp,
+			want: []syncOp{
+				{Action: actionUpload, Path: "edited", Size: 3, Reason: "checksum"},
+				{Action: actionUpload, Path: "local-only", Size: 3, Reason: "missing"},
+				{Action: actionUpload, Path: "multipart-local-newer", Size: 3, Reason: "newer"},
+				{Action: actionUpload, Path: "resized", Size: 3, Reason: "size"},
+			},
+		},
+		{
+			name:      "up with delete",
+			direction: syncUp,
+			delete:    true,
+			want: []syncOp{
+				{Action: actionDelete, Path: "dir/remote-only", Size: 3, Reason: "extraneous"},
+				{Action: actionUpload, Path: "edited", Size: 3, Reason: "checksum"},
+				{Action: actionUpload, Path: "local-only", Size: 3, Reason: "missing"},
+				{Action: actionUpload, Path: "multipart-local-newer", Size: 3, Reason: "newer"},
+				{Action: actionUpload, Path: "resized", Size: 3, Reason: "size"},
+			},
+		},
+		{
+			name:      "down",
+			direction: syncDown,
+			want: []syncOp{
+				{Action: actionDownload, Path: "dir/remote-only", Size: 3, Reason: "missing"},
+				{Action: actionDownload, Path: "edited", Size: 3, Reason: "checksum"},
+				{Action: actionDownload, Path: "multipart-remote-newer", Size: 3, Reason: "newer"},
+				{Action: actionDownload, Path: "resized", Size: 4, Reason: "size"},
+			},
+		},
+		{
+			name:      "down with delete",
+			direction: syncDown,
+			delete:    true,
+			want: []syncOp{
+				{Action: actionDownload, Path: "dir/remote-only", Size: 3, Reason: "missing"},
+				{Action: actionDownload, Path: "edited", Size: 3, Reason: "checksum"},
+				{Action: actionDelete, Path: "local-only", Size: 3, Reason: "extraneous"},
+				{Action: actionDownload, Path: "multipart-remote-newer", Size: 3, Reason: "newer"},
+				{Action: actionDownload, Path: "resized", Size: 4, Reason: "size"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		locals, remotes := syncSides(t, dir, files)
+		opts := syncOptions{direction: tt.direction, localDir: dir, bucket: "b", delete: tt.delete}
+		ops, err := planSync(opts, locals, remotes, newTestCheckpoint(t))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(ops) != len(tt.want) {
+			t.Errorf("%s: planned %+v, want %+v", tt.name, ops, tt.want)
+			continue
+		}
+		for i := range ops {
+			if ops[i] != tt.want[i] {
+				t.Errorf("%s: op %d = %+v, want %+v", tt.name, i, ops[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestPlanSyncCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	locals, remotes := syncSides(t, dir, []syncFile{{path: "f", local: "abc", remote: "abc"}})
+	opts := syncOptions{direction: syncUp, localDir: dir, bucket: "b"}
+	cp := newTestCheckpoint(t)
+
+	if ops, err := planSync(opts, locals, remotes, cp); err != nil || len(ops) != 0 {
+		t.Fatalf("plan = %+v, %v; want nothing to do", ops, err)
+	}
+	e, ok := cp.Entries["f"]
+	if !ok || e.MD5 != md5Of("abc") || e.Size != 3 || e.MTime != syncEpoch.UnixNano() {
+		t.Fatalf("checkpoint entry = %+v, %v; want the hash of f", e, ok)
+	}
+
+	// a matching entry is trusted without reading the file again
+	if err := os.WriteFile(locals["f"].abs, []byte("xyz"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(locals["f"].abs, syncEpoch, syncEpoch); err != nil {
+		t.Fatal(err)
+	}
+	if ops, err := planSync(opts, locals, remotes, cp); err != nil || len(ops) != 0 {
+		t.Errorf("plan with a matching checkpoint = %+v, %v; want the cached hash used", ops, err)
+	}
+
+	// one for another mtime is stale, and the file is hashed again
+	later := syncEpoch.Add(time.Minute)
+	if err := os.Chtimes(locals["f"].abs, later, later); err != nil {
+		t.Fatal(err)
+	}
+	lf := locals["f"]
+	lf.mtime = later
+	locals["f"] = lf
+	ops, err := planSync(opts, locals, remotes, cp)
+	if err != nil || len(ops) != 1 || ops[0].Reason != "checksum" {
+		t.Fatalf("plan with a stale checkpoint = %+v, %v; want an upload for the checksum", ops, err)
+	}
+	if cp.Entries["f"].MD5 != md5Of("xyz") {
+		t.Errorf("checkpoint keeps %s, want the new hash", cp.Entries["f"].MD5)
+	}
+
+	// the checkpoint outlives the run
+	t.Setenv("SMARTCTL_PROFILES", filepath.Join(t.TempDir(), "profiles.yaml"))
+	p := &Profile{Endpoint: "http://gw", Env: "dev", Region: "r1"}
+	saved, err := openCheckpoint(p, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved.record("f", lf, md5Of("xyz"))
+	if err := saved.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	reopened, err := openCheckpoint(p, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Entries["f"] != saved.Entries["f"] {
+		t.Errorf("reopened entry = %+v, want %+v", reopened.Entries["f"], saved.Entries["f"])
+	}
+	other := opts
+	other.prefix = "other/"
+	if fresh, err := openCheckpoint(p, other); err != nil || len(fresh.Entries) != 0 {
+		t.Errorf("checkpoint of another sync pair has %d entries, %v; want none", len(fresh.Entries), err)
+	}
+}
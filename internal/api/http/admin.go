@@ -0,0 +1,166 @@
+package apihttp
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+	"github.com/kenelite/smartstore/internal/storage/smart"
+)
+
+// WithAdminToken protects /admin routes with a bearer token. Admin routes
+// are not registered at all when no token is configured.
+func WithAdminToken(token string) Option {
+	return func(h *Handler) { h.adminToken = token }
+}
+
+func (h *Handler) registerAdminRoutes(r chi.Router) {
+	if h.adminToken == "" {
+		return
+	}
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(h.requireAdmin)
+		r.Get("/routes/resolve", h.ResolveRoute)
+		r.Delete("/cache/{env}/{region}/{bucket}/*", h.PurgeCache)
+		r.Get("/quotas", h.ListQuotas)
+		r.Post("/quotas/recompute", h.RecomputeQuotas)
+		r.Get("/quotas/{env}/{region}/{bucket}", h.GetQuota)
+		r.Post("/trash/purge", h.PurgeTrash)
+		r.Post("/lifecycle/run", h.RunLifecycle)
+		r.Post("/gc/orphans", h.CollectOrphans)
+		r.Post("/scrub/run", h.RunScrub)
+		r.Get("/scrub/findings", h.ListScrubFindings)
+		r.Get("/replicas/{env}/{region}/{bucket}/*", h.ListReplicas)
+		r.Post("/rebalance/run", h.RunRebalance)
+		r.Post("/packs/compact", h.CompactPacks)
+	})
+}
+
+func (h *Handler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, CodeAccessDenied, errors.New("invalid admin token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// boolParam reads a flag of an admin job such as ?dry_run=true; false when
+// it is not set.
+func boolParam(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return b, nil
+}
+
+type routeResponse struct {
+	ProviderName   string `json:"provider_name"`
+	ProviderType   string `json:"provider_type"`
+	ProviderRegion string `json:"provider_region"`
+	ProviderBucket string `json:"provider_bucket"`
+}
+
+func (h *Handler) ResolveRoute(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	key := objectstore.RouteKey{
+		Env:           q.Get("env"),
+		LogicalRegion: q.Get("region"),
+		Bucket:        q.Get("bucket"),
+		StorageClass:  q.Get("class"),
+	}
+	if key.Env == "" || key.LogicalRegion == "" || key.Bucket == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, errors.New("env, region and bucket are required"))
+		return
+	}
+	if key.StorageClass == "" {
+		key.StorageClass = "HOT"
+	}
+
+	route, err := h.svc.ResolveRoute(key)
+	if err != nil {
+		writeError(w, http.StatusNotFound, CodeNoSuchRoute, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(routeResponse{
+		ProviderName:   route.ProviderName,
+		ProviderType:   string(route.ProviderType),
+		ProviderRegion: route.ProviderRegion,
+		ProviderBucket: route.ProviderBucket,
+	})
+}
+
+func (h *Handler) PurgeCache(w http.ResponseWriter, r *http.Request) {
+	err := h.svc.PurgeCache(r.Context(), chi.URLParam(r, "env"), chi.URLParam(r, "bucket"), chi.URLParam(r, "*"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type quotasResponse struct {
+	Buckets []*smart.QuotaStatus `json:"buckets"`
+}
+
+func (h *Handler) ListQuotas(w http.ResponseWriter, r *http.Request) {
+	sts, err := h.svc.Quotas(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(quotasResponse{Buckets: sts})
+}
+
+func (h *Handler) GetQuota(w http.ResponseWriter, r *http.Request) {
+	st, err := h.svc.Quota(r.Context(), chi.URLParam(r, "env"), chi.URLParam(r, "region"), chi.URLParam(r, "bucket"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+// RecomputeQuotas rebuilds bucket usage from object metadata right away
+// instead of waiting for the periodic job.
+func (h *Handler) RecomputeQuotas(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.RecomputeUsage(r.Context()); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	h.ListQuotas(w, r)
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// PurgeTrash removes expired trash entries right away instead of waiting
+// for the periodic job.
+func (h *Handler) PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	n, err := h.svc.PurgeTrash(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(purgeResponse{Purged: n})
+}
@@ -0,0 +1,93 @@
+package apihttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/kenelite/smartstore/internal/imaging"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/pipeline"
+	"github.com/kenelite/smartstore/internal/policy"
+	"github.com/kenelite/smartstore/internal/storage/smart"
+)
+
+// Error codes returned in the "code" field of error bodies. pkg/client
+// mirrors these values.
+const (
+	CodeNoSuchKey      = "NoSuchKey"
+	CodeNoSuchRoute    = "NoSuchRoute"
+	CodeInvalidRequest = "InvalidRequest"
+	CodeAccessDenied   = "AccessDenied"
+	CodeInternalError  = "InternalError"
+
+	CodeTransformNotAllowed = "TransformNotAllowed"
+	CodeUnsupportedMedia    = "UnsupportedMediaType"
+	CodeEntityTooLarge      = "EntityTooLarge"
+	CodeUploadRejected      = "UploadRejected"
+	CodeQuarantined         = "Quarantined"
+	CodeObjectQuarantined   = "ObjectQuarantined"
+	CodeInspectionFailed    = "InspectionFailed"
+	CodeQuotaExceeded       = "QuotaExceeded"
+	CodeObjectQuotaExceeded = "ObjectQuotaExceeded"
+	CodeEntityTooSmall      = "EntityTooSmall"
+	CodeInvalidKey          = "InvalidKey"
+	CodeObjectExists        = "ObjectExists"
+	CodeObjectLocked        = "ObjectLocked"
+	CodeServiceUnavailable  = "ServiceUnavailable"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+func writeError(w http.ResponseWriter, status int, code string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: err.Error(), Code: code})
+}
+
+// writeServiceError maps errors returned by smart.Service to HTTP responses.
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, metadata.ErrNotFound):
+		writeError(w, http.StatusNotFound, CodeNoSuchKey, err)
+	case errors.Is(err, metadata.ErrExists):
+		writeError(w, http.StatusConflict, CodeObjectExists, err)
+	case errors.Is(err, smart.ErrObjectLocked):
+		writeError(w, http.StatusForbidden, CodeObjectLocked, err)
+	case errors.Is(err, imaging.ErrInvalidOptions), errors.Is(err, smart.ErrInvalidObjectLock):
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err)
+	case errors.Is(err, smart.ErrTransformNotAllowed):
+		writeError(w, http.StatusForbidden, CodeTransformNotAllowed, err)
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		writeError(w, http.StatusUnsupportedMediaType, CodeUnsupportedMedia, err)
+	case errors.Is(err, policy.ErrTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, CodeEntityTooLarge, err)
+	case errors.Is(err, policy.ErrTooSmall):
+		writeError(w, http.StatusBadRequest, CodeEntityTooSmall, err)
+	case errors.Is(err, policy.ErrContentTypeNotAllowed):
+		writeError(w, http.StatusUnsupportedMediaType, CodeUnsupportedMedia, err)
+	case errors.Is(err, policy.ErrKeyNotAllowed):
+		writeError(w, http.StatusBadRequest, CodeInvalidKey, err)
+	case errors.Is(err, smart.ErrSourceTooLarge), errors.Is(err, smart.ErrUploadTooLarge), errors.Is(err, imaging.ErrImageTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, CodeEntityTooLarge, err)
+	case errors.Is(err, smart.ErrObjectQuarantined):
+		writeError(w, http.StatusForbidden, CodeObjectQuarantined, err)
+	case errors.Is(err, smart.ErrInspectionFailed):
+		writeError(w, http.StatusServiceUnavailable, CodeInspectionFailed, err)
+	case errors.Is(err, smart.ErrStorageQuotaExceeded):
+		writeError(w, http.StatusInsufficientStorage, CodeQuotaExceeded, err)
+	case errors.Is(err, smart.ErrObjectQuotaExceeded):
+		writeError(w, http.StatusForbidden, CodeObjectQuotaExceeded, err)
+	case errors.Is(err, smart.ErrQuarantined):
+		writeError(w, http.StatusUnprocessableEntity, CodeQuarantined, err)
+	case errors.Is(err, smart.ErrObjectUnavailable), errors.Is(err, smart.ErrQuorumNotReached):
+		writeError(w, http.StatusServiceUnavailable, CodeServiceUnavailable, err)
+	case errors.Is(err, pipeline.ErrRejected):
+		writeError(w, http.StatusUnprocessableEntity, CodeUploadRejected, err)
+	default:
+		writeError(w, http.StatusInternalServerError, CodeInternalError, err)
+	}
+}
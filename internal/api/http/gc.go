@@ -0,0 +1,23 @@
+package apihttp
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// CollectOrphans deletes provider objects no metadata record points to, or
+// with ?dry_run=true only reports them.
+func (h *Handler) CollectOrphans(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := boolParam(r, "dry_run")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err)
+		return
+	}
+	report, err := h.svc.CollectOrphans(r.Context(), dryRun)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
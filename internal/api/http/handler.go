@@ -2,26 +2,67 @@ package apihttp
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/kenelite/smartstore/internal/imaging"
+	"github.com/kenelite/smartstore/internal/presign"
 	"github.com/kenelite/smartstore/internal/storage/smart"
 )
 
 type Handler struct {
-	svc *smart.Service
+	svc           *smart.Service
+	presignSecret string
+	adminToken    string
 }
 
-func NewHandler(svc *smart.Service) *Handler {
-	return &Handler{svc: svc}
+type Option func(*Handler)
+
+// WithPresignSecret enables verification of presigned URLs. Requests that
+// carry a signature are rejected when it is invalid or expired.
+func WithPresignSecret(secret string) Option {
+	return func(h *Handler) { h.presignSecret = secret }
+}
+
+func NewHandler(svc *smart.Service, opts ...Option) *Handler {
+	h := &Handler{svc: svc}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
-	r.Put("/v1/{env}/{region}/{bucket}/*", h.PutObject)
-	r.Get("/v1/{env}/{region}/{bucket}/*", h.GetObject)
+	r.Group(func(r chi.Router) {
+		r.Use(h.verifyPresigned)
+		r.Get("/v1/{env}/{region}/{bucket}", h.ListObjects)
+		r.Put("/v1/{env}/{region}/{bucket}/*", h.PutObject)
+		r.Post("/v1/{env}/{region}/{bucket}/*", h.PostObject)
+		r.Get("/v1/{env}/{region}/{bucket}/*", h.GetObject)
+		r.Head("/v1/{env}/{region}/{bucket}/*", h.HeadObject)
+		r.Delete("/v1/{env}/{region}/{bucket}/*", h.DeleteObject)
+	})
+	h.registerAdminRoutes(r)
+}
+
+func (h *Handler) verifyPresigned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.presignSecret != "" && presign.IsSigned(r.URL.Query()) {
+			if err := presign.Verify(h.presignSecret, r.Method, r.URL, time.Now()); err != nil {
+				writeError(w, http.StatusForbidden, CodeAccessDenied, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (h *Handler) PutObject(w http.ResponseWriter, r *http.Request) {
@@ -31,8 +72,7 @@ func (h *Handler) PutObject(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "*")
 
 	ct := r.Header.Get("Content-Type")
-	sizeStr := r.Header.Get("Content-Length")
-	size, _ := strconv.ParseInt(sizeStr, 10, 64)
+	size := r.ContentLength // -1 for chunked uploads
 
 	req := &smart.PutRequest{
 		Env:           env,
@@ -44,33 +84,93 @@ func (h *Handler) PutObject(w http.ResponseWriter, r *http.Request) {
 		Body:          r.Body,
 		StorageClass:  r.Header.Get("X-Storage-Class"),
 	}
+	var err error
+	if req.Lock, err = parseLockHeaders(r.Header); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err)
+		return
+	}
+	if req.Tags, err = parseTagging(r.Header.Get(headerTagging)); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err)
+		return
+	}
+	if req.BypassGovernance, err = h.bypassGovernance(r); err != nil {
+		writeError(w, http.StatusForbidden, CodeAccessDenied, err)
+		return
+	}
 
-	resp, err := h.svc.Put(r.Context(), req)
+	var resp *smart.PutResponse
+	if src := r.Header.Get("X-Copy-Source"); src != "" {
+		source, perr := parseCopySource(src)
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, perr)
+			return
+		}
+		req.Body = nil
+		req.Size = 0
+		resp, err = h.svc.Copy(r.Context(), &smart.CopyRequest{Source: *source, Destination: *req})
+	} else {
+		resp, err = h.svc.Put(r.Context(), req)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		writeServiceError(w, err)
 		return
 	}
 
+	if resp.VersionID != "" {
+		w.Header().Set("X-Version-Id", resp.VersionID)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// parseCopySource parses an X-Copy-Source header of the form
+// "/{env}/{region}/{bucket}/{key}[?versionId=...]".
+func parseCopySource(src string) (*smart.GetRequest, error) {
+	path, query, _ := strings.Cut(src, "?")
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 4)
+	if len(parts) != 4 || parts[0] == "" || parts[1] == "" || parts[2] == "" || parts[3] == "" {
+		return nil, fmt.Errorf("invalid copy source %q", src)
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid copy source %q", src)
+	}
+	return &smart.GetRequest{
+		Env:           parts[0],
+		LogicalRegion: parts[1],
+		Bucket:        parts[2],
+		Key:           parts[3],
+		VersionID:     q.Get("versionId"),
+	}, nil
+}
+
 func (h *Handler) GetObject(w http.ResponseWriter, r *http.Request) {
 	env := chi.URLParam(r, "env")
 	region := chi.URLParam(r, "region")
 	bucket := chi.URLParam(r, "bucket")
 	key := chi.URLParam(r, "*")
 
-	resp, err := h.svc.Get(r.Context(), &smart.GetRequest{
+	getReq := &smart.GetRequest{
 		Env:           env,
 		LogicalRegion: region,
 		Bucket:        bucket,
 		Key:           key,
-	})
+		VersionID:     r.URL.Query().Get("versionId"),
+	}
+	var (
+		resp *smart.GetResponse
+		err  error
+	)
+	if opts, ok, perr := parseTransform(r.URL.Query()); perr != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, perr)
+		return
+	} else if ok {
+		resp, err = h.svc.GetTransformed(r.Context(), getReq, opts)
+	} else {
+		resp, err = h.svc.Get(r.Context(), getReq)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		writeServiceError(w, err)
 		return
 	}
 	defer resp.Body.Close()
@@ -78,6 +178,15 @@ func (h *Handler) GetObject(w http.ResponseWriter, r *http.Request) {
 	if resp.ContentType != "" {
 		w.Header().Set("Content-Type", resp.ContentType)
 	}
+	if resp.ETag != "" {
+		w.Header().Set("ETag", resp.ETag)
+	}
+	if getReq.VersionID != "" {
+		w.Header().Set("X-Version-Id", getReq.VersionID)
+	}
+	if resp.ServedFrom != "" {
+		w.Header().Set("X-Served-From", resp.ServedFrom)
+	}
 	if resp.Size > 0 {
 		w.Header().Set("Content-Length", strconv.FormatInt(resp.Size, 10))
 	}
@@ -85,3 +194,172 @@ func (h *Handler) GetObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// parseTransform reads image transform parameters (w, h, fit, fmt, q). ok is
+// false when the request asks for no transform.
+func parseTransform(q url.Values) (opts imaging.Options, ok bool, err error) {
+	if q.Get("w") == "" && q.Get("h") == "" && q.Get("fit") == "" && q.Get("fmt") == "" && q.Get("q") == "" {
+		return opts, false, nil
+	}
+	for name, dst := range map[string]*int{"w": &opts.Width, "h": &opts.Height, "q": &opts.Quality} {
+		if v := q.Get(name); v != "" {
+			if *dst, err = strconv.Atoi(v); err != nil {
+				return opts, false, fmt.Errorf("invalid %s %q", name, v)
+			}
+		}
+	}
+	if opts.Fit, err = imaging.ParseFit(q.Get("fit")); err != nil {
+		return opts, false, err
+	}
+	if opts.Format, err = imaging.ParseFormat(q.Get("fmt")); err != nil {
+		return opts, false, err
+	}
+	return opts, true, opts.Validate()
+}
+
+func (h *Handler) HeadObject(w http.ResponseWriter, r *http.Request) {
+	info, err := h.svc.Head(r.Context(), &smart.GetRequest{
+		Env:           chi.URLParam(r, "env"),
+		LogicalRegion: chi.URLParam(r, "region"),
+		Bucket:        chi.URLParam(r, "bucket"),
+		Key:           chi.URLParam(r, "*"),
+		VersionID:     r.URL.Query().Get("versionId"),
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("ETag", info.ETag)
+	w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	w.Header().Set("X-Storage-Class", info.StorageClass)
+	w.Header().Set("X-Object-Version", strconv.FormatInt(info.Version, 10))
+	w.Header().Set("X-Object-Status", info.Status)
+	if info.VersionID != "" {
+		w.Header().Set("X-Version-Id", info.VersionID)
+	}
+	setLockHeaders(w, info.Lock)
+	setTaggingHeader(w, info.Tags)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) DeleteObject(w http.ResponseWriter, r *http.Request) {
+	bypass, err := h.bypassGovernance(r)
+	if err != nil {
+		writeError(w, http.StatusForbidden, CodeAccessDenied, err)
+		return
+	}
+	res, err := h.svc.Delete(r.Context(), &smart.DeleteRequest{
+		Env:              chi.URLParam(r, "env"),
+		LogicalRegion:    chi.URLParam(r, "region"),
+		Bucket:           chi.URLParam(r, "bucket"),
+		Key:              chi.URLParam(r, "*"),
+		VersionID:        r.URL.Query().Get("versionId"),
+		BypassGovernance: bypass,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if res.VersionID != "" {
+		w.Header().Set("X-Version-Id", res.VersionID)
+	}
+	if res.DeleteMarker {
+		w.Header().Set("X-Delete-Marker", "true")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListObjects lists live objects, with ?versions every version and delete
+// marker, or with ?trash the bucket's deleted objects that can still be
+// restored.
+func (h *Handler) ListObjects(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 0
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Errorf("invalid limit %q", s))
+			return
+		}
+		limit = n
+	}
+
+	req := &smart.ListRequest{
+		Env:           chi.URLParam(r, "env"),
+		LogicalRegion: chi.URLParam(r, "region"),
+		Bucket:        chi.URLParam(r, "bucket"),
+		Prefix:        q.Get("prefix"),
+		StartAfter:    q.Get("marker"),
+		Limit:         limit,
+	}
+	var (
+		resp any
+		err  error
+	)
+	if q.Has("trash") {
+		if s := q.Get("id_marker"); s != "" {
+			if req.StartAfterID, err = strconv.ParseInt(s, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Errorf("invalid id_marker %q", s))
+				return
+			}
+		}
+		resp, err = h.svc.ListTrash(r.Context(), req)
+	} else if q.Has("versions") {
+		req.StartAfterVersionID = q.Get("version_id_marker")
+		resp, err = h.svc.ListVersions(r.Context(), req)
+	} else {
+		resp, err = h.svc.List(r.Context(), req)
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// PostObject handles object actions selected by query: ?restore[&id=N]
+// brings a deleted object back from the trash, ?retention and ?legal-hold
+// change the object lock of the latest version or of ?versionId=.
+func (h *Handler) PostObject(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case q.Has("retention"):
+		h.setRetention(w, r)
+		return
+	case q.Has("legal-hold"):
+		h.setLegalHold(w, r)
+		return
+	case !q.Has("restore"):
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, errors.New("unsupported object action; use ?restore, ?retention or ?legal-hold"))
+		return
+	}
+	req := &smart.RestoreRequest{
+		Env:           chi.URLParam(r, "env"),
+		LogicalRegion: chi.URLParam(r, "region"),
+		Bucket:        chi.URLParam(r, "bucket"),
+		Key:           chi.URLParam(r, "*"),
+	}
+	if s := q.Get("id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Errorf("invalid id %q", s))
+			return
+		}
+		req.ID = id
+	}
+
+	info, err := h.svc.Restore(r.Context(), req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(info)
+}
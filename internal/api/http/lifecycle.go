@@ -0,0 +1,60 @@
+package apihttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// headerTagging carries object tags as a URL query string: "k=v&k2=v2".
+const headerTagging = "X-Object-Tagging"
+
+func parseTagging(v string) (map[string]string, error) {
+	if v == "" {
+		return nil, nil
+	}
+	q, err := url.ParseQuery(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", headerTagging, v, err)
+	}
+	tags := make(map[string]string, len(q))
+	for k, vs := range q {
+		if k == "" {
+			return nil, fmt.Errorf("invalid %s %q: empty tag key", headerTagging, v)
+		}
+		if len(vs) != 1 {
+			return nil, fmt.Errorf("invalid %s %q: tag %q set %d times", headerTagging, v, k, len(vs))
+		}
+		tags[k] = vs[0]
+	}
+	return tags, nil
+}
+
+func setTaggingHeader(w http.ResponseWriter, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	q := make(url.Values, len(tags))
+	for k, v := range tags {
+		q.Set(k, v)
+	}
+	w.Header().Set(headerTagging, q.Encode())
+}
+
+// RunLifecycle applies the lifecycle rules of all buckets once, or with
+// ?dry_run=true only reports what they would do.
+func (h *Handler) RunLifecycle(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := boolParam(r, "dry_run")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err)
+		return
+	}
+	report, err := h.svc.ApplyLifecycle(r.Context(), dryRun)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
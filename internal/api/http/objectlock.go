@@ -0,0 +1,161 @@
+package apihttp
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kenelite/smartstore/internal/storage/smart"
+)
+
+// Object lock headers. Legal hold is ON or OFF; retain-until is RFC 3339.
+const (
+	headerLockMode         = "X-Object-Lock-Mode"
+	headerLockRetainUntil  = "X-Object-Lock-Retain-Until"
+	headerLockLegalHold    = "X-Object-Lock-Legal-Hold"
+	headerBypassGovernance = "X-Bypass-Governance-Retention"
+)
+
+// parseLockHeaders reads the lock requested with an upload; nil when the
+// request sets none.
+func parseLockHeaders(h http.Header) (*smart.ObjectLock, error) {
+	mode, until, hold := h.Get(headerLockMode), h.Get(headerLockRetainUntil), h.Get(headerLockLegalHold)
+	if mode == "" && until == "" && hold == "" {
+		return nil, nil
+	}
+	lock := &smart.ObjectLock{Mode: strings.ToUpper(mode)}
+	if until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", headerLockRetainUntil, until)
+		}
+		lock.RetainUntil = t
+	}
+	switch strings.ToUpper(hold) {
+	case "", "OFF":
+	case "ON":
+		lock.LegalHold = true
+	default:
+		return nil, fmt.Errorf("invalid %s %q, want ON or OFF", headerLockLegalHold, hold)
+	}
+	return lock, nil
+}
+
+func setLockHeaders(w http.ResponseWriter, lock *smart.ObjectLock) {
+	if lock == nil {
+		return
+	}
+	if lock.Mode != "" {
+		w.Header().Set(headerLockMode, lock.Mode)
+		w.Header().Set(headerLockRetainUntil, lock.RetainUntil.UTC().Format(time.RFC3339))
+	}
+	if lock.LegalHold {
+		w.Header().Set(headerLockLegalHold, "ON")
+	} else {
+		w.Header().Set(headerLockLegalHold, "OFF")
+	}
+}
+
+var (
+	// errBypassDenied is returned when a request asks to bypass governance
+	// retention without the admin token.
+	errBypassDenied = errors.New("bypassing governance retention requires the admin token")
+	// errLiftHoldDenied is returned when a request lifts a legal hold
+	// without the admin token.
+	errLiftHoldDenied = errors.New("lifting a legal hold requires the admin token")
+)
+
+// bypassGovernance reports whether r asks to lift governance retention. The
+// override is reserved to holders of the admin token.
+func (h *Handler) bypassGovernance(r *http.Request) (bool, error) {
+	if !strings.EqualFold(r.Header.Get(headerBypassGovernance), "true") {
+		return false, nil
+	}
+	if !h.hasAdminToken(r) {
+		return false, errBypassDenied
+	}
+	return true, nil
+}
+
+// hasAdminToken reports whether r carries the admin token, outside the
+// /admin routes.
+func (h *Handler) hasAdminToken(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return h.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1
+}
+
+type retentionBody struct {
+	Mode        string    `json:"mode"`
+	RetainUntil time.Time `json:"retain_until"`
+}
+
+// setRetention handles POST ?retention with a retentionBody; an empty mode
+// removes the retention.
+func (h *Handler) setRetention(w http.ResponseWriter, r *http.Request) {
+	var body retentionBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Errorf("invalid retention body: %w", err))
+		return
+	}
+	bypass, err := h.bypassGovernance(r)
+	if err != nil {
+		writeError(w, http.StatusForbidden, CodeAccessDenied, err)
+		return
+	}
+	lock, err := h.svc.SetRetention(r.Context(), &smart.RetentionRequest{
+		Env:              chi.URLParam(r, "env"),
+		LogicalRegion:    chi.URLParam(r, "region"),
+		Bucket:           chi.URLParam(r, "bucket"),
+		Key:              chi.URLParam(r, "*"),
+		VersionID:        r.URL.Query().Get("versionId"),
+		Mode:             strings.ToUpper(body.Mode),
+		RetainUntil:      body.RetainUntil,
+		BypassGovernance: bypass,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(lock)
+}
+
+type legalHoldBody struct {
+	LegalHold bool `json:"legal_hold"`
+}
+
+// setLegalHold handles POST ?legal-hold with a legalHoldBody. Anyone may
+// place a hold; lifting one needs the admin token.
+func (h *Handler) setLegalHold(w http.ResponseWriter, r *http.Request) {
+	var body legalHoldBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Errorf("invalid legal hold body: %w", err))
+		return
+	}
+	admin := h.hasAdminToken(r)
+	if !body.LegalHold && !admin {
+		writeError(w, http.StatusForbidden, CodeAccessDenied, errLiftHoldDenied)
+		return
+	}
+	lock, err := h.svc.SetLegalHold(r.Context(), &smart.LegalHoldRequest{
+		Env:           chi.URLParam(r, "env"),
+		LogicalRegion: chi.URLParam(r, "region"),
+		Bucket:        chi.URLParam(r, "bucket"),
+		Key:           chi.URLParam(r, "*"),
+		VersionID:     r.URL.Query().Get("versionId"),
+		LegalHold:     body.LegalHold,
+		Admin:         admin,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(lock)
+}
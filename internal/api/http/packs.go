@@ -0,0 +1,23 @@
+package apihttp
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// CompactPacks deletes and rewrites packs holding mostly deleted objects
+// once, or with ?dry_run=true only reports what it would do.
+func (h *Handler) CompactPacks(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := boolParam(r, "dry_run")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err)
+		return
+	}
+	report, err := h.svc.CompactPacks(r.Context(), dryRun)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
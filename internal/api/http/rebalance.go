@@ -0,0 +1,23 @@
+package apihttp
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RunRebalance moves objects written to a fallback back to their route's
+// provider once, or with ?dry_run=true only reports what it would move.
+func (h *Handler) RunRebalance(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := boolParam(r, "dry_run")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err)
+		return
+	}
+	report, err := h.svc.Rebalance(r.Context(), dryRun)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
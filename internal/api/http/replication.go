@@ -0,0 +1,33 @@
+package apihttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/smart"
+)
+
+type replicasResponse struct {
+	Replicas []*metadata.ReplicaRecord `json:"replicas"`
+}
+
+// ListReplicas reports the replication status of an object version in each
+// replica target of its route.
+func (h *Handler) ListReplicas(w http.ResponseWriter, r *http.Request) {
+	reps, err := h.svc.ListReplicas(r.Context(), &smart.GetRequest{
+		Env:           chi.URLParam(r, "env"),
+		LogicalRegion: chi.URLParam(r, "region"),
+		Bucket:        chi.URLParam(r, "bucket"),
+		Key:           chi.URLParam(r, "*"),
+		VersionID:     r.URL.Query().Get("versionId"),
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(replicasResponse{Replicas: reps})
+}
@@ -0,0 +1,71 @@
+package apihttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/smart"
+)
+
+// RunScrub compares all metadata with the provider objects once.
+// ?verify=true re-reads content, ?repair=true rewrites damaged objects.
+func (h *Handler) RunScrub(w http.ResponseWriter, r *http.Request) {
+	var opts smart.ScrubOptions
+	var err error
+	if opts.Verify, err = boolParam(r, "verify"); err == nil {
+		opts.Repair, err = boolParam(r, "repair")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err)
+		return
+	}
+	report, err := h.svc.Scrub(r.Context(), opts)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+type scrubFindingsResponse struct {
+	Findings     []*metadata.ScrubFinding `json:"findings"`
+	NextBeforeID int64                    `json:"next_before_id,omitempty"`
+}
+
+// ListScrubFindings pages through recorded findings, newest first.
+func (h *Handler) ListScrubFindings(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var beforeID int64
+	if v := q.Get("before_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, errors.New("invalid before_id"))
+			return
+		}
+		beforeID = n
+	}
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, errors.New("invalid limit, want 1-1000"))
+			return
+		}
+		limit = n
+	}
+	findings, err := h.svc.ListScrubFindings(r.Context(), beforeID, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	resp := scrubFindingsResponse{Findings: findings}
+	if len(findings) == limit {
+		resp.NextBeforeID = findings[len(findings)-1].ID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -4,16 +4,22 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 
 	apihttp "github.com/kenelite/smartstore/internal/api/http"
 	"github.com/kenelite/smartstore/internal/cache"
 	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/inspect"
 	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
+	"github.com/kenelite/smartstore/internal/migrate"
+	"github.com/kenelite/smartstore/internal/pipeline"
+	"github.com/kenelite/smartstore/internal/policy"
 	"github.com/kenelite/smartstore/internal/storage/objectstore"
 	"github.com/kenelite/smartstore/internal/storage/smart"
 )
@@ -35,13 +41,16 @@ func NewHTTPServer(cfg *config.Config) *http.Server {
 	if cfg.DB.DSN != "" {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		conn, err := pgx.Connect(ctx, cfg.DB.DSN)
+		pool, err := openDB(ctx, cfg.DB)
 		if err != nil {
 			log.Printf("failed to connect DB, fallback to in-memory repo: %v", err)
 			repo = metadata.NewInMemoryRepository()
 		} else {
 			log.Printf("connected to DB")
-			repo = metadata.NewSQLRepository(conn)
+			if cfg.DB.MigrateOnStart {
+				runMigrations(pool)
+			}
+			repo = metadata.NewSQLRepository(pool)
 		}
 	} else {
 		log.Printf("no DB configured, using in-memory metadata repo")
@@ -55,6 +64,7 @@ func NewHTTPServer(cfg *config.Config) *http.Server {
 	// register providers based on config
 	ctx := context.Background()
 	for _, p := range cfg.ObjectStorage.Providers {
+		var backend objectstore.ObjectStorage
 		switch p.Type {
 		case config.ProviderAWS_S3, config.ProviderCF_R2:
 			s3Adapter, err := objectstore.NewS3Adapter(objectstore.S3Config{
@@ -67,23 +77,131 @@ func NewHTTPServer(cfg *config.Config) *http.Server {
 				log.Printf("failed to init S3 adapter for provider %s: %v", p.Name, err)
 				continue
 			}
-			registry.Register(p.Name, s3Adapter)
+			backend = s3Adapter
 		case config.ProviderGCP_GCS:
 			gcsAdapter, err := objectstore.NewGCSAdapter(ctx)
 			if err != nil {
 				log.Printf("failed to init GCS adapter for provider %s: %v", p.Name, err)
 				continue
 			}
-			registry.Register(p.Name, gcsAdapter)
+			backend = gcsAdapter
+		case config.ProviderLocalFS:
+			fsAdapter, err := objectstore.NewLocalFSAdapter(objectstore.LocalFSConfig{
+				Root:  p.Root,
+				Fsync: p.Fsync,
+			})
+			if err != nil {
+				log.Printf("failed to init local fs adapter for provider %s: %v", p.Name, err)
+				continue
+			}
+			backend = fsAdapter
+		case config.ProviderAzure:
+			azureAdapter, err := objectstore.NewAzureBlobAdapter(objectstore.AzureConfig{
+				Account:   p.AccountID,
+				SharedKey: p.SecretKey,
+				SASToken:  p.SASToken,
+				Endpoint:  p.Endpoint,
+			})
+			if err != nil {
+				log.Printf("failed to init Azure Blob adapter for provider %s: %v", p.Name, err)
+				continue
+			}
+			backend = azureAdapter
+		case config.ProviderMemory:
+			log.Printf("provider %s keeps objects in memory; they are lost on restart", p.Name)
+			backend = objectstore.NewMemoryAdapter()
 		default:
 			log.Printf("unknown provider type %s for provider %s", p.Type, p.Name)
+			continue
+		}
+		if f := p.Faults; f != nil {
+			log.Printf("provider %s: injecting faults (error rate %g, latency %s)", p.Name, f.ErrorRate, f.Latency)
+			backend = objectstore.NewFaultAdapter(backend, faultConfig(f))
+		}
+		registry.Register(p.Name, backend)
+	}
+
+	for _, rt := range cfg.ObjectStorage.Routes {
+		if rt.WriteQuorum > 1+len(rt.Replicas) {
+			log.Fatalf("route %s/%s/%s/%s: write_quorum %d exceeds its %d locations",
+				rt.Env, rt.LogicalRegion, rt.Bucket, rt.StorageClass, rt.WriteQuorum, 1+len(rt.Replicas))
+		}
+		if rt.WriteQuorum > 1 && len(rt.Fallbacks) > 0 {
+			log.Fatalf("route %s/%s/%s/%s: fallbacks cannot be combined with a write_quorum",
+				rt.Env, rt.LogicalRegion, rt.Bucket, rt.StorageClass)
+		}
+		for _, t := range rt.Replicas {
+			if _, ok := registry.Get(t.ProviderName); !ok {
+				log.Printf("route %s/%s/%s/%s: replica provider %s is not available, replicas to it stay pending",
+					rt.Env, rt.LogicalRegion, rt.Bucket, rt.StorageClass, t.ProviderName)
+			}
+		}
+		for _, t := range rt.Fallbacks {
+			if _, ok := registry.Get(t.ProviderName); !ok {
+				log.Printf("route %s/%s/%s/%s: fallback provider %s is not available, writes skip it",
+					rt.Env, rt.LogicalRegion, rt.Bucket, rt.StorageClass, t.ProviderName)
+			}
+		}
+	}
+
+	for _, b := range cfg.ObjectStorage.Buckets {
+		if b.WriteHooks != nil {
+			if _, err := pipeline.New(b.WriteHooks.Hooks); err != nil {
+				log.Fatalf("bucket %s: %v", b.Bucket, err)
+			}
+		}
+		if b.Policy != nil {
+			if _, err := policy.Compile(b.Policy); err != nil {
+				log.Fatalf("bucket %s: %v", b.Bucket, err)
+			}
+		}
+		if b.ObjectLock != nil {
+			if err := smart.ValidateObjectLock(b.ObjectLock); err != nil {
+				log.Fatalf("bucket %s: %v", b.Bucket, err)
+			}
+		}
+		if err := smart.ValidateLifecycle(b.Lifecycle); err != nil {
+			log.Fatalf("bucket %s: %v", b.Bucket, err)
+		}
+	}
+
+	svcOpts := []smart.Option{
+		smart.WithBucketConfigs(cfg.ObjectStorage.Buckets),
+		smart.WithOrphanGC(cfg.Workers.OrphanGC),
+	}
+	if c := cfg.Inspection.Clamd; c != nil {
+		inspector, err := inspect.NewClamdInspector(inspect.ClamdConfig{
+			Network: c.Network,
+			Address: c.Address,
+			Timeout: c.Timeout,
+		})
+		if err != nil {
+			log.Fatalf("init clamd inspector: %v", err)
 		}
+		svcOpts = append(svcOpts, smart.WithInspector(inspector))
 	}
 
-	smartSvc := smart.NewService(redisCache, repo, route, registry)
-	handler := apihttp.NewHandler(smartSvc)
+	smartSvc := smart.NewService(redisCache, repo, route, registry, svcOpts...)
+	handler := apihttp.NewHandler(smartSvc,
+		apihttp.WithPresignSecret(cfg.HTTP.PresignSecret),
+		apihttp.WithAdminToken(cfg.HTTP.AdminToken),
+	)
+
+	go smartSvc.RunUsageRecompute(context.Background(), cfg.Workers.QuotaRecomputeInterval)
+	go smartSvc.RunTrashPurge(context.Background(), cfg.Workers.TrashPurgeInterval)
+	go smartSvc.RunLifecycle(context.Background(), cfg.Workers.LifecycleInterval, cfg.Workers.LifecycleDryRun)
+	go smartSvc.RunReplication(context.Background(), cfg.Workers.ReplicationInterval)
+	go smartSvc.RunRebalance(context.Background(), cfg.Workers.RebalanceInterval)
+	go smartSvc.RunPackCompaction(context.Background(), cfg.Workers.PackCompactionInterval)
+	if gc := cfg.Workers.OrphanGC; gc.Interval > 0 {
+		go smartSvc.RunOrphanGC(context.Background(), gc.Interval, gc.DryRun)
+	}
+	if sc := cfg.Workers.Scrub; sc.Interval > 0 {
+		go smartSvc.RunScrub(context.Background(), sc.Interval, smart.ScrubOptions{Verify: sc.Verify, Repair: sc.Repair})
+	}
 
 	r := chi.NewRouter()
+	r.Handle("/metrics", metrics.Handler())
 	handler.RegisterRoutes(r)
 
 	srv := &http.Server{
@@ -95,3 +213,69 @@ func NewHTTPServer(cfg *config.Config) *http.Server {
 	}
 	return srv
 }
+
+// openDB opens the connection pool shared by the handlers and workers and
+// checks that the database is reachable.
+func openDB(ctx context.Context, cfg config.DBConfig) (*pgxpool.Pool, error) {
+	pc, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxConns > 0 {
+		pc.MaxConns = cfg.MaxConns
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, pc)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// runMigrations applies pending schema migrations. Serving against a
+// partially migrated schema is worse than not starting, so failures are fatal.
+func runMigrations(pool *pgxpool.Pool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	// the migrator's advisory lock is session scoped: hold one connection
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		log.Fatalf("acquire DB connection for migrations: %v", err)
+	}
+	defer conn.Release()
+	m, err := migrate.New(conn.Conn())
+	if err != nil {
+		log.Fatalf("load migrations: %v", err)
+	}
+	n, err := m.Up(ctx)
+	if err != nil {
+		log.Fatalf("apply migrations: %v", err)
+	}
+	log.Printf("applied %d migration(s)", n)
+}
+
+// faultConfig converts a provider's fault injection settings. An unknown
+// operation is fatal: the faults would silently miss it.
+func faultConfig(f *config.FaultConfig) objectstore.FaultConfig {
+	fc := objectstore.FaultConfig{
+		Latency:             f.Latency,
+		Jitter:              f.Jitter,
+		ErrorRate:           f.ErrorRate,
+		PartialReadRate:     f.PartialReadRate,
+		PartialReadBytes:    f.PartialReadBytes,
+		TruncatedWriteRate:  f.TruncatedWriteRate,
+		TruncatedWriteBytes: f.TruncatedWriteBytes,
+		Seed:                f.Seed,
+	}
+	for _, name := range f.Ops {
+		op := objectstore.Operation(name)
+		if !slices.Contains(objectstore.Operations, op) {
+			log.Fatalf("faults: unknown operation %q", name)
+		}
+		fc.Ops = append(fc.Ops, op)
+	}
+	return fc
+}
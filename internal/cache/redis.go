@@ -7,6 +7,8 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// RedisCache caches small objects. A nil *RedisCache caches nothing, for
+// running the service without Redis.
 type RedisCache struct {
 	client *redis.Client
 }
@@ -17,13 +19,22 @@ func NewRedisCache(opts *redis.Options) *RedisCache {
 }
 
 func (c *RedisCache) GetObject(ctx context.Context, key string) ([]byte, error) {
+	if c == nil {
+		return nil, redis.Nil
+	}
 	return c.client.Get(ctx, key).Bytes()
 }
 
 func (c *RedisCache) SetObject(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if c == nil {
+		return nil
+	}
 	return c.client.Set(ctx, key, value, ttl).Err()
 }
 
 func (c *RedisCache) Del(ctx context.Context, key string) error {
+	if c == nil {
+		return nil
+	}
 	return c.client.Del(ctx, key).Err()
 }
@@ -13,6 +13,9 @@ const (
 	ProviderAWS_S3  ProviderType = "AWS_S3"
 	ProviderCF_R2   ProviderType = "CF_R2"
 	ProviderGCP_GCS ProviderType = "GCP_GCS"
+	ProviderLocalFS ProviderType = "LOCAL_FS"
+	ProviderMemory  ProviderType = "MEMORY" // objects live in process memory; for development
+	ProviderAzure   ProviderType = "AZURE_BLOB"
 )
 
 type ProviderConfig struct {
@@ -23,9 +26,27 @@ type ProviderConfig struct {
 	AccessKey     string       `yaml:"access_key,omitempty"`
 	SecretKey     string       `yaml:"secret_key,omitempty"`
 	UseSSL        bool         `yaml:"use_ssl,omitempty"`
-	AccountID     string       `yaml:"account_id,omitempty"`     // for R2
+	AccountID     string       `yaml:"account_id,omitempty"`     // for R2; the storage account for AZURE_BLOB
 	ProjectID     string       `yaml:"project,omitempty"`        // for GCS
 	CredentialRef string       `yaml:"credential_ref,omitempty"` // e.g. path to JSON
+	SASToken      string       `yaml:"sas_token,omitempty"`      // for AZURE_BLOB: used instead of the shared key in secret_key
+	Root          string       `yaml:"root,omitempty"`           // for LOCAL_FS: directory holding one subdirectory per provider bucket
+	Fsync         bool         `yaml:"fsync,omitempty"`          // for LOCAL_FS: sync files and directories before a write returns
+	Faults        *FaultConfig `yaml:"faults,omitempty"`         // inject latency and failures into the provider, for testing
+}
+
+// FaultConfig makes a provider fail at random, to try the gateway against
+// a misbehaving backend. Never set it in production.
+type FaultConfig struct {
+	Latency             time.Duration `yaml:"latency,omitempty"`               // added to every operation
+	Jitter              time.Duration `yaml:"jitter,omitempty"`                // up to this much more, at random
+	ErrorRate           float64       `yaml:"error_rate,omitempty"`            // share of operations that fail
+	Ops                 []string      `yaml:"ops,omitempty"`                   // put, get, get_range, delete, stat, list, copy; default all
+	PartialReadRate     float64       `yaml:"partial_read_rate,omitempty"`     // share of reads cut short
+	PartialReadBytes    int64         `yaml:"partial_read_bytes,omitempty"`    // bytes a cut read returns
+	TruncatedWriteRate  float64       `yaml:"truncated_write_rate,omitempty"`  // share of uploads silently truncated
+	TruncatedWriteBytes int64         `yaml:"truncated_write_bytes,omitempty"` // bytes a truncated upload keeps
+	Seed                int64         `yaml:"seed,omitempty"`                  // the same seed fails the same calls
 }
 
 type RouteRule struct {
@@ -35,12 +56,160 @@ type RouteRule struct {
 	StorageClass   string `yaml:"storage_class"` // HOT/COLD/ARCHIVE
 	ProviderName   string `yaml:"provider_name"` // reference to Providers[*].Name
 	ProviderBucket string `yaml:"provider_bucket"`
+
+	Replicas []RouteTarget `yaml:"replicas,omitempty"` // copied to asynchronously after each write
+	// Fallbacks take writes, in order, while the provider is failing; the
+	// rebalancer moves those objects back once it recovers.
+	Fallbacks []RouteTarget `yaml:"fallbacks,omitempty"`
+	// WriteQuorum > 1 writes the provider and the replicas at once and
+	// acknowledges a write once this many of them stored it.
+	WriteQuorum int `yaml:"write_quorum,omitempty"`
+}
+
+// RouteTarget is a provider bucket a route writes to besides its own: a
+// replica or a fallback.
+type RouteTarget struct {
+	ProviderName   string `yaml:"provider_name"`
+	ProviderBucket string `yaml:"provider_bucket"`
+}
+
+// BucketConfig holds per logical bucket settings. An empty Env or
+// LogicalRegion matches any value; see BucketConfigs.Lookup.
+type BucketConfig struct {
+	Env           string              `yaml:"env,omitempty"`
+	LogicalRegion string              `yaml:"logical_region,omitempty"`
+	Bucket        string              `yaml:"bucket"`
+	Transform     *TransformConfig    `yaml:"transform,omitempty"`
+	WriteHooks    *WriteHooksConfig   `yaml:"write_hooks,omitempty"`
+	Inspect       *InspectConfig      `yaml:"inspect,omitempty"`
+	Quota         *QuotaConfig        `yaml:"quota,omitempty"`
+	Policy        *UploadPolicyConfig `yaml:"policy,omitempty"`
+	Trash         *TrashConfig        `yaml:"trash,omitempty"`
+	Versioning    bool                `yaml:"versioning,omitempty"` // keep every write as a version; deletes add delete markers
+	Dedup         bool                `yaml:"dedup,omitempty"`      // store identical content once, keyed by its SHA-256
+	Pack          *PackConfig         `yaml:"pack,omitempty"`
+	ObjectLock    *ObjectLockConfig   `yaml:"object_lock,omitempty"`
+	Lifecycle     []LifecycleRule     `yaml:"lifecycle,omitempty"`
+}
+
+// TransformConfig enables on-the-fly image transforms on GET.
+type TransformConfig struct {
+	AllowedSizes    []string      `yaml:"allowed_sizes"`               // "WxH", 0 for an auto side, e.g. "128x128", "256x0"
+	AllowedFormats  []string      `yaml:"allowed_formats,omitempty"`   // png/jpeg/gif; empty allows all
+	MaxSourceBytes  int64         `yaml:"max_source_bytes,omitempty"`  // default 20MB
+	MaxSourcePixels int64         `yaml:"max_source_pixels,omitempty"` // width×height, default 40 megapixels
+	CacheTTL        time.Duration `yaml:"cache_ttl,omitempty"`         // default 24h
+	PersistVariants bool          `yaml:"persist_variants,omitempty"`  // also store variants next to the source object
+}
+
+// WriteHooksConfig runs upload hooks (see internal/pipeline) before an
+// object is stored.
+type WriteHooksConfig struct {
+	Hooks     []string `yaml:"hooks"`                // in order, e.g. validate_content_type, normalize_orientation, strip_exif
+	OnFailure string   `yaml:"on_failure,omitempty"` // "reject" (default) or "quarantine"
+	MaxBytes  int64    `yaml:"max_bytes,omitempty"`  // largest upload buffered for hooks, default 32MB
+}
+
+// InspectConfig scans uploads with the configured inspection backend.
+// Infected objects are stored with status QUARANTINED and never served.
+type InspectConfig struct {
+	FailOpen bool `yaml:"fail_open,omitempty"` // accept uploads when the scanner is unavailable
+}
+
+// QuotaConfig caps the live bytes and object count of a bucket. Zero leaves
+// that dimension unlimited.
+type QuotaConfig struct {
+	MaxBytes         int64 `yaml:"max_bytes,omitempty"`
+	MaxObjects       int64 `yaml:"max_objects,omitempty"`
+	SoftLimitPercent int   `yaml:"soft_limit_percent,omitempty"` // warn above this share of a limit, default 80
+}
+
+// UploadPolicyConfig restricts what may be uploaded to a bucket (see
+// internal/policy).
+type UploadPolicyConfig struct {
+	MaxSize             int64    `yaml:"max_size,omitempty"`              // bytes, 0 for no limit
+	MinSize             int64    `yaml:"min_size,omitempty"`              // bytes
+	AllowedContentTypes []string `yaml:"allowed_content_types,omitempty"` // e.g. "image/png", "image/*"; empty allows all
+	KeyPattern          string   `yaml:"key_pattern,omitempty"`           // regexp the whole key must match
+	ForbiddenExtensions []string `yaml:"forbidden_extensions,omitempty"`  // e.g. ".exe", ".tar.gz"
+}
+
+// TrashConfig sets how long deleted objects stay restorable.
+type TrashConfig struct {
+	Retention time.Duration `yaml:"retention"` // default 7 days; 0 purges on the next worker run
+}
+
+// PackConfig stores a bucket's small objects together in pack files, one
+// provider object per pack instead of one per upload. An upload returns
+// once its pack is stored.
+type PackConfig struct {
+	MaxBytes     int64         `yaml:"max_bytes,omitempty"`     // seal a pack once it holds this much, default 8MB
+	MaxDelay     time.Duration `yaml:"max_delay,omitempty"`     // seal a pack this long after its first object, default 200ms
+	CompactRatio float64       `yaml:"compact_ratio,omitempty"` // rewrite packs with at least this fraction of dead bytes, default 0.5
+}
+
+// ObjectLockConfig gives new objects a default retention. Retention and
+// legal holds set on an object are enforced whether or not its bucket has
+// this section.
+type ObjectLockConfig struct {
+	Mode      string        `yaml:"mode"`      // GOVERNANCE or COMPLIANCE
+	Retention time.Duration `yaml:"retention"` // how long new objects are retained
+}
+
+// LifecycleRule moves the latest version of matching objects to colder
+// storage classes and finally expires it. An object matches when its key
+// has Prefix and it carries all Tags. Noncurrent versions are left alone:
+// they keep their storage class until they are deleted by version ID.
+type LifecycleRule struct {
+	ID          string                `yaml:"id"`
+	Prefix      string                `yaml:"prefix,omitempty"`
+	Tags        map[string]string     `yaml:"tags,omitempty"`
+	Transitions []LifecycleTransition `yaml:"transitions,omitempty"`
+	Expiration  *LifecycleCondition   `yaml:"expiration,omitempty"`
+}
+
+// LifecycleCondition holds once the object is older than Age or has not
+// been read for Idle. Zero values are not checked.
+type LifecycleCondition struct {
+	Age  time.Duration `yaml:"age,omitempty"`  // since the object was written
+	Idle time.Duration `yaml:"idle,omitempty"` // since its last read, or its write if never read
+}
+
+type LifecycleTransition struct {
+	LifecycleCondition `yaml:",inline"`
+	StorageClass       string `yaml:"storage_class"` // COLD or ARCHIVE
+}
+
+type BucketConfigs []BucketConfig
+
+// Lookup returns the most specific config for a logical bucket, or nil.
+func (bs BucketConfigs) Lookup(env, region, bucket string) *BucketConfig {
+	var best *BucketConfig
+	bestScore := -1
+	for i := range bs {
+		b := &bs[i]
+		if b.Bucket != bucket || (b.Env != "" && b.Env != env) || (b.LogicalRegion != "" && b.LogicalRegion != region) {
+			continue
+		}
+		score := 0
+		if b.Env != "" {
+			score += 2
+		}
+		if b.LogicalRegion != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = b, score
+		}
+	}
+	return best
 }
 
 type ObjectStorageConfig struct {
 	DefaultStorageClass string           `yaml:"default_storage_class"`
 	Routes              []RouteRule      `yaml:"routes"`
 	Providers           []ProviderConfig `yaml:"providers"`
+	Buckets             BucketConfigs    `yaml:"buckets,omitempty"`
 }
 
 type RedisConfig struct {
@@ -53,12 +222,55 @@ type RedisConfig struct {
 }
 
 type HTTPConfig struct {
-	Addr string `yaml:"addr"` // ":8080"
+	Addr          string `yaml:"addr"`                     // ":8080"
+	PresignSecret string `yaml:"presign_secret,omitempty"` // HMAC key for presigned URLs
+	AdminToken    string `yaml:"admin_token,omitempty"`    // bearer token for /admin; admin API disabled when empty
 }
 
 type DBConfig struct {
-	Driver string `yaml:"driver"` // "pgx"
-	DSN    string `yaml:"dsn"`    // connection string
+	Driver         string `yaml:"driver"`                     // "pgx"
+	DSN            string `yaml:"dsn"`                        // connection string
+	MigrateOnStart bool   `yaml:"migrate_on_start,omitempty"` // apply pending migrations before serving
+	MaxConns       int32  `yaml:"max_conns,omitempty"`        // connection pool size, default max(4, CPUs)
+}
+
+type ClamdConfig struct {
+	Network string        `yaml:"network"` // "unix" or "tcp"
+	Address string        `yaml:"address"` // socket path or host:port
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+type InspectionConfig struct {
+	Clamd *ClamdConfig `yaml:"clamd,omitempty"`
+}
+
+// WorkersConfig tunes the gateway's background jobs.
+type WorkersConfig struct {
+	QuotaRecomputeInterval time.Duration  `yaml:"quota_recompute_interval,omitempty"` // default 1h
+	TrashPurgeInterval     time.Duration  `yaml:"trash_purge_interval,omitempty"`     // default 10m
+	LifecycleInterval      time.Duration  `yaml:"lifecycle_interval,omitempty"`       // default 1h
+	LifecycleDryRun        bool           `yaml:"lifecycle_dry_run,omitempty"`        // only log what lifecycle rules would do
+	OrphanGC               OrphanGCConfig `yaml:"orphan_gc,omitempty"`
+	Scrub                  ScrubConfig    `yaml:"scrub,omitempty"`
+	ReplicationInterval    time.Duration  `yaml:"replication_interval,omitempty"`     // default 30s; writes also wake the worker
+	RebalanceInterval      time.Duration  `yaml:"rebalance_interval,omitempty"`       // default 10m; moves objects written to fallbacks back
+	PackCompactionInterval time.Duration  `yaml:"pack_compaction_interval,omitempty"` // default 1h
+}
+
+// ScrubConfig tunes the job that compares metadata with provider objects.
+type ScrubConfig struct {
+	Interval time.Duration `yaml:"interval,omitempty"` // 0 disables the background job
+	Verify   bool          `yaml:"verify,omitempty"`   // re-read content to check recorded checksums
+	Repair   bool          `yaml:"repair,omitempty"`   // rewrite damaged objects from a healthy copy
+}
+
+// OrphanGCConfig tunes the job that deletes provider objects no metadata
+// record points to.
+type OrphanGCConfig struct {
+	Interval time.Duration `yaml:"interval,omitempty"` // 0 disables the background job
+	Grace    time.Duration `yaml:"grace,omitempty"`    // minimum age of a deleted orphan, default 24h
+	Rate     float64       `yaml:"rate,omitempty"`     // deletes per second, default 10
+	DryRun   bool          `yaml:"dry_run,omitempty"`  // only log the orphans found
 }
 
 type Config struct {
@@ -67,6 +279,8 @@ type Config struct {
 	Redis         RedisConfig         `yaml:"redis"`
 	DB            DBConfig            `yaml:"db"`
 	ObjectStorage ObjectStorageConfig `yaml:"object_storage"`
+	Inspection    InspectionConfig    `yaml:"inspection,omitempty"`
+	Workers       WorkersConfig       `yaml:"workers,omitempty"`
 }
 
 func Load(path string) (*Config, error) {
@@ -81,6 +295,24 @@ func Load(path string) (*Config, error) {
 	if cfg.ObjectStorage.DefaultStorageClass == "" {
 		cfg.ObjectStorage.DefaultStorageClass = "HOT"
 	}
+	if cfg.Workers.QuotaRecomputeInterval == 0 {
+		cfg.Workers.QuotaRecomputeInterval = time.Hour
+	}
+	if cfg.Workers.TrashPurgeInterval == 0 {
+		cfg.Workers.TrashPurgeInterval = 10 * time.Minute
+	}
+	if cfg.Workers.LifecycleInterval == 0 {
+		cfg.Workers.LifecycleInterval = time.Hour
+	}
+	if cfg.Workers.ReplicationInterval == 0 {
+		cfg.Workers.ReplicationInterval = 30 * time.Second
+	}
+	if cfg.Workers.RebalanceInterval == 0 {
+		cfg.Workers.RebalanceInterval = 10 * time.Minute
+	}
+	if cfg.Workers.PackCompactionInterval == 0 {
+		cfg.Workers.PackCompactionInterval = time.Hour
+	}
 	if cfg.HTTP.Addr == "" {
 		cfg.HTTP.Addr = ":8080"
 	}
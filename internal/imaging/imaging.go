@@ -0,0 +1,208 @@
+// Package imaging resizes, crops and re-encodes images with pure-Go codecs.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the WebP decoder
+)
+
+type Fit string
+
+const (
+	// FitCover scales to fill the box and crops the overflow, keeping the center.
+	FitCover Fit = "cover"
+	// FitContain scales to fit inside the box; the result may be smaller on one side.
+	FitContain Fit = "contain"
+	// FitFill stretches to exactly the box, ignoring the aspect ratio.
+	FitFill Fit = "fill"
+)
+
+type Format string
+
+const (
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+	FormatGIF  Format = "gif"
+)
+
+var (
+	ErrInvalidOptions    = errors.New("invalid image transform")
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrImageTooLarge     = errors.New("image dimensions too large")
+)
+
+// DefaultMaxPixels caps width×height of decoded sources when
+// Options.MaxPixels is unset: 40 megapixels, 160MB as RGBA.
+const DefaultMaxPixels = 40_000_000
+
+// Options describes a transform. A zero Width or Height is derived from the
+// other side and the source aspect ratio. An empty Format keeps the source
+// format (WebP sources are re-encoded as PNG).
+type Options struct {
+	Width   int
+	Height  int
+	Fit     Fit
+	Format  Format
+	Quality int // JPEG only, 1-100
+
+	// MaxPixels rejects sources whose header declares more than this many
+	// pixels before they are decoded; 0 means DefaultMaxPixels.
+	MaxPixels int64
+}
+
+// ParseFormat normalizes a format name such as "jpg" or "PNG".
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return "", nil
+	case "png":
+		return FormatPNG, nil
+	case "jpg", "jpeg":
+		return FormatJPEG, nil
+	case "gif":
+		return FormatGIF, nil
+	}
+	return "", fmt.Errorf("%w: format %q", ErrInvalidOptions, s)
+}
+
+// ParseFit validates a fit mode; empty means cover.
+func ParseFit(s string) (Fit, error) {
+	switch Fit(strings.ToLower(s)) {
+	case "", FitCover:
+		return FitCover, nil
+	case FitContain:
+		return FitContain, nil
+	case FitFill:
+		return FitFill, nil
+	}
+	return "", fmt.Errorf("%w: fit %q", ErrInvalidOptions, s)
+}
+
+func (o Options) Validate() error {
+	if o.Width < 0 || o.Height < 0 || (o.Width == 0 && o.Height == 0) {
+		return fmt.Errorf("%w: width or height required", ErrInvalidOptions)
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("%w: quality %d", ErrInvalidOptions, o.Quality)
+	}
+	if o.MaxPixels < 0 {
+		return fmt.Errorf("%w: max pixels %d", ErrInvalidOptions, o.MaxPixels)
+	}
+	return nil
+}
+
+// Size is the "WxH" form used in allowlists, with 0 for an auto side.
+func (o Options) Size() string {
+	return fmt.Sprintf("%dx%d", o.Width, o.Height)
+}
+
+// Transform decodes src, applies opts and encodes the result. It returns the
+// encoded bytes and their content type.
+func Transform(src io.Reader, opts Options) ([]byte, string, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, "", err
+	}
+	// the header is checked first: a small file may declare dimensions
+	// whose pixels would not fit in memory
+	var head bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(src, &head))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	maxPixels := opts.MaxPixels
+	if maxPixels == 0 {
+		maxPixels = DefaultMaxPixels
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, "", fmt.Errorf("%w: %dx%d exceeds %d pixels", ErrImageTooLarge, cfg.Width, cfg.Height, maxPixels)
+	}
+	img, srcFormat, err := image.Decode(io.MultiReader(&head, src))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	format := opts.Format
+	if format == "" {
+		format, err = ParseFormat(srcFormat)
+		if err != nil {
+			format = FormatPNG
+		}
+	}
+
+	out := resize(img, opts)
+	var buf bytes.Buffer
+	switch format {
+	case FormatPNG:
+		err = png.Encode(&buf, out)
+	case FormatJPEG:
+		q := opts.Quality
+		if q == 0 {
+			q = 85
+		}
+		err = jpeg.Encode(&buf, out, &jpeg.Options{Quality: q})
+	case FormatGIF:
+		err = gif.Encode(&buf, out, nil)
+	default:
+		return nil, "", fmt.Errorf("%w: format %q", ErrInvalidOptions, format)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ContentType(format), nil
+}
+
+func ContentType(f Format) string {
+	return "image/" + string(f)
+}
+
+func resize(img image.Image, opts Options) image.Image {
+	sb := img.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	if sw == 0 || sh == 0 {
+		return img
+	}
+	w, h := opts.Width, opts.Height
+	switch {
+	case w == 0:
+		w = max(1, sw*h/sh)
+	case h == 0:
+		h = max(1, sh*w/sw)
+	}
+
+	srcRect := sb
+	dw, dh := w, h
+	switch opts.Fit {
+	case FitFill:
+	case FitContain:
+		// scale by the tighter side
+		if sw*h > sh*w {
+			dh = max(1, sh*w/sw)
+		} else {
+			dw = max(1, sw*h/sh)
+		}
+	default: // cover: crop the source to the target aspect ratio
+		if sw*h > sh*w {
+			cw := sh * w / h
+			x0 := sb.Min.X + (sw-cw)/2
+			srcRect = image.Rect(x0, sb.Min.Y, x0+cw, sb.Max.Y)
+		} else {
+			ch := sw * h / w
+			y0 := sb.Min.Y + (sh-ch)/2
+			srcRect = image.Rect(sb.Min.X, y0, sb.Max.X, y0+ch)
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, srcRect, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,78 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// bombPNG is a tiny PNG whose header claims w×h pixels.
+func bombPNG(t *testing.T, w, h uint32) []byte {
+	t.Helper()
+	data := encodePNG(t, 1, 1)
+	// signature (8), IHDR length (4), "IHDR" (4), then width and height
+	ihdr := data[12 : 12+4+13]
+	binary.BigEndian.PutUint32(ihdr[4:], w)
+	binary.BigEndian.PutUint32(ihdr[8:], h)
+	binary.BigEndian.PutUint32(data[12+4+13:], crc32.ChecksumIEEE(ihdr))
+	return data
+}
+
+func TestTransform(t *testing.T) {
+	out, contentType, err := Transform(bytes.NewReader(encodePNG(t, 40, 20)), Options{Width: 10, Fit: FitContain})
+	if err != nil {
+		t.Fatalf("transform: %v", err)
+	}
+	if contentType != "image/png" {
+		t.Errorf("content type = %q", contentType)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 10 || cfg.Height != 5 {
+		t.Errorf("size = %dx%d, want 10x5", cfg.Width, cfg.Height)
+	}
+}
+
+func TestTransformRejectsHugeDimensions(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       []byte
+		maxPixels int64
+		wantErr   error
+	}{
+		{name: "bomb under default", src: bombPNG(t, 100000, 100000), wantErr: ErrImageTooLarge},
+		{name: "over configured max", src: encodePNG(t, 40, 20), maxPixels: 799, wantErr: ErrImageTooLarge},
+		{name: "at configured max", src: encodePNG(t, 40, 20), maxPixels: 800},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Transform(bytes.NewReader(tt.src), Options{Width: 8, Height: 8, MaxPixels: tt.maxPixels})
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("transform: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package inspect
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ClamdInspector scans streams with a clamd daemon using the INSTREAM
+// command over a Unix or TCP socket.
+type ClamdInspector struct {
+	network   string // "unix" or "tcp"
+	address   string
+	timeout   time.Duration
+	chunkSize int
+}
+
+type ClamdConfig struct {
+	Network string
+	Address string
+	Timeout time.Duration // per scan, default 60s
+}
+
+func NewClamdInspector(cfg ClamdConfig) (*ClamdInspector, error) {
+	if cfg.Network != "unix" && cfg.Network != "tcp" {
+		return nil, fmt.Errorf("clamd network must be unix or tcp, got %q", cfg.Network)
+	}
+	if cfg.Address == "" {
+		return nil, errors.New("clamd address is required")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 60 * time.Second
+	}
+	return &ClamdInspector{
+		network:   cfg.Network,
+		address:   cfg.Address,
+		timeout:   cfg.Timeout,
+		chunkSize: 64 * 1024,
+	}, nil
+}
+
+func (c *ClamdInspector) Inspect(ctx context.Context, r io.Reader) (Verdict, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("dial clamd: %w", err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(c.timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if werr := c.stream(conn, r); werr != nil {
+		// clamd closes the stream early when it hits StreamMaxLength; its
+		// reply explains why, so prefer it over the write error
+		if v, rerr := readReply(conn); rerr == nil || !errors.Is(rerr, errNoReply) {
+			return v, rerr
+		}
+		return Verdict{}, fmt.Errorf("stream to clamd: %w", werr)
+	}
+	return readReply(conn)
+}
+
+// stream sends r as INSTREAM chunks: a 4-byte big-endian length followed
+// by data, terminated by a zero-length chunk.
+func (c *ClamdInspector) stream(w io.Writer, r io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buf := make([]byte, 4+c.chunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+var errNoReply = errors.New("no reply from clamd")
+
+// readReply parses "stream: OK", "stream: <sig> FOUND" or "<msg> ERROR".
+func readReply(r io.Reader) (Verdict, error) {
+	line, err := bufio.NewReader(r).ReadString(0)
+	line = strings.TrimSpace(strings.TrimRight(line, "\x00"))
+	if line == "" {
+		if err == nil {
+			err = io.EOF
+		}
+		return Verdict{}, fmt.Errorf("%w: %v", errNoReply, err)
+	}
+	line = strings.TrimPrefix(line, "stream: ")
+	switch {
+	case line == "OK":
+		return Verdict{Clean: true}, nil
+	case strings.HasSuffix(line, " FOUND"):
+		return Verdict{Signature: strings.TrimSuffix(line, " FOUND")}, nil
+	case strings.HasSuffix(line, " ERROR"):
+		return Verdict{}, fmt.Errorf("clamd: %s", strings.TrimSuffix(line, " ERROR"))
+	}
+	return Verdict{}, fmt.Errorf("unexpected clamd reply %q", line)
+}
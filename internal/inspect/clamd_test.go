@@ -0,0 +1,145 @@
+package inspect
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd accepts INSTREAM sessions and answers each with reply, or
+// never answers when reply is empty.
+func fakeClamd(t *testing.T, reply string) (addr string, received <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	got := make(chan []byte, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				data, err := readInstream(conn)
+				if err != nil {
+					return
+				}
+				got <- data
+				if reply == "" {
+					// hold the connection open until the client gives up
+					_, _ = io.Copy(io.Discard, conn)
+					return
+				}
+				_, _ = io.WriteString(conn, reply+"\x00")
+			}()
+		}
+	}()
+	return ln.Addr().String(), got
+}
+
+// readInstream reads a zINSTREAM command and returns the streamed data.
+func readInstream(r io.Reader) ([]byte, error) {
+	cmd := make([]byte, len("zINSTREAM\x00"))
+	if _, err := io.ReadFull(r, cmd); err != nil {
+		return nil, err
+	}
+	if string(cmd) != "zINSTREAM\x00" {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var data bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data.Bytes(), nil
+		}
+		if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestClamdInspect(t *testing.T) {
+	body := strings.Repeat("0123456789", 20_000) // several chunks
+
+	tests := []struct {
+		name    string
+		reply   string
+		want    Verdict
+		wantErr string
+	}{
+		{name: "clean", reply: "stream: OK", want: Verdict{Clean: true}},
+		{name: "infected", reply: "stream: Eicar-Test-Signature FOUND", want: Verdict{Signature: "Eicar-Test-Signature"}},
+		{name: "scanner error", reply: "INSTREAM size limit exceeded. ERROR", wantErr: "size limit exceeded"},
+		{name: "unexpected reply", reply: "PONG", wantErr: "unexpected clamd reply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, received := fakeClamd(t, tt.reply)
+			c, err := NewClamdInspector(ClamdConfig{Network: "tcp", Address: addr, Timeout: 5 * time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := c.Inspect(context.Background(), strings.NewReader(body))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("inspect: %v", err)
+			}
+			if v != tt.want {
+				t.Errorf("verdict = %+v, want %+v", v, tt.want)
+			}
+			if data := <-received; string(data) != body {
+				t.Errorf("clamd received %d bytes, want %d", len(data), len(body))
+			}
+		})
+	}
+}
+
+func TestClamdInspectTimeout(t *testing.T) {
+	addr, _ := fakeClamd(t, "")
+	c, err := NewClamdInspector(ClamdConfig{Network: "tcp", Address: addr, Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = c.Inspect(context.Background(), strings.NewReader("data"))
+	if err == nil {
+		t.Fatal("inspect succeeded without a reply")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("inspect returned after %v, want about the 100ms timeout", elapsed)
+	}
+}
+
+func TestClamdInspectUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c, err := NewClamdInspector(ClamdConfig{Network: "tcp", Address: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Inspect(context.Background(), strings.NewReader("data")); err == nil {
+		t.Fatal("inspect succeeded without a scanner")
+	}
+}
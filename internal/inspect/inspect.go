@@ -0,0 +1,20 @@
+// Package inspect scans uploaded content before it is committed.
+package inspect
+
+import (
+	"context"
+	"io"
+)
+
+// Verdict is the outcome of a scan. Signature names the match when the
+// content is not clean.
+type Verdict struct {
+	Clean     bool
+	Signature string
+}
+
+// Inspector scans a stream. It returns an error only when the scan itself
+// failed; a detection is reported through the Verdict.
+type Inspector interface {
+	Inspect(ctx context.Context, r io.Reader) (Verdict, error)
+}
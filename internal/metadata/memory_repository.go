@@ -2,19 +2,42 @@ package metadata
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 // InMemoryRepository is useful for local dev / fallback when DB is not configured.
 type InMemoryRepository struct {
-	mu   sync.RWMutex
-	data map[string]*ObjectRecord
+	mu     sync.RWMutex
+	rows   map[int64]*ObjectRecord  // every record by ID: versions, delete markers and trash
+	latest map[string]*ObjectRecord // latest version by makeKey
+	usage  map[string]*BucketUsage  // keyed by makeKey(env, region, bucket, "")
+	nextID int64
+
+	findings []*ScrubFinding // oldest first
+
+	replicas      map[int64]*ReplicaRecord
+	nextReplicaID int64
+
+	refs    map[string]int64 // references by "provider_bucket/physical_key"
+	retired map[string]bool  // tombstones left by RetireRef, same keys
+
+	packs      map[int64]*PackRecord
+	nextPackID int64
 }
 
 func NewInMemoryRepository() *InMemoryRepository {
 	return &InMemoryRepository{
-		data: make(map[string]*ObjectRecord),
+		rows:   make(map[int64]*ObjectRecord),
+		latest: make(map[string]*ObjectRecord),
+		usage:  make(map[string]*BucketUsage),
+
+		replicas: make(map[int64]*ReplicaRecord),
+		refs:     make(map[string]int64),
+		retired:  make(map[string]bool),
+		packs:    make(map[int64]*PackRecord),
 	}
 }
 
@@ -22,48 +45,689 @@ func makeKey(env, region, bucket, key string) string {
 	return env + "|" + region + "|" + bucket + "|" + key
 }
 
+// isLive reports whether rec holds data counted towards bucket usage.
+func isLive(rec *ObjectRecord) bool {
+	return rec.Status == StatusActive || rec.Status == StatusQuarantined
+}
+
 func (r *InMemoryRepository) GetObject(_ context.Context, env, region, bucket, key string) (*ObjectRecord, error) {
 	k := makeKey(env, region, bucket, key)
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	rec, ok := r.data[k]
-	if !ok || rec.Status == "DELETED" {
+	rec, ok := r.latest[k]
+	if !ok || rec.Status == StatusDeleteMarker {
 		return nil, ErrNotFound
 	}
 	return rec, nil
 }
 
-func (r *InMemoryRepository) PutObject(_ context.Context, rec *ObjectRecord) error {
+func (r *InMemoryRepository) PutObject(_ context.Context, rec *ObjectRecord) (*ObjectRecord, error) {
 	if rec == nil {
-		return ErrNotFound
+		return nil, ErrNotFound
 	}
 	now := time.Now()
 	rec.UpdatedAt = now
 	if rec.CreatedAt.IsZero() {
 		rec.CreatedAt = now
 	}
+	if rec.Status == "" {
+		rec.Status = StatusActive
+	}
+	rec.IsLatest = true
+	k := makeKey(rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bytes, objects := rec.SizeBytes, int64(1)
+	var replaced *ObjectRecord
+	if prev, ok := r.latest[k]; ok {
+		if isLive(prev) {
+			bytes, objects = bytes-prev.SizeBytes, 0
+			replaced = prev
+		}
+		rec.ID = prev.ID
+		if rec.Version == 0 {
+			rec.Version = prev.Version + 1
+		}
+	} else {
+		r.nextID++
+		rec.ID = r.nextID
+	}
 	if rec.Version == 0 {
 		rec.Version = 1
 	}
+	r.rows[rec.ID] = rec
+	r.latest[k] = rec
+	r.addUsage(rec.Env, rec.LogicalRegion, rec.Bucket, bytes, objects)
+	return replaced, nil
+}
+
+func (r *InMemoryRepository) MarkDeleted(_ context.Context, env, region, bucket, key string, purgeAt time.Time) error {
+	k := makeKey(env, region, bucket, key)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.latest[k]
+	if !ok || rec.Status == StatusDeleteMarker {
+		return ErrNotFound
+	}
+	now := time.Now()
+	delete(r.latest, k)
+	rec.Status = StatusDeleted
+	rec.IsLatest = false
+	rec.UpdatedAt = now
+	rec.DeletedAt = now
+	rec.PurgeAt = purgeAt
+	r.addUsage(env, region, bucket, -rec.SizeBytes, -1)
+	return nil
+}
+
+func (r *InMemoryRepository) ListObjects(_ context.Context, env, region, bucket string, opts ListOptions) ([]*ObjectRecord, error) {
+	r.mu.RLock()
+	out := make([]*ObjectRecord, 0)
+	for _, rec := range r.latest {
+		if rec.Status != StatusActive || rec.Env != env || rec.LogicalRegion != region || rec.Bucket != bucket {
+			continue
+		}
+		if !strings.HasPrefix(rec.ObjectKey, opts.Prefix) || rec.ObjectKey <= opts.StartAfter {
+			continue
+		}
+		out = append(out, rec)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ObjectKey < out[j].ObjectKey })
+	if opts.Limit > 0 && len(out) > opts.Limit {
+		out = out[:opts.Limit]
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepository) GetObjectVersion(_ context.Context, env, region, bucket, key, versionID string) (*ObjectRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if rec := r.findVersion(env, region, bucket, key, versionID); rec != nil {
+		return rec, nil
+	}
+	return nil, ErrNotFound
+}
+
+// findVersion must be called with mu held. Trash entries are not versions.
+func (r *InMemoryRepository) findVersion(env, region, bucket, key, versionID string) *ObjectRecord {
+	for _, rec := range r.rows {
+		if rec.VersionID == versionID && rec.Status != StatusDeleted &&
+			rec.Env == env && rec.LogicalRegion == region && rec.Bucket == bucket && rec.ObjectKey == key {
+			return rec
+		}
+	}
+	return nil
+}
+
+func (r *InMemoryRepository) AddVersion(_ context.Context, rec *ObjectRecord) error {
+	if rec == nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	rec.UpdatedAt = now
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
 	if rec.Status == "" {
-		rec.Status = "ACTIVE"
+		rec.Status = StatusActive
 	}
 	k := makeKey(rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey)
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.data[k] = rec
+	rec.Version = 1
+	if prev, ok := r.latest[k]; ok {
+		prev.IsLatest = false
+		rec.Version = prev.Version + 1
+	}
+	r.nextID++
+	rec.ID = r.nextID
+	rec.IsLatest = true
+	r.rows[rec.ID] = rec
+	r.latest[k] = rec
+	if isLive(rec) {
+		r.addUsage(rec.Env, rec.LogicalRegion, rec.Bucket, rec.SizeBytes, 1)
+	}
 	return nil
 }
 
-func (r *InMemoryRepository) MarkDeleted(_ context.Context, env, region, bucket, key string) error {
-	k := makeKey(env, region, bucket, key)
+func (r *InMemoryRepository) DeleteVersion(_ context.Context, env, region, bucket, key, versionID string) (*ObjectRecord, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	rec, ok := r.data[k]
+	rec := r.findVersion(env, region, bucket, key, versionID)
+	if rec == nil {
+		return nil, ErrNotFound
+	}
+	delete(r.rows, rec.ID)
+	if rec.IsLatest {
+		k := makeKey(env, region, bucket, key)
+		delete(r.latest, k)
+		var next *ObjectRecord
+		for _, v := range r.rows {
+			if v.Status != StatusDeleted && v.Env == env && v.LogicalRegion == region && v.Bucket == bucket && v.ObjectKey == key &&
+				(next == nil || v.ID > next.ID) {
+				next = v
+			}
+		}
+		if next != nil {
+			next.IsLatest = true
+			r.latest[k] = next
+		}
+		rec.IsLatest = false
+	}
+	if isLive(rec) {
+		r.addUsage(env, region, bucket, -rec.SizeBytes, -1)
+	}
+	return rec, nil
+}
+
+func (r *InMemoryRepository) ListVersions(_ context.Context, env, region, bucket string, opts ListOptions) ([]*ObjectRecord, error) {
+	r.mu.RLock()
+	var markerID int64
+	if opts.StartAfterVersionID != "" {
+		if m := r.findVersion(env, region, bucket, opts.StartAfter, opts.StartAfterVersionID); m != nil {
+			markerID = m.ID
+		}
+	}
+	out := make([]*ObjectRecord, 0)
+	for _, rec := range r.rows {
+		if rec.Status == StatusDeleted || rec.Env != env || rec.LogicalRegion != region || rec.Bucket != bucket || !strings.HasPrefix(rec.ObjectKey, opts.Prefix) {
+			continue
+		}
+		if rec.ObjectKey < opts.StartAfter || (rec.ObjectKey == opts.StartAfter && (markerID == 0 || rec.ID >= markerID)) {
+			continue
+		}
+		out = append(out, rec)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ObjectKey != out[j].ObjectKey {
+			return out[i].ObjectKey < out[j].ObjectKey
+		}
+		return out[i].ID > out[j].ID
+	})
+	if opts.Limit > 0 && len(out) > opts.Limit {
+		out = out[:opts.Limit]
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepository) SetObjectLock(_ context.Context, id int64, mode string, retainUntil time.Time, legalHold bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.rows[id]
+	if !ok || rec.Status == StatusDeleted {
+		return ErrNotFound
+	}
+	rec.RetentionMode = mode
+	rec.RetainUntil = retainUntil
+	rec.LegalHold = legalHold
+	rec.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *InMemoryRepository) TouchObject(_ context.Context, env, region, bucket, key string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.latest[makeKey(env, region, bucket, key)]
 	if !ok {
 		return ErrNotFound
 	}
-	rec.Status = "DELETED"
+	rec.LastAccessedAt = at
+	return nil
+}
+
+func (r *InMemoryRepository) Relocate(_ context.Context, rec *ObjectRecord, oldPhysicalKey string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, ok := r.rows[rec.ID]
+	if !ok || cur.PhysicalKey != oldPhysicalKey {
+		return ErrNotFound
+	}
+	cur.StorageClass = rec.StorageClass
+	cur.StoreBackend = rec.StoreBackend
+	cur.ProviderName = rec.ProviderName
+	cur.ProviderType = rec.ProviderType
+	cur.ProviderRegion = rec.ProviderRegion
+	cur.ProviderBucket = rec.ProviderBucket
+	cur.PhysicalKey = rec.PhysicalKey
+	cur.PackID = rec.PackID
+	cur.PackOffset = rec.PackOffset
+	cur.ETag = rec.ETag
+	cur.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *InMemoryRepository) ScanObjects(_ context.Context, afterID int64, limit int) ([]*ObjectRecord, error) {
+	r.mu.RLock()
+	out := make([]*ObjectRecord, 0)
+	for id, rec := range r.rows {
+		if id > afterID {
+			out = append(out, rec)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepository) ListDeleted(_ context.Context, env, region, bucket string, opts ListOptions) ([]*ObjectRecord, error) {
+	r.mu.RLock()
+	out := make([]*ObjectRecord, 0)
+	for _, rec := range r.rows {
+		if rec.Status != StatusDeleted || rec.Env != env || rec.LogicalRegion != region || rec.Bucket != bucket || !strings.HasPrefix(rec.ObjectKey, opts.Prefix) {
+			continue
+		}
+		if rec.ObjectKey < opts.StartAfter || (rec.ObjectKey == opts.StartAfter && rec.ID <= opts.StartAfterID) {
+			continue
+		}
+		out = append(out, rec)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ObjectKey != out[j].ObjectKey {
+			return out[i].ObjectKey < out[j].ObjectKey
+		}
+		return out[i].ID < out[j].ID
+	})
+	if opts.Limit > 0 && len(out) > opts.Limit {
+		out = out[:opts.Limit]
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepository) Restore(_ context.Context, env, region, bucket, key string, id int64) (*ObjectRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rec *ObjectRecord
+	if id != 0 {
+		rec = r.rows[id]
+		if rec != nil && (rec.Status != StatusDeleted || rec.Env != env || rec.LogicalRegion != region || rec.Bucket != bucket || rec.ObjectKey != key) {
+			rec = nil
+		}
+	} else {
+		for _, t := range r.rows {
+			if t.Status == StatusDeleted && t.Env == env && t.LogicalRegion == region && t.Bucket == bucket && t.ObjectKey == key && (rec == nil || t.ID > rec.ID) {
+				rec = t
+			}
+		}
+	}
+	if rec == nil {
+		return nil, ErrNotFound
+	}
+	k := makeKey(env, region, bucket, key)
+	if _, ok := r.latest[k]; ok {
+		return nil, ErrExists
+	}
+	rec.Status = StatusActive
+	rec.IsLatest = true
 	rec.UpdatedAt = time.Now()
+	rec.DeletedAt = time.Time{}
+	rec.PurgeAt = time.Time{}
+	r.latest[k] = rec
+	r.addUsage(env, region, bucket, rec.SizeBytes, 1)
+	return rec, nil
+}
+
+func (r *InMemoryRepository) ListPurgeable(_ context.Context, now time.Time, limit int) ([]*ObjectRecord, error) {
+	r.mu.RLock()
+	out := make([]*ObjectRecord, 0)
+	for _, rec := range r.rows {
+		if rec.Status == StatusDeleted && !rec.PurgeAt.After(now) {
+			out = append(out, rec)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].PurgeAt.Before(out[j].PurgeAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepository) DeleteRecord(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec, ok := r.rows[id]; !ok || rec.Status != StatusDeleted {
+		return ErrNotFound
+	}
+	delete(r.rows, id)
+	return nil
+}
+
+func (r *InMemoryRepository) PhysicalKeyInUse(_ context.Context, providerBucket, physicalKey string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rec := range r.rows {
+		if rec.ProviderBucket == providerBucket && rec.PhysicalKey == physicalKey {
+			return true, nil
+		}
+	}
+	for _, rep := range r.replicas {
+		if rep.TargetBucket == providerBucket && rep.SourceBucket != providerBucket && rep.PhysicalKey == physicalKey {
+			return true, nil
+		}
+	}
+	return r.refs[providerBucket+"/"+physicalKey] > 0, nil
+}
+
+func (r *InMemoryRepository) AcquireRef(_ context.Context, providerBucket, physicalKey string, _ int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := providerBucket + "/" + physicalKey
+	if r.retired[k] {
+		return 0, ErrRefRetired
+	}
+	r.refs[k]++
+	return r.refs[k], nil
+}
+
+func (r *InMemoryRepository) ReleaseRef(_ context.Context, providerBucket, physicalKey string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := providerBucket + "/" + physicalKey
+	if r.retired[k] {
+		return 0, nil
+	}
+	n := r.refs[k] - 1
+	if n <= 0 {
+		delete(r.refs, k)
+		return 0, nil
+	}
+	r.refs[k] = n
+	return n, nil
+}
+
+func (r *InMemoryRepository) RetireRef(_ context.Context, providerBucket, physicalKey string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := providerBucket + "/" + physicalKey
+	if r.retired[k] {
+		return 0, ErrRefRetired
+	}
+	n := r.refs[k] - 1
+	if n <= 0 {
+		delete(r.refs, k)
+		r.retired[k] = true
+		return 0, nil
+	}
+	r.refs[k] = n
+	return n, nil
+}
+
+func (r *InMemoryRepository) DropRef(_ context.Context, providerBucket, physicalKey string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.retired, providerBucket+"/"+physicalKey)
+	return nil
+}
+
+// addUsage must be called with mu held.
+func (r *InMemoryRepository) addUsage(env, region, bucket string, bytes, objects int64) {
+	k := makeKey(env, region, bucket, "")
+	u, ok := r.usage[k]
+	if !ok {
+		u = &BucketUsage{Env: env, LogicalRegion: region, Bucket: bucket}
+		r.usage[k] = u
+	}
+	u.Bytes += bytes
+	u.Objects += objects
+	u.UpdatedAt = time.Now()
+}
+
+func (r *InMemoryRepository) GetUsage(_ context.Context, env, region, bucket string) (*BucketUsage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if u, ok := r.usage[makeKey(env, region, bucket, "")]; ok {
+		cp := *u
+		return &cp, nil
+	}
+	return &BucketUsage{Env: env, LogicalRegion: region, Bucket: bucket}, nil
+}
+
+func (r *InMemoryRepository) ListUsage(_ context.Context) ([]*BucketUsage, error) {
+	r.mu.RLock()
+	out := make([]*BucketUsage, 0, len(r.usage))
+	for _, u := range r.usage {
+		cp := *u
+		out = append(out, &cp)
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		return makeKey(out[i].Env, out[i].LogicalRegion, out[i].Bucket, "") < makeKey(out[j].Env, out[j].LogicalRegion, out[j].Bucket, "")
+	})
+	return out, nil
+}
+
+func (r *InMemoryRepository) RecomputeUsage(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.usage {
+		u.Bytes, u.Objects = 0, 0
+	}
+	for _, rec := range r.rows {
+		if isLive(rec) {
+			r.addUsage(rec.Env, rec.LogicalRegion, rec.Bucket, rec.SizeBytes, 1)
+		}
+	}
+	return nil
+}
+
+func (r *InMemoryRepository) AddScrubFinding(_ context.Context, f *ScrubFinding) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f.ID = int64(len(r.findings)) + 1
+	if f.DetectedAt.IsZero() {
+		f.DetectedAt = time.Now()
+	}
+	cp := *f
+	r.findings = append(r.findings, &cp)
+	return nil
+}
+
+func (r *InMemoryRepository) ListScrubFindings(_ context.Context, beforeID int64, limit int) ([]*ScrubFinding, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*ScrubFinding, 0)
+	for i := len(r.findings) - 1; i >= 0 && len(out) < limit; i-- {
+		if f := r.findings[i]; beforeID == 0 || f.ID < beforeID {
+			cp := *f
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepository) AddReplicas(_ context.Context, reps []*ReplicaRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+next:
+	for _, rep := range reps {
+		for _, cur := range r.replicas {
+			if cur.SourceBucket == rep.SourceBucket && cur.PhysicalKey == rep.PhysicalKey &&
+				cur.TargetProvider == rep.TargetProvider && cur.TargetBucket == rep.TargetBucket {
+				continue next
+			}
+		}
+		r.nextReplicaID++
+		rep.ID = r.nextReplicaID
+		if rep.Status == "" {
+			rep.Status = ReplicaPending
+		}
+		rep.CreatedAt = now
+		if rep.NextAttemptAt.IsZero() {
+			rep.NextAttemptAt = now
+		}
+		cp := *rep
+		r.replicas[rep.ID] = &cp
+	}
+	return nil
+}
+
+func (r *InMemoryRepository) ListReplicas(_ context.Context, sourceBucket, physicalKey string) ([]*ReplicaRecord, error) {
+	r.mu.RLock()
+	out := make([]*ReplicaRecord, 0)
+	for _, rep := range r.replicas {
+		if rep.SourceBucket == sourceBucket && rep.PhysicalKey == physicalKey {
+			cp := *rep
+			out = append(out, &cp)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (r *InMemoryRepository) ListReplicaJobs(_ context.Context, now time.Time, limit int) ([]*ReplicaRecord, error) {
+	r.mu.RLock()
+	out := make([]*ReplicaRecord, 0)
+	for _, rep := range r.replicas {
+		if rep.Status != ReplicaCompleted && !rep.NextAttemptAt.After(now) {
+			cp := *rep
+			out = append(out, &cp)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].NextAttemptAt.Equal(out[j].NextAttemptAt) {
+			return out[i].NextAttemptAt.Before(out[j].NextAttemptAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepository) UpdateReplica(_ context.Context, rep *ReplicaRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, ok := r.replicas[rep.ID]
+	if !ok || (cur.Status == ReplicaDeleting && rep.Status != ReplicaDeleting) {
+		return ErrNotFound
+	}
+	cur.Status, cur.ETag, cur.Attempts, cur.LastError = rep.Status, rep.ETag, rep.Attempts, rep.LastError
+	cur.NextAttemptAt, cur.ReplicatedAt = rep.NextAttemptAt, rep.ReplicatedAt
+	return nil
+}
+
+func (r *InMemoryRepository) MarkReplicasDeleting(_ context.Context, sourceBucket, physicalKey string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, rep := range r.replicas {
+		if rep.SourceBucket == sourceBucket && rep.PhysicalKey == physicalKey {
+			rep.Status, rep.NextAttemptAt, rep.Attempts, rep.LastError = ReplicaDeleting, now, 0, ""
+		}
+	}
+	return nil
+}
+
+func (r *InMemoryRepository) DeleteReplica(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.replicas[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.replicas, id)
+	return nil
+}
+
+func (r *InMemoryRepository) ReplicationBacklog(_ context.Context) ([]*ReplicaBacklog, error) {
+	r.mu.RLock()
+	byTarget := map[string]*ReplicaBacklog{}
+	for _, rep := range r.replicas {
+		k := rep.TargetProvider + "|" + rep.TargetBucket
+		b, ok := byTarget[k]
+		if !ok {
+			b = &ReplicaBacklog{TargetProvider: rep.TargetProvider, TargetBucket: rep.TargetBucket}
+			byTarget[k] = b
+		}
+		if rep.Status == ReplicaPending || rep.Status == ReplicaFailed {
+			b.Pending++
+			if b.OldestCreated.IsZero() || rep.CreatedAt.Before(b.OldestCreated) {
+				b.OldestCreated = rep.CreatedAt
+			}
+		}
+	}
+	r.mu.RUnlock()
+	out := make([]*ReplicaBacklog, 0, len(byTarget))
+	for _, b := range byTarget {
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].TargetProvider+"|"+out[i].TargetBucket < out[j].TargetProvider+"|"+out[j].TargetBucket
+	})
+	return out, nil
+}
+
+func (r *InMemoryRepository) AddPack(_ context.Context, p *PackRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextPackID++
+	p.ID = r.nextPackID
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+	cp := *p
+	r.packs[p.ID] = &cp
+	return nil
+}
+
+func (r *InMemoryRepository) ScanPacks(_ context.Context, afterID int64, limit int) ([]*PackRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*PackRecord, 0)
+	for id, p := range r.packs {
+		if id > afterID {
+			cp := *p
+			out = append(out, &cp)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	for _, p := range out {
+		for _, rec := range r.rows {
+			if rec.PackID == p.ID {
+				p.LiveEntries++
+				p.LiveBytes += rec.SizeBytes
+			}
+		}
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepository) ListPackEntries(_ context.Context, id int64) ([]*ObjectRecord, error) {
+	r.mu.RLock()
+	out := make([]*ObjectRecord, 0)
+	for _, rec := range r.rows {
+		if rec.PackID == id {
+			out = append(out, rec)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].PackOffset < out[j].PackOffset })
+	return out, nil
+}
+
+func (r *InMemoryRepository) DeletePack(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.packs, id)
 	return nil
 }
@@ -14,7 +14,18 @@ const (
 	StoreRedisObject StoreBackend = "REDIS_OBJECT"
 )
 
+// Object statuses. Each key has at most one latest record; in versioned
+// buckets older ACTIVE/QUARANTINED records and delete markers are kept as
+// noncurrent versions. DELETED records are trash entries.
+const (
+	StatusActive       = "ACTIVE"
+	StatusDeleted      = "DELETED"
+	StatusQuarantined  = "QUARANTINED"   // failed content inspection; never served
+	StatusDeleteMarker = "DELETE_MARKER" // latest version of a key deleted in a versioned bucket
+)
+
 type ObjectRecord struct {
+	ID            int64 // row id; tells apart trash entries of the same key
 	Env           string
 	LogicalRegion string
 	Bucket        string
@@ -25,23 +36,285 @@ type ObjectRecord struct {
 	StorageClass string
 	StoreBackend StoreBackend
 
+	// ProviderName is the registry name of the provider holding the
+	// object; empty for records written before it was kept.
+	ProviderName   string
 	ProviderType   string
 	ProviderRegion string
 	ProviderBucket string
 	PhysicalKey    string
+	// Packed objects share the physical object of pack PackID and start at
+	// PackOffset in it; SizeBytes is their length. PackID is 0 otherwise.
+	PackID     int64
+	PackOffset int64
+
+	ETag      string
+	Checksum  string // hex SHA-256 of the content; empty for records written before checksums
+	Version   int64  // write counter of the key
+	VersionID string // unique per write; also the suffix of PhysicalKey
+	IsLatest  bool
+	Status    string
+
+	// Object lock: the record may not be overwritten or deleted before
+	// RetainUntil, nor at all while LegalHold is set.
+	RetentionMode string // "", GOVERNANCE or COMPLIANCE
+	RetainUntil   time.Time
+	LegalHold     bool
+
+	Tags map[string]string // set on upload; matched by lifecycle rules
 
-	ETag    string
-	Version int64
-	Status  string
+	CreatedAt      time.Time // when this content was written
+	UpdatedAt      time.Time
+	LastAccessedAt time.Time // last read, recorded at most hourly; zero if never read
+	DeletedAt      time.Time // set while Status is DELETED
+	PurgeAt        time.Time // when a DELETED record and its object are removed for good
+}
+
+// Retention modes. GOVERNANCE retention can be lifted by an admin;
+// COMPLIANCE retention can only be extended.
+const (
+	RetentionGovernance = "GOVERNANCE"
+	RetentionCompliance = "COMPLIANCE"
+)
+
+// Locked reports whether rec is under retention or legal hold at now.
+func (rec *ObjectRecord) Locked(now time.Time) bool {
+	return rec.LegalHold || (rec.RetentionMode != "" && rec.RetainUntil.After(now))
+}
 
-	CreatedAt time.Time
-	UpdatedAt time.Time
+// ListOptions narrows and pages a ListObjects call. Results are ordered by
+// object key; StartAfter is exclusive.
+type ListOptions struct {
+	Prefix     string
+	StartAfter string
+	// StartAfterID pages ListDeleted, where a key may have several entries:
+	// listing resumes after (StartAfter, StartAfterID).
+	StartAfterID int64
+	// StartAfterVersionID pages ListVersions, which lists the versions of a
+	// key newest first: listing resumes after that version of StartAfter.
+	StartAfterVersionID string
+	Limit               int
+}
+
+// BucketUsage is the footprint of a bucket's live (ACTIVE or QUARANTINED)
+// objects. PutObject and MarkDeleted keep it up to date incrementally;
+// RecomputeUsage rebuilds it from the objects table to correct drift.
+type BucketUsage struct {
+	Env           string    `json:"env"`
+	LogicalRegion string    `json:"logical_region"`
+	Bucket        string    `json:"bucket"`
+	Bytes         int64     `json:"bytes"`
+	Objects       int64     `json:"objects"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type Repository interface {
+	// GetObject returns the latest version of key unless it is a delete marker.
 	GetObject(ctx context.Context, env, region, bucket, key string) (*ObjectRecord, error)
-	PutObject(ctx context.Context, rec *ObjectRecord) error
-	MarkDeleted(ctx context.Context, env, region, bucket, key string) error
+	// PutObject replaces the latest version of the key in place and returns
+	// the live record it replaced, or nil. Of concurrent writers of a key,
+	// each gets a different record back.
+	PutObject(ctx context.Context, rec *ObjectRecord) (*ObjectRecord, error)
+	MarkDeleted(ctx context.Context, env, region, bucket, key string, purgeAt time.Time) error
+	ListObjects(ctx context.Context, env, region, bucket string, opts ListOptions) ([]*ObjectRecord, error)
+
+	// Versions: GetObjectVersion returns any version, delete markers included.
+	GetObjectVersion(ctx context.Context, env, region, bucket, key, versionID string) (*ObjectRecord, error)
+	// AddVersion makes rec the latest version and keeps the previous one.
+	AddVersion(ctx context.Context, rec *ObjectRecord) error
+	// DeleteVersion removes one version for good and returns it. When it was
+	// the latest, the next newest version takes its place.
+	DeleteVersion(ctx context.Context, env, region, bucket, key, versionID string) (*ObjectRecord, error)
+	ListVersions(ctx context.Context, env, region, bucket string, opts ListOptions) ([]*ObjectRecord, error)
+
+	// SetObjectLock replaces the retention and legal hold of the record.
+	SetObjectLock(ctx context.Context, id int64, mode string, retainUntil time.Time, legalHold bool) error
+	// TouchObject records a read of the latest version of key.
+	TouchObject(ctx context.Context, env, region, bucket, key string, at time.Time) error
+	// Relocate points record rec.ID at rec's storage class, backend, provider
+	// location, pack and ETag, provided it still points at oldPhysicalKey;
+	// ErrNotFound otherwise.
+	Relocate(ctx context.Context, rec *ObjectRecord, oldPhysicalKey string) error
+	// ScanObjects returns records of any status with an ID above afterID in
+	// ID order, for jobs that walk all metadata.
+	ScanObjects(ctx context.Context, afterID int64, limit int) ([]*ObjectRecord, error)
+
+	// Trash: DELETED records are kept until their PurgeAt.
+	ListDeleted(ctx context.Context, env, region, bucket string, opts ListOptions) ([]*ObjectRecord, error)
+	// Restore makes the DELETED record id live again; id 0 picks the most
+	// recently deleted record of key. It fails with ErrExists when the key
+	// already has a live record.
+	Restore(ctx context.Context, env, region, bucket, key string, id int64) (*ObjectRecord, error)
+	ListPurgeable(ctx context.Context, now time.Time, limit int) ([]*ObjectRecord, error)
+	// DeleteRecord removes a DELETED record; ErrNotFound if it was restored.
+	DeleteRecord(ctx context.Context, id int64) error
+	// PhysicalKeyInUse reports whether any live or DELETED record still
+	// points at the physical object, a replica of any status was copied
+	// there from another provider bucket, or it holds references.
+	PhysicalKeyInUse(ctx context.Context, providerBucket, physicalKey string) (bool, error)
+
+	// AcquireRef adds a reference to a deduplicated physical object and
+	// returns how many it has now.
+	AcquireRef(ctx context.Context, providerBucket, physicalKey string, size int64) (int64, error)
+	// ReleaseRef drops a reference and returns how many are left. The last
+	// one removes the object's row; releasing an unknown object returns 0.
+	ReleaseRef(ctx context.Context, providerBucket, physicalKey string) (int64, error)
+	// RetireRef drops a reference like ReleaseRef, but the last one leaves a
+	// tombstone in the object's row, so that the caller can delete the
+	// object: AcquireRef fails with ErrRefRetired until DropRef removes the
+	// tombstone. Retiring an unknown object leaves one too. A second
+	// RetireRef of a tombstoned object fails with ErrRefRetired.
+	RetireRef(ctx context.Context, providerBucket, physicalKey string) (int64, error)
+	// DropRef removes the tombstone RetireRef left.
+	DropRef(ctx context.Context, providerBucket, physicalKey string) error
+
+	// GetUsage returns zero usage for a bucket that has never held objects.
+	GetUsage(ctx context.Context, env, region, bucket string) (*BucketUsage, error)
+	ListUsage(ctx context.Context) ([]*BucketUsage, error)
+	RecomputeUsage(ctx context.Context) error
+
+	// AddScrubFinding records an inconsistency the scrubber found.
+	AddScrubFinding(ctx context.Context, f *ScrubFinding) error
+	// ListScrubFindings returns findings newest first, starting below
+	// beforeID when it is not 0.
+	ListScrubFindings(ctx context.Context, beforeID int64, limit int) ([]*ScrubFinding, error)
+
+	// AddReplicas records replicas and sets their IDs. Status defaults to
+	// PENDING and NextAttemptAt to now. A replica that is already recorded
+	// for the same physical object and target is left as it is; its ID
+	// stays 0.
+	AddReplicas(ctx context.Context, reps []*ReplicaRecord) error
+	// ListReplicas returns the replicas of one physical object.
+	ListReplicas(ctx context.Context, sourceBucket, physicalKey string) ([]*ReplicaRecord, error)
+	// ListReplicaJobs returns PENDING, FAILED and DELETING replicas due at
+	// now, longest waiting first.
+	ListReplicaJobs(ctx context.Context, now time.Time, limit int) ([]*ReplicaRecord, error)
+	// UpdateReplica stores the status, ETag, attempts, error and times of
+	// rep; ErrNotFound once the replica is DELETING, unless rep is as well.
+	UpdateReplica(ctx context.Context, rep *ReplicaRecord) error
+	// MarkReplicasDeleting queues the replicas of a released physical object
+	// for deletion.
+	MarkReplicasDeleting(ctx context.Context, sourceBucket, physicalKey string) error
+	DeleteReplica(ctx context.Context, id int64) error
+	// ReplicationBacklog summarizes the replicas not yet COMPLETED by target.
+	ReplicationBacklog(ctx context.Context) ([]*ReplicaBacklog, error)
+
+	// AddPack records a stored pack and sets its ID.
+	AddPack(ctx context.Context, p *PackRecord) error
+	// ScanPacks returns packs with an ID above afterID in ID order, with
+	// their live entries counted.
+	ScanPacks(ctx context.Context, afterID int64, limit int) ([]*PackRecord, error)
+	// ListPackEntries returns the records of any status in pack id.
+	ListPackEntries(ctx context.Context, id int64) ([]*ObjectRecord, error)
+	DeletePack(ctx context.Context, id int64) error
+}
+
+// PackRecord is one provider object holding many small objects back to
+// back. Records find their content by PackID, PackOffset and SizeBytes.
+type PackRecord struct {
+	ID            int64  `json:"id"`
+	Env           string `json:"env"`
+	LogicalRegion string `json:"logical_region"`
+	Bucket        string `json:"bucket"`
+	StorageClass  string `json:"storage_class"`
+
+	ProviderName   string `json:"provider_name,omitempty"` // empty for packs sealed before it was kept
+	ProviderType   string `json:"provider_type"`
+	ProviderRegion string `json:"provider_region"`
+	ProviderBucket string `json:"provider_bucket"`
+	PhysicalKey    string `json:"physical_key"`
+	ETag           string `json:"etag"`
+
+	SizeBytes int64 `json:"size"`
+	Entries   int   `json:"entries"` // objects written into the pack
+
+	// counted by ScanPacks: records still pointing into the pack
+	LiveEntries int   `json:"live_entries"`
+	LiveBytes   int64 `json:"live_bytes"`
+
+	CreatedAt time.Time `json:"created_at"`
 }
 
-var ErrNotFound = errors.New("object not found")
+// Replica statuses. FAILED replicas are retried with backoff.
+const (
+	ReplicaPending   = "PENDING"
+	ReplicaCompleted = "COMPLETED"
+	ReplicaFailed    = "FAILED"
+	ReplicaDeleting  = "DELETING" // the source was released; the copy is removed next
+)
+
+// ReplicaRecord is the copy of one physical object in a replica target. The
+// copy has the same physical key as the source object.
+type ReplicaRecord struct {
+	ID            int64  `json:"id"`
+	Env           string `json:"env"`
+	LogicalRegion string `json:"logical_region"`
+	Bucket        string `json:"bucket"`
+	ObjectKey     string `json:"key"`
+	VersionID     string `json:"version_id"`
+
+	SizeBytes    int64  `json:"size"`
+	ContentType  string `json:"content_type"`
+	StorageClass string `json:"storage_class"`
+
+	SourceProvider string `json:"source_provider"` // provider name
+	SourceBucket   string `json:"source_bucket"`
+	PhysicalKey    string `json:"physical_key"`
+
+	TargetProvider     string `json:"target_provider"` // provider name
+	TargetProviderType string `json:"target_provider_type"`
+	TargetRegion       string `json:"target_region"`
+	TargetBucket       string `json:"target_bucket"`
+
+	Status    string `json:"status"`
+	ETag      string `json:"etag,omitempty"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+
+	CreatedAt     time.Time `json:"created_at"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	ReplicatedAt  time.Time `json:"replicated_at,omitempty"`
+}
+
+// ReplicaBacklog counts the replicas of one target that are not COMPLETED.
+type ReplicaBacklog struct {
+	TargetProvider string
+	TargetBucket   string
+	Pending        int64
+	OldestCreated  time.Time // zero when Pending is 0
+}
+
+// Scrub finding kinds.
+const (
+	FindingMissing          = "MISSING"           // the provider has no object at the physical key
+	FindingSizeMismatch     = "SIZE_MISMATCH"     // provider size differs from SizeBytes
+	FindingETagDrift        = "ETAG_DRIFT"        // provider ETag differs from the recorded one
+	FindingChecksumMismatch = "CHECKSUM_MISMATCH" // re-read content does not hash to Checksum
+)
+
+// ScrubFinding is a metadata record whose physical object does not match
+// it. Expected and Actual hold the compared values.
+type ScrubFinding struct {
+	ID             int64     `json:"id"`
+	ObjectID       int64     `json:"object_id"`
+	Env            string    `json:"env"`
+	LogicalRegion  string    `json:"logical_region"`
+	Bucket         string    `json:"bucket"`
+	ObjectKey      string    `json:"key"`
+	VersionID      string    `json:"version_id"`
+	ProviderBucket string    `json:"provider_bucket"`
+	PhysicalKey    string    `json:"physical_key"`
+	Kind           string    `json:"kind"`
+	Expected       string    `json:"expected,omitempty"`
+	Actual         string    `json:"actual,omitempty"`
+	Repaired       bool      `json:"repaired"`
+	DetectedAt     time.Time `json:"detected_at"`
+}
+
+var (
+	ErrNotFound = errors.New("object not found")
+	ErrExists   = errors.New("object already exists")
+	// ErrRefRetired means the deduplicated object is being deleted and
+	// cannot take new references.
+	ErrRefRetired = errors.New("object is being deleted")
+)
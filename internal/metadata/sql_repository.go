@@ -6,46 +6,113 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+const uniqueViolation = "23505"
+
+// DB is what SQLRepository needs of the database. *pgxpool.Pool
+// satisfies it; a single *pgx.Conn does too but is not safe for the
+// concurrent requests and workers sharing the repository.
+type DB interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type SQLRepository struct {
-	conn *pgx.Conn
+	db DB
 }
 
-func NewSQLRepository(conn *pgx.Conn) *SQLRepository {
-	return &SQLRepository{conn: conn}
+func NewSQLRepository(db DB) *SQLRepository {
+	return &SQLRepository{db: db}
 }
 
-func (r *SQLRepository) GetObject(ctx context.Context, env, region, bucket, key string) (*ObjectRecord, error) {
-	const q = `
-SELECT env, logical_region, bucket, object_key,
+// objectColumns is the column list scanObject expects.
+const objectColumns = `id, env, logical_region, bucket, object_key,
        size_bytes, content_type, storage_class, store_backend,
-       provider_type, provider_region, provider_bucket, physical_key,
-       etag, version, status, created_at, updated_at
-FROM objects
-WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4 AND status = 'ACTIVE'
-`
-	row := r.conn.QueryRow(ctx, q, env, region, bucket, key)
+       provider_name, provider_type, provider_region, provider_bucket, physical_key, pack_id, pack_offset,
+       etag, checksum, version, version_id, is_latest, status,
+       retention_mode, retain_until, legal_hold, tags,
+       created_at, updated_at, last_accessed_at, deleted_at, purge_at`
+
+func scanObject(row pgx.Row) (*ObjectRecord, error) {
 	var rec ObjectRecord
 	var storeBackend string
+	var retainUntil, lastAccessedAt, deletedAt, purgeAt *time.Time
 	if err := row.Scan(
-		&rec.Env, &rec.LogicalRegion, &rec.Bucket, &rec.ObjectKey,
+		&rec.ID, &rec.Env, &rec.LogicalRegion, &rec.Bucket, &rec.ObjectKey,
 		&rec.SizeBytes, &rec.ContentType, &rec.StorageClass, &storeBackend,
-		&rec.ProviderType, &rec.ProviderRegion, &rec.ProviderBucket, &rec.PhysicalKey,
-		&rec.ETag, &rec.Version, &rec.Status, &rec.CreatedAt, &rec.UpdatedAt,
+		&rec.ProviderName, &rec.ProviderType, &rec.ProviderRegion, &rec.ProviderBucket, &rec.PhysicalKey, &rec.PackID, &rec.PackOffset,
+		&rec.ETag, &rec.Checksum, &rec.Version, &rec.VersionID, &rec.IsLatest, &rec.Status,
+		&rec.RetentionMode, &retainUntil, &rec.LegalHold, &rec.Tags,
+		&rec.CreatedAt, &rec.UpdatedAt, &lastAccessedAt, &deletedAt, &purgeAt,
 	); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrNotFound
-		}
 		return nil, err
 	}
 	rec.StoreBackend = StoreBackend(storeBackend)
+	if retainUntil != nil {
+		rec.RetainUntil = *retainUntil
+	}
+	if lastAccessedAt != nil {
+		rec.LastAccessedAt = *lastAccessedAt
+	}
+	if deletedAt != nil {
+		rec.DeletedAt = *deletedAt
+	}
+	if purgeAt != nil {
+		rec.PurgeAt = *purgeAt
+	}
 	return &rec, nil
 }
 
-func (r *SQLRepository) PutObject(ctx context.Context, rec *ObjectRecord) error {
+// nullTime maps the zero time to NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// tagsOf never returns nil so the tags column always holds a JSON object.
+func tagsOf(rec *ObjectRecord) map[string]string {
+	if rec.Tags == nil {
+		return map[string]string{}
+	}
+	return rec.Tags
+}
+
+func scanObjects(rows pgx.Rows) ([]*ObjectRecord, error) {
+	defer rows.Close()
+	var out []*ObjectRecord
+	for rows.Next() {
+		rec, err := scanObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLRepository) GetObject(ctx context.Context, env, region, bucket, key string) (*ObjectRecord, error) {
+	const q = `
+SELECT ` + objectColumns + `
+FROM objects
+WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4
+  AND is_latest AND status IN ('ACTIVE', 'QUARANTINED')
+`
+	rec, err := scanObject(r.db.QueryRow(ctx, q, env, region, bucket, key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return rec, err
+}
+
+func (r *SQLRepository) PutObject(ctx context.Context, rec *ObjectRecord) (*ObjectRecord, error) {
 	if rec == nil {
-		return errors.New("nil record")
+		return nil, errors.New("nil record")
 	}
 	now := time.Now()
 	if rec.CreatedAt.IsZero() {
@@ -56,51 +123,410 @@ func (r *SQLRepository) PutObject(ctx context.Context, rec *ObjectRecord) error
 		rec.Version = 1
 	}
 	if rec.Status == "" {
-		rec.Status = "ACTIVE"
+		rec.Status = StatusActive
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// lock the latest row so concurrent writers compute usage deltas and
+	// see the record they replace in turn; a delete marker is replaced like
+	// any other version but holds no data
+	var replaced *ObjectRecord
+	bytes, objects := rec.SizeBytes, int64(1)
+	prev, err := scanObject(tx.QueryRow(ctx, `
+SELECT `+objectColumns+` FROM objects
+WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4
+  AND is_latest
+FOR UPDATE`, rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey))
+	switch {
+	case err == nil:
+		if prev.Status != StatusDeleteMarker {
+			bytes, objects = bytes-prev.SizeBytes, 0
+		}
+		if prev.Status == StatusActive || prev.Status == StatusQuarantined {
+			replaced = prev
+		}
+	case !errors.Is(err, pgx.ErrNoRows):
+		return nil, err
 	}
+
 	const q = `
 INSERT INTO objects (
     env, logical_region, bucket, object_key,
     size_bytes, content_type, storage_class, store_backend,
     provider_type, provider_region, provider_bucket, physical_key,
-    etag, version, status, created_at, updated_at
+    etag, version, version_id, is_latest, status,
+    retention_mode, retain_until, legal_hold, tags, created_at, updated_at,
+    checksum, pack_id, pack_offset, provider_name
 ) VALUES (
     $1,$2,$3,$4,
     $5,$6,$7,$8,
     $9,$10,$11,$12,
-    $13,$14,$15,$16,$17
+    $13,$14,$15,true,$16,
+    $17,$18,$19,$20,$21,$22,
+    $23,$24,$25,$26
 )
-ON CONFLICT (env, logical_region, bucket, object_key, status)
-WHERE status = 'ACTIVE'
+ON CONFLICT (env, logical_region, bucket, object_key)
+WHERE is_latest
 DO UPDATE SET
     size_bytes = EXCLUDED.size_bytes,
     content_type = EXCLUDED.content_type,
     storage_class = EXCLUDED.storage_class,
     store_backend = EXCLUDED.store_backend,
+    provider_name = EXCLUDED.provider_name,
     provider_type = EXCLUDED.provider_type,
     provider_region = EXCLUDED.provider_region,
     provider_bucket = EXCLUDED.provider_bucket,
     physical_key = EXCLUDED.physical_key,
+    pack_id = EXCLUDED.pack_id,
+    pack_offset = EXCLUDED.pack_offset,
     etag = EXCLUDED.etag,
+    checksum = EXCLUDED.checksum,
+    status = EXCLUDED.status,
     version = objects.version + 1,
-    updated_at = EXCLUDED.updated_at
+    version_id = EXCLUDED.version_id,
+    retention_mode = EXCLUDED.retention_mode,
+    retain_until = EXCLUDED.retain_until,
+    legal_hold = EXCLUDED.legal_hold,
+    tags = EXCLUDED.tags,
+    created_at = EXCLUDED.created_at,
+    updated_at = EXCLUDED.updated_at,
+    last_accessed_at = NULL
+RETURNING id, version
 `
-	_, err := r.conn.Exec(ctx, q,
+	if err := tx.QueryRow(ctx, q,
 		rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey,
 		rec.SizeBytes, rec.ContentType, rec.StorageClass, string(rec.StoreBackend),
 		rec.ProviderType, rec.ProviderRegion, rec.ProviderBucket, rec.PhysicalKey,
-		rec.ETag, rec.Version, rec.Status, rec.CreatedAt, rec.UpdatedAt,
-	)
+		rec.ETag, rec.Version, rec.VersionID, rec.Status,
+		rec.RetentionMode, nullTime(rec.RetainUntil), rec.LegalHold, tagsOf(rec), rec.CreatedAt, rec.UpdatedAt,
+		rec.Checksum, rec.PackID, rec.PackOffset, rec.ProviderName,
+	).Scan(&rec.ID, &rec.Version); err != nil {
+		return nil, err
+	}
+	rec.IsLatest = true
+	if err := addUsage(ctx, tx, rec.Env, rec.LogicalRegion, rec.Bucket, bytes, objects); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return replaced, nil
+}
+
+func (r *SQLRepository) MarkDeleted(ctx context.Context, env, region, bucket, key string, purgeAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	const q = `
+UPDATE objects
+SET status = 'DELETED', is_latest = false, updated_at = now(), deleted_at = now(), purge_at = $5
+WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4
+  AND is_latest AND status IN ('ACTIVE', 'QUARANTINED')
+RETURNING size_bytes
+`
+	var size int64
+	if err := tx.QueryRow(ctx, q, env, region, bucket, key, purgeAt).Scan(&size); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := addUsage(ctx, tx, env, region, bucket, -size, -1); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func addUsage(ctx context.Context, tx pgx.Tx, env, region, bucket string, bytes, objects int64) error {
+	const q = `
+INSERT INTO bucket_usage (env, logical_region, bucket, bytes, objects, updated_at)
+VALUES ($1, $2, $3, $4, $5, now())
+ON CONFLICT (env, logical_region, bucket) DO UPDATE SET
+    bytes = bucket_usage.bytes + EXCLUDED.bytes,
+    objects = bucket_usage.objects + EXCLUDED.objects,
+    updated_at = EXCLUDED.updated_at
+`
+	_, err := tx.Exec(ctx, q, env, region, bucket, bytes, objects)
 	return err
 }
 
-func (r *SQLRepository) MarkDeleted(ctx context.Context, env, region, bucket, key string) error {
+func (r *SQLRepository) GetUsage(ctx context.Context, env, region, bucket string) (*BucketUsage, error) {
+	const q = `
+SELECT bytes, objects, updated_at FROM bucket_usage
+WHERE env = $1 AND logical_region = $2 AND bucket = $3
+`
+	u := &BucketUsage{Env: env, LogicalRegion: region, Bucket: bucket}
+	err := r.db.QueryRow(ctx, q, env, region, bucket).Scan(&u.Bytes, &u.Objects, &u.UpdatedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (r *SQLRepository) ListUsage(ctx context.Context) ([]*BucketUsage, error) {
+	const q = `
+SELECT env, logical_region, bucket, bytes, objects, updated_at FROM bucket_usage
+ORDER BY env, logical_region, bucket
+`
+	rows, err := r.db.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*BucketUsage
+	for rows.Next() {
+		var u BucketUsage
+		if err := rows.Scan(&u.Env, &u.LogicalRegion, &u.Bucket, &u.Bytes, &u.Objects, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &u)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLRepository) RecomputeUsage(ctx context.Context) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Writers bump bucket_usage inside their own transaction, so holding
+	// this lock until commit means every write is either in the snapshot
+	// below or applies its delta afterwards.
+	if _, err := tx.Exec(ctx, `LOCK TABLE bucket_usage IN EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	const reset = `
+UPDATE bucket_usage u SET bytes = 0, objects = 0, updated_at = now()
+WHERE NOT EXISTS (
+    SELECT 1 FROM objects o
+    WHERE o.env = u.env AND o.logical_region = u.logical_region AND o.bucket = u.bucket
+      AND o.status IN ('ACTIVE', 'QUARANTINED')
+)
+`
+	if _, err := tx.Exec(ctx, reset); err != nil {
+		return err
+	}
+	const recompute = `
+INSERT INTO bucket_usage (env, logical_region, bucket, bytes, objects, updated_at)
+SELECT env, logical_region, bucket, COALESCE(SUM(size_bytes), 0), COUNT(*), now()
+FROM objects
+WHERE status IN ('ACTIVE', 'QUARANTINED')
+GROUP BY env, logical_region, bucket
+ON CONFLICT (env, logical_region, bucket) DO UPDATE SET
+    bytes = EXCLUDED.bytes,
+    objects = EXCLUDED.objects,
+    updated_at = EXCLUDED.updated_at
+`
+	if _, err := tx.Exec(ctx, recompute); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *SQLRepository) ListObjects(ctx context.Context, env, region, bucket string, opts ListOptions) ([]*ObjectRecord, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	const q = `
+SELECT ` + objectColumns + `
+FROM objects
+WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND is_latest AND status = 'ACTIVE'
+  AND starts_with(object_key, $4) AND object_key > $5
+ORDER BY object_key
+LIMIT $6
+`
+	rows, err := r.db.Query(ctx, q, env, region, bucket, opts.Prefix, opts.StartAfter, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanObjects(rows)
+}
+
+func (r *SQLRepository) GetObjectVersion(ctx context.Context, env, region, bucket, key, versionID string) (*ObjectRecord, error) {
+	const q = `
+SELECT ` + objectColumns + `
+FROM objects
+WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4
+  AND version_id = $5 AND status <> 'DELETED'
+`
+	rec, err := scanObject(r.db.QueryRow(ctx, q, env, region, bucket, key, versionID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return rec, err
+}
+
+func (r *SQLRepository) AddVersion(ctx context.Context, rec *ObjectRecord) error {
+	if rec == nil {
+		return errors.New("nil record")
+	}
+	now := time.Now()
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+	rec.UpdatedAt = now
+	if rec.Status == "" {
+		rec.Status = StatusActive
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var prevVersion int64
+	err = tx.QueryRow(ctx, `
+UPDATE objects SET is_latest = false
+WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4
+  AND is_latest
+RETURNING version`, rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey).Scan(&prevVersion)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	rec.Version = prevVersion + 1
+
+	const q = `
+INSERT INTO objects (
+    env, logical_region, bucket, object_key,
+    size_bytes, content_type, storage_class, store_backend,
+    provider_type, provider_region, provider_bucket, physical_key,
+    etag, version, version_id, is_latest, status,
+    retention_mode, retain_until, legal_hold, tags, created_at, updated_at,
+    checksum, pack_id, pack_offset, provider_name
+) VALUES (
+    $1,$2,$3,$4,
+    $5,$6,$7,$8,
+    $9,$10,$11,$12,
+    $13,$14,$15,true,$16,
+    $17,$18,$19,$20,$21,$22,
+    $23,$24,$25,$26
+)
+RETURNING id
+`
+	if err := tx.QueryRow(ctx, q,
+		rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey,
+		rec.SizeBytes, rec.ContentType, rec.StorageClass, string(rec.StoreBackend),
+		rec.ProviderType, rec.ProviderRegion, rec.ProviderBucket, rec.PhysicalKey,
+		rec.ETag, rec.Version, rec.VersionID, rec.Status,
+		rec.RetentionMode, nullTime(rec.RetainUntil), rec.LegalHold, tagsOf(rec), rec.CreatedAt, rec.UpdatedAt,
+		rec.Checksum, rec.PackID, rec.PackOffset, rec.ProviderName,
+	).Scan(&rec.ID); err != nil {
+		return err
+	}
+	rec.IsLatest = true
+	if rec.Status != StatusDeleteMarker {
+		if err := addUsage(ctx, tx, rec.Env, rec.LogicalRegion, rec.Bucket, rec.SizeBytes, 1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *SQLRepository) DeleteVersion(ctx context.Context, env, region, bucket, key, versionID string) (*ObjectRecord, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	const q = `
+DELETE FROM objects
+WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4
+  AND version_id = $5 AND status <> 'DELETED'
+RETURNING ` + objectColumns
+	rec, err := scanObject(tx.QueryRow(ctx, q, env, region, bucket, key, versionID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if rec.IsLatest {
+		// the next newest version, if any, becomes current again
+		const promote = `
+UPDATE objects SET is_latest = true
+WHERE id = (
+    SELECT id FROM objects
+    WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4
+      AND status <> 'DELETED'
+    ORDER BY id DESC
+    LIMIT 1
+)
+`
+		if _, err := tx.Exec(ctx, promote, env, region, bucket, key); err != nil {
+			return nil, err
+		}
+		rec.IsLatest = false
+	}
+	if rec.Status != StatusDeleteMarker {
+		if err := addUsage(ctx, tx, env, region, bucket, -rec.SizeBytes, -1); err != nil {
+			return nil, err
+		}
+	}
+	return rec, tx.Commit(ctx)
+}
+
+func (r *SQLRepository) ListVersions(ctx context.Context, env, region, bucket string, opts ListOptions) ([]*ObjectRecord, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	// versions of a key are listed newest first; paging resumes after the
+	// marker version, or after the whole marker key when no version is given
+	const q = `
+SELECT ` + objectColumns + `
+FROM objects
+WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND status <> 'DELETED'
+  AND starts_with(object_key, $4)
+  AND (object_key > $5 OR (object_key = $5 AND id < (
+      SELECT id FROM objects
+      WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $5
+        AND version_id = $6 AND status <> 'DELETED'
+  )))
+ORDER BY object_key, id DESC
+LIMIT $7
+`
+	rows, err := r.db.Query(ctx, q, env, region, bucket, opts.Prefix, opts.StartAfter, opts.StartAfterVersionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanObjects(rows)
+}
+
+func (r *SQLRepository) SetObjectLock(ctx context.Context, id int64, mode string, retainUntil time.Time, legalHold bool) error {
 	const q = `
 UPDATE objects
-SET status = 'DELETED', updated_at = now()
-WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4 AND status = 'ACTIVE'
+SET retention_mode = $2, retain_until = $3, legal_hold = $4, updated_at = now()
+WHERE id = $1 AND status <> 'DELETED'
+`
+	cmd, err := r.db.Exec(ctx, q, id, mode, nullTime(retainUntil), legalHold)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLRepository) TouchObject(ctx context.Context, env, region, bucket, key string, at time.Time) error {
+	const q = `
+UPDATE objects SET last_accessed_at = $5
+WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4
+  AND is_latest
 `
-	cmd, err := r.conn.Exec(ctx, q, env, region, bucket, key)
+	cmd, err := r.db.Exec(ctx, q, env, region, bucket, key, at)
 	if err != nil {
 		return err
 	}
@@ -109,3 +535,480 @@ WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4 AND s
 	}
 	return nil
 }
+
+func (r *SQLRepository) Relocate(ctx context.Context, rec *ObjectRecord, oldPhysicalKey string) error {
+	const q = `
+UPDATE objects
+SET storage_class = $3, store_backend = $4,
+    provider_type = $5, provider_region = $6, provider_bucket = $7, physical_key = $8,
+    etag = $9, pack_id = $10, pack_offset = $11, provider_name = $12, updated_at = now()
+WHERE id = $1 AND physical_key = $2
+`
+	cmd, err := r.db.Exec(ctx, q, rec.ID, oldPhysicalKey,
+		rec.StorageClass, string(rec.StoreBackend),
+		rec.ProviderType, rec.ProviderRegion, rec.ProviderBucket, rec.PhysicalKey, rec.ETag,
+		rec.PackID, rec.PackOffset, rec.ProviderName)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLRepository) ScanObjects(ctx context.Context, afterID int64, limit int) ([]*ObjectRecord, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	const q = `
+SELECT ` + objectColumns + `
+FROM objects
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+	rows, err := r.db.Query(ctx, q, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanObjects(rows)
+}
+
+func (r *SQLRepository) ListDeleted(ctx context.Context, env, region, bucket string, opts ListOptions) ([]*ObjectRecord, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	const q = `
+SELECT ` + objectColumns + `
+FROM objects
+WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND status = 'DELETED'
+  AND starts_with(object_key, $4) AND (object_key, id) > ($5, $6)
+ORDER BY object_key, id
+LIMIT $7
+`
+	rows, err := r.db.Query(ctx, q, env, region, bucket, opts.Prefix, opts.StartAfter, opts.StartAfterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanObjects(rows)
+}
+
+func (r *SQLRepository) Restore(ctx context.Context, env, region, bucket, key string, id int64) (*ObjectRecord, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// id 0 restores the most recent deletion of the key
+	const q = `
+UPDATE objects
+SET status = 'ACTIVE', is_latest = true, updated_at = now(), deleted_at = NULL, purge_at = NULL
+WHERE id = (
+    SELECT id FROM objects
+    WHERE env = $1 AND logical_region = $2 AND bucket = $3 AND object_key = $4
+      AND status = 'DELETED' AND ($5 = 0 OR id = $5)
+    ORDER BY id DESC
+    LIMIT 1
+)
+RETURNING ` + objectColumns
+	rec, err := scanObject(tx.QueryRow(ctx, q, env, region, bucket, key, id))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+			return nil, ErrExists
+		}
+		return nil, err
+	}
+	if err := addUsage(ctx, tx, env, region, bucket, rec.SizeBytes, 1); err != nil {
+		return nil, err
+	}
+	return rec, tx.Commit(ctx)
+}
+
+func (r *SQLRepository) ListPurgeable(ctx context.Context, now time.Time, limit int) ([]*ObjectRecord, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	const q = `
+SELECT ` + objectColumns + `
+FROM objects
+WHERE status = 'DELETED' AND purge_at <= $1
+ORDER BY purge_at
+LIMIT $2
+`
+	rows, err := r.db.Query(ctx, q, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanObjects(rows)
+}
+
+func (r *SQLRepository) DeleteRecord(ctx context.Context, id int64) error {
+	cmd, err := r.db.Exec(ctx, `DELETE FROM objects WHERE id = $1 AND status = 'DELETED'`, id)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLRepository) PhysicalKeyInUse(ctx context.Context, providerBucket, physicalKey string) (bool, error) {
+	const q = `
+SELECT EXISTS (SELECT 1 FROM objects WHERE provider_bucket = $1 AND physical_key = $2)
+    OR EXISTS (SELECT 1 FROM object_replicas WHERE target_bucket = $1 AND source_bucket <> $1 AND physical_key = $2)
+    OR EXISTS (SELECT 1 FROM object_refs WHERE provider_bucket = $1 AND physical_key = $2 AND refs > 0)
+`
+	var inUse bool
+	err := r.db.QueryRow(ctx, q, providerBucket, physicalKey).Scan(&inUse)
+	return inUse, err
+}
+
+// refTombstoneTTL is how long a tombstone left by RetireRef blocks
+// AcquireRef. A releaser that crashed before DropRef leaves it behind; the
+// next upload of the content after that takes the row over.
+const refTombstoneTTL = time.Hour
+
+func (r *SQLRepository) AcquireRef(ctx context.Context, providerBucket, physicalKey string, size int64) (int64, error) {
+	const q = `
+INSERT INTO object_refs (provider_bucket, physical_key, refs, size_bytes)
+VALUES ($1, $2, 1, $3)
+ON CONFLICT (provider_bucket, physical_key)
+DO UPDATE SET
+    refs = CASE WHEN object_refs.retired_at IS NULL THEN object_refs.refs + 1 ELSE 1 END,
+    size_bytes = EXCLUDED.size_bytes,
+    retired_at = NULL,
+    updated_at = now()
+WHERE object_refs.retired_at IS NULL OR object_refs.retired_at < $4
+RETURNING refs
+`
+	var refs int64
+	err := r.db.QueryRow(ctx, q, providerBucket, physicalKey, size, time.Now().Add(-refTombstoneTTL)).Scan(&refs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrRefRetired
+	}
+	return refs, err
+}
+
+func (r *SQLRepository) ReleaseRef(ctx context.Context, providerBucket, physicalKey string) (int64, error) {
+	const q = `
+UPDATE object_refs SET refs = refs - 1, updated_at = now()
+WHERE provider_bucket = $1 AND physical_key = $2 AND retired_at IS NULL
+RETURNING refs
+`
+	var refs int64
+	err := r.db.QueryRow(ctx, q, providerBucket, physicalKey).Scan(&refs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil || refs > 0 {
+		return refs, err
+	}
+	// an AcquireRef since the update keeps the row
+	const del = `DELETE FROM object_refs WHERE provider_bucket = $1 AND physical_key = $2 AND refs <= 0 AND retired_at IS NULL`
+	cmd, err := r.db.Exec(ctx, del, providerBucket, physicalKey)
+	if err != nil {
+		return 0, err
+	}
+	if cmd.RowsAffected() == 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (r *SQLRepository) RetireRef(ctx context.Context, providerBucket, physicalKey string) (int64, error) {
+	// the upsert locks the row, so the decrement and the tombstone are one
+	// step for concurrent AcquireRef calls
+	const q = `
+INSERT INTO object_refs (provider_bucket, physical_key, refs, size_bytes, retired_at)
+VALUES ($1, $2, 0, 0, now())
+ON CONFLICT (provider_bucket, physical_key)
+DO UPDATE SET
+    refs = GREATEST(object_refs.refs - 1, 0),
+    retired_at = CASE WHEN object_refs.refs <= 1 THEN now() END,
+    updated_at = now()
+WHERE object_refs.retired_at IS NULL
+RETURNING refs
+`
+	var refs int64
+	err := r.db.QueryRow(ctx, q, providerBucket, physicalKey).Scan(&refs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrRefRetired
+	}
+	return refs, err
+}
+
+func (r *SQLRepository) DropRef(ctx context.Context, providerBucket, physicalKey string) error {
+	const q = `DELETE FROM object_refs WHERE provider_bucket = $1 AND physical_key = $2 AND retired_at IS NOT NULL`
+	_, err := r.db.Exec(ctx, q, providerBucket, physicalKey)
+	return err
+}
+
+func (r *SQLRepository) AddScrubFinding(ctx context.Context, f *ScrubFinding) error {
+	const q = `
+INSERT INTO scrub_findings (
+    object_id, env, logical_region, bucket, object_key, version_id,
+    provider_bucket, physical_key, kind, expected, actual, repaired, detected_at
+) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,COALESCE($13, now()))
+RETURNING id, detected_at
+`
+	return r.db.QueryRow(ctx, q,
+		f.ObjectID, f.Env, f.LogicalRegion, f.Bucket, f.ObjectKey, f.VersionID,
+		f.ProviderBucket, f.PhysicalKey, f.Kind, f.Expected, f.Actual, f.Repaired, nullTime(f.DetectedAt),
+	).Scan(&f.ID, &f.DetectedAt)
+}
+
+func (r *SQLRepository) ListScrubFindings(ctx context.Context, beforeID int64, limit int) ([]*ScrubFinding, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	const q = `
+SELECT id, object_id, env, logical_region, bucket, object_key, version_id,
+       provider_bucket, physical_key, kind, expected, actual, repaired, detected_at
+FROM scrub_findings
+WHERE $1 = 0 OR id < $1
+ORDER BY id DESC
+LIMIT $2
+`
+	rows, err := r.db.Query(ctx, q, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]*ScrubFinding, 0)
+	for rows.Next() {
+		var f ScrubFinding
+		if err := rows.Scan(&f.ID, &f.ObjectID, &f.Env, &f.LogicalRegion, &f.Bucket, &f.ObjectKey, &f.VersionID,
+			&f.ProviderBucket, &f.PhysicalKey, &f.Kind, &f.Expected, &f.Actual, &f.Repaired, &f.DetectedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &f)
+	}
+	return out, rows.Err()
+}
+
+const replicaColumns = `id, env, logical_region, bucket, object_key, version_id,
+       size_bytes, content_type, storage_class, source_provider, source_bucket, physical_key,
+       target_provider, target_provider_type, target_region, target_bucket,
+       status, etag, attempts, last_error, created_at, next_attempt_at, replicated_at`
+
+func scanReplicas(rows pgx.Rows) ([]*ReplicaRecord, error) {
+	defer rows.Close()
+	out := make([]*ReplicaRecord, 0)
+	for rows.Next() {
+		var rep ReplicaRecord
+		var replicatedAt *time.Time
+		if err := rows.Scan(&rep.ID, &rep.Env, &rep.LogicalRegion, &rep.Bucket, &rep.ObjectKey, &rep.VersionID,
+			&rep.SizeBytes, &rep.ContentType, &rep.StorageClass, &rep.SourceProvider, &rep.SourceBucket, &rep.PhysicalKey,
+			&rep.TargetProvider, &rep.TargetProviderType, &rep.TargetRegion, &rep.TargetBucket,
+			&rep.Status, &rep.ETag, &rep.Attempts, &rep.LastError, &rep.CreatedAt, &rep.NextAttemptAt, &replicatedAt); err != nil {
+			return nil, err
+		}
+		if replicatedAt != nil {
+			rep.ReplicatedAt = *replicatedAt
+		}
+		out = append(out, &rep)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLRepository) AddReplicas(ctx context.Context, reps []*ReplicaRecord) error {
+	const q = `
+INSERT INTO object_replicas (
+    env, logical_region, bucket, object_key, version_id,
+    size_bytes, content_type, storage_class, source_provider, source_bucket, physical_key,
+    target_provider, target_provider_type, target_region, target_bucket,
+    status, etag, next_attempt_at, replicated_at
+) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,
+    COALESCE(NULLIF($16, ''), 'PENDING'), $17, COALESCE($18, now()), $19)
+ON CONFLICT (source_bucket, physical_key, target_provider, target_bucket) DO NOTHING
+RETURNING id, status, created_at, next_attempt_at
+`
+	for _, rep := range reps {
+		err := r.db.QueryRow(ctx, q,
+			rep.Env, rep.LogicalRegion, rep.Bucket, rep.ObjectKey, rep.VersionID,
+			rep.SizeBytes, rep.ContentType, rep.StorageClass, rep.SourceProvider, rep.SourceBucket, rep.PhysicalKey,
+			rep.TargetProvider, rep.TargetProviderType, rep.TargetRegion, rep.TargetBucket,
+			rep.Status, rep.ETag, nullTime(rep.NextAttemptAt), nullTime(rep.ReplicatedAt),
+		).Scan(&rep.ID, &rep.Status, &rep.CreatedAt, &rep.NextAttemptAt)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLRepository) ListReplicas(ctx context.Context, sourceBucket, physicalKey string) ([]*ReplicaRecord, error) {
+	q := `SELECT ` + replicaColumns + `
+FROM object_replicas
+WHERE source_bucket = $1 AND physical_key = $2
+ORDER BY id
+`
+	rows, err := r.db.Query(ctx, q, sourceBucket, physicalKey)
+	if err != nil {
+		return nil, err
+	}
+	return scanReplicas(rows)
+}
+
+func (r *SQLRepository) ListReplicaJobs(ctx context.Context, now time.Time, limit int) ([]*ReplicaRecord, error) {
+	q := `SELECT ` + replicaColumns + `
+FROM object_replicas
+WHERE status <> 'COMPLETED' AND next_attempt_at <= $1
+ORDER BY next_attempt_at, id
+LIMIT $2
+`
+	rows, err := r.db.Query(ctx, q, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanReplicas(rows)
+}
+
+func (r *SQLRepository) UpdateReplica(ctx context.Context, rep *ReplicaRecord) error {
+	const q = `
+UPDATE object_replicas
+SET status = $2, etag = $3, attempts = $4, last_error = $5, next_attempt_at = $6, replicated_at = $7
+WHERE id = $1 AND (status <> 'DELETING' OR $2 = 'DELETING')
+`
+	cmd, err := r.db.Exec(ctx, q, rep.ID, rep.Status, rep.ETag, rep.Attempts, rep.LastError,
+		rep.NextAttemptAt, nullTime(rep.ReplicatedAt))
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLRepository) MarkReplicasDeleting(ctx context.Context, sourceBucket, physicalKey string) error {
+	const q = `
+UPDATE object_replicas
+SET status = 'DELETING', next_attempt_at = now(), attempts = 0, last_error = ''
+WHERE source_bucket = $1 AND physical_key = $2
+`
+	_, err := r.db.Exec(ctx, q, sourceBucket, physicalKey)
+	return err
+}
+
+func (r *SQLRepository) DeleteReplica(ctx context.Context, id int64) error {
+	cmd, err := r.db.Exec(ctx, `DELETE FROM object_replicas WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLRepository) ReplicationBacklog(ctx context.Context) ([]*ReplicaBacklog, error) {
+	const q = `
+SELECT target_provider, target_bucket,
+       COUNT(*) FILTER (WHERE status IN ('PENDING', 'FAILED')),
+       MIN(created_at) FILTER (WHERE status IN ('PENDING', 'FAILED'))
+FROM object_replicas
+GROUP BY target_provider, target_bucket
+ORDER BY target_provider, target_bucket
+`
+	rows, err := r.db.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]*ReplicaBacklog, 0)
+	for rows.Next() {
+		var b ReplicaBacklog
+		var oldest *time.Time
+		if err := rows.Scan(&b.TargetProvider, &b.TargetBucket, &b.Pending, &oldest); err != nil {
+			return nil, err
+		}
+		if oldest != nil {
+			b.OldestCreated = *oldest
+		}
+		out = append(out, &b)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLRepository) AddPack(ctx context.Context, p *PackRecord) error {
+	const q = `
+INSERT INTO packs (
+    env, logical_region, bucket, storage_class,
+    provider_type, provider_region, provider_bucket, physical_key, etag,
+    size_bytes, entries, provider_name
+) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+RETURNING id, created_at
+`
+	return r.db.QueryRow(ctx, q,
+		p.Env, p.LogicalRegion, p.Bucket, p.StorageClass,
+		p.ProviderType, p.ProviderRegion, p.ProviderBucket, p.PhysicalKey, p.ETag,
+		p.SizeBytes, p.Entries, p.ProviderName,
+	).Scan(&p.ID, &p.CreatedAt)
+}
+
+func (r *SQLRepository) ScanPacks(ctx context.Context, afterID int64, limit int) ([]*PackRecord, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	const q = `
+SELECT p.id, p.env, p.logical_region, p.bucket, p.storage_class,
+       p.provider_type, p.provider_region, p.provider_bucket, p.physical_key, p.etag,
+       p.size_bytes, p.entries, p.created_at, p.provider_name,
+       COUNT(o.id), COALESCE(SUM(o.size_bytes), 0)
+FROM packs p
+LEFT JOIN objects o ON o.pack_id = p.id
+WHERE p.id > $1
+GROUP BY p.id
+ORDER BY p.id
+LIMIT $2
+`
+	rows, err := r.db.Query(ctx, q, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]*PackRecord, 0)
+	for rows.Next() {
+		var p PackRecord
+		if err := rows.Scan(
+			&p.ID, &p.Env, &p.LogicalRegion, &p.Bucket, &p.StorageClass,
+			&p.ProviderType, &p.ProviderRegion, &p.ProviderBucket, &p.PhysicalKey, &p.ETag,
+			&p.SizeBytes, &p.Entries, &p.CreatedAt, &p.ProviderName,
+			&p.LiveEntries, &p.LiveBytes,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &p)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLRepository) ListPackEntries(ctx context.Context, id int64) ([]*ObjectRecord, error) {
+	const q = `
+SELECT ` + objectColumns + `
+FROM objects
+WHERE pack_id = $1
+ORDER BY pack_offset
+`
+	rows, err := r.db.Query(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+	return scanObjects(rows)
+}
+
+func (r *SQLRepository) DeletePack(ctx context.Context, id int64) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM packs WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,158 @@
+// Package metrics holds the gateway's Prometheus collectors. They are
+// registered with the default registry and served on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "smartstore"
+
+var bucketLabels = []string{"env", "region", "bucket"}
+
+var (
+	BucketUsageBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bucket_usage_bytes",
+		Help:      "Live bytes stored in a logical bucket.",
+	}, bucketLabels)
+	BucketUsageObjects = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bucket_usage_objects",
+		Help:      "Live objects stored in a logical bucket.",
+	}, bucketLabels)
+	BucketQuotaBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bucket_quota_bytes",
+		Help:      "Configured byte quota of a logical bucket.",
+	}, bucketLabels)
+	BucketQuotaObjects = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bucket_quota_objects",
+		Help:      "Configured object count quota of a logical bucket.",
+	}, bucketLabels)
+	BucketQuotaSoftLimitExceeded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bucket_quota_soft_limit_exceeded",
+		Help:      "1 when a bucket is above the soft limit of any of its quotas.",
+	}, bucketLabels)
+	QuotaRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quota_rejections_total",
+		Help:      "Uploads rejected because a bucket quota was exhausted.",
+	}, append(bucketLabels, "quota"))
+	GovernanceBypassTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "governance_bypass_total",
+		Help:      "Writes that lifted governance retention with the admin override.",
+	}, append(bucketLabels, "action"))
+	LegalHoldsLiftedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "legal_holds_lifted_total",
+		Help:      "Legal holds lifted by holders of the admin token.",
+	}, bucketLabels)
+	OrphanObjectsDeletedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orphan_objects_deleted_total",
+		Help:      "Provider objects deleted by the orphan GC because no metadata referenced them.",
+	}, []string{"provider", "provider_bucket"})
+	OrphanBytesDeletedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orphan_bytes_deleted_total",
+		Help:      "Bytes of provider objects deleted by the orphan GC.",
+	}, []string{"provider", "provider_bucket"})
+	ScrubObjectsCheckedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scrub_objects_checked_total",
+		Help:      "Metadata records the scrubber compared with their physical objects.",
+	})
+	ScrubFindingsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scrub_findings_total",
+		Help:      "Inconsistencies between metadata and provider objects found by the scrubber.",
+	}, append(bucketLabels, "kind"))
+	ScrubRepairsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scrub_repairs_total",
+		Help:      "Physical objects the scrubber rewrote from a healthy copy.",
+	}, bucketLabels)
+	ReplicationLagSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "replication_lag_seconds",
+		Help:      "Time from the primary write to the completed copy in a replica target.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 14),
+	}, []string{"provider", "provider_bucket"})
+	ReplicationBacklog = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "replication_backlog",
+		Help:      "Replicas waiting to be copied to a replica target.",
+	}, []string{"provider", "provider_bucket"})
+	ReplicationOldestPendingSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "replication_oldest_pending_seconds",
+		Help:      "Age of the oldest replica waiting to be copied to a replica target.",
+	}, []string{"provider", "provider_bucket"})
+	ReplicationFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "replication_failures_total",
+		Help:      "Failed attempts to copy an object to, or delete it from, a replica target.",
+	}, []string{"provider", "provider_bucket"})
+	QuorumWritesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quorum_writes_total",
+		Help:      "Uploads to routes with a write quorum, by result (ok or failed).",
+	}, append(bucketLabels, "result"))
+	ReadFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "read_failures_total",
+		Help:      "Object reads a location failed, by class (not_found or unavailable).",
+	}, []string{"provider", "provider_bucket", "class"})
+	ReplicaReadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "replica_reads_total",
+		Help:      "Object reads served by a replica after the primary location failed.",
+	}, []string{"provider", "provider_bucket"})
+	WriteFailoversTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "write_failovers_total",
+		Help:      "Uploads a location failed or skipped while unhealthy, leaving them to the route's next fallback.",
+	}, []string{"provider", "provider_bucket"})
+	DedupHitsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dedup_hits_total",
+		Help:      "Uploads to deduplicated buckets whose content was already stored.",
+	}, bucketLabels)
+	DedupBytesSavedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dedup_bytes_saved_total",
+		Help:      "Bytes not stored again because identical content already was.",
+	}, bucketLabels)
+	RebalancedObjectsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rebalanced_objects_total",
+		Help:      "Objects moved from a fallback back to their route's provider.",
+	}, []string{"provider", "provider_bucket"})
+	PackedObjectsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "packed_objects_total",
+		Help:      "Small objects stored in a pack rather than as their own provider object.",
+	}, bucketLabels)
+	PacksSealedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "packs_sealed_total",
+		Help:      "Packs uploaded, by result (ok or failed).",
+	}, append(bucketLabels, "result"))
+	PackBytesReclaimedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pack_bytes_reclaimed_total",
+		Help:      "Bytes of deleted objects freed by deleting or rewriting packs.",
+	}, bucketLabels)
+)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,254 @@
+// Package migrate applies the versioned SQL migrations embedded from
+// migrations/. Files are named NNNN_name.up.sql / NNNN_name.down.sql and run
+// in version order; applied versions and their checksums are recorded in
+// schema_migrations. A Postgres advisory lock keeps concurrent gateways from
+// migrating at the same time.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// lockID is the pg_advisory_lock key held while migrating.
+const lockID int64 = 0x736d617274 // "smart"
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	conn       *pgx.Conn
+	migrations []Migration
+}
+
+// New loads the embedded migrations. conn must be a dedicated connection:
+// the advisory lock is session scoped.
+func New(conn *pgx.Conn) (*Migrator, error) {
+	ms, err := load(migrationsFS)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{conn: conn, migrations: ms}, nil
+}
+
+var fileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := fileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name must match NNNN_name.(up|down).sql", e.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		data, err := fs.ReadFile(fsys, "migrations/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+		if (m[3] == "up" && mig.Checksum != "") || (m[3] == "down" && mig.Down != "") {
+			return nil, fmt.Errorf("migration %d has more than one %s file", version, m[3])
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+			sum := sha256.Sum256(data)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Up applies every pending migration and returns how many ran.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(applied map[int64]appliedRow) error {
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, mig.Version, mig.Up, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx,
+					`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+					mig.Version, mig.Name, mig.Checksum)
+				return err
+			}); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down rolls back the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(applied map[int64]appliedRow) error {
+		for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+			}
+			if err := m.apply(ctx, mig.Version, mig.Down, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+				return err
+			}); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var out []Status
+	err := m.locked(ctx, func(applied map[int64]appliedRow) error {
+		for _, mig := range m.migrations {
+			row, ok := applied[mig.Version]
+			out = append(out, Status{Migration: mig, Applied: ok, AppliedAt: row.appliedAt})
+		}
+		return nil
+	})
+	return out, err
+}
+
+type appliedRow struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// locked runs fn while holding the advisory lock, after making sure the
+// tracking table exists and every applied migration still matches its
+// embedded checksum.
+func (m *Migrator) locked(ctx context.Context, fn func(applied map[int64]appliedRow) error) error {
+	if _, err := m.conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		_, _ = m.conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+	}()
+
+	const ddl = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version    BIGINT PRIMARY KEY,
+  name       TEXT NOT NULL,
+  checksum   VARCHAR(64) NOT NULL,
+  applied_at TIMESTAMP NOT NULL DEFAULT now()
+)`
+	if _, err := m.conn.Exec(ctx, ddl); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	rows, err := m.conn.Query(ctx, `SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	applied := map[int64]appliedRow{}
+	for rows.Next() {
+		var v int64
+		var r appliedRow
+		if err := rows.Scan(&v, &r.checksum, &r.appliedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[v] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := verify(m.migrations, applied); err != nil {
+		return err
+	}
+	return fn(applied)
+}
+
+// verify checks that every applied migration is one of ms and unchanged
+// since it was applied.
+func verify(ms []Migration, applied map[int64]appliedRow) error {
+	known := map[int64]bool{}
+	for _, mig := range ms {
+		known[mig.Version] = true
+		if r, ok := applied[mig.Version]; ok && r.checksum != mig.Checksum {
+			return fmt.Errorf("%w: migration %d_%s was modified after being applied", ErrChecksumMismatch, mig.Version, mig.Name)
+		}
+	}
+	for v := range applied {
+		if !known[v] {
+			return fmt.Errorf("database has migration %d which this binary does not know; refusing to run", v)
+		}
+	}
+	return nil
+}
+
+// apply runs sql and the bookkeeping statement in one transaction.
+func (m *Migrator) apply(ctx context.Context, version int64, sql string, record func(pgx.Tx) error) error {
+	tx, err := m.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("migration %d: %w", version, err)
+	}
+	if err := record(tx); err != nil {
+		return fmt.Errorf("migration %d: record: %w", version, err)
+	}
+	return tx.Commit(ctx)
+}
+
+var ErrChecksumMismatch = errors.New("migration checksum mismatch")
@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func files(names ...string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, name := range names {
+		fsys["migrations/"+name] = &fstest.MapFile{Data: []byte("-- " + name)}
+	}
+	return fsys
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		versions []int64 // nil when load must fail
+		err      string
+	}{
+		{
+			name:     "ordered by version, not by name",
+			fsys:     files("10_c.up.sql", "10_c.down.sql", "2_b.up.sql", "2_b.down.sql", "0001_a.up.sql", "0001_a.down.sql"),
+			versions: []int64{1, 2, 10},
+		},
+		{
+			name:     "missing down file",
+			fsys:     files("0001_a.up.sql", "0002_b.up.sql", "0002_b.down.sql"),
+			versions: []int64{1, 2},
+		},
+		{name: "missing up file", fsys: files("0001_a.up.sql", "0002_b.down.sql"), err: "has no up file"},
+		{name: "duplicate version", fsys: files("0001_a.up.sql", "0001_b.up.sql"), err: "conflicting names"},
+		{name: "duplicate version, padded differently", fsys: files("0001_a.up.sql", "1_a.up.sql"), err: "more than one up file"},
+		{name: "duplicate down file", fsys: files("0001_a.up.sql", "0001_a.down.sql", "01_a.down.sql"), err: "more than one down file"},
+		{name: "bad name", fsys: files("0001_a.up.sql", "0002_b.sql"), err: "name must match"},
+		{name: "no directory", fsys: fstest.MapFS{}, err: "migrations"},
+	}
+	for _, tt := range tests {
+		ms, err := load(tt.fsys)
+		if tt.versions == nil {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err = %v, want one mentioning %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(ms) != len(tt.versions) {
+			t.Errorf("%s: loaded %d migrations, want %d", tt.name, len(ms), len(tt.versions))
+			continue
+		}
+		for i, m := range ms {
+			if m.Version != tt.versions[i] {
+				t.Errorf("%s: migration %d is version %d, want %d", tt.name, i, m.Version, tt.versions[i])
+			}
+			if !strings.HasSuffix(m.Up, "_"+m.Name+".up.sql") {
+				t.Errorf("%s: version %d has up %q, want %s's up file", tt.name, m.Version, m.Up, m.Name)
+			}
+		}
+	}
+
+	ms, err := load(files("0001_a.up.sql", "0002_b.up.sql", "0002_b.down.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms[0].Down != "" || ms[1].Down != "-- 0002_b.down.sql" {
+		t.Errorf("down files %q and %q, want none and 0002_b's", ms[0].Down, ms[1].Down)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	fsys := files("0001_a.up.sql", "0002_b.up.sql")
+	ms, err := load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := map[int64]appliedRow{1: {checksum: ms[0].Checksum}}
+	if err := verify(ms, applied); err != nil {
+		t.Errorf("verify of unchanged migrations: %v", err)
+	}
+
+	// editing an applied migration changes its checksum
+	fsys["migrations/0001_a.up.sql"] = &fstest.MapFile{Data: []byte("-- edited")}
+	edited, err := load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited[0].Checksum == ms[0].Checksum {
+		t.Fatal("editing the up file kept its checksum")
+	}
+	if err := verify(edited, applied); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("verify of an edited migration: err = %v, want ErrChecksumMismatch", err)
+	}
+	// editing one not yet applied is fine
+	fsys["migrations/0002_b.up.sql"] = &fstest.MapFile{Data: []byte("-- edited")}
+	if edited, err = load(fsys); err != nil || verify(edited, map[int64]appliedRow{1: {checksum: edited[0].Checksum}}) != nil {
+		t.Errorf("verify with a pending migration edited: %v", err)
+	}
+
+	applied[3] = appliedRow{}
+	if err := verify(ms, applied); err == nil || !strings.Contains(err.Error(), "does not know") {
+		t.Errorf("verify with an unknown applied migration: err = %v", err)
+	}
+}
+
+func TestLoadEmbedded(t *testing.T) {
+	ms, err := load(migrationsFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range ms {
+		if m.Version != int64(i+1) || m.Down == "" {
+			t.Errorf("migration %d_%s: want version %d with a down file", m.Version, m.Name, i+1)
+		}
+	}
+}
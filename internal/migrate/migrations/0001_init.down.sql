@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_objects_active;
+DROP TABLE IF EXISTS objects;
@@ -0,0 +1,7 @@
+DELETE FROM objects WHERE status = 'QUARANTINED';
+
+DROP INDEX IF EXISTS idx_objects_live;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_objects_active
+ON objects (env, logical_region, bucket, object_key, status)
+WHERE status = 'ACTIVE';
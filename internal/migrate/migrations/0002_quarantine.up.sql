@@ -0,0 +1,6 @@
+-- A key has one live row, which is either ACTIVE or QUARANTINED.
+DROP INDEX IF EXISTS idx_objects_active;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_objects_live
+ON objects (env, logical_region, bucket, object_key)
+WHERE status IN ('ACTIVE', 'QUARANTINED');
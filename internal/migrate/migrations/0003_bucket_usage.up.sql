@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS bucket_usage (
+  env             VARCHAR(16) NOT NULL,
+  logical_region  VARCHAR(32) NOT NULL,
+  bucket          VARCHAR(64) NOT NULL,
+  bytes           BIGINT NOT NULL DEFAULT 0,
+  objects         BIGINT NOT NULL DEFAULT 0,
+  updated_at      TIMESTAMP NOT NULL DEFAULT now(),
+  PRIMARY KEY (env, logical_region, bucket)
+);
+
+-- chunked uploads used to be recorded with size -1
+UPDATE objects SET size_bytes = 0 WHERE size_bytes < 0;
+
+INSERT INTO bucket_usage (env, logical_region, bucket, bytes, objects)
+SELECT env, logical_region, bucket, COALESCE(SUM(size_bytes), 0), COUNT(*)
+FROM objects
+WHERE status IN ('ACTIVE', 'QUARANTINED')
+GROUP BY env, logical_region, bucket;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_objects_physical;
+DROP INDEX IF EXISTS idx_objects_purge;
+DROP INDEX IF EXISTS idx_objects_trash;
+
+ALTER TABLE objects DROP COLUMN IF EXISTS purge_at;
+ALTER TABLE objects DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,18 @@
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS purge_at TIMESTAMP;
+
+-- rows deleted before the trash existed get the default 7 day retention
+UPDATE objects
+SET deleted_at = updated_at, purge_at = updated_at + INTERVAL '7 days'
+WHERE status = 'DELETED';
+
+CREATE INDEX IF NOT EXISTS idx_objects_trash
+ON objects (env, logical_region, bucket, object_key, id)
+WHERE status = 'DELETED';
+
+CREATE INDEX IF NOT EXISTS idx_objects_purge
+ON objects (purge_at)
+WHERE status = 'DELETED';
+
+CREATE INDEX IF NOT EXISTS idx_objects_physical
+ON objects (provider_bucket, physical_key);
@@ -0,0 +1,16 @@
+-- Noncurrent versions go to the trash so the purge worker reclaims their
+-- data; delete markers carry none and are dropped.
+DELETE FROM objects WHERE status = 'DELETE_MARKER';
+UPDATE objects
+SET status = 'DELETED', deleted_at = now(), purge_at = now()
+WHERE NOT is_latest AND status IN ('ACTIVE', 'QUARANTINED');
+
+DROP INDEX IF EXISTS idx_objects_version;
+DROP INDEX IF EXISTS idx_objects_latest;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_objects_live
+ON objects (env, logical_region, bucket, object_key)
+WHERE status IN ('ACTIVE', 'QUARANTINED');
+
+ALTER TABLE objects DROP COLUMN IF EXISTS is_latest;
+ALTER TABLE objects DROP COLUMN IF EXISTS version_id;
@@ -0,0 +1,18 @@
+-- Every write gets a version ID. Versioned buckets keep older versions and
+-- delete markers as extra rows, so uniqueness moves from the live status to
+-- the is_latest flag.
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS version_id VARCHAR(64);
+UPDATE objects SET version_id = id::text WHERE version_id IS NULL;
+ALTER TABLE objects ALTER COLUMN version_id SET NOT NULL;
+
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS is_latest BOOLEAN NOT NULL DEFAULT false;
+UPDATE objects SET is_latest = true WHERE status IN ('ACTIVE', 'QUARANTINED');
+
+DROP INDEX IF EXISTS idx_objects_live;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_objects_latest
+ON objects (env, logical_region, bucket, object_key)
+WHERE is_latest;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_objects_version
+ON objects (env, logical_region, bucket, object_key, version_id);
@@ -0,0 +1,3 @@
+ALTER TABLE objects DROP COLUMN IF EXISTS legal_hold;
+ALTER TABLE objects DROP COLUMN IF EXISTS retain_until;
+ALTER TABLE objects DROP COLUMN IF EXISTS retention_mode;
@@ -0,0 +1,3 @@
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS retention_mode VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS retain_until TIMESTAMP;
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS legal_hold BOOLEAN NOT NULL DEFAULT false;
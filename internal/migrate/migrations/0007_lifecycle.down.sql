@@ -0,0 +1,2 @@
+ALTER TABLE objects DROP COLUMN IF EXISTS last_accessed_at;
+ALTER TABLE objects DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,3 @@
+-- Lifecycle rules match objects by tag and by time since their last read.
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS last_accessed_at TIMESTAMP;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS scrub_findings;
+ALTER TABLE objects DROP COLUMN IF EXISTS checksum;
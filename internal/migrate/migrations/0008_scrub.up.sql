@@ -0,0 +1,21 @@
+-- SHA-256 of the content, recorded on upload so the scrubber can verify it.
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS checksum VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS scrub_findings (
+  id              BIGSERIAL PRIMARY KEY,
+  object_id       BIGINT NOT NULL,
+  env             VARCHAR(16) NOT NULL,
+  logical_region  VARCHAR(32) NOT NULL,
+  bucket          VARCHAR(64) NOT NULL,
+  object_key      TEXT NOT NULL,
+  version_id      VARCHAR(64) NOT NULL DEFAULT '',
+  provider_bucket VARCHAR(255) NOT NULL,
+  physical_key    TEXT NOT NULL,
+  kind            VARCHAR(32) NOT NULL,
+  expected        TEXT NOT NULL DEFAULT '',
+  actual          TEXT NOT NULL DEFAULT '',
+  repaired        BOOLEAN NOT NULL DEFAULT false,
+  detected_at     TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_scrub_findings_object ON scrub_findings (object_id);
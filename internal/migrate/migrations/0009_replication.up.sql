@@ -0,0 +1,31 @@
+-- Copies of physical objects in the replica targets of their route, kept
+-- per physical object so a copy outlives rewrites of the object's record.
+CREATE TABLE IF NOT EXISTS object_replicas (
+  id                   BIGSERIAL PRIMARY KEY,
+  env                  VARCHAR(16) NOT NULL,
+  logical_region       VARCHAR(32) NOT NULL,
+  bucket               VARCHAR(64) NOT NULL,
+  object_key           TEXT NOT NULL,
+  version_id           VARCHAR(64) NOT NULL DEFAULT '',
+  size_bytes           BIGINT NOT NULL,
+  content_type         VARCHAR(255) NOT NULL DEFAULT '',
+  storage_class        VARCHAR(32) NOT NULL DEFAULT '',
+  source_provider      VARCHAR(64) NOT NULL,
+  source_bucket        VARCHAR(255) NOT NULL,
+  physical_key         TEXT NOT NULL,
+  target_provider      VARCHAR(64) NOT NULL,
+  target_provider_type VARCHAR(32) NOT NULL,
+  target_region        VARCHAR(64) NOT NULL DEFAULT '',
+  target_bucket        VARCHAR(255) NOT NULL,
+  status               VARCHAR(16) NOT NULL,
+  etag                 VARCHAR(128) NOT NULL DEFAULT '',
+  attempts             INT NOT NULL DEFAULT 0,
+  last_error           TEXT NOT NULL DEFAULT '',
+  created_at           TIMESTAMP NOT NULL DEFAULT now(),
+  next_attempt_at      TIMESTAMP NOT NULL DEFAULT now(),
+  replicated_at        TIMESTAMP,
+  UNIQUE (source_bucket, physical_key, target_provider, target_bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_object_replicas_due ON object_replicas (next_attempt_at) WHERE status <> 'COMPLETED';
+CREATE INDEX IF NOT EXISTS idx_object_replicas_target ON object_replicas (target_bucket, physical_key);
@@ -0,0 +1,12 @@
+-- Reference counts of deduplicated physical objects, which are shared by
+-- every record with the same content in a bucket. The object is deleted
+-- with its last reference.
+CREATE TABLE IF NOT EXISTS object_refs (
+  provider_bucket VARCHAR(255) NOT NULL,
+  physical_key    TEXT NOT NULL,
+  refs            BIGINT NOT NULL,
+  size_bytes      BIGINT NOT NULL,
+  created_at      TIMESTAMP NOT NULL DEFAULT now(),
+  updated_at      TIMESTAMP NOT NULL DEFAULT now(),
+  PRIMARY KEY (provider_bucket, physical_key)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_objects_pack;
+ALTER TABLE objects DROP COLUMN IF EXISTS pack_offset;
+ALTER TABLE objects DROP COLUMN IF EXISTS pack_id;
+DROP TABLE IF EXISTS packs;
@@ -0,0 +1,24 @@
+-- Pack files: provider objects holding many small objects back to back.
+-- A packed object points at its pack's physical key and records where its
+-- content starts; its size_bytes is the length.
+CREATE TABLE IF NOT EXISTS packs (
+  id              BIGSERIAL PRIMARY KEY,
+  env             VARCHAR(16) NOT NULL,
+  logical_region  VARCHAR(32) NOT NULL,
+  bucket          VARCHAR(64) NOT NULL,
+  storage_class   VARCHAR(32) NOT NULL DEFAULT '',
+  provider_type   VARCHAR(32) NOT NULL,
+  provider_region VARCHAR(64) NOT NULL DEFAULT '',
+  provider_bucket VARCHAR(255) NOT NULL,
+  physical_key    TEXT NOT NULL,
+  etag            VARCHAR(128) NOT NULL DEFAULT '',
+  size_bytes      BIGINT NOT NULL,
+  entries         INT NOT NULL,
+  created_at      TIMESTAMP NOT NULL DEFAULT now(),
+  UNIQUE (provider_bucket, physical_key)
+);
+
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS pack_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS pack_offset BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_objects_pack ON objects (pack_id) WHERE pack_id <> 0;
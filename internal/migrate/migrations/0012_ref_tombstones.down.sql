@@ -0,0 +1,2 @@
+DELETE FROM object_refs WHERE retired_at IS NOT NULL;
+ALTER TABLE object_refs DROP COLUMN IF EXISTS retired_at;
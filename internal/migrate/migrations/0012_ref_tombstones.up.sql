@@ -0,0 +1,4 @@
+-- A deduplicated object whose last reference is gone keeps its row as a
+-- tombstone while the object is deleted, so that a new upload of the same
+-- content cannot take a reference to it in the meantime.
+ALTER TABLE object_refs ADD COLUMN IF NOT EXISTS retired_at TIMESTAMP;
@@ -0,0 +1,2 @@
+ALTER TABLE packs DROP COLUMN IF EXISTS provider_name;
+ALTER TABLE objects DROP COLUMN IF EXISTS provider_name;
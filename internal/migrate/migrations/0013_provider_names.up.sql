@@ -0,0 +1,6 @@
+-- The registry name of the provider holding an object or pack. Type and
+-- bucket do not tell apart two providers of the same type whose buckets
+-- share a name in different regions. Rows written before are left empty
+-- and resolved through the routes.
+ALTER TABLE objects ADD COLUMN IF NOT EXISTS provider_name VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE packs ADD COLUMN IF NOT EXISTS provider_name VARCHAR(64) NOT NULL DEFAULT '';
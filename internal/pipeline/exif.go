@@ -0,0 +1,233 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+
+	"github.com/kenelite/smartstore/internal/imaging"
+)
+
+var errMalformed = errors.New("malformed image")
+
+// StripEXIF removes EXIF (including GPS), XMP, IPTC and comment metadata
+// from JPEG and PNG uploads without re-encoding the pixels. Other formats
+// pass through unchanged.
+type StripEXIF struct{}
+
+func (StripEXIF) Name() string { return "strip_exif" }
+
+func (s StripEXIF) Process(_ context.Context, obj *Object) error {
+	var (
+		out []byte
+		err error
+	)
+	switch {
+	case isJPEG(obj.Data):
+		out, err = stripJPEG(obj.Data)
+	case isPNG(obj.Data):
+		out, err = stripPNG(obj.Data)
+	default:
+		return nil
+	}
+	if err != nil {
+		return reject(s.Name(), "%v", err)
+	}
+	obj.Data = out
+	return nil
+}
+
+// NormalizeOrientation applies a JPEG's EXIF orientation to the pixels so
+// clients that ignore EXIF display it upright. Rotated images are
+// re-encoded, which drops all metadata, so run it before strip_exif.
+type NormalizeOrientation struct{}
+
+func (NormalizeOrientation) Name() string { return "normalize_orientation" }
+
+func (n NormalizeOrientation) Process(_ context.Context, obj *Object) error {
+	if !isJPEG(obj.Data) {
+		return nil
+	}
+	o := jpegOrientation(obj.Data)
+	if o <= 1 || o > 8 {
+		return nil
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(obj.Data))
+	if err != nil {
+		return reject(n.Name(), "decode jpeg: %v", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > imaging.DefaultMaxPixels {
+		return reject(n.Name(), "%dx%d jpeg exceeds %d pixels", cfg.Width, cfg.Height, imaging.DefaultMaxPixels)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(obj.Data))
+	if err != nil {
+		return reject(n.Name(), "decode jpeg: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, orient(img, o), &jpeg.Options{Quality: 92}); err != nil {
+		return err
+	}
+	obj.Data = buf.Bytes()
+	return nil
+}
+
+func isJPEG(b []byte) bool { return len(b) > 3 && b[0] == 0xFF && b[1] == 0xD8 }
+
+var pngSig = []byte("\x89PNG\r\n\x1a\n")
+
+func isPNG(b []byte) bool { return bytes.HasPrefix(b, pngSig) }
+
+// walkJPEG calls fn for every marker segment before the image data. Returning
+// false drops the segment. The (possibly filtered) file is returned.
+func walkJPEG(b []byte, fn func(marker byte, payload []byte) bool) ([]byte, error) {
+	out := make([]byte, 0, len(b))
+	out = append(out, 0xFF, 0xD8)
+	i := 2
+	for i+1 < len(b) {
+		if b[i] != 0xFF {
+			return nil, errMalformed
+		}
+		marker := b[i+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			i++
+			continue
+		case marker == 0xDA || marker == 0xD9: // start of scan / end of image
+			return append(out, b[i:]...), nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // standalone
+			out = append(out, b[i:i+2]...)
+			i += 2
+			continue
+		}
+		if i+4 > len(b) {
+			return nil, errMalformed
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+		if end > len(b) || end < i+4 {
+			return nil, errMalformed
+		}
+		if fn(marker, b[i+4:end]) {
+			out = append(out, b[i:end]...)
+		}
+		i = end
+	}
+	return nil, errMalformed
+}
+
+func stripJPEG(b []byte) ([]byte, error) {
+	return walkJPEG(b, func(marker byte, _ []byte) bool {
+		switch marker {
+		case 0xE1, 0xED, 0xFE: // APP1 (EXIF/XMP), APP13 (IPTC), COM
+			return false
+		}
+		return true
+	})
+}
+
+func stripPNG(b []byte) ([]byte, error) {
+	out := append(make([]byte, 0, len(b)), pngSig...)
+	i := len(pngSig)
+	for i+12 <= len(b) {
+		n := int(binary.BigEndian.Uint32(b[i:]))
+		end := i + 12 + n
+		if n < 0 || end > len(b) {
+			return nil, errMalformed
+		}
+		switch string(b[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+		default:
+			out = append(out, b[i:end]...)
+		}
+		i = end
+	}
+	if i != len(b) {
+		return nil, errMalformed
+	}
+	return out, nil
+}
+
+// jpegOrientation returns the EXIF orientation tag (1-8), or 0 if absent.
+func jpegOrientation(b []byte) int {
+	orientation := 0
+	_, _ = walkJPEG(b, func(marker byte, p []byte) bool {
+		if marker != 0xE1 || orientation != 0 || !bytes.HasPrefix(p, []byte("Exif\x00\x00")) {
+			return true
+		}
+		orientation = tiffOrientation(p[6:])
+		return true
+	})
+	return orientation
+}
+
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 0
+	}
+	var bo binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(bo.Uint32(t[4:]))
+	if ifd < 8 || ifd+2 > len(t) {
+		return 0
+	}
+	n := int(bo.Uint16(t[ifd:]))
+	for e := 0; e < n; e++ {
+		off := ifd + 2 + e*12
+		if off+12 > len(t) {
+			return 0
+		}
+		if bo.Uint16(t[off:]) == 0x0112 {
+			return int(bo.Uint16(t[off+8:]))
+		}
+	}
+	return 0
+}
+
+// orient maps img through EXIF orientation o.
+func orient(img image.Image, o int) image.Image {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if o >= 5 && o <= 8 { // transposed
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,304 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+var (
+	soi = []byte{0xFF, 0xD8}
+	// a start of scan with its header, entropy-coded data and end of image
+	scan = []byte{0xFF, 0xDA, 0x00, 0x04, 0x01, 0x00, 0x12, 0x34, 0xFF, 0xD9}
+)
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// segment is a JPEG marker segment; length overrides the computed length
+// when non-zero.
+func segment(marker byte, payload string, length ...uint16) []byte {
+	n := uint16(len(payload) + 2)
+	if len(length) > 0 {
+		n = length[0]
+	}
+	return join([]byte{0xFF, marker, byte(n >> 8), byte(n)}, []byte(payload))
+}
+
+func chunk(typ, data string) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	b = append(b, typ+data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE([]byte(typ+data)))
+}
+
+func TestStripJPEG(t *testing.T) {
+	app0 := segment(0xE0, "JFIF\x00\x01\x02")
+	app2 := segment(0xE2, "ICC_PROFILE\x00")
+	dqt := segment(0xDB, "\x00quant")
+	exif := segment(0xE1, "Exif\x00\x00MM\x00*")
+	xmp := segment(0xE1, "http://ns.adobe.com/xap/1.0/\x00<x/>")
+	iptc := segment(0xED, "Photoshop 3.0\x00")
+	com := segment(0xFE, "a comment")
+
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte // nil for errMalformed
+	}{
+		{
+			name: "metadata removed",
+			in:   join(soi, app0, exif, xmp, app2, iptc, dqt, com, scan),
+			want: join(soi, app0, app2, dqt, scan),
+		},
+		{
+			name: "nothing to remove",
+			in:   join(soi, app0, dqt, scan),
+			want: join(soi, app0, dqt, scan),
+		},
+		{
+			name: "fill bytes and standalone markers",
+			in:   join(soi, []byte{0xFF, 0xFF}, exif, []byte{0xFF, 0xD0}, dqt, scan),
+			want: join(soi, []byte{0xFF, 0xD0}, dqt, scan),
+		},
+		{
+			name: "data after the scan kept as is",
+			in:   join(soi, scan, com),
+			want: join(soi, scan, com),
+		},
+		{name: "length past the end", in: join(soi, app0, segment(0xE1, "Exif", 0x0100), scan)},
+		{name: "length shorter than itself", in: join(soi, segment(0xE1, "Exif", 1), scan)},
+		{name: "length cut off", in: join(soi, app0, []byte{0xFF, 0xE1, 0x00})},
+		{name: "no marker", in: join(soi, []byte{0x00, 0xE1, 0x00, 0x02}, scan)},
+		{name: "no scan", in: join(soi, app0, exif)},
+		{name: "only the start of image", in: soi},
+	}
+	for _, tt := range tests {
+		got, err := stripJPEG(tt.in)
+		if tt.want == nil {
+			if !errors.Is(err, errMalformed) {
+				t.Errorf("%s: err = %v, want errMalformed", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: stripJPEG = % x, %v\nwant % x", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	ihdr := chunk("IHDR", "\x00\x00\x00\x01\x00\x00\x00\x01\x08\x02\x00\x00\x00")
+	idat := chunk("IDAT", "pixels")
+	iend := chunk("IEND", "")
+
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte // nil for errMalformed
+	}{
+		{
+			name: "metadata removed",
+			in: join(pngSig, ihdr, chunk("eXIf", "MM\x00*"), chunk("tEXt", "Comment\x00hi"), chunk("iCCP", "icc"),
+				chunk("zTXt", "z"), idat, chunk("iTXt", "XML:com.adobe.xmp\x00"), iend),
+			want: join(pngSig, ihdr, chunk("iCCP", "icc"), idat, iend),
+		},
+		{
+			name: "nothing to remove",
+			in:   join(pngSig, ihdr, idat, iend),
+			want: join(pngSig, ihdr, idat, iend),
+		},
+		{name: "length past the end", in: join(pngSig, ihdr, idat[:len(idat)-1])},
+		{name: "huge length", in: join(pngSig, ihdr, []byte{0xFF, 0xFF, 0xFF, 0xFF}, []byte("tEXt"), iend)},
+		{name: "trailing bytes", in: join(pngSig, ihdr, iend, []byte{0, 0, 0})},
+	}
+	for _, tt := range tests {
+		got, err := stripPNG(tt.in)
+		if tt.want == nil {
+			if !errors.Is(err, errMalformed) {
+				t.Errorf("%s: err = %v, want errMalformed", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: stripPNG = %q, %v\nwant %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// tiff is a TIFF header followed, at ifd, by an IFD of n entries of which
+// those given are written. Each entry is a tag and a SHORT value.
+func tiff(order string, ifd uint32, n uint16, entries ...[2]uint16) []byte {
+	var bo binary.AppendByteOrder = binary.BigEndian
+	if order == "II" {
+		bo = binary.LittleEndian
+	}
+	b := []byte(order)
+	b = bo.AppendUint16(b, 42)
+	b = bo.AppendUint32(b, ifd)
+	for len(b) < int(ifd) && ifd < 64 {
+		b = append(b, 0)
+	}
+	b = bo.AppendUint16(b, n)
+	for _, e := range entries {
+		b = bo.AppendUint16(b, e[0])
+		b = bo.AppendUint16(b, 3) // SHORT
+		b = bo.AppendUint32(b, 1)
+		b = bo.AppendUint16(b, e[1])
+		b = append(b, 0, 0)
+	}
+	return b
+}
+
+func TestTIFFOrientation(t *testing.T) {
+	const tag = 0x0112
+	tests := []struct {
+		name string
+		in   []byte
+		want int
+	}{
+		{name: "little endian", in: tiff("II", 8, 1, [2]uint16{tag, 6}), want: 6},
+		{name: "big endian", in: tiff("MM", 8, 1, [2]uint16{tag, 3}), want: 3},
+		{name: "after other tags", in: tiff("MM", 8, 2, [2]uint16{0x010F, 1}, [2]uint16{tag, 8}), want: 8},
+		{name: "IFD further on", in: tiff("II", 16, 1, [2]uint16{tag, 5}), want: 5},
+		{name: "no orientation", in: tiff("II", 8, 1, [2]uint16{0x010F, 6})},
+		{name: "unknown byte order", in: tiff("XX", 8, 1, [2]uint16{tag, 6})},
+		{name: "too short", in: []byte("II*\x00")},
+		{name: "IFD inside the header", in: tiff("II", 4, 1, [2]uint16{tag, 6})},
+		{name: "IFD past the end", in: tiff("II", 0xFFFFFFFF, 1, [2]uint16{tag, 6})},
+		{name: "entries past the end", in: tiff("MM", 8, 3, [2]uint16{0x010F, 1})},
+		{name: "entry cut off", in: tiff("MM", 8, 1, [2]uint16{tag, 6})[:18]},
+	}
+	for _, tt := range tests {
+		if got := tiffOrientation(tt.in); got != tt.want {
+			t.Errorf("%s: orientation %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	exif := func(b []byte) []byte { return segment(0xE1, "Exif\x00\x00"+string(b)) }
+	tests := []struct {
+		name string
+		in   []byte
+		want int
+	}{
+		{name: "exif", in: join(soi, exif(tiff("MM", 8, 1, [2]uint16{0x0112, 6})), scan), want: 6},
+		{name: "first exif wins", in: join(soi, exif(tiff("II", 8, 1, [2]uint16{0x0112, 3})), exif(tiff("II", 8, 1, [2]uint16{0x0112, 6})), scan), want: 3},
+		{name: "xmp only", in: join(soi, segment(0xE1, "http://ns.adobe.com/xap/1.0/\x00"), scan)},
+		{name: "malformed after the exif", in: join(soi, exif(tiff("MM", 8, 1, [2]uint16{0x0112, 8})), segment(0xE0, "", 0x0100)), want: 8},
+		{name: "exif header only", in: join(soi, segment(0xE1, "Exif\x00\x00"), scan)},
+	}
+	for _, tt := range tests {
+		if got := jpegOrientation(tt.in); got != tt.want {
+			t.Errorf("%s: orientation %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// labels returns the red channel of each pixel, row by row.
+func labels(img image.Image) [][]uint8 {
+	b := img.Bounds()
+	rows := make([][]uint8, 0, b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := make([]uint8, 0, b.Dx())
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			row = append(row, uint8(r>>8))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestOrient(t *testing.T) {
+	// stored as
+	//   1 2 3
+	//   4 5 6
+	src := image.NewRGBA(image.Rect(10, 20, 13, 22)) // bounds need not start at 0
+	for i := 0; i < 6; i++ {
+		src.SetRGBA(10+i%3, 20+i/3, color.RGBA{R: uint8(i + 1), A: 255})
+	}
+	tests := map[int][][]uint8{
+		1: {{1, 2, 3}, {4, 5, 6}},
+		2: {{3, 2, 1}, {6, 5, 4}},   // mirrored horizontally
+		3: {{6, 5, 4}, {3, 2, 1}},   // rotated 180°
+		4: {{4, 5, 6}, {1, 2, 3}},   // mirrored vertically
+		5: {{1, 4}, {2, 5}, {3, 6}}, // transposed
+		6: {{4, 1}, {5, 2}, {6, 3}}, // rotated 90° clockwise
+		7: {{6, 3}, {5, 2}, {4, 1}}, // transversed
+		8: {{3, 6}, {2, 5}, {1, 4}}, // rotated 90° counter-clockwise
+		0: {{1, 2, 3}, {4, 5, 6}},   // none
+		9: {{1, 2, 3}, {4, 5, 6}},   // invalid
+	}
+	for o, want := range tests {
+		got := labels(orient(src, o))
+		if !equalRows(got, want) {
+			t.Errorf("orientation %d: %v, want %v", o, got, want)
+		}
+	}
+}
+
+func equalRows(a, b [][]uint8) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNormalizeOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+	app1 := segment(0xE1, "Exif\x00\x00"+string(tiff("MM", 8, 1, [2]uint16{0x0112, 6})))
+	rotated := join(plain[:2], app1, plain[2:])
+
+	obj := &Object{Data: rotated}
+	if err := (NormalizeOrientation{}).Process(context.Background(), obj); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(obj.Data))
+	if err != nil || cfg.Width != 2 || cfg.Height != 4 {
+		t.Errorf("normalized to %dx%d, %v; want 2x4", cfg.Width, cfg.Height, err)
+	}
+	if o := jpegOrientation(obj.Data); o != 0 {
+		t.Errorf("orientation %d left after normalizing", o)
+	}
+
+	obj = &Object{Data: plain}
+	if err := (NormalizeOrientation{}).Process(context.Background(), obj); err != nil || !bytes.Equal(obj.Data, plain) {
+		t.Errorf("an upright jpeg was changed: %v", err)
+	}
+}
+
+func TestStripEXIF(t *testing.T) {
+	obj := &Object{Data: join(soi, segment(0xE1, "Exif\x00\x00"), scan)}
+	if err := (StripEXIF{}).Process(context.Background(), obj); err != nil || !bytes.Equal(obj.Data, join(soi, scan)) {
+		t.Errorf("strip = % x, %v", obj.Data, err)
+	}
+
+	obj = &Object{Data: join(soi, segment(0xE1, "Exif", 0x0100))}
+	var rejected *RejectError
+	if err := (StripEXIF{}).Process(context.Background(), obj); !errors.As(err, &rejected) {
+		t.Errorf("malformed jpeg: err = %v, want a rejection", err)
+	}
+
+	text := []byte("not an image")
+	obj = &Object{Data: text}
+	if err := (StripEXIF{}).Process(context.Background(), obj); err != nil || !bytes.Equal(obj.Data, text) {
+		t.Errorf("other content changed: %q, %v", obj.Data, err)
+	}
+}
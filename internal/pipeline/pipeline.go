@@ -0,0 +1,90 @@
+// Package pipeline runs composable write-time hooks over an upload before it
+// is stored: content validation, metadata stripping and normalization.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Object is an upload held in memory while hooks run. Hooks may replace Data
+// and ContentType.
+type Object struct {
+	Env           string
+	LogicalRegion string
+	Bucket        string
+	Key           string
+	ContentType   string
+	Data          []byte
+}
+
+type Hook interface {
+	Name() string
+	Process(ctx context.Context, obj *Object) error
+}
+
+// ErrRejected is wrapped by every *RejectError.
+var ErrRejected = errors.New("upload rejected")
+
+// RejectError reports which hook refused an upload and why.
+type RejectError struct {
+	Hook   string
+	Reason string
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("upload rejected by %s: %s", e.Hook, e.Reason)
+}
+
+func (e *RejectError) Unwrap() error { return ErrRejected }
+
+func reject(hook, format string, args ...any) error {
+	return &RejectError{Hook: hook, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Pipeline runs hooks in order; the first failure stops it.
+type Pipeline []Hook
+
+func (p Pipeline) Run(ctx context.Context, obj *Object) error {
+	for _, h := range p {
+		if err := h.Process(ctx, obj); err != nil {
+			var rej *RejectError
+			if errors.As(err, &rej) {
+				return err
+			}
+			return fmt.Errorf("hook %s: %w", h.Name(), err)
+		}
+	}
+	return nil
+}
+
+var registry = map[string]func() Hook{
+	"validate_content_type": func() Hook { return ValidateContentType{} },
+	"strip_exif":            func() Hook { return StripEXIF{} },
+	"normalize_orientation": func() Hook { return NormalizeOrientation{} },
+}
+
+// New builds a pipeline from hook names as used in bucket config.
+func New(names []string) (Pipeline, error) {
+	p := make(Pipeline, 0, len(names))
+	for _, name := range names {
+		ctor, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown write hook %q (known: %v)", name, Names())
+		}
+		p = append(p, ctor())
+	}
+	return p, nil
+}
+
+// Names lists the registered hook names.
+func Names() []string {
+	out := make([]string, 0, len(registry))
+	for n := range registry {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
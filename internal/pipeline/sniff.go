@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ValidateContentType checks the body's magic bytes against the declared
+// Content-Type. An empty declaration is filled in from the sniffed type.
+type ValidateContentType struct{}
+
+func (ValidateContentType) Name() string { return "validate_content_type" }
+
+func (v ValidateContentType) Process(_ context.Context, obj *Object) error {
+	detected := mediaType(http.DetectContentType(obj.Data))
+	if obj.ContentType == "" {
+		obj.ContentType = detected
+		return nil
+	}
+	declared := mediaType(obj.ContentType)
+	if declared == detected {
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(detected, "text/"):
+		// text has no magic bytes; any text-like declaration is fine
+		if isTextual(declared) {
+			return nil
+		}
+	case detected == "application/octet-stream":
+		// no signature recognized: only reject when the declared type has one
+		if !sniffable(declared) {
+			return nil
+		}
+	}
+	return reject(v.Name(), "declared %s but content is %s", declared, detected)
+}
+
+func mediaType(ct string) string {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(ct))
+	}
+	return mt
+}
+
+func isTextual(mt string) bool {
+	if strings.HasPrefix(mt, "text/") {
+		return true
+	}
+	switch mt {
+	case "application/json", "application/xml", "application/javascript",
+		"application/x-ndjson", "application/yaml", "application/x-yaml", "image/svg+xml":
+		return true
+	}
+	return strings.HasSuffix(mt, "+json") || strings.HasSuffix(mt, "+xml")
+}
+
+// sniffable reports whether http.DetectContentType recognizes mt by its
+// signature, so a declaration of mt without that signature is a lie.
+func sniffable(mt string) bool {
+	switch mt {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp", "image/x-icon",
+		"application/pdf", "application/zip", "application/x-gzip", "application/gzip",
+		"application/x-rar-compressed", "application/wasm", "application/ogg",
+		"audio/mpeg", "audio/wave", "audio/aiff", "audio/midi", "audio/basic",
+		"video/mp4", "video/webm", "video/avi", "font/woff", "font/woff2", "font/ttf", "font/otf":
+		return true
+	}
+	return false
+}
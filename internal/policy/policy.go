@@ -0,0 +1,149 @@
+// Package policy enforces per-bucket upload rules: size bounds, allowed
+// content types, a key pattern and forbidden extensions. Checks run on the
+// request metadata before any body is read; uploads of unknown size are
+// bounded by wrapping their body with Reader.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/kenelite/smartstore/internal/config"
+)
+
+// ErrViolation is wrapped by every policy error.
+var ErrViolation = errors.New("upload policy violation")
+
+var (
+	ErrTooLarge              = fmt.Errorf("%w: object too large", ErrViolation)
+	ErrTooSmall              = fmt.Errorf("%w: object too small", ErrViolation)
+	ErrContentTypeNotAllowed = fmt.Errorf("%w: content type not allowed", ErrViolation)
+	ErrKeyNotAllowed         = fmt.Errorf("%w: key not allowed", ErrViolation)
+)
+
+type Policy struct {
+	maxSize      int64
+	minSize      int64
+	contentTypes []string
+	keyPattern   *regexp.Regexp
+	forbidden    []string
+}
+
+// Compile validates cfg. The key pattern must match the whole key.
+func Compile(cfg *config.UploadPolicyConfig) (*Policy, error) {
+	if cfg.MaxSize < 0 || cfg.MinSize < 0 {
+		return nil, errors.New("policy sizes must not be negative")
+	}
+	if cfg.MaxSize > 0 && cfg.MinSize > cfg.MaxSize {
+		return nil, fmt.Errorf("policy min_size %d exceeds max_size %d", cfg.MinSize, cfg.MaxSize)
+	}
+	p := &Policy{maxSize: cfg.MaxSize, minSize: cfg.MinSize}
+	for _, ct := range cfg.AllowedContentTypes {
+		ct = strings.ToLower(strings.TrimSpace(ct))
+		if _, err := path.Match(ct, ""); err != nil {
+			return nil, fmt.Errorf("policy content type pattern %q: %w", ct, err)
+		}
+		p.contentTypes = append(p.contentTypes, ct)
+	}
+	if cfg.KeyPattern != "" {
+		re, err := regexp.Compile(`^(?:` + cfg.KeyPattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("policy key_pattern: %w", err)
+		}
+		p.keyPattern = re
+	}
+	for _, ext := range cfg.ForbiddenExtensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		p.forbidden = append(p.forbidden, ext)
+	}
+	return p, nil
+}
+
+// Check validates an upload before its body is read. size is -1 when the
+// length is unknown; Reader enforces the size bounds for such uploads.
+func (p *Policy) Check(key, contentType string, size int64) error {
+	if p.maxSize > 0 && size > p.maxSize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, size, p.maxSize)
+	}
+	if size >= 0 && size < p.minSize {
+		return fmt.Errorf("%w: %d bytes, minimum %d", ErrTooSmall, size, p.minSize)
+	}
+	if len(p.contentTypes) > 0 && !p.allowsContentType(contentType) {
+		return fmt.Errorf("%w: %q", ErrContentTypeNotAllowed, contentType)
+	}
+	if p.keyPattern != nil && !p.keyPattern.MatchString(key) {
+		return fmt.Errorf("%w: %q does not match %s", ErrKeyNotAllowed, key, p.keyPattern)
+	}
+	lower := strings.ToLower(key)
+	for _, ext := range p.forbidden {
+		if strings.HasSuffix(lower, ext) {
+			return fmt.Errorf("%w: extension %s is forbidden", ErrKeyNotAllowed, ext)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) allowsContentType(contentType string) bool {
+	mt := "application/octet-stream"
+	if contentType != "" {
+		parsed, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return false
+		}
+		mt = parsed
+	}
+	for _, pattern := range p.contentTypes {
+		if ok, _ := path.Match(pattern, mt); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Limited reports whether uploads of unknown size need a Reader.
+func (p *Policy) Limited() bool {
+	return p.maxSize > 0 || p.minSize > 0
+}
+
+// Reader bounds a body of unknown length: reads fail with ErrTooLarge past
+// the maximum size, and EOF is replaced with ErrTooSmall when the body
+// ended short of the minimum.
+type Reader struct {
+	r   io.Reader
+	n   int64
+	max int64
+	min int64
+	Err error // the violation, once one was hit
+}
+
+func (p *Policy) Reader(r io.Reader) *Reader {
+	return &Reader{r: r, max: p.maxSize, min: p.minSize}
+}
+
+func (l *Reader) Read(b []byte) (int, error) {
+	if l.Err != nil {
+		return 0, l.Err
+	}
+	n, err := l.r.Read(b)
+	l.n += int64(n)
+	if l.max > 0 && l.n > l.max {
+		l.Err = fmt.Errorf("%w: body exceeds %d bytes", ErrTooLarge, l.max)
+		return n, l.Err
+	}
+	if errors.Is(err, io.EOF) && l.n < l.min {
+		l.Err = fmt.Errorf("%w: %d bytes, minimum %d", ErrTooSmall, l.n, l.min)
+		return n, l.Err
+	}
+	return n, err
+}
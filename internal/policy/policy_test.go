@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/kenelite/smartstore/internal/config"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.UploadPolicyConfig
+		ok   bool
+	}{
+		{name: "empty", ok: true},
+		{name: "full", cfg: config.UploadPolicyConfig{MinSize: 1, MaxSize: 10, AllowedContentTypes: []string{"image/*"}, KeyPattern: `[a-z]+`, ForbiddenExtensions: []string{"exe"}}, ok: true},
+		{name: "negative size", cfg: config.UploadPolicyConfig{MaxSize: -1}},
+		{name: "min above max", cfg: config.UploadPolicyConfig{MinSize: 11, MaxSize: 10}},
+		{name: "min without max", cfg: config.UploadPolicyConfig{MinSize: 11}, ok: true},
+		{name: "bad content type pattern", cfg: config.UploadPolicyConfig{AllowedContentTypes: []string{"image/["}}},
+		{name: "bad key pattern", cfg: config.UploadPolicyConfig{KeyPattern: `(`}},
+	}
+	for _, tt := range tests {
+		if _, err := Compile(&tt.cfg); (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p, err := Compile(&config.UploadPolicyConfig{
+		MinSize:             2,
+		MaxSize:             10,
+		AllowedContentTypes: []string{" Image/* ", "application/octet-stream"},
+		KeyPattern:          `uploads/[a-z.]+`,
+		ForbiddenExtensions: []string{"exe", ".SH", " "},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		key         string
+		contentType string
+		size        int64
+		want        error // nil when allowed
+	}{
+		{name: "allowed", key: "uploads/a.png", contentType: "image/png", size: 5},
+		{name: "bounds are inclusive", key: "uploads/a.png", contentType: "image/png", size: 10},
+		{name: "minimum is inclusive", key: "uploads/a.png", contentType: "image/png", size: 2},
+		{name: "unknown size is left to the reader", key: "uploads/a.png", contentType: "image/png", size: -1},
+		{name: "parameters are ignored", key: "uploads/a.png", contentType: "image/png; q=1", size: 5},
+		{name: "no content type is octet-stream", key: "uploads/a.bin", size: 5},
+		{name: "too large", key: "uploads/a.png", contentType: "image/png", size: 11, want: ErrTooLarge},
+		{name: "too small", key: "uploads/a.png", contentType: "image/png", size: 1, want: ErrTooSmall},
+		{name: "content type", key: "uploads/a.txt", contentType: "text/plain", size: 5, want: ErrContentTypeNotAllowed},
+		{name: "malformed content type", key: "uploads/a.png", contentType: "image/", size: 5, want: ErrContentTypeNotAllowed},
+		{name: "key must match whole", key: "uploads/a.png/", contentType: "image/png", size: 5, want: ErrKeyNotAllowed},
+		{name: "key pattern", key: "other/a.png", contentType: "image/png", size: 5, want: ErrKeyNotAllowed},
+		{name: "forbidden extension", key: "uploads/a.exe", contentType: "image/png", size: 5, want: ErrKeyNotAllowed},
+		{name: "forbidden extension ignores case", key: "uploads/a.sh", contentType: "image/png", size: 5, want: ErrKeyNotAllowed},
+
+		// several violations report the first of size, content type, key
+		{name: "size before content type", key: "uploads/a.txt", contentType: "text/plain", size: 11, want: ErrTooLarge},
+		{name: "content type before key", key: "other/a.exe", contentType: "text/plain", size: 5, want: ErrContentTypeNotAllowed},
+		{name: "size before key", key: "other/a.png", contentType: "image/png", size: 1, want: ErrTooSmall},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.key, tt.contentType, tt.size)
+		switch {
+		case tt.want == nil && err != nil:
+			t.Errorf("%s: denied: %v", tt.name, err)
+		case tt.want != nil && (!errors.Is(err, tt.want) || !errors.Is(err, ErrViolation)):
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.UploadPolicyConfig
+		size     int
+		want     error
+		limited  bool
+		fullRead bool
+	}{
+		{name: "unlimited", size: 100, fullRead: true},
+		{name: "within bounds", cfg: config.UploadPolicyConfig{MinSize: 2, MaxSize: 10}, size: 10, limited: true, fullRead: true},
+		{name: "too large", cfg: config.UploadPolicyConfig{MaxSize: 10}, size: 11, want: ErrTooLarge, limited: true},
+		{name: "too small", cfg: config.UploadPolicyConfig{MinSize: 2}, size: 1, want: ErrTooSmall, limited: true},
+		{name: "empty body too small", cfg: config.UploadPolicyConfig{MinSize: 1}, want: ErrTooSmall, limited: true},
+	}
+	for _, tt := range tests {
+		p, err := Compile(&tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if p.Limited() != tt.limited {
+			t.Errorf("%s: limited %v, want %v", tt.name, p.Limited(), tt.limited)
+		}
+		r := p.Reader(bytes.NewReader(bytes.Repeat([]byte("x"), tt.size)))
+		got, err := io.ReadAll(r)
+		if !errors.Is(err, tt.want) || !errors.Is(r.Err, tt.want) {
+			t.Errorf("%s: read err = %v, recorded %v; want %v", tt.name, err, r.Err, tt.want)
+		}
+		if tt.fullRead && len(got) != tt.size {
+			t.Errorf("%s: read %d bytes, want %d", tt.name, len(got), tt.size)
+		}
+		// the violation sticks
+		if tt.want != nil {
+			if _, err := r.Read(make([]byte, 1)); !errors.Is(err, tt.want) {
+				t.Errorf("%s: read after the violation: err = %v", tt.name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	azureAPIVersion = "2021-08-06"
+	// azureBlockSize is the size of the blocks large uploads are sent in;
+	// smaller uploads of a known size are a single Put Blob.
+	azureBlockSize = 8 << 20
+	// azureCopyPoll is how often a pending Copy Blob is checked on.
+	azureCopyPoll = time.Second
+)
+
+// azureTiers maps storage classes to Azure access tiers.
+var azureTiers = map[string]string{
+	"HOT":     "Hot",
+	"COLD":    "Cool",
+	"ARCHIVE": "Archive",
+}
+
+// AzureBlobAdapter talks to Azure Blob Storage over its REST API. Provider
+// buckets are containers. Requests are signed with the account's shared
+// key, or carry a SAS token instead.
+type AzureBlobAdapter struct {
+	endpoint string // service URL without a trailing slash
+	account  string
+	key      []byte     // decoded shared key; nil with a SAS token
+	sas      url.Values // nil with a shared key
+	client   *http.Client
+}
+
+type AzureConfig struct {
+	Account   string
+	SharedKey string // base64 account key
+	SASToken  string // used instead of SharedKey when set
+	// Endpoint overrides https://<account>.blob.core.windows.net, e.g.
+	// http://127.0.0.1:10000/devstoreaccount1 for the Azurite emulator.
+	Endpoint string
+}
+
+func NewAzureBlobAdapter(cfg AzureConfig) (*AzureBlobAdapter, error) {
+	if cfg.Account == "" {
+		return nil, errors.New("azure: account is required")
+	}
+	a := &AzureBlobAdapter{
+		endpoint: strings.TrimSuffix(cfg.Endpoint, "/"),
+		account:  cfg.Account,
+		client:   &http.Client{},
+	}
+	if a.endpoint == "" {
+		a.endpoint = "https://" + cfg.Account + ".blob.core.windows.net"
+	}
+	switch {
+	case cfg.SASToken != "":
+		sas, err := url.ParseQuery(strings.TrimPrefix(cfg.SASToken, "?"))
+		if err != nil {
+			return nil, fmt.Errorf("azure: parse sas token: %w", err)
+		}
+		a.sas = sas
+	case cfg.SharedKey != "":
+		key, err := base64.StdEncoding.DecodeString(cfg.SharedKey)
+		if err != nil {
+			return nil, fmt.Errorf("azure: decode shared key: %w", err)
+		}
+		a.key = key
+	default:
+		return nil, errors.New("azure: a shared key or a sas token is required")
+	}
+	return a, nil
+}
+
+// blobURL returns the URL of a blob, or of the container when key is empty.
+func (a *AzureBlobAdapter) blobURL(container, key string, query url.Values) (*url.URL, error) {
+	path := "/" + url.PathEscape(container)
+	if key != "" {
+		segs := strings.Split(key, "/")
+		for i, s := range segs {
+			segs[i] = url.PathEscape(s)
+		}
+		path += "/" + strings.Join(segs, "/")
+	}
+	u, err := url.Parse(a.endpoint + path)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	for k, v := range a.sas {
+		q[k] = v
+	}
+	for k, v := range query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+// do sends a request and returns the response when its status is expected;
+// other statuses become errors.
+func (a *AzureBlobAdapter) do(ctx context.Context, method, container, key string, query url.Values, header http.Header, body io.Reader, size int64, expect ...int) (*http.Response, error) {
+	u, err := a.blobURL(container, key, query)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil && size == 0 {
+		// the client would send an empty body of unknown type chunked,
+		// which the service refuses
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if a.key != nil {
+		req.Header.Set("Authorization", "SharedKey "+a.account+":"+a.sign(req))
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range expect {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	return nil, azureError(resp, container, key)
+}
+
+// sign computes the Shared Key signature of req.
+func (a *AzureBlobAdapter) sign(req *http.Request) string {
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+	h := req.Header
+	var b strings.Builder
+	for _, s := range []string{
+		req.Method,
+		h.Get("Content-Encoding"),
+		h.Get("Content-Language"),
+		length,
+		h.Get("Content-MD5"),
+		h.Get("Content-Type"),
+		"", // Date: x-ms-date is sent instead
+		h.Get("If-Modified-Since"),
+		h.Get("If-Match"),
+		h.Get("If-None-Match"),
+		h.Get("If-Unmodified-Since"),
+		h.Get("Range"),
+	} {
+		b.WriteString(s)
+		b.WriteByte('\n')
+	}
+
+	var names []string
+	for k := range h {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-ms-") {
+			names = append(names, lk)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		b.WriteString(k + ":" + strings.TrimSpace(h.Get(k)) + "\n")
+	}
+
+	b.WriteString("/" + a.account + req.URL.EscapedPath())
+	q := req.URL.Query()
+	params := make([]string, 0, len(q))
+	for k := range q {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	for _, k := range params {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		b.WriteString("\n" + strings.ToLower(k) + ":" + strings.Join(vals, ","))
+	}
+
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// azureError turns a failed response into an error, ErrObjectNotFound for
+// a missing blob or container.
+func azureError(resp *http.Response, container, key string) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = xml.Unmarshal(body, &e)
+	if e.Code == "" {
+		e.Code = resp.Header.Get("x-ms-error-code")
+	}
+	if resp.StatusCode == http.StatusNotFound && (e.Code == "" || e.Code == "BlobNotFound" || e.Code == "ContainerNotFound" || e.Code == "CannotVerifyCopySource") {
+		return fmt.Errorf("%w: %s/%s", ErrObjectNotFound, container, key)
+	}
+	msg, _, _ := strings.Cut(e.Message, "\n")
+	return fmt.Errorf("azure: %s %s/%s: %s %s", resp.Status, container, key, e.Code, msg)
+}
+
+func (a *AzureBlobAdapter) PutObject(ctx context.Context, loc ObjectLocation, r io.Reader, size int64, opts PutOptions) (string, error) {
+	header := http.Header{}
+	if opts.ContentType != "" {
+		header.Set("x-ms-blob-content-type", opts.ContentType)
+	}
+	if tier, ok := azureTiers[opts.StorageClass]; ok {
+		header.Set("x-ms-access-tier", tier)
+	}
+	for k, v := range opts.Metadata {
+		header.Set("x-ms-meta-"+k, v)
+	}
+	if size >= 0 && size <= azureBlockSize {
+		header.Set("x-ms-blob-type", "BlockBlob")
+		resp, err := a.do(ctx, http.MethodPut, loc.ProviderBucket, loc.PhysicalKey, nil, header, r, size, http.StatusCreated)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		return strings.Trim(resp.Header.Get("ETag"), `"`), nil
+	}
+	return a.putBlocks(ctx, loc, r, header)
+}
+
+// putBlocks uploads r as blocks and commits them as the blob, for uploads
+// too large for one request or of unknown size. Uncommitted blocks of a
+// failed upload are discarded by the service after a week.
+func (a *AzureBlobAdapter) putBlocks(ctx context.Context, loc ObjectLocation, r io.Reader, header http.Header) (string, error) {
+	var ids []string
+	buf := make([]byte, azureBlockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			// IDs of a blob's blocks must all have the same length
+			id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", len(ids))))
+			resp, perr := a.do(ctx, http.MethodPut, loc.ProviderBucket, loc.PhysicalKey,
+				url.Values{"comp": {"block"}, "blockid": {id}}, nil, bytes.NewReader(buf[:n]), int64(n), http.StatusCreated)
+			if perr != nil {
+				return "", perr
+			}
+			resp.Body.Close()
+			ids = append(ids, id)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var list bytes.Buffer
+	list.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for _, id := range ids {
+		list.WriteString("<Latest>" + id + "</Latest>")
+	}
+	list.WriteString("</BlockList>")
+	resp, err := a.do(ctx, http.MethodPut, loc.ProviderBucket, loc.PhysicalKey,
+		url.Values{"comp": {"blocklist"}}, header, &list, int64(list.Len()), http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
+func (a *AzureBlobAdapter) GetObject(ctx context.Context, loc ObjectLocation) (io.ReadCloser, int64, string, error) {
+	resp, err := a.do(ctx, http.MethodGet, loc.ProviderBucket, loc.PhysicalKey, nil, nil, nil, 0, http.StatusOK)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return resp.Body, resp.ContentLength, resp.Header.Get("Content-Type"), nil
+}
+
+func (a *AzureBlobAdapter) GetObjectRange(ctx context.Context, loc ObjectLocation, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("x-ms-range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := a.do(ctx, http.MethodGet, loc.ProviderBucket, loc.PhysicalKey, nil, header, nil, 0, http.StatusPartialContent, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (a *AzureBlobAdapter) DeleteObject(ctx context.Context, loc ObjectLocation) error {
+	resp, err := a.do(ctx, http.MethodDelete, loc.ProviderBucket, loc.PhysicalKey, nil, nil, nil, 0, http.StatusAccepted)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil // deletes are idempotent, as on S3
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// CopyObject copies with Copy Blob. Copies within an account mostly finish
+// before the service responds; one still pending is polled until it ends.
+// The copy keeps the source's content type.
+func (a *AzureBlobAdapter) CopyObject(ctx context.Context, src, dst ObjectLocation, opts PutOptions) (string, error) {
+	source, err := a.blobURL(src.ProviderBucket, src.PhysicalKey, nil)
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{}
+	header.Set("x-ms-copy-source", source.String())
+	if tier, ok := azureTiers[opts.StorageClass]; ok {
+		header.Set("x-ms-access-tier", tier)
+	}
+	for k, v := range opts.Metadata {
+		header.Set("x-ms-meta-"+k, v)
+	}
+	resp, err := a.do(ctx, http.MethodPut, dst.ProviderBucket, dst.PhysicalKey, nil, header, nil, 0, http.StatusAccepted)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	for resp.Header.Get("x-ms-copy-status") == "pending" {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(azureCopyPoll):
+		}
+		if resp, err = a.do(ctx, http.MethodHead, dst.ProviderBucket, dst.PhysicalKey, nil, nil, nil, 0, http.StatusOK); err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+	}
+	if status := resp.Header.Get("x-ms-copy-status"); status != "success" {
+		return "", fmt.Errorf("azure: copy %s/%s to %s/%s: %s %s", src.ProviderBucket, src.PhysicalKey,
+			dst.ProviderBucket, dst.PhysicalKey, status, resp.Header.Get("x-ms-copy-status-description"))
+	}
+	return strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
+func (a *AzureBlobAdapter) StatObject(ctx context.Context, loc ObjectLocation) (ObjectSummary, error) {
+	resp, err := a.do(ctx, http.MethodHead, loc.ProviderBucket, loc.PhysicalKey, nil, nil, nil, 0, http.StatusOK)
+	if err != nil {
+		return ObjectSummary{}, err
+	}
+	resp.Body.Close()
+	modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return ObjectSummary{
+		PhysicalKey:  loc.PhysicalKey,
+		Size:         resp.ContentLength,
+		ETag:         strings.Trim(resp.Header.Get("ETag"), `"`),
+		LastModified: modified,
+	}, nil
+}
+
+// azureBlobList is a page of a List Blobs response.
+type azureBlobList struct {
+	Blobs []struct {
+		Name       string `xml:"Name"`
+		Properties struct {
+			LastModified  string `xml:"Last-Modified"`
+			ETag          string `xml:"Etag"`
+			ContentLength int64  `xml:"Content-Length"`
+		} `xml:"Properties"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+func (a *AzureBlobAdapter) ListObjects(ctx context.Context, loc ObjectLocation, fn func(ObjectSummary) error) error {
+	marker := ""
+	for {
+		q := url.Values{"restype": {"container"}, "comp": {"list"}}
+		if loc.PhysicalKey != "" {
+			q.Set("prefix", loc.PhysicalKey)
+		}
+		if marker != "" {
+			q.Set("marker", marker)
+		}
+		resp, err := a.do(ctx, http.MethodGet, loc.ProviderBucket, "", q, nil, nil, 0, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		var page azureBlobList
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("azure: decode blob list: %w", err)
+		}
+		for _, b := range page.Blobs {
+			modified, _ := http.ParseTime(b.Properties.LastModified)
+			if err := fn(ObjectSummary{
+				PhysicalKey:  b.Name,
+				Size:         b.Properties.ContentLength,
+				ETag:         strings.Trim(b.Properties.ETag, `"`),
+				LastModified: modified,
+			}); err != nil {
+				return err
+			}
+		}
+		if page.NextMarker == "" {
+			return nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+func (a *AzureBlobAdapter) String() string {
+	return fmt.Sprintf("AzureBlobAdapter{%s}", a.endpoint)
+}
@@ -0,0 +1,391 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	azureTestAccount = "myaccount"
+	azureTestKey     = "YXp1cmUgdGVzdCBrZXk=" // "azure test key"
+	azureTestDate    = "Mon, 19 Oct 2026 00:00:00 GMT"
+)
+
+// The expected signatures are the HMAC-SHA256, under the test key, of the
+// strings to sign spelled out as the Shared Key documentation lays them
+// out.
+func TestAzureSign(t *testing.T) {
+	a, err := NewAzureBlobAdapter(AzureConfig{Account: azureTestAccount, SharedKey: azureTestKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		size   int64
+		header map[string]string
+		// the string to sign, for the reader
+		toSign string
+		want   string
+	}{
+		{
+			name:   "put block",
+			method: http.MethodPut,
+			url:    "https://myaccount.blob.core.windows.net/mycontainer/dir/my%20blob?comp=block&blockid=YmxvY2s%3D",
+			size:   5,
+			header: map[string]string{"x-ms-meta-a": " b "},
+			toSign: "PUT\n\n\n5\n\n\n\n\n\n\n\n\n" +
+				"x-ms-date:Mon, 19 Oct 2026 00:00:00 GMT\nx-ms-meta-a:b\nx-ms-version:2021-08-06\n" +
+				"/myaccount/mycontainer/dir/my%20blob\nblockid:YmxvY2s=\ncomp:block",
+			want: "RCsZyAZ2/okNNBJau+7KUtQ8i6E3k61cBFxWCI0EbB8=",
+		},
+		{
+			name:   "list with a range",
+			method: http.MethodGet,
+			url:    "https://myaccount.blob.core.windows.net/mycontainer?restype=container&prefix=a+b&comp=list",
+			header: map[string]string{"x-ms-range": "bytes=0-9"},
+			toSign: "GET\n\n\n\n\n\n\n\n\n\n\n\n" +
+				"x-ms-date:Mon, 19 Oct 2026 00:00:00 GMT\nx-ms-range:bytes=0-9\nx-ms-version:2021-08-06\n" +
+				"/myaccount/mycontainer\ncomp:list\nprefix:a b\nrestype:container",
+			want: "UWh0QDhYZnshXr0RQrrqcrDZXjcDaE/Bx6Pm4AQaUHg=",
+		},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.ContentLength = tt.size
+		req.Header.Set("x-ms-date", azureTestDate)
+		req.Header.Set("x-ms-version", azureAPIVersion)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		if got := a.sign(req); got != tt.want {
+			t.Errorf("%s: signature %s, want %s, the signature of\n%s", tt.name, got, tt.want, tt.toSign)
+		}
+	}
+}
+
+// fakeAzure is an in-memory Blob service that checks every request's
+// signature against the request as it arrived.
+type fakeAzure struct {
+	t *testing.T
+	a *AzureBlobAdapter
+
+	mu       sync.Mutex
+	blobs    map[string][]byte
+	blocks   map[string][]byte      // staged, by path and block ID
+	requests []*http.Request        // in arrival order
+	headers  map[string]http.Header // of the request that created each blob
+}
+
+func newFakeAzure(t *testing.T) (*fakeAzure, *AzureBlobAdapter) {
+	t.Helper()
+	f := &fakeAzure{t: t, blobs: map[string][]byte{}, blocks: map[string][]byte{}, headers: map[string]http.Header{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	a, err := NewAzureBlobAdapter(AzureConfig{Account: azureTestAccount, SharedKey: azureTestKey, Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.a = a
+	return f, a
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r)
+	if want := "SharedKey " + azureTestAccount + ":" + f.a.sign(r); r.Header.Get("Authorization") != want {
+		f.t.Errorf("%s %s: Authorization %q does not sign the request as sent", r.Method, r.URL, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if len(r.TransferEncoding) > 0 {
+		f.t.Errorf("%s %s: sent %v; the service needs a Content-Length", r.Method, r.URL, r.TransferEncoding)
+		w.WriteHeader(http.StatusLengthRequired)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	path, q := r.URL.Path, r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPut && q.Get("comp") == "block":
+		f.blocks[path+"#"+q.Get("blockid")] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && q.Get("comp") == "blocklist":
+		var list struct {
+			Latest []string `xml:"Latest"`
+		}
+		if err := xml.Unmarshal(body, &list); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var blob []byte
+		for _, id := range list.Latest {
+			block, ok := f.blocks[path+"#"+id]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			blob = append(blob, block...)
+		}
+		f.store(w, r, path, blob)
+	case r.Method == http.MethodPut && r.Header.Get("x-ms-copy-source") != "":
+		src, err := url.Parse(r.Header.Get("x-ms-copy-source"))
+		if err != nil || !strings.HasPrefix(src.String(), f.a.endpoint+"/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		blob, ok := f.blobs[src.Path]
+		if !ok {
+			w.Header().Set("x-ms-error-code", "CannotVerifyCopySource")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.blobs[path] = blob
+		f.headers[path] = r.Header.Clone()
+		w.Header().Set("ETag", fmt.Sprintf(`"0x%X"`, len(blob)))
+		w.Header().Set("x-ms-copy-status", "success")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut:
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.store(w, r, path, body)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		blob, ok := f.blobs[path]
+		if !ok {
+			f.notFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"0x%X"`, len(blob)))
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("x-ms-range"), "bytes=%d-%d", &start, &end); err == nil {
+			w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(blob[start : end+1])
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		w.Write(blob)
+	case r.Method == http.MethodDelete:
+		if _, ok := f.blobs[path]; !ok {
+			f.notFound(w, r)
+			return
+		}
+		delete(f.blobs, path)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeAzure) store(w http.ResponseWriter, r *http.Request, path string, blob []byte) {
+	f.blobs[path] = blob
+	f.headers[path] = r.Header.Clone()
+	w.Header().Set("ETag", fmt.Sprintf(`"0x%X"`, len(blob)))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (f *fakeAzure) notFound(w http.ResponseWriter, r *http.Request) {
+	code := "BlobNotFound"
+	if strings.HasPrefix(r.URL.Path, "/missing/") {
+		code = "ContainerNotFound"
+	}
+	w.Header().Set("x-ms-error-code", code)
+	w.WriteHeader(http.StatusNotFound)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>The specified resource does not exist.
+RequestId:0</Message></Error>`, code)
+	}
+}
+
+// calls counts the requests of a method whose query has comp set to comp.
+func (f *fakeAzure) calls(method, comp string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.requests {
+		if r.Method == method && r.URL.Query().Get("comp") == comp {
+			n++
+		}
+	}
+	return n
+}
+
+func TestAzurePut(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), azureBlockSize/16+1)
+	tests := []struct {
+		name   string
+		data   []byte
+		size   int64
+		blocks int // Put Block calls of uploads that are not a single Put Blob
+	}{
+		{name: "small", data: []byte("hello"), size: 5},
+		{name: "empty", data: nil, size: 0},
+		{name: "unknown size", data: []byte("hello"), size: -1, blocks: 1},
+		{name: "unknown size, empty", data: nil, size: -1, blocks: 0},
+		{name: "larger than a block", data: large, size: int64(len(large)), blocks: 2},
+	}
+	for _, tt := range tests {
+		f, a := newFakeAzure(t)
+		loc := ObjectLocation{ProviderBucket: "c", PhysicalKey: "dir/my blob"}
+		// hide the reader's type so that the client cannot learn the size
+		body := io.LimitReader(bytes.NewReader(tt.data), int64(len(tt.data)))
+		etag, err := a.PutObject(context.Background(), loc, body, tt.size, PutOptions{ContentType: "text/plain", Metadata: map[string]string{"k": "v"}})
+		if err != nil {
+			t.Errorf("%s: put: %v", tt.name, err)
+			continue
+		}
+		if want := fmt.Sprintf("0x%X", len(tt.data)); etag != want {
+			t.Errorf("%s: etag %q, want %q", tt.name, etag, want)
+		}
+		if got := f.blobs["/c/dir/my blob"]; !bytes.Equal(got, tt.data) {
+			t.Errorf("%s: stored %d bytes, want %d", tt.name, len(got), len(tt.data))
+		}
+		single := f.calls(http.MethodPut, "")
+		staged, committed := f.calls(http.MethodPut, "block"), f.calls(http.MethodPut, "blocklist")
+		if tt.size >= 0 && tt.size <= azureBlockSize {
+			if single != 1 || staged != 0 || committed != 0 {
+				t.Errorf("%s: %d Put Blob, %d Put Block, %d Put Block List; want one Put Blob", tt.name, single, staged, committed)
+			}
+		} else if single != 0 || staged != tt.blocks || committed != 1 {
+			t.Errorf("%s: %d Put Blob, %d Put Block, %d Put Block List; want %d blocks committed", tt.name, single, staged, committed, tt.blocks)
+		}
+		h := f.headers["/c/dir/my blob"]
+		if h.Get("x-ms-blob-content-type") != "text/plain" || h.Get("x-ms-meta-k") != "v" {
+			t.Errorf("%s: blob created with content type %q and metadata %q", tt.name, h.Get("x-ms-blob-content-type"), h.Get("x-ms-meta-k"))
+		}
+	}
+}
+
+func TestAzureAccessTier(t *testing.T) {
+	for class, want := range map[string]string{"HOT": "Hot", "COLD": "Cool", "ARCHIVE": "Archive", "": "", "WARM": ""} {
+		for _, size := range []int64{5, -1} {
+			f, a := newFakeAzure(t)
+			loc := ObjectLocation{ProviderBucket: "c", PhysicalKey: "k"}
+			if _, err := a.PutObject(context.Background(), loc, strings.NewReader("hello"), size, PutOptions{StorageClass: class}); err != nil {
+				t.Fatalf("put %q: %v", class, err)
+			}
+			if got := f.headers["/c/k"].Get("x-ms-access-tier"); got != want {
+				t.Errorf("class %q, size %d: access tier %q, want %q", class, size, got, want)
+			}
+		}
+	}
+}
+
+func TestAzureGetStatDelete(t *testing.T) {
+	_, a := newFakeAzure(t)
+	ctx := context.Background()
+	loc := ObjectLocation{ProviderBucket: "c", PhysicalKey: "k"}
+	if _, err := a.PutObject(ctx, loc, strings.NewReader("0123456789"), 10, PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readAll(t, a, loc); err != nil || got != "0123456789" {
+		t.Errorf("get = %q, %v", got, err)
+	}
+	body, err := a.GetObjectRange(ctx, loc, 3, 4)
+	if err != nil {
+		t.Fatalf("get range: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "3456" {
+		t.Errorf("range = %q, want 3456", data)
+	}
+	if stat, err := a.StatObject(ctx, loc); err != nil || stat.Size != 10 || stat.ETag != "0xA" {
+		t.Errorf("stat = %+v, %v", stat, err)
+	}
+
+	if err := a.DeleteObject(ctx, loc); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := a.DeleteObject(ctx, loc); err != nil {
+		t.Errorf("delete of a missing blob: %v, want nil", err)
+	}
+	for _, l := range []ObjectLocation{loc, {ProviderBucket: "missing", PhysicalKey: "k"}} {
+		if _, err := readAll(t, a, l); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("get %s/%s: err = %v, want ErrObjectNotFound", l.ProviderBucket, l.PhysicalKey, err)
+		}
+		if _, err := a.GetObjectRange(ctx, l, 0, 1); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("get range %s/%s: err = %v, want ErrObjectNotFound", l.ProviderBucket, l.PhysicalKey, err)
+		}
+		// a HEAD response has no body; the code comes in a header
+		if _, err := a.StatObject(ctx, l); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("stat %s/%s: err = %v, want ErrObjectNotFound", l.ProviderBucket, l.PhysicalKey, err)
+		}
+	}
+}
+
+func TestAzureCopy(t *testing.T) {
+	f, a := newFakeAzure(t)
+	ctx := context.Background()
+	src := ObjectLocation{ProviderBucket: "c", PhysicalKey: "dir/my blob"}
+	dst := ObjectLocation{ProviderBucket: "c", PhysicalKey: "~sha256/abc"}
+	if _, err := a.PutObject(ctx, src, strings.NewReader("hello"), 5, PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	etag, err := a.CopyObject(ctx, src, dst, PutOptions{StorageClass: "COLD"})
+	if err != nil || etag != "0x5" {
+		t.Fatalf("copy = %q, %v", etag, err)
+	}
+	if got, err := readAll(t, a, dst); err != nil || got != "hello" {
+		t.Errorf("get of the copy = %q, %v", got, err)
+	}
+	if got := f.headers["/c/~sha256/abc"].Get("x-ms-access-tier"); got != "Cool" {
+		t.Errorf("copy has access tier %q, want Cool", got)
+	}
+	if f.calls(http.MethodGet, "") != 1 {
+		t.Error("the copy read the source through the adapter")
+	}
+	if _, err := a.CopyObject(ctx, ObjectLocation{ProviderBucket: "c", PhysicalKey: "missing"}, dst, PutOptions{}); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("copy of a missing blob: err = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestAzureError(t *testing.T) {
+	tests := []struct {
+		status   int
+		body     string
+		header   string
+		notFound bool
+	}{
+		{status: 404, body: "<Error><Code>BlobNotFound</Code></Error>", notFound: true},
+		{status: 404, header: "ContainerNotFound", notFound: true},
+		{status: 404, notFound: true},
+		{status: 404, body: "<Error><Code>ResourceNotFound</Code></Error>"},
+		{status: 403, body: "<Error><Code>AuthenticationFailed</Code><Message>Server failed to authenticate the request.\nRequestId:0</Message></Error>"},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{
+			StatusCode: tt.status,
+			Status:     fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status)),
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(tt.body)),
+		}
+		if tt.header != "" {
+			resp.Header.Set("x-ms-error-code", tt.header)
+		}
+		err := azureError(resp, "c", "k")
+		if errors.Is(err, ErrObjectNotFound) != tt.notFound {
+			t.Errorf("%d %q %q: err = %v, want not found %v", tt.status, tt.body, tt.header, err, tt.notFound)
+		}
+		if strings.Contains(err.Error(), "RequestId") {
+			t.Errorf("%d: error %q keeps the message's second line", tt.status, err)
+		}
+	}
+}
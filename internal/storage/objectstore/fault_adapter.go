@@ -0,0 +1,304 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is the error of operations a FaultAdapter fails.
+var ErrInjectedFault = errors.New("injected provider fault")
+
+// Operations of ObjectStorage and Copier, as FaultAdapter tells them apart.
+type Operation string
+
+const (
+	OpPut      Operation = "put"
+	OpGet      Operation = "get"
+	OpGetRange Operation = "get_range"
+	OpDelete   Operation = "delete"
+	OpStat     Operation = "stat"
+	OpList     Operation = "list"
+	OpCopy     Operation = "copy"
+)
+
+// Operations lists every Operation.
+var Operations = []Operation{OpPut, OpGet, OpGetRange, OpDelete, OpStat, OpList, OpCopy}
+
+// FaultConfig makes a FaultAdapter fail operations at random. Draws come
+// from a generator seeded with Seed, so a run with the same calls in the
+// same order fails the same ones.
+type FaultConfig struct {
+	Latency time.Duration // added to every operation
+	Jitter  time.Duration // up to this much more, at random
+
+	ErrorRate float64     // share of operations failing with ErrInjectedFault
+	Ops       []Operation // operations ErrorRate applies to; empty means all
+
+	PartialReadRate  float64 // share of reads whose body fails after PartialReadBytes
+	PartialReadBytes int64
+
+	TruncatedWriteRate  float64 // share of uploads that store only TruncatedWriteBytes and report success
+	TruncatedWriteBytes int64
+
+	Seed int64
+}
+
+// FaultKind is what a scripted Fault does to its operation.
+type FaultKind int
+
+const (
+	// FaultPass runs the operation, after the fault's delay.
+	FaultPass FaultKind = iota
+	// FaultError fails the operation with Err, or ErrInjectedFault.
+	FaultError
+	// FaultPartial cuts the operation's data after Bytes bytes: a read's
+	// body then fails, an upload stores only those bytes and succeeds.
+	// Other operations run normally.
+	FaultPartial
+)
+
+// Fault scripts one call of an operation.
+type Fault struct {
+	Kind  FaultKind
+	Err   error
+	Bytes int64
+	Delay time.Duration
+}
+
+// FaultAdapter wraps an ObjectStorage and injects latency and failures,
+// either at random after FaultConfig or from per-operation scripts that
+// take precedence: the next calls of an operation take the faults scripted
+// for it in order.
+type FaultAdapter struct {
+	inner ObjectStorage
+
+	mu      sync.Mutex
+	cfg     FaultConfig
+	rnd     *rand.Rand
+	scripts map[Operation][]Fault
+	calls   map[Operation]int
+}
+
+func NewFaultAdapter(inner ObjectStorage, cfg FaultConfig) *FaultAdapter {
+	return &FaultAdapter{
+		inner:   inner,
+		cfg:     cfg,
+		rnd:     rand.New(rand.NewSource(cfg.Seed)),
+		scripts: make(map[Operation][]Fault),
+		calls:   make(map[Operation]int),
+	}
+}
+
+// Configure replaces the random faults, e.g. to start or end an outage.
+// The generator is not reseeded.
+func (a *FaultAdapter) Configure(cfg FaultConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cfg = cfg
+}
+
+// Script queues faults for the next calls of op, after those already
+// queued.
+func (a *FaultAdapter) Script(op Operation, faults ...Fault) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.scripts[op] = append(a.scripts[op], faults...)
+}
+
+// FailNext fails the next n calls of op with ErrInjectedFault.
+func (a *FaultAdapter) FailNext(op Operation, n int) {
+	faults := make([]Fault, n)
+	for i := range faults {
+		faults[i] = Fault{Kind: FaultError}
+	}
+	a.Script(op, faults...)
+}
+
+// Reset drops the queued scripts and the call counts.
+func (a *FaultAdapter) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.scripts = make(map[Operation][]Fault)
+	a.calls = make(map[Operation]int)
+}
+
+// Calls reports how many times op was called, failed or not.
+func (a *FaultAdapter) Calls(op Operation) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls[op]
+}
+
+// next decides the fault of one call of op.
+func (a *FaultAdapter) next(op Operation) Fault {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls[op]++
+	if q := a.scripts[op]; len(q) > 0 {
+		a.scripts[op] = q[1:]
+		return q[0]
+	}
+
+	cfg := a.cfg
+	f := Fault{Delay: cfg.Latency}
+	if cfg.Jitter > 0 {
+		f.Delay += time.Duration(a.rnd.Int63n(int64(cfg.Jitter)))
+	}
+	switch {
+	case appliesTo(cfg.Ops, op) && a.hits(cfg.ErrorRate):
+		f.Kind = FaultError
+	case (op == OpGet || op == OpGetRange) && a.hits(cfg.PartialReadRate):
+		f.Kind, f.Bytes = FaultPartial, cfg.PartialReadBytes
+	case op == OpPut && a.hits(cfg.TruncatedWriteRate):
+		f.Kind, f.Bytes = FaultPartial, cfg.TruncatedWriteBytes
+	}
+	return f
+}
+
+func (a *FaultAdapter) hits(rate float64) bool {
+	return rate > 0 && a.rnd.Float64() < rate
+}
+
+func appliesTo(ops []Operation, op Operation) bool {
+	if len(ops) == 0 {
+		return true
+	}
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// begin waits out the fault's delay and returns the error the call fails
+// with, if any.
+func (a *FaultAdapter) begin(ctx context.Context, op Operation, f Fault, loc ObjectLocation) error {
+	if f.Delay > 0 {
+		t := time.NewTimer(f.Delay)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	if f.Kind != FaultError {
+		return nil
+	}
+	if f.Err != nil {
+		return f.Err
+	}
+	return fmt.Errorf("%w: %s %s/%s", ErrInjectedFault, op, loc.ProviderBucket, loc.PhysicalKey)
+}
+
+func (a *FaultAdapter) PutObject(ctx context.Context, loc ObjectLocation, r io.Reader, size int64, opts PutOptions) (string, error) {
+	f := a.next(OpPut)
+	if err := a.begin(ctx, OpPut, f, loc); err != nil {
+		return "", err
+	}
+	if f.Kind == FaultPartial && (size < 0 || f.Bytes < size) {
+		// the rest of the body is read and dropped, as a provider that
+		// lost it would
+		data, err := io.ReadAll(io.LimitReader(r, f.Bytes))
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return "", err
+		}
+		return a.inner.PutObject(ctx, loc, bytes.NewReader(data), int64(len(data)), opts)
+	}
+	return a.inner.PutObject(ctx, loc, r, size, opts)
+}
+
+func (a *FaultAdapter) GetObject(ctx context.Context, loc ObjectLocation) (io.ReadCloser, int64, string, error) {
+	f := a.next(OpGet)
+	if err := a.begin(ctx, OpGet, f, loc); err != nil {
+		return nil, 0, "", err
+	}
+	body, size, contentType, err := a.inner.GetObject(ctx, loc)
+	if err != nil || f.Kind != FaultPartial {
+		return body, size, contentType, err
+	}
+	return cutBody(body, f.Bytes, loc), size, contentType, nil
+}
+
+func (a *FaultAdapter) GetObjectRange(ctx context.Context, loc ObjectLocation, offset, length int64) (io.ReadCloser, error) {
+	f := a.next(OpGetRange)
+	if err := a.begin(ctx, OpGetRange, f, loc); err != nil {
+		return nil, err
+	}
+	body, err := a.inner.GetObjectRange(ctx, loc, offset, length)
+	if err != nil || f.Kind != FaultPartial {
+		return body, err
+	}
+	return cutBody(body, f.Bytes, loc), nil
+}
+
+func (a *FaultAdapter) DeleteObject(ctx context.Context, loc ObjectLocation) error {
+	if err := a.begin(ctx, OpDelete, a.next(OpDelete), loc); err != nil {
+		return err
+	}
+	return a.inner.DeleteObject(ctx, loc)
+}
+
+func (a *FaultAdapter) StatObject(ctx context.Context, loc ObjectLocation) (ObjectSummary, error) {
+	if err := a.begin(ctx, OpStat, a.next(OpStat), loc); err != nil {
+		return ObjectSummary{}, err
+	}
+	return a.inner.StatObject(ctx, loc)
+}
+
+func (a *FaultAdapter) ListObjects(ctx context.Context, loc ObjectLocation, fn func(ObjectSummary) error) error {
+	if err := a.begin(ctx, OpList, a.next(OpList), loc); err != nil {
+		return err
+	}
+	return a.inner.ListObjects(ctx, loc, fn)
+}
+
+// CopyObject copies through the wrapped adapter, which fails with
+// ErrCopyUnsupported unless it is a Copier.
+func (a *FaultAdapter) CopyObject(ctx context.Context, src, dst ObjectLocation, opts PutOptions) (string, error) {
+	c, ok := a.inner.(Copier)
+	if !ok {
+		return "", ErrCopyUnsupported
+	}
+	if err := a.begin(ctx, OpCopy, a.next(OpCopy), src); err != nil {
+		return "", err
+	}
+	return c.CopyObject(ctx, src, dst, opts)
+}
+
+func (a *FaultAdapter) String() string {
+	return fmt.Sprintf("FaultAdapter{%v}", a.inner)
+}
+
+// cutBody returns body failing with ErrInjectedFault after n bytes.
+func cutBody(body io.ReadCloser, n int64, loc ObjectLocation) io.ReadCloser {
+	return &cutReader{ReadCloser: body, left: n, loc: loc}
+}
+
+type cutReader struct {
+	io.ReadCloser
+	left int64
+	loc  ObjectLocation
+}
+
+func (r *cutReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, fmt.Errorf("%w: read cut short %s/%s", ErrInjectedFault, r.loc.ProviderBucket, r.loc.PhysicalKey)
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.left -= int64(n)
+	return n, err
+}
@@ -0,0 +1,202 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var faultLoc = ObjectLocation{ProviderBucket: "b", PhysicalKey: "k"}
+
+func newTestFaultAdapter(t *testing.T, cfg FaultConfig) (*FaultAdapter, *MemoryAdapter) {
+	t.Helper()
+	mem := NewMemoryAdapter()
+	return NewFaultAdapter(mem, cfg), mem
+}
+
+func putString(t *testing.T, s ObjectStorage, loc ObjectLocation, data string) error {
+	t.Helper()
+	_, err := s.PutObject(context.Background(), loc, strings.NewReader(data), int64(len(data)), PutOptions{})
+	return err
+}
+
+func readAll(t *testing.T, s ObjectStorage, loc ObjectLocation) (string, error) {
+	t.Helper()
+	body, _, _, err := s.GetObject(context.Background(), loc)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	return string(data), err
+}
+
+func TestFaultAdapterScript(t *testing.T) {
+	a, _ := newTestFaultAdapter(t, FaultConfig{})
+	boom := errors.New("boom")
+	a.Script(OpPut, Fault{Kind: FaultError, Err: boom}, Fault{Kind: FaultError})
+
+	if err := putString(t, a, faultLoc, "v"); !errors.Is(err, boom) {
+		t.Errorf("first put: err = %v, want the scripted error", err)
+	}
+	if err := putString(t, a, faultLoc, "v"); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("second put: err = %v, want ErrInjectedFault", err)
+	}
+	if err := putString(t, a, faultLoc, "v"); err != nil {
+		t.Errorf("third put: %v, want the script used up", err)
+	}
+	if got, err := readAll(t, a, faultLoc); err != nil || got != "v" {
+		t.Errorf("get = %q, %v", got, err)
+	}
+	if a.Calls(OpPut) != 3 || a.Calls(OpGet) != 1 {
+		t.Errorf("calls = %d puts, %d gets; want 3 and 1", a.Calls(OpPut), a.Calls(OpGet))
+	}
+
+	a.FailNext(OpStat, 2)
+	for i := 0; i < 2; i++ {
+		if _, err := a.StatObject(context.Background(), faultLoc); !errors.Is(err, ErrInjectedFault) {
+			t.Errorf("stat %d: err = %v, want ErrInjectedFault", i, err)
+		}
+	}
+	if _, err := a.StatObject(context.Background(), faultLoc); err != nil {
+		t.Errorf("stat after FailNext: %v", err)
+	}
+
+	a.FailNext(OpDelete, 1)
+	a.Reset()
+	if err := a.DeleteObject(context.Background(), faultLoc); err != nil {
+		t.Errorf("delete after Reset: %v", err)
+	}
+	if a.Calls(OpDelete) != 1 || a.Calls(OpPut) != 0 {
+		t.Errorf("Reset kept the call counts")
+	}
+}
+
+func TestFaultAdapterPartialRead(t *testing.T) {
+	a, _ := newTestFaultAdapter(t, FaultConfig{})
+	if err := putString(t, a, faultLoc, "0123456789"); err != nil {
+		t.Fatal(err)
+	}
+
+	a.Script(OpGet, Fault{Kind: FaultPartial, Bytes: 4})
+	got, err := readAll(t, a, faultLoc)
+	if !errors.Is(err, ErrInjectedFault) || got != "0123" {
+		t.Errorf("cut get = %q, %v; want 4 bytes then ErrInjectedFault", got, err)
+	}
+
+	a.Script(OpGetRange, Fault{Kind: FaultPartial, Bytes: 2})
+	body, err := a.GetObjectRange(context.Background(), faultLoc, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if !errors.Is(err, ErrInjectedFault) || string(data) != "34" {
+		t.Errorf("cut range = %q, %v; want 2 bytes then ErrInjectedFault", data, err)
+	}
+
+	// a cut longer than the body changes nothing
+	a.Script(OpGet, Fault{Kind: FaultPartial, Bytes: 100})
+	if got, err := readAll(t, a, faultLoc); err != nil || got != "0123456789" {
+		t.Errorf("get = %q, %v", got, err)
+	}
+}
+
+func TestFaultAdapterTruncatedWrite(t *testing.T) {
+	a, mem := newTestFaultAdapter(t, FaultConfig{})
+	a.Script(OpPut, Fault{Kind: FaultPartial, Bytes: 3})
+
+	body := strings.NewReader("0123456789")
+	if _, err := a.PutObject(context.Background(), faultLoc, body, 10, PutOptions{}); err != nil {
+		t.Fatalf("truncated put reported %v, want success", err)
+	}
+	if body.Len() != 0 {
+		t.Errorf("%d bytes of the body left unread", body.Len())
+	}
+	if got, err := readAll(t, mem, faultLoc); err != nil || got != "012" {
+		t.Errorf("stored %q, %v; want the first 3 bytes", got, err)
+	}
+}
+
+func TestFaultAdapterDelay(t *testing.T) {
+	a, _ := newTestFaultAdapter(t, FaultConfig{})
+	a.Script(OpStat, Fault{Delay: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := a.StatObject(ctx, faultLoc); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("delayed stat: err = %v, want the context's error", err)
+	}
+}
+
+func TestFaultAdapterRandomFaults(t *testing.T) {
+	run := func() []bool {
+		a, _ := newTestFaultAdapter(t, FaultConfig{ErrorRate: 0.5, Ops: []Operation{OpPut}, Seed: 42})
+		var failed []bool
+		for i := 0; i < 32; i++ {
+			failed = append(failed, putString(t, a, faultLoc, "v") != nil)
+		}
+		// operations outside Ops never fail
+		if _, err := a.StatObject(context.Background(), faultLoc); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("stat: %v", err)
+		}
+		return failed
+	}
+	first, second := run(), run()
+	n := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("put %d failed in one run only; the seed should replay the faults", i)
+		}
+		if first[i] {
+			n++
+		}
+	}
+	if n == 0 || n == len(first) {
+		t.Errorf("%d of %d puts failed at rate 0.5", n, len(first))
+	}
+
+	a, mem := newTestFaultAdapter(t, FaultConfig{TruncatedWriteRate: 1, TruncatedWriteBytes: 1, PartialReadRate: 1, PartialReadBytes: 2})
+	if err := putString(t, a, faultLoc, "abcdef"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := readAll(t, mem, faultLoc); got != "a" {
+		t.Errorf("stored %q, want a truncated write", got)
+	}
+	if err := putString(t, mem, faultLoc, "abcdef"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readAll(t, a, faultLoc); !errors.Is(err, ErrInjectedFault) || got != "ab" {
+		t.Errorf("get = %q, %v; want a partial read", got, err)
+	}
+}
+
+func TestFaultAdapterCopy(t *testing.T) {
+	a, mem := newTestFaultAdapter(t, FaultConfig{})
+	ctx := context.Background()
+	dst := ObjectLocation{ProviderBucket: "b", PhysicalKey: "copy"}
+	if err := putString(t, a, faultLoc, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	a.FailNext(OpCopy, 1)
+	if _, err := a.CopyObject(ctx, faultLoc, dst, PutOptions{}); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("copy with a fault: err = %v, want ErrInjectedFault", err)
+	}
+	if _, err := a.CopyObject(ctx, faultLoc, dst, PutOptions{ContentType: "text/plain"}); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if got, err := readAll(t, mem, dst); err != nil || got != "hello" {
+		t.Errorf("get of the copy = %q, %v", got, err)
+	}
+	if a.Calls(OpCopy) != 2 || a.Calls(OpGet) != 0 {
+		t.Errorf("%d copies, %d gets; want 2 copies", a.Calls(OpCopy), a.Calls(OpGet))
+	}
+
+	// an adapter that cannot copy says so
+	plain := NewFaultAdapter(struct{ ObjectStorage }{mem}, FaultConfig{})
+	if _, err := plain.CopyObject(ctx, faultLoc, dst, PutOptions{}); !errors.Is(err, ErrCopyUnsupported) {
+		t.Errorf("copy through a non-copier: err = %v, want ErrCopyUnsupported", err)
+	}
+}
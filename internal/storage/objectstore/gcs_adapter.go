@@ -3,7 +3,9 @@ package objectstore
 import (
 	"cloud.google.com/go/storage"
 	"context"
+	"errors"
 	"fmt"
+	"google.golang.org/api/iterator"
 	"io"
 	"time"
 )
@@ -43,6 +45,9 @@ func (a *GCSAdapter) PutObject(ctx context.Context, loc ObjectLocation, r io.Rea
 
 func (a *GCSAdapter) GetObject(ctx context.Context, loc ObjectLocation) (io.ReadCloser, int64, string, error) {
 	rc, err := a.client.Bucket(loc.ProviderBucket).Object(loc.PhysicalKey).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, 0, "", fmt.Errorf("%w: %s/%s", ErrObjectNotFound, loc.ProviderBucket, loc.PhysicalKey)
+	}
 	if err != nil {
 		return nil, 0, "", err
 	}
@@ -50,10 +55,77 @@ func (a *GCSAdapter) GetObject(ctx context.Context, loc ObjectLocation) (io.Read
 	return rc, rc.Attrs.Size, rc.ContentType(), nil
 }
 
+func (a *GCSAdapter) GetObjectRange(ctx context.Context, loc ObjectLocation, offset, length int64) (io.ReadCloser, error) {
+	rc, err := a.client.Bucket(loc.ProviderBucket).Object(loc.PhysicalKey).NewRangeReader(ctx, offset, length)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, loc.ProviderBucket, loc.PhysicalKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
 func (a *GCSAdapter) DeleteObject(ctx context.Context, loc ObjectLocation) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	return a.client.Bucket(loc.ProviderBucket).Object(loc.PhysicalKey).Delete(ctx)
+	err := a.client.Bucket(loc.ProviderBucket).Object(loc.PhysicalKey).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil // deletes are idempotent, as on S3
+	}
+	return err
+}
+
+// CopyObject copies with the rewrite API, which takes several calls for
+// large objects; Run makes them.
+func (a *GCSAdapter) CopyObject(ctx context.Context, src, dst ObjectLocation, opts PutOptions) (string, error) {
+	c := a.client.Bucket(dst.ProviderBucket).Object(dst.PhysicalKey).CopierFrom(a.client.Bucket(src.ProviderBucket).Object(src.PhysicalKey))
+	c.ContentType = opts.ContentType
+	attrs, err := c.Run(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return "", fmt.Errorf("%w: %s/%s", ErrObjectNotFound, src.ProviderBucket, src.PhysicalKey)
+	}
+	if err != nil {
+		return "", err
+	}
+	return attrs.Etag, nil
+}
+
+func (a *GCSAdapter) StatObject(ctx context.Context, loc ObjectLocation) (ObjectSummary, error) {
+	attrs, err := a.client.Bucket(loc.ProviderBucket).Object(loc.PhysicalKey).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ObjectSummary{}, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, loc.ProviderBucket, loc.PhysicalKey)
+	}
+	if err != nil {
+		return ObjectSummary{}, err
+	}
+	return ObjectSummary{
+		PhysicalKey:  attrs.Name,
+		Size:         attrs.Size,
+		ETag:         attrs.Etag,
+		LastModified: attrs.Updated,
+	}, nil
+}
+
+func (a *GCSAdapter) ListObjects(ctx context.Context, loc ObjectLocation, fn func(ObjectSummary) error) error {
+	it := a.client.Bucket(loc.ProviderBucket).Objects(ctx, &storage.Query{Prefix: loc.PhysicalKey})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(ObjectSummary{
+			PhysicalKey:  attrs.Name,
+			Size:         attrs.Size,
+			ETag:         attrs.Etag,
+			LastModified: attrs.Updated,
+		}); err != nil {
+			return err
+		}
+	}
 }
 
 func (a *GCSAdapter) String() string {
@@ -2,7 +2,9 @@ package objectstore
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
 )
 
 type ProviderType string
@@ -11,6 +13,9 @@ const (
 	ProviderAWS_S3  ProviderType = "AWS_S3"
 	ProviderCF_R2   ProviderType = "CF_R2"
 	ProviderGCP_GCS ProviderType = "GCP_GCS"
+	ProviderLocalFS ProviderType = "LOCAL_FS"
+	ProviderMemory  ProviderType = "MEMORY"
+	ProviderAzure   ProviderType = "AZURE_BLOB"
 )
 
 type ObjectLocation struct {
@@ -26,8 +31,42 @@ type PutOptions struct {
 	StorageClass string // HOT/COLD/ARCHIVE
 }
 
+// ObjectSummary is one entry of a provider bucket listing.
+type ObjectSummary struct {
+	PhysicalKey  string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// ErrObjectNotFound is returned, possibly wrapped, by GetObject,
+// GetObjectRange and StatObject when there is no object at the location.
+var ErrObjectNotFound = errors.New("physical object not found")
+
+// ErrCopyUnsupported is returned by CopyObject when the provider behind an
+// adapter cannot copy objects itself.
+var ErrCopyUnsupported = errors.New("provider-side copy not supported")
+
 type ObjectStorage interface {
 	PutObject(ctx context.Context, loc ObjectLocation, r io.Reader, size int64, opts PutOptions) (etag string, err error)
 	GetObject(ctx context.Context, loc ObjectLocation) (body io.ReadCloser, size int64, contentType string, err error)
+	// GetObjectRange reads length bytes of the object at loc starting at
+	// offset.
+	GetObjectRange(ctx context.Context, loc ObjectLocation, offset, length int64) (io.ReadCloser, error)
 	DeleteObject(ctx context.Context, loc ObjectLocation) error
+	// StatObject returns the size, ETag and modification time of the object
+	// at loc without reading it.
+	StatObject(ctx context.Context, loc ObjectLocation) (ObjectSummary, error)
+	// ListObjects calls fn for every object in loc.ProviderBucket whose key
+	// starts with loc.PhysicalKey, in key order. It stops at the first error
+	// fn returns and returns it.
+	ListObjects(ctx context.Context, loc ObjectLocation, fn func(ObjectSummary) error) error
+}
+
+// Copier is implemented by adapters whose provider copies an object within
+// a provider bucket without the bytes passing through the gateway. The copy
+// at dst takes its storage class, and its content type where the provider
+// lets a copy change it, from opts.
+type Copier interface {
+	CopyObject(ctx context.Context, src, dst ObjectLocation, opts PutOptions) (etag string, err error)
 }
@@ -0,0 +1,447 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directories of a provider bucket under the adapter's root. Sidecars
+// mirror the data tree, so any key that fits one fits the other.
+const (
+	localDataDir = "data"
+	localMetaDir = "meta"
+	localTmpDir  = "tmp" // uploads in progress, renamed into data when done
+)
+
+// LocalFSAdapter stores objects as files under a root directory:
+// root/<provider bucket>/data/<physical key>. Each object has a JSON sidecar
+// with its content type and ETag, the hex MD5 of the content. Uploads are
+// written to a temporary file and renamed into place, so readers never see
+// a partial object. A sidecar names the size and modification time of the
+// data file it describes; one that does not match the data file, left by a
+// crash between the two renames, is ignored and the ETag is computed from
+// the content.
+type LocalFSAdapter struct {
+	root  string
+	fsync bool
+}
+
+type LocalFSConfig struct {
+	Root  string
+	Fsync bool // sync files and directories before a write returns
+}
+
+// localSidecar is what the adapter keeps next to each object. Sidecars
+// written before Size and ModTime were recorded have them zero.
+type localSidecar struct {
+	ContentType  string            `json:"content_type,omitempty"`
+	ETag         string            `json:"etag"`
+	StorageClass string            `json:"storage_class,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Size         int64             `json:"size,omitempty"`
+	ModTime      int64             `json:"mod_time,omitempty"` // of the data file, in Unix nanoseconds
+}
+
+// describes reports whether sc was written for the data file with info.
+func (sc localSidecar) describes(info fs.FileInfo) bool {
+	if sc.ModTime == 0 {
+		return true
+	}
+	return sc.Size == info.Size() && sc.ModTime == info.ModTime().UnixNano()
+}
+
+func NewLocalFSAdapter(cfg LocalFSConfig) (*LocalFSAdapter, error) {
+	if cfg.Root == "" {
+		return nil, errors.New("local fs: root is required")
+	}
+	root, err := filepath.Abs(cfg.Root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalFSAdapter{root: root, fsync: cfg.Fsync}, nil
+}
+
+// bucketDir returns the directory of a provider bucket, which must be a
+// single path element.
+func (a *LocalFSAdapter) bucketDir(bucket string) (string, error) {
+	if bucket == "" || bucket == "." || bucket == ".." || strings.ContainsAny(bucket, "/\\\x00") {
+		return "", fmt.Errorf("local fs: invalid bucket %q", bucket)
+	}
+	return filepath.Join(a.root, bucket), nil
+}
+
+// validKey rejects keys that would not stay inside the bucket's tree or
+// that do not map to one file: absolute paths, empty, "." and ".."
+// elements, backslashes and NUL bytes. A prefix may end in "/".
+func validKey(key string, prefix bool) bool {
+	if strings.ContainsAny(key, "\\\x00") || strings.HasPrefix(key, "/") {
+		return false
+	}
+	if prefix {
+		if key == "" {
+			return true
+		}
+		key = strings.TrimSuffix(key, "/")
+	}
+	for _, elem := range strings.Split(key, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// paths returns the data file and sidecar of the object at loc.
+func (a *LocalFSAdapter) paths(loc ObjectLocation) (data, meta string, err error) {
+	dir, err := a.bucketDir(loc.ProviderBucket)
+	if err != nil {
+		return "", "", err
+	}
+	if !validKey(loc.PhysicalKey, false) {
+		return "", "", fmt.Errorf("local fs: invalid key %q", loc.PhysicalKey)
+	}
+	rel := filepath.FromSlash(loc.PhysicalKey)
+	return filepath.Join(dir, localDataDir, rel), filepath.Join(dir, localMetaDir, rel), nil
+}
+
+func (a *LocalFSAdapter) PutObject(ctx context.Context, loc ObjectLocation, r io.Reader, size int64, opts PutOptions) (string, error) {
+	data, meta, err := a.paths(loc)
+	if err != nil {
+		return "", err
+	}
+	dir, _ := a.bucketDir(loc.ProviderBucket)
+	tmpDir := filepath.Join(dir, localTmpDir)
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(tmpDir, "put-*")
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // gone already once renamed
+
+	sum := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, sum), &ctxReader{ctx: ctx, r: r})
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("local fs: wrote %d bytes of %d", n, size)
+	}
+	if err == nil && a.fsync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	var info fs.FileInfo
+	if err == nil {
+		info, err = os.Stat(tmp) // the rename keeps the modification time
+	}
+	if err != nil {
+		return "", err
+	}
+
+	etag := hex.EncodeToString(sum.Sum(nil))
+	sidecar, err := json.Marshal(localSidecar{
+		ContentType:  opts.ContentType,
+		ETag:         etag,
+		StorageClass: opts.StorageClass,
+		Metadata:     opts.Metadata,
+		Size:         info.Size(),
+		ModTime:      info.ModTime().UnixNano(),
+	})
+	if err != nil {
+		return "", err
+	}
+	// the data goes first; until the sidecar follows, the old one does not
+	// describe it and is ignored
+	if err := a.rename(tmp, data); err != nil {
+		return "", err
+	}
+	if err := a.writeFile(tmpDir, meta, sidecar); err != nil {
+		return "", err
+	}
+	return etag, nil
+}
+
+// writeFile replaces path with content atomically.
+func (a *LocalFSAdapter) writeFile(tmpDir, path string, content []byte) error {
+	f, err := os.CreateTemp(tmpDir, "meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(content)
+	if err == nil && a.fsync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return a.rename(f.Name(), path)
+}
+
+// rename moves a finished temporary file to path, creating its parent
+// directories, and syncs the directory when the adapter fsyncs.
+func (a *LocalFSAdapter) rename(tmp, path string) error {
+	dir := filepath.Dir(path)
+	var err error
+	// a delete emptying the directory may remove it between the two steps
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		if err = os.Rename(tmp, path); !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !a.fsync {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (a *LocalFSAdapter) GetObject(ctx context.Context, loc ObjectLocation) (io.ReadCloser, int64, string, error) {
+	data, meta, err := a.paths(loc)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	f, err := a.open(loc, data)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, "", err
+	}
+	sc, err := readSidecar(meta)
+	if err != nil || !sc.describes(info) {
+		sc = localSidecar{}
+	}
+	return f, info.Size(), sc.ContentType, nil
+}
+
+func (a *LocalFSAdapter) GetObjectRange(ctx context.Context, loc ObjectLocation, offset, length int64) (io.ReadCloser, error) {
+	data, _, err := a.paths(loc)
+	if err != nil {
+		return nil, err
+	}
+	f, err := a.open(loc, data)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+// open opens the data file of the object at loc.
+func (a *LocalFSAdapter) open(loc ObjectLocation, data string) (*os.File, error) {
+	f, err := os.Open(data)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, loc.ProviderBucket, loc.PhysicalKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		// a prefix of other keys, not an object
+		f.Close()
+		return nil, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, loc.ProviderBucket, loc.PhysicalKey)
+	}
+	return f, nil
+}
+
+func (a *LocalFSAdapter) DeleteObject(ctx context.Context, loc ObjectLocation) error {
+	data, meta, err := a.paths(loc)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Lstat(data); err != nil || info.IsDir() {
+		return nil // no object; a directory is a prefix of other keys
+	}
+	if err := os.Remove(data); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(meta); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	dir, _ := a.bucketDir(loc.ProviderBucket)
+	removeEmptyParents(data, filepath.Join(dir, localDataDir))
+	removeEmptyParents(meta, filepath.Join(dir, localMetaDir))
+	return nil
+}
+
+// removeEmptyParents removes the directories between path and stop that
+// deleting path left empty. A directory another write just created stays
+// because it is not empty, or is created again by that write's rename.
+func removeEmptyParents(path, stop string) {
+	for dir := filepath.Dir(path); dir != stop && strings.HasPrefix(dir, stop); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+func (a *LocalFSAdapter) StatObject(ctx context.Context, loc ObjectLocation) (ObjectSummary, error) {
+	data, meta, err := a.paths(loc)
+	if err != nil {
+		return ObjectSummary{}, err
+	}
+	info, err := os.Stat(data)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return ObjectSummary{}, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, loc.ProviderBucket, loc.PhysicalKey)
+	}
+	if err != nil {
+		return ObjectSummary{}, err
+	}
+	return a.summary(loc.PhysicalKey, data, meta, info)
+}
+
+// summary describes an object; an object whose sidecar is missing or does
+// not describe its data file gets its ETag computed from the content.
+func (a *LocalFSAdapter) summary(key, data, meta string, info fs.FileInfo) (ObjectSummary, error) {
+	sc, err := readSidecar(meta)
+	if err != nil || !sc.describes(info) {
+		if sc.ETag, err = hashFile(data); err != nil {
+			return ObjectSummary{}, err
+		}
+	}
+	return ObjectSummary{
+		PhysicalKey:  key,
+		Size:         info.Size(),
+		ETag:         sc.ETag,
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func readSidecar(path string) (localSidecar, error) {
+	var sc localSidecar
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return sc, err
+	}
+	err = json.Unmarshal(b, &sc)
+	return sc, err
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum := md5.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func (a *LocalFSAdapter) ListObjects(ctx context.Context, loc ObjectLocation, fn func(ObjectSummary) error) error {
+	dir, err := a.bucketDir(loc.ProviderBucket)
+	if err != nil {
+		return err
+	}
+	prefix := loc.PhysicalKey
+	if !validKey(prefix, true) {
+		return fmt.Errorf("local fs: invalid prefix %q", prefix)
+	}
+	dataDir := filepath.Join(dir, localDataDir)
+	// walk only the directory the prefix ends in
+	start := dataDir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		start = filepath.Join(dataDir, filepath.FromSlash(prefix[:i]))
+	}
+
+	// directories sort before their siblings that share a name prefix, so
+	// the walk is not in key order
+	var keys []string
+	err = filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(dataDir, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, meta, _ := a.paths(ObjectLocation{ProviderBucket: loc.ProviderBucket, PhysicalKey: key})
+		info, err := os.Stat(data)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // deleted since the walk
+		}
+		if err != nil {
+			return err
+		}
+		obj, err := a.summary(key, data, meta, info)
+		if err != nil {
+			return err
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *LocalFSAdapter) String() string {
+	return fmt.Sprintf("LocalFSAdapter{%s}", a.root)
+}
+
+// ctxReader stops an upload when its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,184 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestLocalFS(t *testing.T) *LocalFSAdapter {
+	t.Helper()
+	a, err := NewLocalFSAdapter(LocalFSConfig{Root: filepath.Join(t.TempDir(), "root")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key    string
+		prefix bool
+		want   bool
+	}{
+		{key: "a", want: true},
+		{key: "a/b/c.txt", want: true},
+		{key: "a..b", want: true},
+		{key: "", want: false},
+		{key: "", prefix: true, want: true},
+		{key: "a/", want: false},
+		{key: "a/", prefix: true, want: true},
+		{key: ".", want: false},
+		{key: "..", want: false},
+		{key: "../etc/passwd", want: false},
+		{key: "a/../../b", want: false},
+		{key: "a/./b", want: false},
+		{key: "a//b", want: false},
+		{key: "../", prefix: true, want: false},
+		{key: "/etc/passwd", want: false},
+		{key: "/", prefix: true, want: false},
+		{key: `a\b`, want: false},
+		{key: `..\..\b`, want: false},
+		{key: "a\x00b", want: false},
+		{key: "a\x00", prefix: true, want: false},
+	}
+	for _, tt := range tests {
+		if got := validKey(tt.key, tt.prefix); got != tt.want {
+			t.Errorf("validKey(%q, %v) = %v, want %v", tt.key, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestBucketDir(t *testing.T) {
+	a := newTestLocalFS(t)
+	tests := []struct {
+		bucket string
+		ok     bool
+	}{
+		{bucket: "bucket", ok: true},
+		{bucket: "my.bucket-1", ok: true},
+		{bucket: "", ok: false},
+		{bucket: ".", ok: false},
+		{bucket: "..", ok: false},
+		{bucket: "a/b", ok: false},
+		{bucket: "../b", ok: false},
+		{bucket: "/abs", ok: false},
+		{bucket: `a\b`, ok: false},
+		{bucket: "a\x00", ok: false},
+	}
+	for _, tt := range tests {
+		dir, err := a.bucketDir(tt.bucket)
+		if (err == nil) != tt.ok {
+			t.Errorf("bucketDir(%q) = %q, %v; want ok %v", tt.bucket, dir, err, tt.ok)
+			continue
+		}
+		if err == nil && filepath.Dir(dir) != a.root {
+			t.Errorf("bucketDir(%q) = %q, not directly under %q", tt.bucket, dir, a.root)
+		}
+	}
+}
+
+func TestLocalFSRejectsEscapingKeys(t *testing.T) {
+	a := newTestLocalFS(t)
+	ctx := context.Background()
+	for _, key := range []string{"../escape", "a/../../escape", "/escape", `..\escape`, "esc\x00ape"} {
+		loc := ObjectLocation{ProviderBucket: "b", PhysicalKey: key}
+		if _, err := a.PutObject(ctx, loc, strings.NewReader("x"), 1, PutOptions{}); err == nil {
+			t.Errorf("put %q succeeded", key)
+		}
+		if _, _, _, err := a.GetObject(ctx, loc); err == nil || errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("get %q: err = %v, want an invalid key error", key, err)
+		}
+		if err := a.DeleteObject(ctx, loc); err == nil {
+			t.Errorf("delete %q succeeded", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(a.root), "escape")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a file was written outside the root: %v", err)
+	}
+}
+
+func TestLocalFSPutGet(t *testing.T) {
+	a := newTestLocalFS(t)
+	ctx := context.Background()
+	loc := ObjectLocation{ProviderBucket: "b", PhysicalKey: "dir/obj"}
+
+	etag, err := a.PutObject(ctx, loc, strings.NewReader("hello"), 5, PutOptions{ContentType: "text/plain"})
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if etag != md5Hex("hello") {
+		t.Errorf("etag = %s, want the MD5 of the content", etag)
+	}
+	body, size, contentType, err := a.GetObject(ctx, loc)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "hello" || size != 5 || contentType != "text/plain" {
+		t.Errorf("get = %q, %d, %q", data, size, contentType)
+	}
+
+	if _, err := a.PutObject(ctx, loc, strings.NewReader("short"), 9, PutOptions{}); err == nil {
+		t.Error("put of a short body succeeded")
+	}
+	if stat, err := a.StatObject(ctx, loc); err != nil || stat.ETag != etag {
+		t.Errorf("stat after a failed put = %+v, %v; want the first version", stat, err)
+	}
+}
+
+// A crash after the data file is renamed into place and before its sidecar
+// is leaves the previous object's sidecar behind.
+func TestLocalFSStaleSidecar(t *testing.T) {
+	a := newTestLocalFS(t)
+	ctx := context.Background()
+	loc := ObjectLocation{ProviderBucket: "b", PhysicalKey: "obj"}
+	if _, err := a.PutObject(ctx, loc, strings.NewReader("v1"), 2, PutOptions{ContentType: "text/plain"}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	data, meta, _ := a.paths(loc)
+	if err := os.WriteFile(data, []byte("version 2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := a.StatObject(ctx, loc)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if stat.ETag != md5Hex("version 2") {
+		t.Errorf("etag = %s, want the MD5 of the data file %s", stat.ETag, md5Hex("version 2"))
+	}
+	var listed []ObjectSummary
+	if err := a.ListObjects(ctx, ObjectLocation{ProviderBucket: "b"}, func(o ObjectSummary) error {
+		listed = append(listed, o)
+		return nil
+	}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ETag != md5Hex("version 2") {
+		t.Errorf("listed %+v, want obj with the data file's ETag", listed)
+	}
+	if _, _, contentType, err := a.GetObject(ctx, loc); err != nil || contentType != "" {
+		t.Errorf("get: content type %q, %v; want none from the stale sidecar", contentType, err)
+	}
+
+	// sidecars from before sizes and times were recorded are trusted
+	if err := os.WriteFile(meta, []byte(`{"etag":"legacy"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if stat, err := a.StatObject(ctx, loc); err != nil || stat.ETag != "legacy" {
+		t.Errorf("stat with a legacy sidecar = %+v, %v", stat, err)
+	}
+}
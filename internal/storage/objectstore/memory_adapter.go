@@ -0,0 +1,155 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryAdapter keeps objects in process memory. Everything is lost when
+// the process exits; it serves development setups and tests of the code
+// above the adapters. ETags are the hex MD5 of the content.
+type MemoryAdapter struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string]*memoryObject // by provider bucket, then physical key
+}
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	etag        string
+	modified    time.Time
+}
+
+func NewMemoryAdapter() *MemoryAdapter {
+	return &MemoryAdapter{buckets: make(map[string]map[string]*memoryObject)}
+}
+
+func (a *MemoryAdapter) PutObject(ctx context.Context, loc ObjectLocation, r io.Reader, size int64, opts PutOptions) (string, error) {
+	data, err := io.ReadAll(&ctxReader{ctx: ctx, r: r})
+	if err != nil {
+		return "", err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return "", fmt.Errorf("memory: read %d bytes of %d", len(data), size)
+	}
+	sum := md5.Sum(data)
+	obj := &memoryObject{
+		data:        data,
+		contentType: opts.ContentType,
+		etag:        hex.EncodeToString(sum[:]),
+		modified:    time.Now(),
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := a.buckets[loc.ProviderBucket]
+	if b == nil {
+		b = make(map[string]*memoryObject)
+		a.buckets[loc.ProviderBucket] = b
+	}
+	b[loc.PhysicalKey] = obj
+	return obj.etag, nil
+}
+
+// CopyObject shares src's content with dst.
+func (a *MemoryAdapter) CopyObject(ctx context.Context, src, dst ObjectLocation, opts PutOptions) (string, error) {
+	obj, err := a.get(src)
+	if err != nil {
+		return "", err
+	}
+	cp := &memoryObject{data: obj.data, contentType: opts.ContentType, etag: obj.etag, modified: time.Now()}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := a.buckets[dst.ProviderBucket]
+	if b == nil {
+		b = make(map[string]*memoryObject)
+		a.buckets[dst.ProviderBucket] = b
+	}
+	b[dst.PhysicalKey] = cp
+	return cp.etag, nil
+}
+
+// get returns the object at loc. Objects are replaced, never modified, so
+// their data can be read without the lock.
+func (a *MemoryAdapter) get(loc ObjectLocation) (*memoryObject, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	obj, ok := a.buckets[loc.ProviderBucket][loc.PhysicalKey]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, loc.ProviderBucket, loc.PhysicalKey)
+	}
+	return obj, nil
+}
+
+func (a *MemoryAdapter) GetObject(ctx context.Context, loc ObjectLocation) (io.ReadCloser, int64, string, error) {
+	obj, err := a.get(loc)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), int64(len(obj.data)), obj.contentType, nil
+}
+
+func (a *MemoryAdapter) GetObjectRange(ctx context.Context, loc ObjectLocation, offset, length int64) (io.ReadCloser, error) {
+	obj, err := a.get(loc)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(io.NewSectionReader(bytes.NewReader(obj.data), offset, length)), nil
+}
+
+func (a *MemoryAdapter) DeleteObject(ctx context.Context, loc ObjectLocation) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.buckets[loc.ProviderBucket], loc.PhysicalKey)
+	return nil
+}
+
+func (a *MemoryAdapter) StatObject(ctx context.Context, loc ObjectLocation) (ObjectSummary, error) {
+	obj, err := a.get(loc)
+	if err != nil {
+		return ObjectSummary{}, err
+	}
+	return obj.summary(loc.PhysicalKey), nil
+}
+
+func (a *MemoryAdapter) ListObjects(ctx context.Context, loc ObjectLocation, fn func(ObjectSummary) error) error {
+	// fn may call back into the adapter, so it runs on a snapshot
+	a.mu.RLock()
+	var objs []ObjectSummary
+	for key, obj := range a.buckets[loc.ProviderBucket] {
+		if strings.HasPrefix(key, loc.PhysicalKey) {
+			objs = append(objs, obj.summary(key))
+		}
+	}
+	a.mu.RUnlock()
+	sort.Slice(objs, func(i, j int) bool { return objs[i].PhysicalKey < objs[j].PhysicalKey })
+	for _, obj := range objs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *memoryObject) summary(key string) ObjectSummary {
+	return ObjectSummary{
+		PhysicalKey:  key,
+		Size:         int64(len(o.data)),
+		ETag:         o.etag,
+		LastModified: o.modified,
+	}
+}
+
+func (a *MemoryAdapter) String() string {
+	return fmt.Sprintf("MemoryAdapter{%p}", a)
+}
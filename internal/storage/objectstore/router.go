@@ -23,6 +23,17 @@ type RouteResult struct {
 // ObjectRoute maps logical info to a physical provider/bucket.
 type ObjectRoute interface {
 	ResolveRoute(key RouteKey) (RouteResult, error)
+	// ResolveReplicas returns the replica targets of the route for key.
+	ResolveReplicas(key RouteKey) []RouteResult
+	// ResolveFallbacks returns the locations that take writes, in order,
+	// while the route's provider is failing.
+	ResolveFallbacks(key RouteKey) []RouteResult
+	// WriteQuorum returns how many of the route's locations, the provider
+	// and its replicas, must store a write before it is acknowledged; 1
+	// when only the provider is written synchronously.
+	WriteQuorum(key RouteKey) int
+	// Routes lists every configured route.
+	Routes() []RouteResultWithKey
 }
 
 type StaticRouter struct {
@@ -30,8 +41,18 @@ type StaticRouter struct {
 }
 
 type RouteResultWithKey struct {
-	Key    RouteKey
-	Result RouteResult
+	Key         RouteKey
+	Result      RouteResult
+	Replicas    []RouteResult
+	Fallbacks   []RouteResult
+	WriteQuorum int
+}
+
+// Locations lists every location the route writes to: its provider, its
+// replicas and its fallbacks.
+func (r RouteResultWithKey) Locations() []RouteResult {
+	locs := append([]RouteResult{r.Result}, r.Replicas...)
+	return append(locs, r.Fallbacks...)
 }
 
 func NewStaticRouter(cfg config.ObjectStorageConfig) *StaticRouter {
@@ -59,11 +80,32 @@ func NewStaticRouter(cfg config.ObjectStorageConfig) *StaticRouter {
 				ProviderRegion: p.Region,
 				ProviderBucket: r.ProviderBucket,
 			},
+			Replicas:    targetRoutes(providers, r.Replicas),
+			Fallbacks:   targetRoutes(providers, r.Fallbacks),
+			WriteQuorum: max(r.WriteQuorum, 1),
 		})
 	}
 	return &StaticRouter{routes: rs}
 }
 
+// targetRoutes resolves route targets, skipping unknown providers.
+func targetRoutes(providers map[string]config.ProviderConfig, targets []config.RouteTarget) []RouteResult {
+	var rs []RouteResult
+	for _, t := range targets {
+		p, ok := providers[t.ProviderName]
+		if !ok {
+			continue
+		}
+		rs = append(rs, RouteResult{
+			ProviderName:   p.Name,
+			ProviderType:   ProviderType(p.Type),
+			ProviderRegion: p.Region,
+			ProviderBucket: t.ProviderBucket,
+		})
+	}
+	return rs
+}
+
 func (s *StaticRouter) ResolveRoute(key RouteKey) (RouteResult, error) {
 	for _, r := range s.routes {
 		if r.Key == key {
@@ -72,3 +114,34 @@ func (s *StaticRouter) ResolveRoute(key RouteKey) (RouteResult, error) {
 	}
 	return RouteResult{}, fmt.Errorf("no route for %+v", key)
 }
+
+func (s *StaticRouter) ResolveReplicas(key RouteKey) []RouteResult {
+	for _, r := range s.routes {
+		if r.Key == key {
+			return r.Replicas
+		}
+	}
+	return nil
+}
+
+func (s *StaticRouter) ResolveFallbacks(key RouteKey) []RouteResult {
+	for _, r := range s.routes {
+		if r.Key == key {
+			return r.Fallbacks
+		}
+	}
+	return nil
+}
+
+func (s *StaticRouter) WriteQuorum(key RouteKey) int {
+	for _, r := range s.routes {
+		if r.Key == key {
+			return r.WriteQuorum
+		}
+	}
+	return 1
+}
+
+func (s *StaticRouter) Routes() []RouteResultWithKey {
+	return append([]RouteResultWithKey(nil), s.routes...)
+}
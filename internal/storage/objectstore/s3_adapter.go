@@ -2,6 +2,7 @@ package objectstore
 
 import (
 	"context"
+	"fmt"
 	"io"
 
 	"github.com/minio/minio-go/v7"
@@ -51,11 +52,91 @@ func (a *S3Adapter) GetObject(ctx context.Context, loc ObjectLocation) (io.ReadC
 	stat, err := obj.Stat()
 	if err != nil {
 		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, 0, "", fmt.Errorf("%w: %s/%s", ErrObjectNotFound, loc.ProviderBucket, loc.PhysicalKey)
+		}
 		return nil, 0, "", err
 	}
 	return obj, stat.Size, stat.ContentType, nil
 }
 
+func (a *S3Adapter) GetObjectRange(ctx context.Context, loc ObjectLocation, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+	obj, err := a.client.GetObject(ctx, loc.ProviderBucket, loc.PhysicalKey, opts)
+	if err != nil {
+		return nil, err
+	}
+	// the request is sent lazily; Stat surfaces a missing object now
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, loc.ProviderBucket, loc.PhysicalKey)
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
 func (a *S3Adapter) DeleteObject(ctx context.Context, loc ObjectLocation) error {
 	return a.client.RemoveObject(ctx, loc.ProviderBucket, loc.PhysicalKey, minio.RemoveObjectOptions{})
 }
+
+// CopyObject copies with CopyObject, or part by part with UploadPartCopy
+// for objects larger than a single copy may be.
+func (a *S3Adapter) CopyObject(ctx context.Context, src, dst ObjectLocation, opts PutOptions) (string, error) {
+	dstOpts := minio.CopyDestOptions{Bucket: dst.ProviderBucket, Object: dst.PhysicalKey}
+	if opts.ContentType != "" {
+		dstOpts.ReplaceMetadata = true
+		dstOpts.UserMetadata = map[string]string{"Content-Type": opts.ContentType}
+	}
+	info, err := a.client.ComposeObject(ctx, dstOpts, minio.CopySrcOptions{Bucket: src.ProviderBucket, Object: src.PhysicalKey})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return "", fmt.Errorf("%w: %s/%s", ErrObjectNotFound, src.ProviderBucket, src.PhysicalKey)
+		}
+		return "", err
+	}
+	return info.ETag, nil
+}
+
+func (a *S3Adapter) StatObject(ctx context.Context, loc ObjectLocation) (ObjectSummary, error) {
+	info, err := a.client.StatObject(ctx, loc.ProviderBucket, loc.PhysicalKey, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ObjectSummary{}, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, loc.ProviderBucket, loc.PhysicalKey)
+		}
+		return ObjectSummary{}, err
+	}
+	return ObjectSummary{
+		PhysicalKey:  info.Key,
+		Size:         info.Size,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (a *S3Adapter) ListObjects(ctx context.Context, loc ObjectLocation, fn func(ObjectSummary) error) error {
+	// cancelling stops the listing goroutine when fn fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for obj := range a.client.ListObjects(ctx, loc.ProviderBucket, minio.ListObjectsOptions{
+		Prefix:    loc.PhysicalKey,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if err := fn(ObjectSummary{
+			PhysicalKey:  obj.Key,
+			Size:         obj.Size,
+			ETag:         obj.ETag,
+			LastModified: obj.LastModified,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+// contentKeyMarker precedes the SHA-256 in the physical keys of
+// deduplicated objects. Keys of regular writes end in a write ID instead,
+// so the two never collide.
+const contentKeyMarker = "~sha256/"
+
+func (s *Service) dedups(env, region, bucket string) bool {
+	bc := s.buckets.Lookup(env, region, bucket)
+	return bc != nil && bc.Dedup
+}
+
+// buildContentKey is the physical key of content with SHA-256 sum in a
+// deduplicated bucket: identical uploads to the bucket share it.
+func (s *Service) buildContentKey(req *PutRequest, sum string) string {
+	return fmt.Sprintf("%s/%s/%s/%s%s", req.Env, req.LogicalRegion, req.Bucket, contentKeyMarker, sum)
+}
+
+// contentAddressed reports whether rec points at a deduplicated object,
+// whose references are counted.
+func (s *Service) contentAddressed(rec *metadata.ObjectRecord) bool {
+	return rec.Checksum != "" && rec.PhysicalKey == s.buildContentKey(&PutRequest{
+		Env:           rec.Env,
+		LogicalRegion: rec.LogicalRegion,
+		Bucket:        rec.Bucket,
+	}, rec.Checksum)
+}
+
+// storedCopy reports the ETag of the object at loc when it holds size bytes.
+func (s *Service) storedCopy(ctx context.Context, route objectstore.RouteResult, loc objectstore.ObjectLocation, size int64) (string, bool) {
+	backend, ok := s.providers.Get(route.ProviderName)
+	if !ok {
+		return "", false
+	}
+	stat, err := backend.StatObject(ctx, loc)
+	if err != nil || stat.Size != size {
+		return "", false
+	}
+	return stat.ETag, true
+}
+
+// putContent stores body under its content key through route, or only
+// takes a reference when route already holds the content. The reference
+// belongs to the record about to point at the returned location; releasing
+// that record drops it. It fails with metadata.ErrRefRetired while the
+// stored copy is being deleted.
+func (s *Service) putContent(ctx context.Context, key objectstore.RouteKey, route objectstore.RouteResult, contentKey string, body io.Reader, size int64, opts objectstore.PutOptions) (objectstore.RouteResult, string, *quorumWrite, error) {
+	refs, err := s.metaRepo.AcquireRef(ctx, route.ProviderBucket, contentKey, size)
+	if err != nil {
+		return route, "", nil, err
+	}
+	if refs > 1 {
+		// a writer racing the first upload of the content finds nothing
+		// yet and uploads the same bytes again
+		if etag, ok := s.storedCopy(ctx, route, routeLocation(route, contentKey), size); ok {
+			metrics.DedupHitsTotal.WithLabelValues(key.Env, key.LogicalRegion, key.Bucket).Inc()
+			metrics.DedupBytesSavedTotal.WithLabelValues(key.Env, key.LogicalRegion, key.Bucket).Add(float64(size))
+			return route, etag, nil, nil
+		}
+	}
+	stored, etag, qw, err := s.putObject(ctx, key, route, contentKey, body, size, opts)
+	if err != nil {
+		s.releaseRef(ctx, route.ProviderBucket, contentKey)
+		return route, "", nil, err
+	}
+	if stored.ProviderBucket != route.ProviderBucket {
+		// a fallback or replica took the write; the reference moves along
+		if _, err := s.metaRepo.AcquireRef(ctx, stored.ProviderBucket, contentKey, size); err != nil {
+			s.releaseRef(ctx, route.ProviderBucket, contentKey)
+			return route, "", nil, err
+		}
+		s.releaseRef(ctx, route.ProviderBucket, contentKey)
+	}
+	return stored, etag, qw, nil
+}
+
+// adoptContent moves a streamed upload, hashed only while it was stored
+// under stagingKey, to its content key, with a provider-side copy where
+// the provider has one. When route already holds the content the staged
+// copy is just deleted. It returns the ETag at the
+// content key; on failure, including a stored copy being deleted, the
+// upload stays at stagingKey and no reference is held.
+func (s *Service) adoptContent(ctx context.Context, req *PutRequest, route objectstore.RouteResult, stagingKey, contentKey string, size int64, opts objectstore.PutOptions) (string, error) {
+	backend, ok := s.providers.Get(route.ProviderName)
+	if !ok {
+		return "", fmt.Errorf("no backend for provider %s", route.ProviderName)
+	}
+	staged, dst := routeLocation(route, stagingKey), routeLocation(route, contentKey)
+	refs, err := s.metaRepo.AcquireRef(ctx, route.ProviderBucket, contentKey, size)
+	if err != nil {
+		return "", err
+	}
+	etag, ok := "", false
+	if refs > 1 {
+		etag, ok = s.storedCopy(ctx, route, dst, size)
+	}
+	if ok {
+		metrics.DedupHitsTotal.WithLabelValues(req.Env, req.LogicalRegion, req.Bucket).Inc()
+		metrics.DedupBytesSavedTotal.WithLabelValues(req.Env, req.LogicalRegion, req.Bucket).Add(float64(size))
+	} else if etag, err = copyObject(ctx, backend, staged, dst, size, opts); err != nil {
+		s.releaseRef(ctx, route.ProviderBucket, contentKey)
+		return "", err
+	}
+	if err := backend.DeleteObject(ctx, staged); err != nil {
+		log.Printf("dedup: delete staged upload %s/%s: %v", route.ProviderBucket, stagingKey, err)
+	}
+	return etag, nil
+}
+
+// copyObject copies src to dst within one provider. Providers that copy
+// objects themselves do; with the others the bytes make a round trip
+// through the gateway.
+func copyObject(ctx context.Context, backend objectstore.ObjectStorage, src, dst objectstore.ObjectLocation, size int64, opts objectstore.PutOptions) (string, error) {
+	if c, ok := backend.(objectstore.Copier); ok {
+		etag, err := c.CopyObject(ctx, src, dst, opts)
+		if !errors.Is(err, objectstore.ErrCopyUnsupported) {
+			return etag, err
+		}
+	}
+	body, _, _, err := backend.GetObject(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	return backend.PutObject(ctx, dst, body, size, opts)
+}
+
+// releaseRef drops a reference taken for a record that was not committed.
+// The object stays for the orphan GC if nothing else references it.
+func (s *Service) releaseRef(ctx context.Context, providerBucket, physicalKey string) {
+	if _, err := s.metaRepo.ReleaseRef(ctx, providerBucket, physicalKey); err != nil {
+		log.Printf("dedup: release %s/%s: %v", providerBucket, physicalKey, err)
+	}
+}
@@ -0,0 +1,163 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+func newDedupService(t *testing.T) *testService {
+	t.Helper()
+	return newTestService(t, config.RouteRule{}, config.BucketConfig{Dedup: true})
+}
+
+func TestDedupUploadDuringRelease(t *testing.T) {
+	ts := newDedupService(t)
+	x := []byte("shared content")
+	if _, err := ts.put(t, "a", x); err != nil {
+		t.Fatalf("put a: %v", err)
+	}
+
+	// overwriting a releases the last reference to x, whose delete is slow
+	ts.faults["primary"].Script(objectstore.OpDelete, objectstore.Fault{Delay: 300 * time.Millisecond})
+	done := make(chan error, 1)
+	go func() {
+		_, err := ts.put(t, "a", []byte("new content"))
+		done <- err
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for ts.faults["primary"].Calls(objectstore.OpDelete) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the overwrite never deleted x")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// an upload of x meanwhile must not end up at the key being deleted
+	if _, err := ts.put(t, "b", x); err != nil {
+		t.Fatalf("put b: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("overwrite a: %v", err)
+	}
+	if got, _, err := ts.get(t, "b"); err != nil || !bytes.Equal(got, x) {
+		t.Fatalf("get b = %q, %v; want %q", got, err, x)
+	}
+	if rec := ts.record(t, "b"); ts.contentAddressed(rec) {
+		t.Errorf("b points at the content key %s being deleted", rec.PhysicalKey)
+	}
+
+	// once the delete is done the content is shared again
+	if _, err := ts.put(t, "c", x); err != nil {
+		t.Fatalf("put c: %v", err)
+	}
+	if rec := ts.record(t, "c"); !ts.contentAddressed(rec) {
+		t.Errorf("c has physical key %s, want the content key", rec.PhysicalKey)
+	}
+	if got, _, err := ts.get(t, "c"); err != nil || !bytes.Equal(got, x) {
+		t.Errorf("get c = %q, %v; want %q", got, err, x)
+	}
+}
+
+// barrierRepo holds each PutObject until n of them are waiting, so that
+// concurrent writers of a key overlap.
+type barrierRepo struct {
+	*metadata.InMemoryRepository
+	n       int
+	mu      sync.Mutex
+	waiting int
+	release chan struct{}
+}
+
+func (r *barrierRepo) PutObject(ctx context.Context, rec *metadata.ObjectRecord) (*metadata.ObjectRecord, error) {
+	r.mu.Lock()
+	r.waiting++
+	if r.waiting == r.n {
+		close(r.release)
+	}
+	r.mu.Unlock()
+	select {
+	case <-r.release:
+	case <-time.After(2 * time.Second):
+	}
+	return r.InMemoryRepository.PutObject(ctx, rec)
+}
+
+func TestDedupConcurrentOverwrites(t *testing.T) {
+	ts := newDedupService(t)
+	x := []byte("shared content")
+	for _, key := range []string{"a", "keep"} {
+		if _, err := ts.put(t, key, x); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+
+	const writers = 4
+	ts.metaRepo = &barrierRepo{InMemoryRepository: ts.repo, n: writers, release: make(chan struct{})}
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := ts.put(t, "a", []byte{byte('0' + i)})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("overwrite a: %v", err)
+		}
+	}
+
+	// only one writer replaced a's record with x, so keep's reference stays
+	if got, _, err := ts.get(t, "keep"); err != nil || !bytes.Equal(got, x) {
+		t.Fatalf("get keep = %q, %v; want %q", got, err, x)
+	}
+	rec := ts.record(t, "keep")
+	if refs, err := ts.repo.AcquireRef(context.Background(), rec.ProviderBucket, rec.PhysicalKey, rec.SizeBytes); err != nil || refs != 2 {
+		t.Errorf("x has %d references after acquiring one more, %v; want 2", refs, err)
+	}
+}
+
+// Large uploads are staged under their own key, then copied by the
+// provider to their content key.
+func TestDedupAdoptContent(t *testing.T) {
+	ts := newDedupService(t)
+	data := []byte("streamed content")
+	primary := ts.faults["primary"]
+	for _, key := range []string{"a", "b"} {
+		if err := ts.putChunked(key, data); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+		if rec := ts.record(t, key); !ts.contentAddressed(rec) {
+			t.Errorf("%s stored at %s, want its content key", key, rec.PhysicalKey)
+		}
+	}
+	if primary.Calls(objectstore.OpCopy) != 1 || primary.Calls(objectstore.OpGet) != 0 {
+		t.Errorf("%d copies and %d reads, want one copy and no read back", primary.Calls(objectstore.OpCopy), primary.Calls(objectstore.OpGet))
+	}
+	if objects := ts.objects(t, "primary"); len(objects) != 1 {
+		t.Errorf("stored %v, want the shared content alone", objects)
+	}
+
+	// a failed copy leaves the upload at its staging key
+	primary.FailNext(objectstore.OpCopy, 1)
+	if err := ts.putChunked("c", []byte("other content")); err != nil {
+		t.Fatalf("put c: %v", err)
+	}
+	if rec := ts.record(t, "c"); ts.contentAddressed(rec) {
+		t.Errorf("c stored at its content key %s after a failed copy", rec.PhysicalKey)
+	}
+	if got, _, err := ts.get(t, "c"); err != nil || string(got) != "other content" {
+		t.Errorf("get c = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,107 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+// ErrObjectUnavailable means no location holding the object could serve it
+// and at least one of them failed for a reason other than a missing object.
+var ErrObjectUnavailable = errors.New("object temporarily unavailable")
+
+// Classes of failed reads, used as metric labels.
+const (
+	readNotFound    = "not_found"   // the location does not hold the object
+	readUnavailable = "unavailable" // the provider failed; the object may well be there
+)
+
+// servedFromCache is the GetResponse.ServedFrom of cache hits.
+const servedFromCache = "cache"
+
+func classifyReadError(err error) string {
+	if errors.Is(err, objectstore.ErrObjectNotFound) {
+		return readNotFound
+	}
+	return readUnavailable
+}
+
+// readLocation is one copy of a physical object.
+type readLocation struct {
+	provider string                    // registry name
+	backend  objectstore.ObjectStorage // nil when the provider is not registered
+	loc      objectstore.ObjectLocation
+}
+
+func (l readLocation) String() string {
+	return l.provider + "/" + l.loc.ProviderBucket
+}
+
+// openObject opens the content of rec at its primary location and, when
+// that fails, at its completed replicas in the order they were recorded.
+// servedFrom names the location that answered as "provider/bucket".
+func (s *Service) openObject(ctx context.Context, rec *metadata.ObjectRecord) (body io.ReadCloser, size int64, contentType, servedFrom string, err error) {
+	primary := readLocation{provider: s.providerNameOf(rec), loc: locationOf(rec)}
+	if primary.provider == "" {
+		primary.provider = rec.ProviderType
+	}
+	primary.backend, _ = s.backendFor(rec)
+	body, size, contentType, err = s.readFrom(ctx, primary, rec)
+	if err == nil {
+		return body, size, contentType, primary.String(), nil
+	}
+	if ctx.Err() != nil {
+		return nil, 0, "", "", err
+	}
+	primaryErr, unavailable := err, classifyReadError(err) == readUnavailable
+
+	reps, lerr := s.metaRepo.ListReplicas(ctx, rec.ProviderBucket, rec.PhysicalKey)
+	if lerr != nil {
+		log.Printf("read failover %s/%s: list replicas: %v", rec.ProviderBucket, rec.PhysicalKey, lerr)
+	}
+	for _, rep := range reps {
+		if rep.Status != metadata.ReplicaCompleted {
+			continue
+		}
+		l := readLocation{provider: rep.TargetProvider, loc: replicaLocation(rep)}
+		l.backend, _ = s.providers.Get(rep.TargetProvider)
+		body, size, contentType, err = s.readFrom(ctx, l, rec)
+		if err == nil {
+			metrics.ReplicaReadsTotal.WithLabelValues(l.provider, l.loc.ProviderBucket).Inc()
+			return body, size, contentType, l.String(), nil
+		}
+		if ctx.Err() != nil {
+			return nil, 0, "", "", err
+		}
+		unavailable = unavailable || classifyReadError(err) == readUnavailable
+	}
+	if unavailable {
+		return nil, 0, "", "", fmt.Errorf("%w: %v", ErrObjectUnavailable, primaryErr)
+	}
+	return nil, 0, "", "", primaryErr
+}
+
+// readFrom opens the content of rec at one location, logging and counting
+// a failure by class.
+func (s *Service) readFrom(ctx context.Context, l readLocation, rec *metadata.ObjectRecord) (io.ReadCloser, int64, string, error) {
+	err := fmt.Errorf("no backend for provider %s", l.provider)
+	if l.backend != nil {
+		body, size, contentType, gerr := readContent(ctx, l.backend, l.loc, rec)
+		if gerr == nil {
+			return body, size, contentType, nil
+		}
+		err = gerr
+	}
+	if ctx.Err() == nil {
+		class := classifyReadError(err)
+		log.Printf("read %s %s: %s: %v", l, l.loc.PhysicalKey, class, err)
+		metrics.ReadFailuresTotal.WithLabelValues(l.provider, l.loc.ProviderBucket, class).Inc()
+	}
+	return nil, 0, "", err
+}
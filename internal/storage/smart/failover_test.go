@@ -0,0 +1,101 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+// newReplicatedService stores "k" and replicates it to "replica".
+func newReplicatedService(t *testing.T) (*testService, []byte) {
+	t.Helper()
+	ts := newTestService(t, config.RouteRule{Replicas: []config.RouteTarget{target("replica")}}, config.BucketConfig{})
+	data := []byte("replicated content")
+	if _, err := ts.put(t, "k", data); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if done, failed, err := ts.Replicate(context.Background()); err != nil || done != 1 || failed != 0 {
+		t.Fatalf("replicate: %d done, %d failed, %v", done, failed, err)
+	}
+	return ts, data
+}
+
+func TestReadFailover(t *testing.T) {
+	ts, data := newReplicatedService(t)
+
+	got, resp, err := ts.get(t, "k")
+	if err != nil || !bytes.Equal(got, data) || resp.ServedFrom != "primary/primary" {
+		t.Fatalf("get = %q from %v, %v; want the primary's copy", got, resp, err)
+	}
+
+	ts.faults["primary"].FailNext(objectstore.OpGet, 1)
+	got, resp, err = ts.get(t, "k")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("get with the primary failing = %q, %v", got, err)
+	}
+	if resp.ServedFrom != "replica/replica" {
+		t.Errorf("served from %s, want replica/replica", resp.ServedFrom)
+	}
+
+	// a copy missing at the primary is read from the replica too
+	rec := ts.record(t, "k")
+	if err := ts.mem["primary"].DeleteObject(context.Background(), locationOf(rec)); err != nil {
+		t.Fatal(err)
+	}
+	if got, resp, err := ts.get(t, "k"); err != nil || !bytes.Equal(got, data) || resp.ServedFrom != "replica/replica" {
+		t.Errorf("get with the primary's copy gone = %q from %v, %v", got, resp, err)
+	}
+}
+
+func TestReadFailoverExhausted(t *testing.T) {
+	ts, _ := newReplicatedService(t)
+
+	ts.faults["primary"].FailNext(objectstore.OpGet, 1)
+	ts.faults["replica"].FailNext(objectstore.OpGet, 1)
+	if _, _, err := ts.get(t, "k"); !errors.Is(err, ErrObjectUnavailable) {
+		t.Errorf("get with every location failing: err = %v, want ErrObjectUnavailable", err)
+	}
+
+	// only missing copies: the object is gone, not unavailable
+	rec := ts.record(t, "k")
+	for _, name := range []string{"primary", "replica"} {
+		loc := locationOf(rec)
+		loc.ProviderBucket = name
+		if err := ts.mem[name].DeleteObject(context.Background(), loc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err := ts.get(t, "k")
+	if errors.Is(err, ErrObjectUnavailable) || !errors.Is(err, objectstore.ErrObjectNotFound) {
+		t.Errorf("get with every copy gone: err = %v, want ErrObjectNotFound", err)
+	}
+}
+
+// Two providers of one type whose buckets share a name are told apart by
+// the provider name the record keeps.
+func TestReadSharedBucketName(t *testing.T) {
+	ts := newTestService(t, config.RouteRule{
+		ProviderName:   "eu1",
+		ProviderBucket: "shared",
+		Fallbacks:      []config.RouteTarget{{ProviderName: "eu2", ProviderBucket: "shared"}},
+	}, config.BucketConfig{})
+	ts.faults["eu1"].FailNext(objectstore.OpPut, 1)
+	data := []byte("stored at the fallback")
+	if _, err := ts.put(t, "k", data); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if rec := ts.record(t, "k"); rec.ProviderName != "eu2" {
+		t.Fatalf("record names provider %q, want eu2", rec.ProviderName)
+	}
+	got, resp, err := ts.get(t, "k")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("get = %q, %v", got, err)
+	}
+	if resp.ServedFrom != "eu2/shared" {
+		t.Errorf("served from %s, want eu2/shared", resp.ServedFrom)
+	}
+}
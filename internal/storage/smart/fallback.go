@@ -0,0 +1,277 @@
+package smart
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+const (
+	// providerCooldown is how long writes try a provider that failed one
+	// only after its route's fallbacks.
+	providerCooldown    = 30 * time.Second
+	rebalanceBatchSize  = 500
+	maxRebalanceEntries = 1000 // moves listed in a report; counts cover all
+)
+
+// providerHealth remembers the providers that failed a write recently.
+type providerHealth struct {
+	mu        sync.Mutex
+	downUntil map[string]time.Time // by provider name
+}
+
+func (h *providerHealth) healthy(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !time.Now().Before(h.downUntil[name])
+}
+
+func (h *providerHealth) failed(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.downUntil == nil {
+		h.downUntil = map[string]time.Time{}
+	}
+	h.downUntil[name] = time.Now().Add(providerCooldown)
+}
+
+func (h *providerHealth) recovered(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.downUntil, name)
+}
+
+// writeBody is an upload body that remembers how much a provider consumed
+// and whether reading it failed.
+type writeBody struct {
+	r       io.Reader
+	n       int64
+	readErr error // the body failed, not the provider
+}
+
+func (b *writeBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if err != nil && err != io.EOF {
+		b.readErr = err
+	}
+	return n, err
+}
+
+// rewind prepares the body for another upload. It fails when a provider
+// consumed part of it and it cannot seek back to its start.
+func (b *writeBody) rewind() bool {
+	if b.n == 0 {
+		return true
+	}
+	seeker, ok := b.r.(io.Seeker)
+	if !ok {
+		return false
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+	b.n = 0
+	return true
+}
+
+// writeOrder lists the route's provider and its fallbacks in the order
+// writes try them: those that failed a write recently come last.
+func (s *Service) writeOrder(route objectstore.RouteResult, fallbacks []objectstore.RouteResult) []objectstore.RouteResult {
+	var up, down []objectstore.RouteResult
+	for _, t := range append([]objectstore.RouteResult{route}, fallbacks...) {
+		if s.health.healthy(t.ProviderName) {
+			up = append(up, t)
+		} else {
+			down = append(down, t)
+		}
+	}
+	return append(up, down...)
+}
+
+// putFailover stores body at the first of route and its fallbacks that
+// takes it and returns that location. After a failed upload the next
+// location is tried only if the body can be replayed: buffered small
+// objects always can, streamed ones only when the provider failed before
+// reading any of it.
+func (s *Service) putFailover(ctx context.Context, route objectstore.RouteResult, fallbacks []objectstore.RouteResult, physicalKey string, body io.Reader, size int64, opts objectstore.PutOptions) (objectstore.RouteResult, string, error) {
+	wb := &writeBody{r: body}
+	var err error
+	for i, t := range s.writeOrder(route, fallbacks) {
+		if i > 0 && !wb.rewind() {
+			break
+		}
+		backend, ok := s.providers.Get(t.ProviderName)
+		if !ok {
+			err = fmt.Errorf("no backend for provider %s", t.ProviderName)
+			continue
+		}
+		etag, perr := backend.PutObject(ctx, routeLocation(t, physicalKey), wb, size, opts)
+		if perr == nil {
+			s.health.recovered(t.ProviderName)
+			if t != route {
+				log.Printf("write %s: stored at fallback %s/%s", physicalKey, t.ProviderName, t.ProviderBucket)
+			}
+			return t, etag, nil
+		}
+		err = perr
+		if wb.readErr != nil || ctx.Err() != nil {
+			return route, "", err // the client or the body failed, not the provider
+		}
+		s.health.failed(t.ProviderName)
+		metrics.WriteFailoversTotal.WithLabelValues(t.ProviderName, t.ProviderBucket).Inc()
+		log.Printf("write %s to %s/%s: %v", physicalKey, t.ProviderName, t.ProviderBucket, perr)
+	}
+	return route, "", err
+}
+
+// atLocation reports whether rec's object is stored at l.
+func atLocation(rec *metadata.ObjectRecord, l objectstore.RouteResult) bool {
+	if rec.ProviderName != "" {
+		return rec.ProviderName == l.ProviderName && rec.ProviderBucket == l.ProviderBucket
+	}
+	return sameLocation(rec, l)
+}
+
+// RebalanceMove is one object moved from a fallback back to its route's
+// provider.
+type RebalanceMove struct {
+	Env           string `json:"env"`
+	LogicalRegion string `json:"logical_region"`
+	Bucket        string `json:"bucket"`
+	Key           string `json:"key"`
+	VersionID     string `json:"version_id"`
+	From          string `json:"from"` // provider/bucket
+	To            string `json:"to"`
+	Error         string `json:"error,omitempty"`
+}
+
+type RebalanceReport struct {
+	DryRun    bool             `json:"dry_run"`
+	StartedAt time.Time        `json:"started_at"`
+	Found     int              `json:"found"`   // objects stored at a fallback
+	Moved     int              `json:"moved"`   // moved back, or to move in a dry run
+	Skipped   int              `json:"skipped"` // left while their provider is down
+	Failed    int              `json:"failed"`
+	Moves     []*RebalanceMove `json:"moves"`
+	Truncated bool             `json:"truncated"` // more moves than listed
+}
+
+func (r *RebalanceReport) add(m *RebalanceMove) {
+	if m.Error != "" {
+		r.Failed++
+	} else {
+		r.Moved++
+	}
+	if len(r.Moves) < maxRebalanceEntries {
+		r.Moves = append(r.Moves, m)
+	} else {
+		r.Truncated = true
+	}
+}
+
+// Rebalance walks all metadata and moves the objects that writes stored at
+// a fallback back to their route's provider. Objects whose provider still
+// fails writes are left for a later run. With dryRun it only reports what
+// it would move.
+func (s *Service) Rebalance(ctx context.Context, dryRun bool) (*RebalanceReport, error) {
+	report := &RebalanceReport{DryRun: dryRun, StartedAt: time.Now(), Moves: []*RebalanceMove{}}
+	hasFallbacks := false
+	for _, r := range s.router.Routes() {
+		hasFallbacks = hasFallbacks || len(r.Fallbacks) > 0
+	}
+	if !hasFallbacks {
+		return report, nil
+	}
+
+	failing := map[string]bool{} // providers that failed a move in this run
+	var afterID int64
+	for {
+		recs, err := s.metaRepo.ScanObjects(ctx, afterID, rebalanceBatchSize)
+		if err != nil {
+			return report, err
+		}
+		for _, rec := range recs {
+			afterID = rec.ID
+			if rec.PhysicalKey == "" {
+				continue // delete markers hold no data
+			}
+			key := objectstore.RouteKey{
+				Env:           rec.Env,
+				LogicalRegion: rec.LogicalRegion,
+				Bucket:        rec.Bucket,
+				StorageClass:  rec.StorageClass,
+			}
+			route, err := s.router.ResolveRoute(key)
+			if err != nil || atLocation(rec, route) {
+				continue
+			}
+			var from *objectstore.RouteResult
+			for _, f := range s.router.ResolveFallbacks(key) {
+				if atLocation(rec, f) {
+					from = &f
+					break
+				}
+			}
+			if from == nil {
+				continue
+			}
+			report.Found++
+			if failing[route.ProviderName] || !s.health.healthy(route.ProviderName) {
+				report.Skipped++
+				continue
+			}
+			m := &RebalanceMove{
+				Env:           rec.Env,
+				LogicalRegion: rec.LogicalRegion,
+				Bucket:        rec.Bucket,
+				Key:           rec.ObjectKey,
+				VersionID:     rec.VersionID,
+				From:          from.ProviderName + "/" + from.ProviderBucket,
+				To:            route.ProviderName + "/" + route.ProviderBucket,
+			}
+			if !dryRun {
+				// by value: the repository updates the scanned record
+				r := *rec
+				if err := s.moveObject(ctx, &r, route, r.StorageClass); err != nil {
+					m.Error = err.Error()
+					failing[route.ProviderName] = true
+				} else {
+					metrics.RebalancedObjectsTotal.WithLabelValues(route.ProviderName, route.ProviderBucket).Inc()
+				}
+			}
+			report.add(m)
+		}
+		if len(recs) < rebalanceBatchSize || ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+	}
+}
+
+// RunRebalance calls Rebalance every interval until ctx is done.
+func (s *Service) RunRebalance(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		report, err := s.Rebalance(ctx, false)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("rebalance: %v", err)
+		}
+		if report != nil && report.Found > 0 {
+			log.Printf("rebalance: found %d, moved %d, skipped %d, failed %d",
+				report.Found, report.Moved, report.Skipped, report.Failed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
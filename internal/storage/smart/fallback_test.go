@@ -0,0 +1,101 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+func newFallbackService(t *testing.T) *testService {
+	t.Helper()
+	ts := newTestService(t, config.RouteRule{Fallbacks: []config.RouteTarget{target("fallback")}}, config.BucketConfig{})
+	// 64 byte uploads stream through putLarge, smaller ones are buffered
+	ts.smallFileThreshold = 32
+	return ts
+}
+
+func TestWriteFallback(t *testing.T) {
+	for _, size := range []int{16, 64} {
+		ts := newFallbackService(t)
+		data := bytes.Repeat([]byte("f"), size)
+
+		ts.faults["primary"].FailNext(objectstore.OpPut, 1)
+		if _, err := ts.put(t, "k", data); err != nil {
+			t.Fatalf("%d bytes: put with the primary failing: %v", size, err)
+		}
+		if rec := ts.record(t, "k"); rec.ProviderBucket != "fallback" {
+			t.Errorf("%d bytes: stored at %s, want the fallback", size, rec.ProviderBucket)
+		}
+		if got, _, err := ts.get(t, "k"); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: get = %q, %v", size, got, err)
+		}
+
+		// the failed primary is tried last while it cools down
+		if _, err := ts.put(t, "k2", data); err != nil {
+			t.Fatalf("%d bytes: put: %v", size, err)
+		}
+		if rec := ts.record(t, "k2"); rec.ProviderBucket != "fallback" {
+			t.Errorf("%d bytes: second write stored at %s, want the fallback", size, rec.ProviderBucket)
+		}
+		if n := ts.faults["primary"].Calls(objectstore.OpPut); n != 1 {
+			t.Errorf("%d bytes: primary took %d uploads, want 1", size, n)
+		}
+
+		// once it is back, the rebalancer moves the objects home
+		ts.health.recovered("primary")
+		report, err := ts.Rebalance(context.Background(), false)
+		if err != nil || report.Moved != 2 || report.Failed != 0 {
+			t.Fatalf("%d bytes: rebalance = %+v, %v; want 2 moved", size, report, err)
+		}
+		for _, key := range []string{"k", "k2"} {
+			if rec := ts.record(t, key); rec.ProviderBucket != "primary" {
+				t.Errorf("%d bytes: %s at %s after rebalancing", size, key, rec.ProviderBucket)
+			}
+			if got, _, err := ts.get(t, key); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%d bytes: get %s after rebalancing = %q, %v", size, key, got, err)
+			}
+		}
+	}
+}
+
+func TestWriteFallbackExhausted(t *testing.T) {
+	for _, size := range []int{16, 64} {
+		ts := newFallbackService(t)
+		ts.faults["primary"].FailNext(objectstore.OpPut, 1)
+		ts.faults["fallback"].FailNext(objectstore.OpPut, 1)
+		if _, err := ts.put(t, "k", bytes.Repeat([]byte("f"), size)); err == nil {
+			t.Fatalf("%d bytes: put succeeded with every location failing", size)
+		}
+		if _, err := ts.repo.GetObject(context.Background(), testEnv, testRegion, testBucket, "k"); err == nil {
+			t.Errorf("%d bytes: a failed write left a record", size)
+		}
+	}
+}
+
+func TestRebalanceSharedBucketName(t *testing.T) {
+	ts := newTestService(t, config.RouteRule{
+		ProviderName:   "eu1",
+		ProviderBucket: "shared",
+		Fallbacks:      []config.RouteTarget{{ProviderName: "eu2", ProviderBucket: "shared"}},
+	}, config.BucketConfig{})
+	ts.faults["eu1"].FailNext(objectstore.OpPut, 1)
+	data := []byte("stored at the fallback")
+	if _, err := ts.put(t, "k", data); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	ts.health.recovered("eu1")
+	report, err := ts.Rebalance(context.Background(), false)
+	if err != nil || report.Found != 1 || report.Moved != 1 {
+		t.Fatalf("rebalance = %+v, %v; want the object at eu2 moved", report, err)
+	}
+	if rec := ts.record(t, "k"); rec.ProviderName != "eu1" {
+		t.Errorf("record at %s after rebalancing, want eu1", rec.ProviderName)
+	}
+	if got, resp, err := ts.get(t, "k"); err != nil || !bytes.Equal(got, data) || resp.ServedFrom != "eu1/shared" {
+		t.Errorf("get after rebalancing = %q from %v, %v", got, resp, err)
+	}
+}
@@ -0,0 +1,186 @@
+package smart
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metrics"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+const (
+	defaultOrphanGrace = 24 * time.Hour
+	defaultOrphanRate  = 10 // deletes per second
+	maxOrphanEntries   = 1000
+)
+
+// WithOrphanGC sets the grace period and delete rate of the orphan GC.
+func WithOrphanGC(cfg config.OrphanGCConfig) Option {
+	return func(s *Service) { s.orphanGC = cfg }
+}
+
+// OrphanEntry is a provider object the GC found unreferenced.
+type OrphanEntry struct {
+	Provider       string    `json:"provider"`
+	ProviderBucket string    `json:"provider_bucket"`
+	PhysicalKey    string    `json:"physical_key"`
+	Size           int64     `json:"size"`
+	LastModified   time.Time `json:"last_modified"`
+	Error          string    `json:"error,omitempty"`
+}
+
+type OrphanReport struct {
+	DryRun      bool           `json:"dry_run"`
+	StartedAt   time.Time      `json:"started_at"`
+	Grace       string         `json:"grace"`
+	Listed      int            `json:"listed"`
+	Orphans     int            `json:"orphans"`
+	OrphanBytes int64          `json:"orphan_bytes"`
+	Deleted     int            `json:"deleted"`
+	Failed      int            `json:"failed"`
+	Entries     []*OrphanEntry `json:"entries"`
+	Truncated   bool           `json:"truncated"` // more orphans than listed
+}
+
+// gcTarget is one prefix of a provider bucket the gateway writes to.
+type gcTarget struct {
+	route  objectstore.RouteResult
+	prefix string
+}
+
+// gcTargets lists the env/region/bucket/ prefix of every route, replica
+// and fallback target once, no matter how many storage classes share the provider
+// bucket. Keys outside these prefixes were not written by the gateway and
+// are never touched.
+func (s *Service) gcTargets() []gcTarget {
+	seen := map[gcTarget]bool{}
+	var targets []gcTarget
+	for _, r := range s.router.Routes() {
+		prefix := r.Key.Env + "/" + r.Key.LogicalRegion + "/" + r.Key.Bucket + "/"
+		for _, route := range r.Locations() {
+			t := gcTarget{route: route, prefix: prefix}
+			if !seen[t] {
+				seen[t] = true
+				targets = append(targets, t)
+			}
+		}
+	}
+	return targets
+}
+
+// CollectOrphans lists the provider buckets of all routes and deletes the
+// objects older than the grace period that no metadata record points to:
+// leftovers of uploads that failed before their record was written. Trash
+// entries and noncurrent versions still reference their objects. Persisted
+// image variants are orphans once their source is, and quarantined uploads
+// are never collected. With dryRun nothing is deleted.
+func (s *Service) CollectOrphans(ctx context.Context, dryRun bool) (*OrphanReport, error) {
+	grace := s.orphanGC.Grace
+	if grace <= 0 {
+		grace = defaultOrphanGrace
+	}
+	rate := s.orphanGC.Rate
+	if rate <= 0 {
+		rate = defaultOrphanRate
+	}
+	pace := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer pace.Stop()
+
+	report := &OrphanReport{DryRun: dryRun, StartedAt: time.Now(), Grace: grace.String(), Entries: []*OrphanEntry{}}
+	cutoff := report.StartedAt.Add(-grace)
+	for _, t := range s.gcTargets() {
+		backend, ok := s.providers.Get(t.route.ProviderName)
+		if !ok {
+			log.Printf("gc: no backend for provider %s, skipping %s%s", t.route.ProviderName, t.route.ProviderBucket, t.prefix)
+			continue
+		}
+		listLoc := objectstore.ObjectLocation{
+			ProviderType:   t.route.ProviderType,
+			ProviderRegion: t.route.ProviderRegion,
+			ProviderBucket: t.route.ProviderBucket,
+			PhysicalKey:    t.prefix,
+		}
+		err := backend.ListObjects(ctx, listLoc, func(obj objectstore.ObjectSummary) error {
+			report.Listed++
+			if !obj.LastModified.Before(cutoff) || strings.HasPrefix(obj.PhysicalKey, quarantinePrefix) {
+				return nil
+			}
+			referenced := obj.PhysicalKey
+			if i := strings.Index(referenced, variantPhysicalKeyMarker); i >= 0 {
+				referenced = referenced[:i]
+			}
+			inUse, err := s.metaRepo.PhysicalKeyInUse(ctx, t.route.ProviderBucket, referenced)
+			if err != nil || inUse {
+				return err
+			}
+
+			entry := &OrphanEntry{
+				Provider:       t.route.ProviderName,
+				ProviderBucket: t.route.ProviderBucket,
+				PhysicalKey:    obj.PhysicalKey,
+				Size:           obj.Size,
+				LastModified:   obj.LastModified,
+			}
+			report.Orphans++
+			report.OrphanBytes += obj.Size
+			if len(report.Entries) < maxOrphanEntries {
+				report.Entries = append(report.Entries, entry)
+			} else {
+				report.Truncated = true
+			}
+			if dryRun {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-pace.C:
+			}
+			loc := listLoc
+			loc.PhysicalKey = obj.PhysicalKey
+			if err := backend.DeleteObject(ctx, loc); err != nil {
+				entry.Error = err.Error()
+				report.Failed++
+				return nil
+			}
+			report.Deleted++
+			metrics.OrphanObjectsDeletedTotal.WithLabelValues(t.route.ProviderName, t.route.ProviderBucket).Inc()
+			metrics.OrphanBytesDeletedTotal.WithLabelValues(t.route.ProviderName, t.route.ProviderBucket).Add(float64(obj.Size))
+			return nil
+		})
+		if err != nil {
+			return report, fmt.Errorf("list %s/%s%s: %w", t.route.ProviderName, t.route.ProviderBucket, t.prefix, err)
+		}
+	}
+	return report, nil
+}
+
+// RunOrphanGC calls CollectOrphans every interval until ctx is done.
+func (s *Service) RunOrphanGC(ctx context.Context, interval time.Duration, dryRun bool) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		report, err := s.CollectOrphans(ctx, dryRun)
+		if err != nil {
+			log.Printf("orphan gc: %v", err)
+		}
+		if report != nil && report.Orphans > 0 {
+			log.Printf("orphan gc: dry_run=%v listed %d, orphans %d (%d bytes), deleted %d, failed %d",
+				dryRun, report.Listed, report.Orphans, report.OrphanBytes, report.Deleted, report.Failed)
+			if dryRun {
+				for _, e := range report.Entries {
+					log.Printf("orphan gc: would delete %s/%s/%s (%d bytes)", e.Provider, e.ProviderBucket, e.PhysicalKey, e.Size)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
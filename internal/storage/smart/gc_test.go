@@ -0,0 +1,145 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+const strayPrefix = testEnv + "/" + testRegion + "/" + testBucket + "/"
+
+// plant stores an object at physical key key of the primary that no
+// record points to.
+func (ts *testService) plant(t *testing.T, key string) {
+	t.Helper()
+	loc := objectstore.ObjectLocation{ProviderBucket: "primary", PhysicalKey: key}
+	if _, err := ts.mem["primary"].PutObject(context.Background(), loc, bytes.NewReader([]byte("x")), 1, objectstore.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectOrphans(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket config.BucketConfig
+		setup  func(t *testing.T, ts *testService)
+		strays []string // planted keys the GC must delete
+	}{
+		{
+			name: "live and trashed",
+			setup: func(t *testing.T, ts *testService) {
+				for _, key := range []string{"live", "trashed"} {
+					if _, err := ts.put(t, key, []byte(key)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				ts.delete(t, "trashed")
+				// a variant of a live source and quarantined uploads stay
+				ts.plant(t, ts.record(t, "live").PhysicalKey+variantPhysicalKeyMarker+"abc/w100")
+				ts.plant(t, quarantinePrefix+"20260101T000000Z/"+strayPrefix+"infected~1")
+			},
+			strays: []string{
+				strayPrefix + "failed-upload~1",
+				strayPrefix + "gone~1" + variantPhysicalKeyMarker + "abc/w100",
+			},
+		},
+		{
+			name:   "noncurrent versions and delete markers",
+			bucket: config.BucketConfig{Versioning: true},
+			setup: func(t *testing.T, ts *testService) {
+				for _, data := range []string{"v1", "v2"} {
+					if _, err := ts.put(t, "k", []byte(data)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, err := ts.put(t, "deleted", []byte("v1")); err != nil {
+					t.Fatal(err)
+				}
+				ts.delete(t, "deleted")
+			},
+			strays: []string{strayPrefix + "k~stray"},
+		},
+		{
+			name:   "pack members",
+			bucket: config.BucketConfig{Pack: &config.PackConfig{MaxBytes: 2 * packEntrySize}},
+			setup: func(t *testing.T, ts *testService) {
+				for i, err := range ts.putAll(t, 2) {
+					if err != nil {
+						t.Fatalf("put k%d: %v", i, err)
+					}
+				}
+			},
+			strays: []string{strayPrefix + packKeyMarker + "stray"},
+		},
+	}
+	for _, tt := range tests {
+		ts := newTestService(t, config.RouteRule{}, tt.bucket, WithOrphanGC(config.OrphanGCConfig{Grace: time.Nanosecond, Rate: 1000}))
+		tt.setup(t, ts)
+		for _, key := range tt.strays {
+			ts.plant(t, key)
+		}
+		// outside the gateway's prefixes
+		ts.plant(t, "other/app/file")
+		before := ts.objects(t, "primary")
+		time.Sleep(time.Millisecond) // past the grace period
+
+		report, err := ts.CollectOrphans(context.Background(), true)
+		if err != nil {
+			t.Fatalf("%s: dry run: %v", tt.name, err)
+		}
+		var found []string
+		for _, e := range report.Entries {
+			found = append(found, e.PhysicalKey)
+		}
+		sort.Strings(found)
+		sort.Strings(tt.strays)
+		if !equalStrings(found, tt.strays) || report.Orphans != len(tt.strays) || report.Deleted != 0 {
+			t.Errorf("%s: dry run found %v (%d deleted), want %v", tt.name, found, report.Deleted, tt.strays)
+		}
+		if after := ts.objects(t, "primary"); !equalStrings(after, before) {
+			t.Errorf("%s: the dry run deleted %d objects", tt.name, len(before)-len(after))
+		}
+
+		// objects younger than the grace period stay
+		ts.orphanGC.Grace = time.Hour
+		if report, err := ts.CollectOrphans(context.Background(), false); err != nil || report.Orphans != 0 {
+			t.Errorf("%s: within the grace period = %+v, %v", tt.name, report, err)
+		}
+
+		ts.orphanGC.Grace = time.Nanosecond
+		report, err = ts.CollectOrphans(context.Background(), false)
+		if err != nil || report.Deleted != len(tt.strays) || report.Failed != 0 {
+			t.Fatalf("%s: collect = %+v, %v", tt.name, report, err)
+		}
+		left := map[string]bool{}
+		for _, key := range ts.objects(t, "primary") {
+			left[key] = true
+		}
+		for _, key := range before {
+			stray := false
+			for _, s := range tt.strays {
+				stray = stray || s == key
+			}
+			if left[key] == stray {
+				t.Errorf("%s: %s kept %v, want %v", tt.name, key, left[key], !stray)
+			}
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/pipeline"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+var (
+	ErrQuarantined    = errors.New("upload quarantined")
+	ErrUploadTooLarge = errors.New("upload too large")
+)
+
+const defaultHookMaxBytes = 32 * 1024 * 1024
+
+// runWriteHooks passes the upload through the bucket's write pipeline and
+// swaps the processed body into req. It runs before anything is written to
+// the provider or the cache.
+func (s *Service) runWriteHooks(ctx context.Context, req *PutRequest) error {
+	bc := s.buckets.Lookup(req.Env, req.LogicalRegion, req.Bucket)
+	if bc == nil || bc.WriteHooks == nil || len(bc.WriteHooks.Hooks) == 0 {
+		return nil
+	}
+	hc := bc.WriteHooks
+	p, err := pipeline.New(hc.Hooks)
+	if err != nil {
+		return err
+	}
+
+	limit := hc.MaxBytes
+	if limit == 0 {
+		limit = defaultHookMaxBytes
+	}
+	if req.Size > limit {
+		return fmt.Errorf("%w: %d bytes exceeds write hook limit %d", ErrUploadTooLarge, req.Size, limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > limit {
+		return fmt.Errorf("%w: exceeds write hook limit %d", ErrUploadTooLarge, limit)
+	}
+
+	obj := &pipeline.Object{
+		Env:           req.Env,
+		LogicalRegion: req.LogicalRegion,
+		Bucket:        req.Bucket,
+		Key:           req.Key,
+		ContentType:   req.ContentType,
+		Data:          data,
+	}
+	if err := p.Run(ctx, obj); err != nil {
+		if errors.Is(err, pipeline.ErrRejected) && hc.OnFailure == "quarantine" {
+			if qerr := s.quarantine(ctx, req, data, err); qerr != nil {
+				return fmt.Errorf("%v; quarantine failed: %w", err, qerr)
+			}
+			return fmt.Errorf("%w: %v", ErrQuarantined, err)
+		}
+		return err
+	}
+
+	req.Body = bytes.NewReader(obj.Data)
+	req.Size = int64(len(obj.Data))
+	req.ContentType = obj.ContentType
+	return nil
+}
+
+// quarantine stores a rejected upload under a _quarantine/ prefix of the
+// bucket's provider for later inspection. It is not recorded in metadata and
+// is never served.
+func (s *Service) quarantine(ctx context.Context, req *PutRequest, data []byte, reason error) error {
+	route, err := s.router.ResolveRoute(objectstore.RouteKey{
+		Env:           req.Env,
+		LogicalRegion: req.LogicalRegion,
+		Bucket:        req.Bucket,
+		StorageClass:  req.StorageClass,
+	})
+	if err != nil {
+		return err
+	}
+	backend, ok := s.providers.Get(route.ProviderName)
+	if !ok {
+		return fmt.Errorf("no backend for provider %s", route.ProviderName)
+	}
+	loc := objectstore.ObjectLocation{
+		ProviderType:   route.ProviderType,
+		ProviderRegion: route.ProviderRegion,
+		ProviderBucket: route.ProviderBucket,
+		PhysicalKey:    quarantinePrefix + time.Now().UTC().Format("20060102T150405Z") + "/" + s.buildPhysicalKey(req, newWriteID()),
+	}
+	_, err = backend.PutObject(ctx, loc, bytes.NewReader(data), int64(len(data)), objectstore.PutOptions{
+		ContentType:  req.ContentType,
+		StorageClass: req.StorageClass,
+		Metadata:     map[string]string{"quarantine-reason": reason.Error()},
+	})
+	if err == nil {
+		log.Printf("quarantined upload %s/%s/%s/%s at %s: %v", req.Env, req.LogicalRegion, req.Bucket, req.Key, loc.PhysicalKey, reason)
+	}
+	return err
+}
+
+const quarantinePrefix = "_quarantine/"
@@ -0,0 +1,86 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/kenelite/smartstore/internal/inspect"
+	"github.com/kenelite/smartstore/internal/metadata"
+)
+
+var (
+	ErrObjectQuarantined = errors.New("object is quarantined")
+	ErrInspectionFailed  = errors.New("content inspection failed")
+)
+
+// WithInspector sets the scanner used for buckets with an inspect section.
+func WithInspector(i inspect.Inspector) Option {
+	return func(s *Service) { s.inspector = i }
+}
+
+// scan inspects an upload while it streams to the provider. The request
+// body is teed into the inspector, so content is read only once.
+type scan struct {
+	pw       *io.PipeWriter
+	done     chan struct{}
+	verdict  inspect.Verdict
+	err      error
+	failOpen bool
+	object   string
+}
+
+// startScan wraps req.Body when the bucket requires inspection. It returns
+// nil otherwise; a nil *scan reports every upload as ACTIVE.
+func (s *Service) startScan(ctx context.Context, req *PutRequest) *scan {
+	if s.inspector == nil {
+		return nil
+	}
+	bc := s.buckets.Lookup(req.Env, req.LogicalRegion, req.Bucket)
+	if bc == nil || bc.Inspect == nil {
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	sc := &scan{
+		pw:       pw,
+		done:     make(chan struct{}),
+		failOpen: bc.Inspect.FailOpen,
+		object:   fmt.Sprintf("%s/%s/%s/%s", req.Env, req.LogicalRegion, req.Bucket, req.Key),
+	}
+	req.Body = io.TeeReader(req.Body, pw)
+	go func() {
+		defer close(sc.done)
+		sc.verdict, sc.err = s.inspector.Inspect(ctx, pr)
+		// keep draining so the upload never blocks on a scanner that stopped early
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+	return sc
+}
+
+// finish ends the stream to the inspector and returns the status to record.
+// uploadErr is passed on to the inspector when the upload itself failed.
+func (sc *scan) finish(uploadErr error) (string, error) {
+	if sc == nil {
+		return metadata.StatusActive, nil
+	}
+	_ = sc.pw.CloseWithError(uploadErr)
+	<-sc.done
+	if uploadErr != nil {
+		return "", uploadErr
+	}
+	if sc.err != nil {
+		if sc.failOpen {
+			log.Printf("inspection of %s failed, accepting (fail-open): %v", sc.object, sc.err)
+			return metadata.StatusActive, nil
+		}
+		return "", fmt.Errorf("%w: %v", ErrInspectionFailed, sc.err)
+	}
+	if !sc.verdict.Clean {
+		log.Printf("quarantining %s: %s", sc.object, sc.verdict.Signature)
+		return metadata.StatusQuarantined, nil
+	}
+	return metadata.StatusActive, nil
+}
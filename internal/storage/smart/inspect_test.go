@@ -0,0 +1,154 @@
+package smart
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/inspect"
+	"github.com/kenelite/smartstore/internal/metadata"
+)
+
+// fakeClamd answers INSTREAM sessions with its current reply: "" closes
+// the connection without one, "hang" never answers.
+type fakeClamd struct {
+	addr  string
+	reply atomic.Value // string
+}
+
+func newFakeClamd(t *testing.T) *fakeClamd {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	fc := &fakeClamd{addr: ln.Addr().String()}
+	fc.reply.Store("stream: OK")
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go fc.serve(conn)
+		}
+	}()
+	return fc
+}
+
+func (fc *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	cmd := make([]byte, len("zINSTREAM\x00"))
+	if _, err := io.ReadFull(conn, cmd); err != nil {
+		return
+	}
+	for {
+		var size uint32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(io.Discard, conn, int64(size)); err != nil {
+			return
+		}
+	}
+	switch reply := fc.reply.Load().(string); reply {
+	case "":
+	case "hang":
+		_, _ = io.Copy(io.Discard, conn)
+	default:
+		_, _ = io.WriteString(conn, reply+"\x00")
+	}
+}
+
+func newInspectedService(t *testing.T, failOpen bool) (*testService, *fakeClamd) {
+	t.Helper()
+	fc := newFakeClamd(t)
+	inspector, err := inspect.NewClamdInspector(inspect.ClamdConfig{Network: "tcp", Address: fc.addr, Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestService(t, config.RouteRule{}, config.BucketConfig{
+		Inspect: &config.InspectConfig{FailOpen: failOpen},
+	}, WithInspector(inspector))
+	// 64 byte uploads stream through putLarge, smaller ones are buffered
+	ts.smallFileThreshold = 32
+	return ts, fc
+}
+
+func TestInspectVerdicts(t *testing.T) {
+	for _, size := range []int{16, 64} {
+		ts, fc := newInspectedService(t, false)
+		data := bytes.Repeat([]byte("x"), size)
+
+		if _, err := ts.put(t, "clean", data); err != nil {
+			t.Fatalf("%d bytes: put clean: %v", size, err)
+		}
+		if got, _, err := ts.get(t, "clean"); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%d bytes: get clean = %q, %v", size, got, err)
+		}
+
+		fc.reply.Store("stream: Eicar-Test-Signature FOUND")
+		if _, err := ts.put(t, "infected", data); !errors.Is(err, ErrQuarantined) {
+			t.Fatalf("%d bytes: put infected: err = %v, want ErrQuarantined", size, err)
+		}
+		if rec := ts.record(t, "infected"); rec.Status != metadata.StatusQuarantined {
+			t.Errorf("%d bytes: infected status = %s", size, rec.Status)
+		}
+		if _, _, err := ts.get(t, "infected"); !errors.Is(err, ErrObjectQuarantined) {
+			t.Errorf("%d bytes: get infected: err = %v, want ErrObjectQuarantined", size, err)
+		}
+	}
+}
+
+func TestInspectFailClosed(t *testing.T) {
+	for _, reply := range []string{"", "hang", "Can't allocate memory ERROR"} {
+		for _, size := range []int{16, 64} {
+			ts, fc := newInspectedService(t, false)
+			v1 := bytes.Repeat([]byte("1"), size)
+			if _, err := ts.put(t, "k", v1); err != nil {
+				t.Fatalf("put v1: %v", err)
+			}
+			stored := ts.objects(t, "primary")
+
+			fc.reply.Store(reply)
+			v2 := bytes.Repeat([]byte("2"), size)
+			if _, err := ts.put(t, "k", v2); !errors.Is(err, ErrInspectionFailed) {
+				t.Fatalf("reply %q, %d bytes: put v2: err = %v, want ErrInspectionFailed", reply, size, err)
+			}
+			// the unscanned upload must not have replaced or removed v1
+			if got, _, err := ts.get(t, "k"); err != nil || !bytes.Equal(got, v1) {
+				t.Errorf("reply %q, %d bytes: get after failed scan = %q, %v; want v1", reply, size, got, err)
+			}
+			if after := ts.objects(t, "primary"); len(after) != len(stored) || after[0] != stored[0] {
+				t.Errorf("reply %q, %d bytes: provider holds %v, want only %v", reply, size, after, stored)
+			}
+		}
+	}
+}
+
+func TestInspectFailOpen(t *testing.T) {
+	for _, size := range []int{16, 64} {
+		ts, fc := newInspectedService(t, true)
+		fc.reply.Store("")
+		data := bytes.Repeat([]byte("x"), size)
+		if _, err := ts.put(t, "k", data); err != nil {
+			t.Fatalf("%d bytes: put: %v", size, err)
+		}
+		if rec := ts.record(t, "k"); rec.Status != metadata.StatusActive {
+			t.Errorf("%d bytes: status = %s, want ACTIVE", size, rec.Status)
+		}
+		if got, _, err := ts.get(t, "k"); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: get = %q, %v", size, got, err)
+		}
+	}
+}
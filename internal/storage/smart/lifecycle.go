@@ -0,0 +1,335 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+const (
+	lifecycleBatchSize  = 500
+	maxLifecycleActions = 1000 // actions listed in a report; counts cover all
+	accessTouchInterval = time.Hour
+)
+
+// storageClassRank orders storage classes from hot to cold. Lifecycle rules
+// only ever move objects to a colder class.
+var storageClassRank = map[string]int{"HOT": 0, "COLD": 1, "ARCHIVE": 2}
+
+// ValidateLifecycle checks a bucket's lifecycle rules.
+func ValidateLifecycle(rules []config.LifecycleRule) error {
+	seen := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if r.ID == "" {
+			return errors.New("lifecycle rule without id")
+		}
+		if seen[r.ID] {
+			return fmt.Errorf("duplicate lifecycle rule %q", r.ID)
+		}
+		seen[r.ID] = true
+		if len(r.Transitions) == 0 && r.Expiration == nil {
+			return fmt.Errorf("lifecycle rule %q has neither transitions nor expiration", r.ID)
+		}
+		for _, t := range r.Transitions {
+			if storageClassRank[t.StorageClass] == 0 {
+				return fmt.Errorf("lifecycle rule %q: cannot transition to storage class %q", r.ID, t.StorageClass)
+			}
+			if t.Age <= 0 && t.Idle <= 0 {
+				return fmt.Errorf("lifecycle rule %q: transition to %s needs age or idle", r.ID, t.StorageClass)
+			}
+		}
+		if e := r.Expiration; e != nil && e.Age <= 0 && e.Idle <= 0 {
+			return fmt.Errorf("lifecycle rule %q: expiration needs age or idle", r.ID)
+		}
+	}
+	return nil
+}
+
+func ruleMatches(r *config.LifecycleRule, rec *metadata.ObjectRecord) bool {
+	if !strings.HasPrefix(rec.ObjectKey, r.Prefix) {
+		return false
+	}
+	for k, v := range r.Tags {
+		if tv, ok := rec.Tags[k]; !ok || tv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func conditionHolds(c *config.LifecycleCondition, rec *metadata.ObjectRecord, now time.Time) bool {
+	lastRead := rec.LastAccessedAt
+	if lastRead.IsZero() {
+		lastRead = rec.CreatedAt
+	}
+	return (c.Age > 0 && now.Sub(rec.CreatedAt) >= c.Age) ||
+		(c.Idle > 0 && now.Sub(lastRead) >= c.Idle)
+}
+
+// LifecycleAction is one transition or expiration a lifecycle run made, or
+// in a dry run would make.
+type LifecycleAction struct {
+	Env           string `json:"env"`
+	LogicalRegion string `json:"logical_region"`
+	Bucket        string `json:"bucket"`
+	Key           string `json:"key"`
+	VersionID     string `json:"version_id"`
+	Rule          string `json:"rule"`
+	Action        string `json:"action"` // "transition" or "expire"
+	From          string `json:"from,omitempty"`
+	To            string `json:"to,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+type LifecycleReport struct {
+	DryRun       bool               `json:"dry_run"`
+	StartedAt    time.Time          `json:"started_at"`
+	Scanned      int                `json:"scanned"`
+	Transitioned int                `json:"transitioned"`
+	Expired      int                `json:"expired"`
+	Failed       int                `json:"failed"`
+	Actions      []*LifecycleAction `json:"actions"`
+	Truncated    bool               `json:"truncated"` // more actions than listed
+}
+
+func (r *LifecycleReport) add(a *LifecycleAction) {
+	switch {
+	case a.Error != "":
+		r.Failed++
+	case a.Action == "expire":
+		r.Expired++
+	default:
+		r.Transitioned++
+	}
+	if len(r.Actions) < maxLifecycleActions {
+		r.Actions = append(r.Actions, a)
+	} else {
+		r.Truncated = true
+	}
+}
+
+// planLifecycle picks what the rules do with rec now: expiration wins over
+// transitions, and of several due transitions the coldest is taken. Objects
+// under retention are not expired unless expiring only adds a delete marker.
+func (s *Service) planLifecycle(rules []config.LifecycleRule, rec *metadata.ObjectRecord, now time.Time) *LifecycleAction {
+	var plan *LifecycleAction
+	rank := storageClassRank[rec.StorageClass]
+	for i := range rules {
+		r := &rules[i]
+		if !ruleMatches(r, rec) {
+			continue
+		}
+		if r.Expiration != nil && conditionHolds(r.Expiration, rec, now) &&
+			(s.versioned(rec.Env, rec.LogicalRegion, rec.Bucket) || !rec.Locked(now)) {
+			return &LifecycleAction{Rule: r.ID, Action: "expire"}
+		}
+		for _, t := range r.Transitions {
+			if storageClassRank[t.StorageClass] > rank && conditionHolds(&t.LifecycleCondition, rec, now) {
+				rank = storageClassRank[t.StorageClass]
+				plan = &LifecycleAction{Rule: r.ID, Action: "transition", From: rec.StorageClass, To: t.StorageClass}
+			}
+		}
+	}
+	return plan
+}
+
+// ApplyLifecycle walks all metadata and applies the lifecycle rules of each
+// object's bucket to its latest version. With dryRun it only reports what
+// it would do.
+func (s *Service) ApplyLifecycle(ctx context.Context, dryRun bool) (*LifecycleReport, error) {
+	report := &LifecycleReport{DryRun: dryRun, StartedAt: time.Now(), Actions: []*LifecycleAction{}}
+	var afterID int64
+	for {
+		recs, err := s.metaRepo.ScanObjects(ctx, afterID, lifecycleBatchSize)
+		if err != nil {
+			return report, err
+		}
+		for _, rec := range recs {
+			afterID = rec.ID
+			if !rec.IsLatest || rec.Status != metadata.StatusActive {
+				continue
+			}
+			bc := s.buckets.Lookup(rec.Env, rec.LogicalRegion, rec.Bucket)
+			if bc == nil || len(bc.Lifecycle) == 0 {
+				continue
+			}
+			report.Scanned++
+			act := s.planLifecycle(bc.Lifecycle, rec, time.Now())
+			if act == nil {
+				continue
+			}
+			act.Env, act.LogicalRegion, act.Bucket, act.Key, act.VersionID = rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey, rec.VersionID
+			if !dryRun {
+				if err := s.applyLifecycleAction(ctx, *rec, act); err != nil {
+					act.Error = err.Error()
+				}
+			}
+			report.add(act)
+		}
+		if len(recs) < lifecycleBatchSize || ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+	}
+}
+
+// applyLifecycleAction takes rec by value: it is the record as scanned,
+// which the repository may update underneath.
+func (s *Service) applyLifecycleAction(ctx context.Context, rec metadata.ObjectRecord, act *LifecycleAction) error {
+	if act.Action == "expire" {
+		// skip keys written again since the scan
+		cur, err := s.metaRepo.GetObject(ctx, rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey)
+		if err != nil {
+			return err
+		}
+		if cur.VersionID != rec.VersionID {
+			return fmt.Errorf("skipped: %s was written again", rec.ObjectKey)
+		}
+		_, err = s.Delete(ctx, &DeleteRequest{Env: rec.Env, LogicalRegion: rec.LogicalRegion, Bucket: rec.Bucket, Key: rec.ObjectKey})
+		return err
+	}
+	return s.transition(ctx, &rec, act.To)
+}
+
+// transition copies the object of rec through the route of storage class
+// to, points the record at the copy and releases the old object.
+func (s *Service) transition(ctx context.Context, rec *metadata.ObjectRecord, to string) error {
+	route, err := s.router.ResolveRoute(objectstore.RouteKey{
+		Env:           rec.Env,
+		LogicalRegion: rec.LogicalRegion,
+		Bucket:        rec.Bucket,
+		StorageClass:  to,
+	})
+	if err != nil {
+		return err
+	}
+	return s.moveObject(ctx, rec, route, to)
+}
+
+// moveObject copies the object of rec to route, stored with storage class
+// class, points the record at the copy and releases the old object. A move
+// to another class also drops the small-object cache entry.
+func (s *Service) moveObject(ctx context.Context, rec *metadata.ObjectRecord, route objectstore.RouteResult, class string) error {
+	dst, ok := s.providers.Get(route.ProviderName)
+	if !ok {
+		return fmt.Errorf("no backend for provider %s", route.ProviderName)
+	}
+	src, err := s.backendFor(rec)
+	if err != nil {
+		return err
+	}
+	body, size, _, err := readContent(ctx, src, locationOf(rec), rec)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	moved := *rec
+	if class != rec.StorageClass {
+		moved.StorageClass = class
+		moved.StoreBackend = metadata.StoreObjectOnly
+	}
+	moved.ProviderName = route.ProviderName
+	moved.ProviderType = string(route.ProviderType)
+	moved.ProviderRegion = route.ProviderRegion
+	moved.ProviderBucket = route.ProviderBucket
+	moved.PackID, moved.PackOffset = 0, 0 // packed objects move out on their own
+	moved.PhysicalKey = s.buildPhysicalKey(&PutRequest{Env: rec.Env, LogicalRegion: rec.LogicalRegion, Bucket: rec.Bucket, Key: rec.ObjectKey}, newWriteID())
+	if moved.ETag, err = dst.PutObject(ctx, locationOf(&moved), body, size, objectstore.PutOptions{
+		ContentType:  rec.ContentType,
+		StorageClass: class,
+	}); err != nil {
+		return err
+	}
+	if err := s.metaRepo.Relocate(ctx, &moved, rec.PhysicalKey); err != nil {
+		_ = dst.DeleteObject(ctx, locationOf(&moved))
+		if errors.Is(err, metadata.ErrNotFound) {
+			return fmt.Errorf("skipped: %s changed during the move", rec.ObjectKey)
+		}
+		return err
+	}
+	if class != rec.StorageClass {
+		_ = s.cache.Del(ctx, s.cacheKey(rec.Env, rec.Bucket, rec.ObjectKey))
+	}
+	s.enqueueReplication(ctx, &moved, route.ProviderName)
+	s.releasePhysical(ctx, rec)
+	return nil
+}
+
+// RunLifecycle calls ApplyLifecycle every interval until ctx is done.
+func (s *Service) RunLifecycle(ctx context.Context, interval time.Duration, dryRun bool) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		report, err := s.ApplyLifecycle(ctx, dryRun)
+		if err != nil {
+			log.Printf("lifecycle: %v", err)
+		}
+		if report != nil && (dryRun || report.Transitioned+report.Expired+report.Failed > 0) {
+			log.Printf("lifecycle: dry_run=%v scanned %d, transitioned %d, expired %d, failed %d",
+				dryRun, report.Scanned, report.Transitioned, report.Expired, report.Failed)
+			if dryRun {
+				for _, a := range report.Actions {
+					log.Printf("lifecycle: would %s %s/%s/%s/%s (rule %s) %s", a.Action, a.Env, a.LogicalRegion, a.Bucket, a.Key, a.Rule, a.To)
+				}
+			}
+		}
+		s.pruneAccessed(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Service) tracksAccess(env, region, bucket string) bool {
+	bc := s.buckets.Lookup(env, region, bucket)
+	if bc == nil {
+		return false
+	}
+	for _, r := range bc.Lifecycle {
+		if r.Expiration != nil && r.Expiration.Idle > 0 {
+			return true
+		}
+		for _, t := range r.Transitions {
+			if t.Idle > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recordAccess notes a read of the latest version of key for idle based
+// lifecycle rules. Each gateway writes it to metadata at most once per
+// accessTouchInterval and key.
+func (s *Service) recordAccess(ctx context.Context, env, region, bucket, key string) {
+	if !s.tracksAccess(env, region, bucket) {
+		return
+	}
+	now := time.Now()
+	k := env + "/" + region + "/" + bucket + "/" + key
+	if last, ok := s.accessed.Load(k); ok && now.Sub(last.(time.Time)) < accessTouchInterval {
+		return
+	}
+	s.accessed.Store(k, now)
+	if err := s.metaRepo.TouchObject(ctx, env, region, bucket, key, now); err != nil && !errors.Is(err, metadata.ErrNotFound) {
+		log.Printf("lifecycle: record access of %s: %v", k, err)
+	}
+}
+
+func (s *Service) pruneAccessed(now time.Time) {
+	s.accessed.Range(func(k, v any) bool {
+		if now.Sub(v.(time.Time)) >= accessTouchInterval {
+			s.accessed.Delete(k)
+		}
+		return true
+	})
+}
@@ -0,0 +1,182 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+func TestPlanLifecycle(t *testing.T) {
+	const day = 24 * time.Hour
+	rules := []config.LifecycleRule{
+		{ID: "logs", Prefix: "logs/", Expiration: &config.LifecycleCondition{Age: 30 * day}},
+		{ID: "tmp", Tags: map[string]string{"tmp": "yes"}, Expiration: &config.LifecycleCondition{Idle: 7 * day}},
+		{ID: "cold", Transitions: []config.LifecycleTransition{
+			{LifecycleCondition: config.LifecycleCondition{Age: day}, StorageClass: "COLD"},
+			{LifecycleCondition: config.LifecycleCondition{Idle: 30 * day}, StorageClass: "ARCHIVE"},
+		}},
+	}
+	now := time.Now()
+	tests := []struct {
+		name    string
+		key     string
+		class   string
+		tags    map[string]string
+		age     time.Duration
+		idle    time.Duration // since the last read; 0 if never read
+		locked  bool
+		action  string // "" for none
+		ruleID  string
+		toClass string
+	}{
+		{name: "prefix and age expire", key: "logs/a", age: 31 * day, idle: day, action: "expire", ruleID: "logs"},
+		{name: "prefix, too young to expire", key: "logs/a", age: 2 * day, idle: day, action: "transition", ruleID: "cold", toClass: "COLD"},
+		{name: "prefix must match from the start", key: "app/logs/a", age: 31 * day, idle: day, action: "transition", ruleID: "cold", toClass: "COLD"},
+		{name: "tag and idle expire", key: "a", tags: map[string]string{"tmp": "yes"}, age: 8 * day, idle: 8 * day, action: "expire", ruleID: "tmp"},
+		{name: "tag, read recently", key: "a", tags: map[string]string{"tmp": "yes"}, age: 10 * day, idle: day, action: "transition", ruleID: "cold", toClass: "COLD"},
+		{name: "tag value differs", key: "a", tags: map[string]string{"tmp": "no"}, age: 8 * day, idle: 8 * day, action: "transition", ruleID: "cold", toClass: "COLD"},
+		{name: "never read counts from the upload", key: "a", age: 31 * day, action: "transition", ruleID: "cold", toClass: "ARCHIVE"},
+		{name: "coldest due transition wins", key: "a", age: 40 * day, idle: 35 * day, action: "transition", ruleID: "cold", toClass: "ARCHIVE"},
+		{name: "already cold", key: "a", class: "COLD", age: 2 * day, idle: day},
+		{name: "never warmer", key: "a", class: "ARCHIVE", age: 40 * day, idle: 35 * day},
+		{name: "too young", key: "a", age: time.Hour},
+		{name: "retained objects are not expired", key: "logs/a", age: 31 * day, idle: day, locked: true, action: "transition", ruleID: "cold", toClass: "COLD"},
+	}
+	ts := newTestService(t, config.RouteRule{}, config.BucketConfig{})
+	for _, tt := range tests {
+		rec := &metadata.ObjectRecord{
+			Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket,
+			ObjectKey:    tt.key,
+			StorageClass: "HOT",
+			Tags:         tt.tags,
+			CreatedAt:    now.Add(-tt.age),
+		}
+		if tt.class != "" {
+			rec.StorageClass = tt.class
+		}
+		if tt.idle > 0 {
+			rec.LastAccessedAt = now.Add(-tt.idle)
+		}
+		if tt.locked {
+			rec.RetentionMode, rec.RetainUntil = metadata.RetentionGovernance, now.Add(day)
+		}
+		act := ts.planLifecycle(rules, rec, now)
+		switch {
+		case tt.action == "" && act != nil:
+			t.Errorf("%s: planned %+v, want nothing", tt.name, act)
+		case tt.action == "":
+		case act == nil:
+			t.Errorf("%s: planned nothing, want %s", tt.name, tt.action)
+		case act.Action != tt.action || act.Rule != tt.ruleID || act.To != tt.toClass:
+			t.Errorf("%s: planned %s by %s to %q, want %s by %s to %q", tt.name, act.Action, act.Rule, act.To, tt.action, tt.ruleID, tt.toClass)
+		}
+	}
+}
+
+// newLifecycleService routes HOT objects to the primary's bucket "primary"
+// and COLD ones to its bucket "cold".
+func newLifecycleService(t *testing.T, bucket config.BucketConfig) *testService {
+	t.Helper()
+	ts := newTestService(t, config.RouteRule{}, bucket)
+	route := config.RouteRule{Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, ProviderName: "primary"}
+	hot, cold := route, route
+	hot.StorageClass, hot.ProviderBucket = "HOT", "primary"
+	cold.StorageClass, cold.ProviderBucket = "COLD", "cold"
+	ts.router = objectstore.NewStaticRouter(config.ObjectStorageConfig{
+		Providers: []config.ProviderConfig{{Name: "primary", Type: config.ProviderMemory}},
+		Routes:    []config.RouteRule{hot, cold},
+	})
+	return ts
+}
+
+func TestApplyLifecycle(t *testing.T) {
+	ts := newLifecycleService(t, config.BucketConfig{Lifecycle: []config.LifecycleRule{
+		{ID: "tmp", Prefix: "tmp/", Expiration: &config.LifecycleCondition{Age: time.Nanosecond}},
+		{ID: "archive", Tags: map[string]string{"archive": "yes"}, Transitions: []config.LifecycleTransition{
+			{LifecycleCondition: config.LifecycleCondition{Age: time.Nanosecond}, StorageClass: "COLD"},
+		}},
+	}})
+	for _, key := range []string{"tmp/a", "keep"} {
+		if _, err := ts.put(t, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := []byte("to archive")
+	if _, err := ts.Put(context.Background(), &PutRequest{
+		Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: "b",
+		Size: int64(len(data)), Body: bytes.NewReader(data), Tags: map[string]string{"archive": "yes"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	report, err := ts.ApplyLifecycle(context.Background(), true)
+	if err != nil || report.Scanned != 3 || report.Expired != 1 || report.Transitioned != 1 || len(report.Actions) != 2 {
+		t.Fatalf("dry run = %+v, %v; want one expiration and one transition", report, err)
+	}
+	if _, _, err := ts.get(t, "tmp/a"); err != nil {
+		t.Errorf("the dry run expired tmp/a: %v", err)
+	}
+	if rec := ts.record(t, "b"); rec.StorageClass != "HOT" {
+		t.Errorf("the dry run moved b to %s", rec.StorageClass)
+	}
+
+	report, err = ts.ApplyLifecycle(context.Background(), false)
+	if err != nil || report.Expired != 1 || report.Transitioned != 1 || report.Failed != 0 {
+		t.Fatalf("apply = %+v, %v", report, err)
+	}
+	if _, _, err := ts.get(t, "tmp/a"); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("get of the expired tmp/a: err = %v, want ErrNotFound", err)
+	}
+	if rec := ts.record(t, "b"); rec.StorageClass != "COLD" || rec.ProviderBucket != "cold" {
+		t.Errorf("b is %s at %s, want COLD at cold", rec.StorageClass, rec.ProviderBucket)
+	}
+	if got, _, err := ts.get(t, "b"); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("get b after the transition = %q, %v", got, err)
+	}
+	if rec := ts.record(t, "keep"); rec.StorageClass != "HOT" {
+		t.Errorf("keep moved to %s", rec.StorageClass)
+	}
+	if report, err := ts.ApplyLifecycle(context.Background(), false); err != nil || len(report.Actions) != 0 {
+		t.Errorf("second run = %+v, %v; want nothing left to do", report, err)
+	}
+}
+
+// Rules apply to the latest version only; noncurrent versions stay put.
+func TestApplyLifecycleNoncurrentVersions(t *testing.T) {
+	ts := newLifecycleService(t, config.BucketConfig{Versioning: true, Lifecycle: []config.LifecycleRule{
+		{ID: "cold", Transitions: []config.LifecycleTransition{
+			{LifecycleCondition: config.LifecycleCondition{Age: time.Nanosecond}, StorageClass: "COLD"},
+		}},
+	}})
+	var ids []string
+	for _, data := range []string{"v1", "v2"} {
+		resp, err := ts.put(t, "k", []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, resp.VersionID)
+	}
+	time.Sleep(time.Millisecond)
+
+	report, err := ts.ApplyLifecycle(context.Background(), false)
+	if err != nil || report.Scanned != 1 || report.Transitioned != 1 || report.Actions[0].VersionID != ids[1] {
+		t.Fatalf("apply = %+v, %v; want the latest version moved", report, err)
+	}
+	v1, err := ts.repo.GetObjectVersion(context.Background(), testEnv, testRegion, testBucket, "k", ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.StorageClass != "HOT" {
+		t.Errorf("noncurrent version moved to %s, want it left HOT", v1.StorageClass)
+	}
+	if got, err := ts.getVersion(t, "k", ids[0]); err != nil || string(got) != "v1" {
+		t.Errorf("get v1 = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,198 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
+)
+
+var (
+	ErrObjectLocked      = errors.New("object is locked")
+	ErrInvalidObjectLock = errors.New("invalid object lock")
+)
+
+// ObjectLock is the retention and legal hold of an object version. An
+// empty Mode means no retention.
+type ObjectLock struct {
+	Mode        string    `json:"mode,omitempty"`
+	RetainUntil time.Time `json:"retain_until"`
+	LegalHold   bool      `json:"legal_hold"`
+}
+
+func objectLockFromRecord(rec *metadata.ObjectRecord) *ObjectLock {
+	if rec.RetentionMode == "" && !rec.LegalHold {
+		return nil
+	}
+	return &ObjectLock{Mode: rec.RetentionMode, RetainUntil: rec.RetainUntil, LegalHold: rec.LegalHold}
+}
+
+// ValidateObjectLock checks a bucket's object lock section.
+func ValidateObjectLock(lc *config.ObjectLockConfig) error {
+	if lc.Mode != metadata.RetentionGovernance && lc.Mode != metadata.RetentionCompliance {
+		return fmt.Errorf("%w: mode %q, want %s or %s", ErrInvalidObjectLock, lc.Mode, metadata.RetentionGovernance, metadata.RetentionCompliance)
+	}
+	if lc.Retention <= 0 {
+		return fmt.Errorf("%w: retention must be positive", ErrInvalidObjectLock)
+	}
+	return nil
+}
+
+// validateRetention checks a retention set by a client: either none, or a
+// known mode with a date in the future.
+func validateRetention(mode string, until time.Time, now time.Time) error {
+	switch mode {
+	case "":
+		if !until.IsZero() {
+			return fmt.Errorf("%w: retain-until date without a mode", ErrInvalidObjectLock)
+		}
+	case metadata.RetentionGovernance, metadata.RetentionCompliance:
+		if !until.After(now) {
+			return fmt.Errorf("%w: retain-until date %s is not in the future", ErrInvalidObjectLock, until.Format(time.RFC3339))
+		}
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidObjectLock, mode)
+	}
+	return nil
+}
+
+// checkOverwrite rejects an upload that would replace a locked object.
+// Versioned buckets keep the old version, so nothing is replaced there.
+func (s *Service) checkOverwrite(ctx context.Context, req *PutRequest) error {
+	if req.Lock != nil {
+		if err := validateRetention(req.Lock.Mode, req.Lock.RetainUntil, time.Now()); err != nil {
+			return err
+		}
+	}
+	if s.versioned(req.Env, req.LogicalRegion, req.Bucket) {
+		return nil
+	}
+	prev, err := s.metaRepo.GetObject(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key)
+	if errors.Is(err, metadata.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.checkLocked(prev, req.BypassGovernance, "overwrite")
+}
+
+// checkLocked fails when rec is locked. Governance retention gives way to
+// bypass, which is audited; compliance retention and legal holds never do.
+func (s *Service) checkLocked(rec *metadata.ObjectRecord, bypass bool, action string) error {
+	if !rec.Locked(time.Now()) {
+		return nil
+	}
+	switch {
+	case rec.LegalHold:
+		return fmt.Errorf("%w: %s is under legal hold", ErrObjectLocked, rec.ObjectKey)
+	case rec.RetentionMode == metadata.RetentionGovernance && bypass:
+		s.auditBypass(rec, action)
+		return nil
+	}
+	return fmt.Errorf("%w: %s is retained in %s mode until %s", ErrObjectLocked,
+		rec.ObjectKey, rec.RetentionMode, rec.RetainUntil.UTC().Format(time.RFC3339))
+}
+
+func (s *Service) auditBypass(rec *metadata.ObjectRecord, action string) {
+	log.Printf("audit: governance retention bypassed: %s %s/%s/%s/%s version %s retained until %s",
+		action, rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey, rec.VersionID, rec.RetainUntil.UTC().Format(time.RFC3339))
+	metrics.GovernanceBypassTotal.WithLabelValues(rec.Env, rec.LogicalRegion, rec.Bucket, action).Inc()
+}
+
+// applyLock sets the lock of a new record: the retention requested with the
+// upload, else the bucket's default. Quarantined objects are never retained
+// so they can always be purged.
+func (s *Service) applyLock(req *PutRequest, rec *metadata.ObjectRecord) {
+	if rec.Status == metadata.StatusQuarantined {
+		return
+	}
+	if req.Lock != nil {
+		rec.LegalHold = req.Lock.LegalHold
+		if req.Lock.Mode != "" {
+			rec.RetentionMode, rec.RetainUntil = req.Lock.Mode, req.Lock.RetainUntil
+			return
+		}
+	}
+	if bc := s.buckets.Lookup(req.Env, req.LogicalRegion, req.Bucket); bc != nil && bc.ObjectLock != nil {
+		rec.RetentionMode = bc.ObjectLock.Mode
+		rec.RetainUntil = time.Now().Add(bc.ObjectLock.Retention)
+	}
+}
+
+type RetentionRequest struct {
+	Env              string
+	LogicalRegion    string
+	Bucket           string
+	Key              string
+	VersionID        string // empty for the latest version
+	Mode             string // empty removes the retention
+	RetainUntil      time.Time
+	BypassGovernance bool
+}
+
+// SetRetention changes the retention of an object version. Retention can
+// always be extended; compliance retention can never be shortened or
+// removed, and governance retention only with BypassGovernance.
+func (s *Service) SetRetention(ctx context.Context, req *RetentionRequest) (*ObjectLock, error) {
+	now := time.Now()
+	if err := validateRetention(req.Mode, req.RetainUntil, now); err != nil {
+		return nil, err
+	}
+	rec, err := s.lookup(ctx, &GetRequest{Env: req.Env, LogicalRegion: req.LogicalRegion, Bucket: req.Bucket, Key: req.Key, VersionID: req.VersionID})
+	if err != nil {
+		return nil, err
+	}
+	if rec.RetentionMode != "" && rec.RetainUntil.After(now) {
+		weakens := req.Mode == "" || req.RetainUntil.Before(rec.RetainUntil) ||
+			(rec.RetentionMode == metadata.RetentionCompliance && req.Mode != metadata.RetentionCompliance)
+		switch {
+		case !weakens:
+		case rec.RetentionMode == metadata.RetentionGovernance && req.BypassGovernance:
+			s.auditBypass(rec, "retention")
+		default:
+			return nil, fmt.Errorf("%w: %s retention until %s can only be extended", ErrObjectLocked,
+				rec.RetentionMode, rec.RetainUntil.UTC().Format(time.RFC3339))
+		}
+	}
+	if err := s.metaRepo.SetObjectLock(ctx, rec.ID, req.Mode, req.RetainUntil, rec.LegalHold); err != nil {
+		return nil, err
+	}
+	return &ObjectLock{Mode: req.Mode, RetainUntil: req.RetainUntil, LegalHold: rec.LegalHold}, nil
+}
+
+type LegalHoldRequest struct {
+	Env           string
+	LogicalRegion string
+	Bucket        string
+	Key           string
+	VersionID     string // empty for the latest version
+	LegalHold     bool
+	Admin         bool // the caller holds the admin token, which lifting a hold needs
+}
+
+// SetLegalHold places or lifts the legal hold of an object version. Lifting
+// one is reserved to admins and audited.
+func (s *Service) SetLegalHold(ctx context.Context, req *LegalHoldRequest) (*ObjectLock, error) {
+	rec, err := s.lookup(ctx, &GetRequest{Env: req.Env, LogicalRegion: req.LogicalRegion, Bucket: req.Bucket, Key: req.Key, VersionID: req.VersionID})
+	if err != nil {
+		return nil, err
+	}
+	if rec.LegalHold && !req.LegalHold {
+		if !req.Admin {
+			return nil, fmt.Errorf("%w: lifting the legal hold of %s needs the admin token", ErrObjectLocked, rec.ObjectKey)
+		}
+		log.Printf("audit: legal hold lifted: %s/%s/%s/%s version %s",
+			rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey, rec.VersionID)
+		metrics.LegalHoldsLiftedTotal.WithLabelValues(rec.Env, rec.LogicalRegion, rec.Bucket).Inc()
+	}
+	if err := s.metaRepo.SetObjectLock(ctx, rec.ID, rec.RetentionMode, rec.RetainUntil, req.LegalHold); err != nil {
+		return nil, err
+	}
+	return &ObjectLock{Mode: rec.RetentionMode, RetainUntil: rec.RetainUntil, LegalHold: req.LegalHold}, nil
+}
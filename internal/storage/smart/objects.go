@@ -0,0 +1,250 @@
+package smart
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+// ObjectInfo is the metadata view of an object returned by Head and List.
+type ObjectInfo struct {
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	ContentType  string            `json:"content_type,omitempty"`
+	StorageClass string            `json:"storage_class"`
+	ETag         string            `json:"etag"`
+	Version      int64             `json:"version"`
+	VersionID    string            `json:"version_id"`
+	LastModified time.Time         `json:"last_modified"`
+	Status       string            `json:"status"`
+	Lock         *ObjectLock       `json:"lock,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+func objectInfoFromRecord(rec *metadata.ObjectRecord) *ObjectInfo {
+	return &ObjectInfo{
+		Key:          rec.ObjectKey,
+		Size:         rec.SizeBytes,
+		ContentType:  rec.ContentType,
+		StorageClass: rec.StorageClass,
+		ETag:         rec.ETag,
+		Version:      rec.Version,
+		VersionID:    rec.VersionID,
+		LastModified: rec.UpdatedAt,
+		Status:       rec.Status,
+		Lock:         objectLockFromRecord(rec),
+		Tags:         rec.Tags,
+	}
+}
+
+func (s *Service) Head(ctx context.Context, req *GetRequest) (*ObjectInfo, error) {
+	rec, err := s.lookup(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return objectInfoFromRecord(rec), nil
+}
+
+type DeleteRequest struct {
+	Env           string
+	LogicalRegion string
+	Bucket        string
+	Key           string
+	VersionID     string // deletes this version for good
+
+	BypassGovernance bool // may delete an object under governance retention
+}
+
+// Delete moves the object to the trash and evicts it from the cache. The
+// physical object is kept until the bucket's trash retention has passed.
+// Quarantined objects are never restorable and are purged on the next run.
+// In versioned buckets Delete adds a delete marker instead, and a request
+// naming a version removes just that version. Locked objects and versions
+// cannot be deleted; adding a delete marker is always allowed.
+func (s *Service) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResult, error) {
+	if req.VersionID != "" {
+		return s.deleteVersion(ctx, req)
+	}
+	rec, err := s.metaRepo.GetObject(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	if s.versioned(req.Env, req.LogicalRegion, req.Bucket) {
+		return s.addDeleteMarker(ctx, req, rec)
+	}
+	if err := s.checkLocked(rec, req.BypassGovernance, "delete"); err != nil {
+		return nil, err
+	}
+	purgeAt := time.Now()
+	if rec.Status != metadata.StatusQuarantined {
+		purgeAt = purgeAt.Add(s.trashRetention(req.Env, req.LogicalRegion, req.Bucket))
+	}
+	if err := s.metaRepo.MarkDeleted(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key, purgeAt); err != nil {
+		return nil, err
+	}
+	_ = s.cache.Del(ctx, s.cacheKey(req.Env, req.Bucket, req.Key))
+	s.observeUsage(ctx, req.Env, req.LogicalRegion, req.Bucket)
+	return &DeleteResult{VersionID: rec.VersionID}, nil
+}
+
+type ListRequest struct {
+	Env           string
+	LogicalRegion string
+	Bucket        string
+	Prefix        string
+	StartAfter    string
+	StartAfterID  int64 // trash listings only
+	// StartAfterVersionID continues a version listing within StartAfter.
+	StartAfterVersionID string
+	Limit               int
+}
+
+type ListResponse struct {
+	Bucket      string        `json:"bucket"`
+	Prefix      string        `json:"prefix,omitempty"`
+	Objects     []*ObjectInfo `json:"objects"`
+	IsTruncated bool          `json:"is_truncated"`
+	NextMarker  string        `json:"next_marker,omitempty"`
+}
+
+const (
+	defaultListLimit = 1000
+	maxListLimit     = 1000
+)
+
+func (s *Service) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	limit := req.Limit
+	if limit <= 0 || limit > maxListLimit {
+		limit = defaultListLimit
+	}
+	// fetch one extra record to find out whether there is another page
+	recs, err := s.metaRepo.ListObjects(ctx, req.Env, req.LogicalRegion, req.Bucket, metadata.ListOptions{
+		Prefix:     req.Prefix,
+		StartAfter: req.StartAfter,
+		Limit:      limit + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ListResponse{
+		Bucket:  req.Bucket,
+		Prefix:  req.Prefix,
+		Objects: make([]*ObjectInfo, 0, len(recs)),
+	}
+	if len(recs) > limit {
+		recs = recs[:limit]
+		resp.IsTruncated = true
+		resp.NextMarker = recs[limit-1].ObjectKey
+	}
+	for _, rec := range recs {
+		resp.Objects = append(resp.Objects, objectInfoFromRecord(rec))
+	}
+	return resp, nil
+}
+
+type CopyRequest struct {
+	Source      GetRequest
+	Destination PutRequest // Body and Size are filled from the source
+}
+
+// Copy streams the source object through the gateway into the destination.
+// Content type, storage class and tags default to the source's when not set.
+func (s *Service) Copy(ctx context.Context, req *CopyRequest) (*PutResponse, error) {
+	src, err := s.lookup(ctx, &req.Source)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := s.Get(ctx, &req.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	dst := req.Destination
+	if dst.ContentType == "" {
+		dst.ContentType = src.ContentType
+	}
+	if dst.StorageClass == "" {
+		dst.StorageClass = src.StorageClass
+	}
+	if dst.Tags == nil {
+		dst.Tags = src.Tags
+	}
+	dst.Size = src.SizeBytes
+	dst.Body = obj.Body
+	return s.Put(ctx, &dst)
+}
+
+func locationOf(rec *metadata.ObjectRecord) objectstore.ObjectLocation {
+	return objectstore.ObjectLocation{
+		ProviderType:   objectstore.ProviderType(rec.ProviderType),
+		ProviderRegion: rec.ProviderRegion,
+		ProviderBucket: rec.ProviderBucket,
+		PhysicalKey:    rec.PhysicalKey,
+	}
+}
+
+func routeLocation(route objectstore.RouteResult, physicalKey string) objectstore.ObjectLocation {
+	return objectstore.ObjectLocation{
+		ProviderType:   route.ProviderType,
+		ProviderRegion: route.ProviderRegion,
+		ProviderBucket: route.ProviderBucket,
+		PhysicalKey:    physicalKey,
+	}
+}
+
+// backendFor resolves the adapter that holds the physical object of rec.
+func (s *Service) backendFor(rec *metadata.ObjectRecord) (objectstore.ObjectStorage, error) {
+	if name := s.providerNameOf(rec); name != "" {
+		if backend, ok := s.providers.Get(name); ok {
+			return backend, nil
+		}
+	}
+	routeName := rec.ProviderType // using provider type/name; here we treat ProviderType as key
+	backend, ok := s.providers.Get(routeName)
+	if !ok {
+		// fallback: try by provider type if name-based lookup failed
+		backend, ok = s.providers.Get(rec.ProviderBucket)
+		if !ok {
+			return nil, fmt.Errorf("no backend for provider %s", routeName)
+		}
+	}
+	return backend, nil
+}
+
+// providerNameOf returns the provider of rec's location. Records written
+// before the provider name was kept have it looked up among the configured
+// routes and their replica and fallback targets.
+func (s *Service) providerNameOf(rec *metadata.ObjectRecord) string {
+	if rec.ProviderName != "" {
+		return rec.ProviderName
+	}
+	for _, r := range s.router.Routes() {
+		for _, l := range r.Locations() {
+			if sameLocation(rec, l) {
+				return l.ProviderName
+			}
+		}
+	}
+	return ""
+}
+
+// sameLocation reports whether provider type, region and bucket of rec are
+// those of l, for records that do not name their provider.
+func sameLocation(rec *metadata.ObjectRecord, l objectstore.RouteResult) bool {
+	return rec.ProviderBucket == l.ProviderBucket && rec.ProviderType == string(l.ProviderType) && rec.ProviderRegion == l.ProviderRegion
+}
+
+// ResolveRoute reports which provider and bucket a write with key would use.
+func (s *Service) ResolveRoute(key objectstore.RouteKey) (objectstore.RouteResult, error) {
+	return s.router.ResolveRoute(key)
+}
+
+// PurgeCache evicts an object from the small-object cache.
+func (s *Service) PurgeCache(ctx context.Context, env, bucket, key string) error {
+	return s.cache.Del(ctx, s.cacheKey(env, bucket, key))
+}
@@ -0,0 +1,482 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+// packKeyMarker precedes the write ID in the physical keys of packs.
+const packKeyMarker = "~pack/"
+
+const (
+	defaultPackMaxBytes     = 8 << 20
+	defaultPackMaxDelay     = 200 * time.Millisecond
+	defaultPackCompactRatio = 0.5
+	// packUploadTimeout bounds the upload of a sealed pack, which no single
+	// request owns.
+	packUploadTimeout  = 5 * time.Minute
+	packScanBatchSize  = 200
+	maxPackCompactions = 1000 // packs listed in a report; counts cover all
+	packContentType    = "application/octet-stream"
+	packActionDelete   = "delete"
+	packActionRewrite  = "rewrite"
+)
+
+// packConfig returns the packing settings of a bucket with defaults
+// applied, or nil when the bucket does not pack.
+func (s *Service) packConfig(env, region, bucket string) *config.PackConfig {
+	bc := s.buckets.Lookup(env, region, bucket)
+	if bc == nil || bc.Pack == nil {
+		return nil
+	}
+	pc := *bc.Pack
+	if pc.MaxBytes <= 0 {
+		pc.MaxBytes = defaultPackMaxBytes
+	}
+	if pc.MaxDelay <= 0 {
+		pc.MaxDelay = defaultPackMaxDelay
+	}
+	if pc.CompactRatio <= 0 {
+		pc.CompactRatio = defaultPackCompactRatio
+	}
+	return &pc
+}
+
+// packer holds the open pack of each route key.
+type packer struct {
+	mu   sync.Mutex
+	open map[objectstore.RouteKey]*openPack
+}
+
+// openPack collects small objects until it is sealed and uploaded. The
+// fields below sealed are set before sealed is closed.
+type openPack struct {
+	key         objectstore.RouteKey
+	route       objectstore.RouteResult
+	physicalKey string
+	buf         bytes.Buffer
+	entries     int
+	timer       *time.Timer
+	uncommitted atomic.Int32 // writers whose records are not committed yet
+
+	sealed chan struct{}
+	stored objectstore.RouteResult // where the pack landed
+	id     int64
+	err    error
+}
+
+// packWrite is one object appended to a pack.
+type packWrite struct {
+	pack   *openPack
+	offset int64
+}
+
+// done releases the writer's hold on the pack once its record is
+// committed, or failed to be. The last writer drops the reference that
+// kept the pack from being collected before any record pointed into it.
+func (w *packWrite) done(ctx context.Context, s *Service) {
+	if w.pack.uncommitted.Add(-1) == 0 && w.pack.err == nil {
+		s.releaseRef(ctx, w.pack.stored.ProviderBucket, w.pack.physicalKey)
+	}
+}
+
+// putPacked appends data to the open pack of key and returns once that
+// pack is stored: writers arriving within the pack's max delay share one
+// upload.
+func (s *Service) putPacked(key objectstore.RouteKey, route objectstore.RouteResult, pc *config.PackConfig, data []byte) (*packWrite, error) {
+	s.packer.mu.Lock()
+	if s.packer.open == nil {
+		s.packer.open = map[objectstore.RouteKey]*openPack{}
+	}
+	p := s.packer.open[key]
+	if p == nil {
+		p = &openPack{
+			key:   key,
+			route: route,
+			physicalKey: fmt.Sprintf("%s/%s/%s/%s%s", key.Env, key.LogicalRegion, key.Bucket,
+				packKeyMarker, newWriteID()),
+			sealed: make(chan struct{}),
+		}
+		s.packer.open[key] = p
+		p.timer = time.AfterFunc(pc.MaxDelay, func() {
+			s.packer.mu.Lock()
+			if s.packer.open[key] != p {
+				s.packer.mu.Unlock()
+				return // sealed by size
+			}
+			s.sealLocked(p)
+			s.packer.mu.Unlock()
+		})
+	}
+	w := &packWrite{pack: p, offset: int64(p.buf.Len())}
+	p.buf.Write(data)
+	p.entries++
+	if int64(p.buf.Len()) >= pc.MaxBytes {
+		p.timer.Stop()
+		s.sealLocked(p)
+	}
+	s.packer.mu.Unlock()
+
+	<-p.sealed
+	if p.err != nil {
+		w.done(context.Background(), s)
+		return nil, p.err
+	}
+	return w, nil
+}
+
+// sealLocked closes p to new objects and uploads it in the background.
+// The caller holds s.packer.mu.
+func (s *Service) sealLocked(p *openPack) {
+	delete(s.packer.open, p.key)
+	p.uncommitted.Store(int32(p.entries))
+	go s.uploadPack(p)
+}
+
+func (s *Service) uploadPack(p *openPack) {
+	defer close(p.sealed)
+	ctx, cancel := context.WithTimeout(context.Background(), packUploadTimeout)
+	defer cancel()
+	labels := []string{p.key.Env, p.key.LogicalRegion, p.key.Bucket}
+
+	size := int64(p.buf.Len())
+	stored, etag, qw, err := s.putObject(ctx, p.key, p.route, p.physicalKey, bytes.NewReader(p.buf.Bytes()), size, objectstore.PutOptions{
+		ContentType:  packContentType,
+		StorageClass: p.key.StorageClass,
+	})
+	if err == nil {
+		// held until the records pointing into the pack are committed
+		if _, err = s.metaRepo.AcquireRef(ctx, stored.ProviderBucket, p.physicalKey, size); err != nil {
+			s.discardObject(ctx, stored, p.physicalKey, qw)
+		}
+	}
+	if err != nil {
+		p.err = err
+		log.Printf("pack %s: upload %d objects: %v", p.physicalKey, p.entries, err)
+		metrics.PacksSealedTotal.WithLabelValues(append(labels, "failed")...).Inc()
+		return
+	}
+	pack := &metadata.PackRecord{
+		Env:            p.key.Env,
+		LogicalRegion:  p.key.LogicalRegion,
+		Bucket:         p.key.Bucket,
+		StorageClass:   p.key.StorageClass,
+		ProviderName:   stored.ProviderName,
+		ProviderType:   string(stored.ProviderType),
+		ProviderRegion: stored.ProviderRegion,
+		ProviderBucket: stored.ProviderBucket,
+		PhysicalKey:    p.physicalKey,
+		ETag:           etag,
+		SizeBytes:      size,
+		Entries:        p.entries,
+	}
+	if err := s.metaRepo.AddPack(ctx, pack); err != nil {
+		p.err = fmt.Errorf("record pack: %w", err)
+		log.Printf("pack %s: %v", p.physicalKey, p.err)
+		s.releaseRef(ctx, stored.ProviderBucket, p.physicalKey)
+		s.discardObject(ctx, stored, p.physicalKey, qw)
+		metrics.PacksSealedTotal.WithLabelValues(append(labels, "failed")...).Inc()
+		return
+	}
+	p.stored, p.id = stored, pack.ID
+	// replicas copy the whole pack; records share them through its key
+	rec := packObject(pack)
+	if qw != nil {
+		s.finishQuorum(ctx, qw, rec)
+	} else {
+		s.enqueueReplication(ctx, rec, stored.ProviderName)
+	}
+	metrics.PacksSealedTotal.WithLabelValues(append(labels, "ok")...).Inc()
+}
+
+// packObject is a record standing for the provider object of pack p, for
+// the code that handles physical objects through records.
+func packObject(p *metadata.PackRecord) *metadata.ObjectRecord {
+	return &metadata.ObjectRecord{
+		Env:            p.Env,
+		LogicalRegion:  p.LogicalRegion,
+		Bucket:         p.Bucket,
+		ObjectKey:      packKeyMarker + strconv.FormatInt(p.ID, 10),
+		SizeBytes:      p.SizeBytes,
+		ContentType:    packContentType,
+		StorageClass:   p.StorageClass,
+		StoreBackend:   metadata.StoreObjectOnly,
+		ProviderName:   p.ProviderName,
+		ProviderType:   p.ProviderType,
+		ProviderRegion: p.ProviderRegion,
+		ProviderBucket: p.ProviderBucket,
+		PhysicalKey:    p.PhysicalKey,
+		PackID:         p.ID,
+		ETag:           p.ETag,
+		Status:         metadata.StatusActive,
+	}
+}
+
+// etagOf is the ETag of packed objects, which have no provider object of
+// their own: the hex MD5 of the content, as single-part S3 uploads get.
+func etagOf(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readContent opens the content of rec at loc, a location of its physical
+// object: all of it, or its range of a pack.
+func readContent(ctx context.Context, backend objectstore.ObjectStorage, loc objectstore.ObjectLocation, rec *metadata.ObjectRecord) (io.ReadCloser, int64, string, error) {
+	if rec.PackID == 0 {
+		return backend.GetObject(ctx, loc)
+	}
+	body, err := backend.GetObjectRange(ctx, loc, rec.PackOffset, rec.SizeBytes)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return body, rec.SizeBytes, rec.ContentType, nil
+}
+
+// PackCompaction is one pack deleted or rewritten by CompactPacks.
+type PackCompaction struct {
+	ID             int64  `json:"id"`
+	Env            string `json:"env"`
+	LogicalRegion  string `json:"logical_region"`
+	Bucket         string `json:"bucket"`
+	ProviderBucket string `json:"provider_bucket"`
+	PhysicalKey    string `json:"physical_key"`
+	Action         string `json:"action"` // delete or rewrite
+	SizeBytes      int64  `json:"size"`
+	LiveEntries    int    `json:"live_entries"`
+	LiveBytes      int64  `json:"live_bytes"`
+	NewPackID      int64  `json:"new_pack_id,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+type PackCompactionReport struct {
+	DryRun         bool              `json:"dry_run"`
+	StartedAt      time.Time         `json:"started_at"`
+	Scanned        int               `json:"scanned"`
+	Deleted        int               `json:"deleted"`   // packs without live objects, or to delete in a dry run
+	Rewritten      int               `json:"rewritten"` // packs whose live objects moved to a new pack
+	Failed         int               `json:"failed"`
+	ReclaimedBytes int64             `json:"reclaimed_bytes"`
+	Packs          []*PackCompaction `json:"packs"`
+	Truncated      bool              `json:"truncated"` // more packs than listed
+}
+
+func (r *PackCompactionReport) add(c *PackCompaction) {
+	switch {
+	case c.Error != "":
+		r.Failed++
+	case c.Action == packActionDelete:
+		r.Deleted++
+	default:
+		r.Rewritten++
+	}
+	if len(r.Packs) < maxPackCompactions {
+		r.Packs = append(r.Packs, c)
+	} else {
+		r.Truncated = true
+	}
+}
+
+// CompactPacks deletes packs that no record points into any more and
+// rewrites those whose deleted objects take at least their bucket's
+// compact ratio of the pack: the live objects are copied into a new pack
+// and their records point there. With dryRun it only reports what it would
+// do.
+func (s *Service) CompactPacks(ctx context.Context, dryRun bool) (*PackCompactionReport, error) {
+	report := &PackCompactionReport{DryRun: dryRun, StartedAt: time.Now(), Packs: []*PackCompaction{}}
+	var afterID int64
+	for {
+		packs, err := s.metaRepo.ScanPacks(ctx, afterID, packScanBatchSize)
+		if err != nil {
+			return report, err
+		}
+		for _, p := range packs {
+			afterID = p.ID
+			report.Scanned++
+			c := &PackCompaction{
+				ID:             p.ID,
+				Env:            p.Env,
+				LogicalRegion:  p.LogicalRegion,
+				Bucket:         p.Bucket,
+				ProviderBucket: p.ProviderBucket,
+				PhysicalKey:    p.PhysicalKey,
+				SizeBytes:      p.SizeBytes,
+				LiveEntries:    p.LiveEntries,
+				LiveBytes:      p.LiveBytes,
+			}
+			if p.LiveEntries == 0 {
+				c.Action = packActionDelete
+			} else if s.packDeadRatio(p) >= s.compactRatio(p) {
+				c.Action = packActionRewrite
+			} else {
+				continue
+			}
+			if !dryRun {
+				var reclaimed int64
+				if c.Action == packActionDelete {
+					reclaimed, err = s.deletePack(ctx, p)
+				} else {
+					c.NewPackID, reclaimed, err = s.rewritePack(ctx, p)
+				}
+				if errors.Is(err, errPackInUse) {
+					continue
+				}
+				if err != nil {
+					c.Error = err.Error()
+					log.Printf("pack compaction: %s pack %d: %v", c.Action, p.ID, err)
+				} else {
+					report.ReclaimedBytes += reclaimed
+					metrics.PackBytesReclaimedTotal.WithLabelValues(p.Env, p.LogicalRegion, p.Bucket).Add(float64(reclaimed))
+				}
+			}
+			report.add(c)
+		}
+		if len(packs) < packScanBatchSize || ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+	}
+}
+
+// errPackInUse means a pack without records is still held by writers.
+var errPackInUse = errors.New("pack in use")
+
+func (s *Service) packDeadRatio(p *metadata.PackRecord) float64 {
+	if p.SizeBytes == 0 {
+		return 1
+	}
+	return 1 - float64(p.LiveBytes)/float64(p.SizeBytes)
+}
+
+// compactRatio applies to packs of buckets that stopped packing too.
+func (s *Service) compactRatio(p *metadata.PackRecord) float64 {
+	if pc := s.packConfig(p.Env, p.LogicalRegion, p.Bucket); pc != nil {
+		return pc.CompactRatio
+	}
+	return defaultPackCompactRatio
+}
+
+// deletePack removes pack p, whose records are all gone, and returns the
+// bytes freed.
+func (s *Service) deletePack(ctx context.Context, p *metadata.PackRecord) (int64, error) {
+	inUse, err := s.metaRepo.PhysicalKeyInUse(ctx, p.ProviderBucket, p.PhysicalKey)
+	if err != nil {
+		return 0, err
+	}
+	if inUse {
+		return 0, errPackInUse
+	}
+	s.releasePhysical(ctx, packObject(p))
+	return p.SizeBytes, nil
+}
+
+// rewritePack copies the live objects of pack p into a new pack next to it
+// and points their records there. p is released once no record points
+// into it. It returns the new pack's ID and the bytes freed.
+func (s *Service) rewritePack(ctx context.Context, p *metadata.PackRecord) (int64, int64, error) {
+	old := packObject(p)
+	backend, err := s.backendFor(old)
+	if err != nil {
+		return 0, 0, err
+	}
+	entries, err := s.metaRepo.ListPackEntries(ctx, p.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(entries) == 0 {
+		return 0, 0, errPackInUse // emptied since the scan; the next run deletes it
+	}
+	body, _, _, err := backend.GetObject(ctx, locationOf(old))
+	if err != nil {
+		return 0, 0, err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, p.SizeBytes+1))
+	body.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	if int64(len(data)) != p.SizeBytes {
+		return 0, 0, fmt.Errorf("pack holds %d bytes, recorded %d", len(data), p.SizeBytes)
+	}
+
+	var buf bytes.Buffer
+	moved := make([]metadata.ObjectRecord, 0, len(entries))
+	for _, e := range entries {
+		if e.PackOffset < 0 || e.PackOffset+e.SizeBytes > p.SizeBytes {
+			return 0, 0, fmt.Errorf("object %s/%s lies outside the pack", e.Bucket, e.ObjectKey)
+		}
+		// by value: the repository updates the listed record
+		r := *e
+		r.PackOffset = int64(buf.Len())
+		buf.Write(data[e.PackOffset : e.PackOffset+e.SizeBytes])
+		moved = append(moved, r)
+	}
+
+	next := *p
+	next.ID = 0
+	next.PhysicalKey = fmt.Sprintf("%s/%s/%s/%s%s", p.Env, p.LogicalRegion, p.Bucket, packKeyMarker, newWriteID())
+	next.SizeBytes = int64(buf.Len())
+	next.Entries = len(moved)
+	next.LiveEntries, next.LiveBytes, next.CreatedAt = 0, 0, time.Time{}
+	loc := locationOf(packObject(&next))
+	if next.ETag, err = backend.PutObject(ctx, loc, bytes.NewReader(buf.Bytes()), next.SizeBytes, objectstore.PutOptions{
+		ContentType:  packContentType,
+		StorageClass: p.StorageClass,
+	}); err != nil {
+		return 0, 0, err
+	}
+	if _, err := s.metaRepo.AcquireRef(ctx, next.ProviderBucket, next.PhysicalKey, next.SizeBytes); err != nil {
+		_ = backend.DeleteObject(ctx, loc)
+		return 0, 0, err
+	}
+	defer s.releaseRef(ctx, next.ProviderBucket, next.PhysicalKey)
+	if err := s.metaRepo.AddPack(ctx, &next); err != nil {
+		_ = backend.DeleteObject(ctx, loc)
+		return 0, 0, fmt.Errorf("record pack: %w", err)
+	}
+	for i := range moved {
+		r := &moved[i]
+		r.PhysicalKey, r.PackID = next.PhysicalKey, next.ID
+		if err := s.metaRepo.Relocate(ctx, r, p.PhysicalKey); err != nil && !errors.Is(err, metadata.ErrNotFound) {
+			// the records moved so far stay in the new pack
+			return next.ID, 0, fmt.Errorf("move %s/%s: %w", r.Bucket, r.ObjectKey, err)
+		}
+	}
+	s.enqueueReplication(ctx, packObject(&next), s.providerNameOf(old))
+	s.releasePhysical(ctx, old)
+	return next.ID, p.SizeBytes - next.SizeBytes, nil
+}
+
+// RunPackCompaction calls CompactPacks every interval until ctx is done.
+func (s *Service) RunPackCompaction(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		report, err := s.CompactPacks(ctx, false)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("pack compaction: %v", err)
+		}
+		if report != nil && report.Deleted+report.Rewritten+report.Failed > 0 {
+			log.Printf("pack compaction: scanned %d, deleted %d, rewritten %d, failed %d, reclaimed %d bytes",
+				report.Scanned, report.Deleted, report.Rewritten, report.Failed, report.ReclaimedBytes)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
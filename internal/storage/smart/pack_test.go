@@ -0,0 +1,181 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+const packEntrySize = 16
+
+// newPackService packs n objects of packEntrySize bytes into each pack:
+// the pack seals once the last of them arrives, never by its delay.
+func newPackService(t *testing.T, n int) *testService {
+	t.Helper()
+	return newTestService(t, config.RouteRule{}, config.BucketConfig{
+		Pack:  &config.PackConfig{MaxBytes: int64(n * packEntrySize), MaxDelay: time.Minute},
+		Trash: &config.TrashConfig{},
+	})
+}
+
+func packEntry(i int) []byte {
+	return []byte(fmt.Sprintf("packed object %02d", i))
+}
+
+// putAll uploads the keys k0..k(n-1) at once and returns their errors.
+func (ts *testService) putAll(t *testing.T, n int) []error {
+	t.Helper()
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = ts.put(t, fmt.Sprintf("k%d", i), packEntry(i))
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func (ts *testService) delete(t *testing.T, key string) {
+	t.Helper()
+	if _, err := ts.Delete(context.Background(), &DeleteRequest{Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: key}); err != nil {
+		t.Fatalf("delete %s: %v", key, err)
+	}
+}
+
+func TestPackConcurrentPuts(t *testing.T) {
+	const n = 8
+	ts := newPackService(t, n)
+	for i, err := range ts.putAll(t, n) {
+		if err != nil {
+			t.Fatalf("put k%d: %v", i, err)
+		}
+	}
+	if keys := ts.objects(t, "primary"); len(keys) != 1 {
+		t.Fatalf("primary holds %v, want one pack", keys)
+	}
+
+	packID := ts.record(t, "k0").PackID
+	offsets := map[int64]bool{}
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("k%d", i)
+		rec := ts.record(t, key)
+		if rec.PackID == 0 || rec.PackID != packID {
+			t.Errorf("%s in pack %d, want %d", key, rec.PackID, packID)
+		}
+		offsets[rec.PackOffset] = true
+		got, resp, err := ts.get(t, key)
+		if err != nil || !bytes.Equal(got, packEntry(i)) {
+			t.Errorf("get %s = %q, %v; want %q", key, got, err, packEntry(i))
+			continue
+		}
+		if resp.ETag != etagOf(packEntry(i)) {
+			t.Errorf("get %s: etag %s, want the MD5 of its content", key, resp.ETag)
+		}
+	}
+	if len(offsets) != n {
+		t.Errorf("%d distinct offsets for %d objects", len(offsets), n)
+	}
+	if gets, ranges := ts.faults["primary"].Calls(objectstore.OpGet), ts.faults["primary"].Calls(objectstore.OpGetRange); gets != 0 || ranges != n {
+		t.Errorf("%d whole and %d ranged reads, want %d ranged only", gets, ranges, n)
+	}
+}
+
+func TestPackCompaction(t *testing.T) {
+	const n = 4
+	ts := newPackService(t, n)
+	for i, err := range ts.putAll(t, n) {
+		if err != nil {
+			t.Fatalf("put k%d: %v", i, err)
+		}
+	}
+	old := *ts.record(t, "k2") // the memory repository updates the record in place
+	for _, key := range []string{"k0", "k1", "k3"} {
+		ts.delete(t, key)
+	}
+	if purged, err := ts.PurgeTrash(context.Background()); err != nil || purged != 3 {
+		t.Fatalf("purge = %d, %v; want 3", purged, err)
+	}
+	if keys := ts.objects(t, "primary"); len(keys) != 1 {
+		t.Fatalf("primary holds %v; the pack must outlive purging some of its objects", keys)
+	}
+
+	report, err := ts.CompactPacks(context.Background(), true)
+	if err != nil || len(report.Packs) != 1 || report.Packs[0].Action != packActionRewrite {
+		t.Fatalf("dry run = %+v, %v; want the pack to be rewritten", report, err)
+	}
+	if rec := ts.record(t, "k2"); rec.PackID != old.PackID {
+		t.Fatalf("dry run moved k2 to pack %d", rec.PackID)
+	}
+
+	report, err = ts.CompactPacks(context.Background(), false)
+	if err != nil || len(report.Packs) != 1 || report.Packs[0].Error != "" {
+		t.Fatalf("compact = %+v, %v", report, err)
+	}
+	if want := int64((n - 1) * packEntrySize); report.ReclaimedBytes != want {
+		t.Errorf("reclaimed %d bytes, want %d", report.ReclaimedBytes, want)
+	}
+	rec := ts.record(t, "k2")
+	if rec.PackID != report.Packs[0].NewPackID || rec.PackOffset != 0 || rec.PhysicalKey == old.PhysicalKey {
+		t.Errorf("k2 in pack %d at %d (%s), want the start of new pack %d",
+			rec.PackID, rec.PackOffset, rec.PhysicalKey, report.Packs[0].NewPackID)
+	}
+	if keys := ts.objects(t, "primary"); len(keys) != 1 || keys[0] != rec.PhysicalKey {
+		t.Errorf("primary holds %v, want only the new pack %s", keys, rec.PhysicalKey)
+	}
+	if got, _, err := ts.get(t, "k2"); err != nil || !bytes.Equal(got, packEntry(2)) {
+		t.Errorf("get k2 after compaction = %q, %v", got, err)
+	}
+
+	// purging the last object of a pack removes the pack
+	ts.delete(t, "k2")
+	if _, err := ts.PurgeTrash(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if keys := ts.objects(t, "primary"); len(keys) != 0 {
+		t.Errorf("primary holds %v after purging every object", keys)
+	}
+	if packs, err := ts.repo.ScanPacks(context.Background(), 0, 10); err != nil || len(packs) != 0 {
+		t.Errorf("packs left: %v, %v", packs, err)
+	}
+}
+
+func TestPackSealUploadFails(t *testing.T) {
+	const n = 3
+	ts := newPackService(t, n)
+	ts.faults["primary"].FailNext(objectstore.OpPut, 1)
+	for i, err := range ts.putAll(t, n) {
+		if err == nil {
+			t.Errorf("put k%d succeeded with its pack's upload failing", i)
+		}
+	}
+	if n := ts.faults["primary"].Calls(objectstore.OpPut); n != 1 {
+		t.Errorf("%d uploads, want the writers to share one", n)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := ts.repo.GetObject(context.Background(), testEnv, testRegion, testBucket, fmt.Sprintf("k%d", i)); err == nil {
+			t.Errorf("a failed write left a record for k%d", i)
+		}
+	}
+	if packs, err := ts.repo.ScanPacks(context.Background(), 0, 10); err != nil || len(packs) != 0 {
+		t.Errorf("packs recorded: %v, %v", packs, err)
+	}
+
+	// the next pack is stored normally
+	for i, err := range ts.putAll(t, n) {
+		if err != nil {
+			t.Fatalf("put k%d after the failure: %v", i, err)
+		}
+	}
+	if got, _, err := ts.get(t, "k1"); err != nil || !bytes.Equal(got, packEntry(1)) {
+		t.Errorf("get k1 = %q, %v", got, err)
+	}
+}
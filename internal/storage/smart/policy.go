@@ -0,0 +1,42 @@
+package smart
+
+import (
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/policy"
+)
+
+// checkPolicy validates req against its bucket's upload policy before the
+// body is read. Bodies of unknown size are wrapped so the size bounds hold
+// while streaming; the returned reader records the violation, if any.
+func (s *Service) checkPolicy(req *PutRequest) (*policy.Reader, error) {
+	bc := s.buckets.Lookup(req.Env, req.LogicalRegion, req.Bucket)
+	if bc == nil || bc.Policy == nil {
+		return nil, nil
+	}
+	p, err := s.compiledPolicy(bc)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Check(req.Key, req.ContentType, req.Size); err != nil {
+		return nil, err
+	}
+	if req.Size >= 0 || !p.Limited() {
+		return nil, nil
+	}
+	pr := p.Reader(req.Body)
+	req.Body = pr
+	return pr, nil
+}
+
+// compiledPolicy caches compiled policies per bucket config entry.
+func (s *Service) compiledPolicy(bc *config.BucketConfig) (*policy.Policy, error) {
+	if p, ok := s.policies.Load(bc); ok {
+		return p.(*policy.Policy), nil
+	}
+	p, err := policy.Compile(bc.Policy)
+	if err != nil {
+		return nil, err
+	}
+	s.policies.Store(bc, p)
+	return p, nil
+}
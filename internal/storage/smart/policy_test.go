@@ -0,0 +1,63 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/policy"
+)
+
+func TestPutPolicy(t *testing.T) {
+	ts := newTestService(t, config.RouteRule{}, config.BucketConfig{
+		Policy: &config.UploadPolicyConfig{MaxSize: 8, AllowedContentTypes: []string{"text/*"}, ForbiddenExtensions: []string{"exe"}},
+		// one object fills the bucket
+		Quota: &config.QuotaConfig{MaxObjects: 1},
+	})
+	tests := []struct {
+		name        string
+		key         string
+		contentType string
+		data        string
+		chunked     bool
+		want        error
+	}{
+		{name: "content type", key: "a.txt", contentType: "image/png", data: "x", want: policy.ErrContentTypeNotAllowed},
+		{name: "extension", key: "a.exe", contentType: "text/plain", data: "x", want: policy.ErrKeyNotAllowed},
+		{name: "size", key: "a.txt", contentType: "text/plain", data: "123456789", want: policy.ErrTooLarge},
+		// the reader's violation is reported, not the provider's read error
+		{name: "chunked size", key: "a.txt", contentType: "text/plain", data: "123456789", chunked: true, want: policy.ErrTooLarge},
+		{name: "allowed", key: "a.txt", contentType: "text/plain", data: "12345678"},
+		{name: "chunked overwrite", key: "a.txt", contentType: "text/plain", data: "1234", chunked: true},
+		// the policy is checked before the quota
+		{name: "policy before quota", key: "b.exe", contentType: "text/plain", data: "x", want: policy.ErrKeyNotAllowed},
+		{name: "quota", key: "b.txt", contentType: "text/plain", data: "x", want: ErrObjectQuotaExceeded},
+	}
+	for _, tt := range tests {
+		req := &PutRequest{
+			Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: tt.key,
+			ContentType: tt.contentType, Size: int64(len(tt.data)), Body: bytes.NewReader([]byte(tt.data)),
+		}
+		if tt.chunked {
+			req.Size = -1
+		}
+		if _, err := ts.Put(context.Background(), req); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if got, _, err := ts.get(t, "a.txt"); err != nil || string(got) != "1234" {
+		t.Errorf("get a.txt = %q, %v; want the allowed overwrite", got, err)
+	}
+	if n := len(ts.objects(t, "primary")); n != 1 {
+		t.Errorf("%d objects stored, want only a.txt", n)
+	}
+}
+
+func TestPutInvalidPolicy(t *testing.T) {
+	ts := newTestService(t, config.RouteRule{}, config.BucketConfig{Policy: &config.UploadPolicyConfig{KeyPattern: "("}})
+	if _, err := ts.put(t, "k", []byte("x")); err == nil {
+		t.Error("put under an invalid policy succeeded")
+	}
+}
@@ -0,0 +1,426 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+const (
+	quorumChunkSize = 256 << 10
+	// quorumCopyBuffer is how many chunks an upload may fall behind the
+	// body before it holds the write up. Past it, the upload is dropped
+	// once w others keep up.
+	quorumCopyBuffer = 8
+	// quorumLagGrace is how long a full upload may keep a chunk waiting
+	// that w others took before it is dropped, so that a location that is
+	// only briefly behind stays in the write.
+	quorumLagGrace = 200 * time.Millisecond
+	// quorumStragglerTimeout bounds uploads that are still running when a
+	// quorum write is acknowledged. The replication worker leaves their
+	// replicas alone for as long.
+	quorumStragglerTimeout = 10 * time.Minute
+)
+
+// ErrQuorumNotReached means fewer of a route's locations than its write
+// quorum stored an upload.
+var ErrQuorumNotReached = errors.New("write quorum not reached")
+
+// errCopyLagging stops an upload that fell too far behind the others.
+var errCopyLagging = errors.New("upload fell behind the write quorum; left to replication")
+
+// putObject stores body under physicalKey through route and returns the
+// location the record points at. Routes with a write quorum write all their
+// locations at once, and qw is the write to finish once the record is
+// committed. Routes with fallbacks write to one of those when the route's
+// provider fails.
+func (s *Service) putObject(ctx context.Context, key objectstore.RouteKey, route objectstore.RouteResult, physicalKey string, body io.Reader, size int64, opts objectstore.PutOptions) (_ objectstore.RouteResult, etag string, qw *quorumWrite, err error) {
+	if w := s.router.WriteQuorum(key); w > 1 {
+		qw, err := s.putQuorum(ctx, key, route, w, physicalKey, body, size, opts)
+		if err != nil {
+			return route, "", nil, err
+		}
+		return qw.chosen.route, qw.chosen.etag, qw, nil
+	}
+	if fallbacks := s.router.ResolveFallbacks(key); len(fallbacks) > 0 {
+		route, etag, err = s.putFailover(ctx, route, fallbacks, physicalKey, body, size, opts)
+		return route, etag, nil, err
+	}
+	backend, ok := s.providers.Get(route.ProviderName)
+	if !ok {
+		return route, "", nil, fmt.Errorf("no backend for provider %s", route.ProviderName)
+	}
+	etag, err = backend.PutObject(ctx, routeLocation(route, physicalKey), body, size, opts)
+	return route, etag, nil, err
+}
+
+// abandonWrite undoes the upload of rec, whose record could not be
+// committed. Copies a quorum write stored are deleted; a single upload is
+// left for the orphan GC. Deduplicated content is deleted only when no
+// other record took a reference to it meanwhile.
+func (s *Service) abandonWrite(ctx context.Context, rec *metadata.ObjectRecord, qw *quorumWrite) {
+	if !s.contentAddressed(rec) {
+		if qw != nil {
+			qw.discard(nil)
+		}
+		return
+	}
+	if qw == nil {
+		s.releaseRef(ctx, rec.ProviderBucket, rec.PhysicalKey)
+		return
+	}
+	refs, err := s.metaRepo.RetireRef(ctx, rec.ProviderBucket, rec.PhysicalKey)
+	if err != nil || refs > 0 {
+		if err != nil && !errors.Is(err, metadata.ErrRefRetired) {
+			log.Printf("dedup: release %s/%s: %v", rec.ProviderBucket, rec.PhysicalKey, err)
+		}
+		qw.cancel()
+		return
+	}
+	done := qw.discard(nil)
+	go func() {
+		<-done
+		if err := s.metaRepo.DropRef(context.WithoutCancel(ctx), rec.ProviderBucket, rec.PhysicalKey); err != nil {
+			log.Printf("dedup: release %s/%s: %v", rec.ProviderBucket, rec.PhysicalKey, err)
+		}
+	}()
+}
+
+// discardObject deletes an upload that will not be recorded.
+func (s *Service) discardObject(ctx context.Context, route objectstore.RouteResult, physicalKey string, qw *quorumWrite) {
+	if qw != nil {
+		qw.discard(nil)
+		return
+	}
+	if backend, ok := s.providers.Get(route.ProviderName); ok {
+		_ = backend.DeleteObject(ctx, routeLocation(route, physicalKey))
+	}
+}
+
+// quorumCopy is the upload to one location of a quorum write. Chunks of
+// the body queue in chunks until a feeder writes them to the upload's pipe,
+// so a slow upload only holds the write up once its queue is full. etag and
+// err are set before it is sent on quorumWrite.results.
+type quorumCopy struct {
+	route   objectstore.RouteResult
+	backend objectstore.ObjectStorage
+	pw      *io.PipeWriter
+	chunks  chan []byte
+	live    bool        // still taking chunks; owned by stream
+	failed  atomic.Bool // the upload stopped reading
+	dropped bool        // stopped for lagging; set before the record is committed
+
+	etag     string
+	err      error
+	received bool // read from results
+}
+
+// quorumWrite streams one upload to several locations at once.
+type quorumWrite struct {
+	physicalKey string
+	targets     []objectstore.RouteResult // the route's provider and replicas
+	copies      []*quorumCopy             // uploads to the targets with a backend
+	results     chan *quorumCopy
+	progress    chan struct{} // a feeder took a chunk or its upload failed
+	pending     int           // copies not yet received
+	chosen      *quorumCopy   // the stored copy the record points at
+	cancel      context.CancelFunc
+}
+
+// putQuorum reads body once, teeing it into an upload per location of the
+// route, and returns when w of them stored it. Preference for the location
+// the record points at goes to the route's provider. Uploads still running
+// then continue in the background; finishQuorum records their outcome.
+func (s *Service) putQuorum(ctx context.Context, key objectstore.RouteKey, primary objectstore.RouteResult, w int, physicalKey string, body io.Reader, size int64, opts objectstore.PutOptions) (*quorumWrite, error) {
+	// stragglers outlive the request; a failing body read still stops them
+	// through their pipes
+	upCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), quorumStragglerTimeout)
+	qw := &quorumWrite{
+		physicalKey: physicalKey,
+		targets:     append([]objectstore.RouteResult{primary}, s.router.ResolveReplicas(key)...),
+		cancel:      cancel,
+	}
+	qw.results = make(chan *quorumCopy, len(qw.targets))
+	qw.progress = make(chan struct{}, 1)
+	for _, t := range qw.targets {
+		backend, ok := s.providers.Get(t.ProviderName)
+		if !ok {
+			log.Printf("quorum write %s: no backend for provider %s", physicalKey, t.ProviderName)
+			continue
+		}
+		pr, pw := io.Pipe()
+		c := &quorumCopy{route: t, backend: backend, pw: pw, chunks: make(chan []byte, quorumCopyBuffer), live: true}
+		qw.copies = append(qw.copies, c)
+		go qw.feed(c)
+		go func() {
+			c.etag, c.err = backend.PutObject(upCtx, routeLocation(t, physicalKey), pr, size, opts)
+			// unblocks the feeder if the upload stopped reading early
+			if c.err != nil {
+				_ = pr.CloseWithError(c.err)
+			} else {
+				_ = pr.Close()
+			}
+			qw.results <- c
+		}()
+	}
+	qw.pending = len(qw.copies)
+
+	err := qw.stream(body, w)
+	stored, failed := 0, 0
+	for err == nil && stored < w {
+		if failed > len(qw.copies)-w {
+			err = fmt.Errorf("%w: %d of %d locations stored %s", ErrQuorumNotReached, stored, len(qw.targets), physicalKey)
+			break
+		}
+		c := qw.receive()
+		if c.err != nil {
+			failed++
+			log.Printf("quorum write %s to %s/%s: %v", physicalKey, c.route.ProviderName, c.route.ProviderBucket, c.err)
+			continue
+		}
+		stored++
+	}
+	if err != nil {
+		metrics.QuorumWritesTotal.WithLabelValues(key.Env, key.LogicalRegion, key.Bucket, "failed").Inc()
+		qw.discard(nil)
+		return nil, err
+	}
+	for _, c := range qw.copies {
+		if c.received && c.err == nil {
+			qw.chosen = c
+			break
+		}
+	}
+	metrics.QuorumWritesTotal.WithLabelValues(key.Env, key.LogicalRegion, key.Bucket, "ok").Inc()
+	return qw, nil
+}
+
+func (qw *quorumWrite) receive() *quorumCopy {
+	c := <-qw.results
+	c.received = true
+	qw.pending--
+	if qw.pending == 0 {
+		qw.cancel()
+	}
+	return c
+}
+
+// feed writes the queued chunks of c to its upload, and ends the upload's
+// body once stream closes the queue. A failed upload only drains it.
+func (qw *quorumWrite) feed(c *quorumCopy) {
+	for chunk := range c.chunks {
+		qw.signal()
+		if c.failed.Load() {
+			continue
+		}
+		if _, err := c.pw.Write(chunk); err != nil {
+			c.failed.Store(true) // the upload reports why on results
+			qw.signal()
+		}
+	}
+	_ = c.pw.Close() // no-op once stream closed it with an error
+}
+
+func (qw *quorumWrite) signal() {
+	select {
+	case qw.progress <- struct{}{}:
+	default:
+	}
+}
+
+// stream queues body to every upload still taking it. A chunk waits for w
+// uploads to take it; uploads whose queue is still full quorumLagGrace
+// later are dropped and left to the replication worker, so one slow
+// location does not hold the write up. It gives up when fewer than w
+// uploads are left.
+func (qw *quorumWrite) stream(body io.Reader, w int) error {
+	for {
+		buf := make([]byte, quorumChunkSize) // queued chunks are not reused
+		n, rerr := body.Read(buf)
+		if n > 0 {
+			if err := qw.queue(buf[:n], w); err != nil {
+				qw.closePipes(err)
+				return err
+			}
+		}
+		if rerr == io.EOF {
+			qw.closePipes(nil)
+			return nil
+		}
+		if rerr != nil {
+			qw.closePipes(rerr)
+			return rerr
+		}
+	}
+}
+
+// queue hands chunk to the live uploads, waiting until w took it.
+func (qw *quorumWrite) queue(chunk []byte, w int) error {
+	var waiting []*quorumCopy
+	for _, c := range qw.copies {
+		if c.live {
+			waiting = append(waiting, c)
+		}
+	}
+	took := 0
+	var grace *time.Timer
+	defer func() {
+		if grace != nil {
+			grace.Stop()
+		}
+	}()
+	for {
+		full := waiting[:0]
+		for _, c := range waiting {
+			if c.failed.Load() {
+				qw.stop(c, nil)
+				continue
+			}
+			select {
+			case c.chunks <- chunk:
+				took++
+			default:
+				full = append(full, c)
+			}
+		}
+		waiting = full
+		if took+len(waiting) < w {
+			return fmt.Errorf("%w: %d of %d locations still writing %s", ErrQuorumNotReached, took+len(waiting), len(qw.targets), qw.physicalKey)
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		if took < w {
+			<-qw.progress
+			continue
+		}
+		if grace == nil {
+			grace = time.NewTimer(quorumLagGrace)
+		}
+		select {
+		case <-qw.progress:
+			continue
+		case <-grace.C:
+		}
+		for _, c := range waiting {
+			log.Printf("quorum write %s: dropping lagging upload to %s/%s", qw.physicalKey, c.route.ProviderName, c.route.ProviderBucket)
+			c.dropped = true
+			qw.stop(c, errCopyLagging)
+		}
+		return nil
+	}
+}
+
+// stop ends the body of c's upload: at the end of its queue when err is
+// nil, at once otherwise.
+func (qw *quorumWrite) stop(c *quorumCopy, err error) {
+	if !c.live {
+		return
+	}
+	c.live = false
+	if err != nil {
+		_ = c.pw.CloseWithError(err)
+	}
+	close(c.chunks)
+}
+
+func (qw *quorumWrite) closePipes(err error) {
+	for _, c := range qw.copies {
+		qw.stop(c, err)
+	}
+}
+
+// discard stops the uploads that are still running and deletes the stored
+// copies other than keep, in the background. The returned channel is closed
+// once it is done.
+func (qw *quorumWrite) discard(keep *quorumCopy) <-chan struct{} {
+	qw.cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for qw.pending > 0 {
+			qw.receive()
+		}
+		for _, c := range qw.copies {
+			if c == keep || c.err != nil {
+				continue
+			}
+			if err := c.backend.DeleteObject(context.Background(), routeLocation(c.route, qw.physicalKey)); err != nil {
+				log.Printf("quorum write %s: discard copy at %s/%s: %v", qw.physicalKey, c.route.ProviderName, c.route.ProviderBucket, err)
+			}
+		}
+	}()
+	return done
+}
+
+// finishQuorum runs once the record of a quorum write is committed. The other
+// locations become replicas of the record's location: COMPLETED when they
+// stored the object, PENDING for the replication worker when they failed,
+// and straggling uploads update theirs when they end. Quarantined content
+// is kept at the record's location only.
+func (s *Service) finishQuorum(ctx context.Context, qw *quorumWrite, rec *metadata.ObjectRecord) {
+	if rec.Status != metadata.StatusActive {
+		qw.discard(qw.chosen)
+		return
+	}
+
+	now := time.Now()
+	byTarget := map[objectstore.RouteResult]*metadata.ReplicaRecord{}
+	var reps []*metadata.ReplicaRecord
+	for _, t := range qw.targets {
+		if t == qw.chosen.route {
+			continue
+		}
+		rep := replicaOf(rec, qw.chosen.route.ProviderName, t)
+		for _, c := range qw.copies {
+			switch {
+			case c.route != t:
+			case c.dropped:
+				// left to the worker from the start
+			case !c.received:
+				// still uploading; keep the worker from copying it twice
+				rep.NextAttemptAt = now.Add(quorumStragglerTimeout)
+			case c.err == nil:
+				rep.Status, rep.ETag, rep.ReplicatedAt, rep.Attempts = metadata.ReplicaCompleted, c.etag, now, 1
+			}
+		}
+		byTarget[t] = rep
+		reps = append(reps, rep)
+	}
+	if err := s.metaRepo.AddReplicas(ctx, reps); err != nil {
+		log.Printf("quorum write %s: record replicas: %v", qw.physicalKey, err)
+		return
+	}
+	s.wakeReplication()
+	if qw.pending == 0 {
+		return
+	}
+	go func() {
+		ctx := context.Background()
+		for qw.pending > 0 {
+			c := qw.receive()
+			rep := byTarget[c.route]
+			if rep == nil || rep.ID == 0 || c.dropped {
+				continue
+			}
+			rep.Attempts = 1
+			if c.err == nil {
+				rep.Status, rep.ETag, rep.ReplicatedAt = metadata.ReplicaCompleted, c.etag, time.Now()
+			} else {
+				rep.Status, rep.LastError, rep.NextAttemptAt = metadata.ReplicaFailed, c.err.Error(), time.Now()
+			}
+			if err := s.metaRepo.UpdateReplica(ctx, rep); err != nil && !errors.Is(err, metadata.ErrNotFound) {
+				log.Printf("quorum write %s: update replica %d: %v", qw.physicalKey, rep.ID, err)
+			}
+			s.wakeReplication()
+		}
+	}()
+}
@@ -0,0 +1,169 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+func TestQuorumLaggingUploadDoesNotHoldWrite(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, config.RouteRule{
+		Replicas:    []config.RouteTarget{target("fast"), target("slow")},
+		WriteQuorum: 2,
+	}, config.BucketConfig{})
+	// the slow location reads nothing for a while
+	ts.faults["slow"].Script(objectstore.OpPut, objectstore.Fault{Delay: 3 * time.Second})
+
+	data := bytes.Repeat([]byte("q"), 4<<20) // more than the copies' buffers
+	start := time.Now()
+	if _, err := ts.put(t, "k", data); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("put took %v; the lagging upload held it up", elapsed)
+	}
+
+	rec := ts.record(t, "k")
+	reps, err := ts.repo.ListReplicas(ctx, rec.ProviderBucket, rec.PhysicalKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := map[string]*metadata.ReplicaRecord{}
+	for _, rep := range reps {
+		status[rep.TargetProvider] = rep
+	}
+	if rep := status["fast"]; rep == nil || rep.Status != metadata.ReplicaCompleted {
+		t.Errorf("fast replica = %+v, want COMPLETED", rep)
+	}
+	if rep := status["slow"]; rep == nil || rep.Status != metadata.ReplicaPending || rep.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("slow replica = %+v, want PENDING and due now", rep)
+	}
+
+	// the replication worker completes the dropped copy
+	if _, failed, err := ts.Replicate(ctx); err != nil || failed != 0 {
+		t.Fatalf("replicate: failed %d, %v", failed, err)
+	}
+	body, _, _, err := ts.mem["slow"].GetObject(ctx, objectstore.ObjectLocation{ProviderBucket: "slow", PhysicalKey: rec.PhysicalKey})
+	if err != nil {
+		t.Fatalf("slow copy: %v", err)
+	}
+	body.Close()
+}
+
+func newQuorumService(t *testing.T) *testService {
+	t.Helper()
+	ts := newTestService(t, config.RouteRule{
+		Replicas:    []config.RouteTarget{target("r1"), target("r2")},
+		WriteQuorum: 2,
+	}, config.BucketConfig{})
+	// 64 byte uploads stream through putLarge, smaller ones are buffered
+	ts.smallFileThreshold = 32
+	return ts
+}
+
+func TestQuorumToleratesFailures(t *testing.T) {
+	ctx := context.Background()
+	for _, size := range []int{16, 64} {
+		ts := newQuorumService(t)
+		ts.faults["primary"].FailNext(objectstore.OpPut, 1)
+		data := bytes.Repeat([]byte("q"), size)
+		if _, err := ts.put(t, "k", data); err != nil {
+			t.Fatalf("%d bytes: put with one location failing: %v", size, err)
+		}
+		// the record points at the first replica that stored the object
+		rec := ts.record(t, "k")
+		if rec.ProviderBucket != "r1" {
+			t.Errorf("%d bytes: record at %s, want r1", size, rec.ProviderBucket)
+		}
+		if got, _, err := ts.get(t, "k"); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: get = %q, %v", size, got, err)
+		}
+		reps, err := ts.repo.ListReplicas(ctx, rec.ProviderBucket, rec.PhysicalKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status := map[string]string{}
+		for _, rep := range reps {
+			status[rep.TargetProvider] = rep.Status
+		}
+		if status["r2"] != metadata.ReplicaCompleted || status["primary"] != metadata.ReplicaPending {
+			t.Errorf("%d bytes: replicas = %v, want r2 COMPLETED and primary PENDING", size, status)
+		}
+	}
+}
+
+func TestQuorumNotReached(t *testing.T) {
+	for _, size := range []int{16, 64} {
+		ts := newQuorumService(t)
+		ts.faults["r1"].FailNext(objectstore.OpPut, 1)
+		ts.faults["r2"].FailNext(objectstore.OpPut, 1)
+		if _, err := ts.put(t, "k", bytes.Repeat([]byte("q"), size)); !errors.Is(err, ErrQuorumNotReached) {
+			t.Fatalf("%d bytes: put with two of three locations failing: err = %v, want ErrQuorumNotReached", size, err)
+		}
+		if _, err := ts.repo.GetObject(context.Background(), testEnv, testRegion, testBucket, "k"); err == nil {
+			t.Errorf("%d bytes: the failed write left a record", size)
+		}
+		// the one stored copy is discarded
+		deadline := time.Now().Add(2 * time.Second)
+		for len(ts.objects(t, "primary")) > 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d bytes: primary still holds %v", size, ts.objects(t, "primary"))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+// failingCommitRepo fails every attempt to commit a record.
+type failingCommitRepo struct {
+	*metadata.InMemoryRepository
+}
+
+var errCommit = errors.New("commit failed")
+
+func (failingCommitRepo) PutObject(context.Context, *metadata.ObjectRecord) (*metadata.ObjectRecord, error) {
+	return nil, errCommit
+}
+
+func (failingCommitRepo) AddVersion(context.Context, *metadata.ObjectRecord) error {
+	return errCommit
+}
+
+func TestQuorumFailedCommitDiscardsCopies(t *testing.T) {
+	for _, bucket := range []config.BucketConfig{{}, {Versioning: true}, {Dedup: true}} {
+		for _, size := range []int{16, 64} {
+			ts := newTestService(t, config.RouteRule{
+				Replicas:    []config.RouteTarget{target("r1"), target("r2")},
+				WriteQuorum: 2,
+			}, bucket)
+			ts.smallFileThreshold = 32
+			ts.metaRepo = failingCommitRepo{ts.repo}
+			// r2 is still uploading when the commit fails
+			ts.faults["r2"].Script(objectstore.OpPut, objectstore.Fault{Delay: 10 * time.Second})
+
+			start := time.Now()
+			if _, err := ts.put(t, "k", bytes.Repeat([]byte("q"), size)); !errors.Is(err, errCommit) {
+				t.Fatalf("%+v, %d bytes: put: err = %v, want the commit error", bucket, size, err)
+			}
+			deadline := start.Add(2 * time.Second)
+			for _, name := range []string{"primary", "r1", "r2"} {
+				for len(ts.objects(t, name)) > 0 {
+					if time.Now().After(deadline) {
+						t.Fatalf("%+v, %d bytes: %s still holds %v", bucket, size, name, ts.objects(t, name))
+					}
+					time.Sleep(5 * time.Millisecond)
+				}
+			}
+			if reps, _ := ts.repo.ListReplicaJobs(context.Background(), time.Now().Add(time.Hour), 10); len(reps) != 0 {
+				t.Errorf("%+v, %d bytes: %d replica jobs for an uncommitted write", bucket, size, len(reps))
+			}
+		}
+	}
+}
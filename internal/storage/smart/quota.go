@@ -0,0 +1,216 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
+)
+
+var (
+	ErrStorageQuotaExceeded = errors.New("bucket storage quota exceeded")
+	ErrObjectQuotaExceeded  = errors.New("bucket object quota exceeded")
+)
+
+const defaultSoftLimitPercent = 80
+
+// QuotaStatus is a bucket's usage measured against its configured quota.
+// Max values of zero mean unlimited.
+type QuotaStatus struct {
+	metadata.BucketUsage
+	MaxBytes          int64 `json:"max_bytes"`
+	MaxObjects        int64 `json:"max_objects"`
+	SoftLimitPercent  int   `json:"soft_limit_percent"`
+	SoftLimitExceeded bool  `json:"soft_limit_exceeded"`
+}
+
+func newQuotaStatus(u *metadata.BucketUsage, qc *config.QuotaConfig) *QuotaStatus {
+	st := &QuotaStatus{BucketUsage: *u}
+	if qc == nil {
+		return st
+	}
+	st.MaxBytes = qc.MaxBytes
+	st.MaxObjects = qc.MaxObjects
+	st.SoftLimitPercent = qc.SoftLimitPercent
+	if st.SoftLimitPercent <= 0 {
+		st.SoftLimitPercent = defaultSoftLimitPercent
+	}
+	st.SoftLimitExceeded = overSoftLimit(u.Bytes, qc.MaxBytes, st.SoftLimitPercent) ||
+		overSoftLimit(u.Objects, qc.MaxObjects, st.SoftLimitPercent)
+	return st
+}
+
+func overSoftLimit(used, limit int64, percent int) bool {
+	return limit > 0 && used*100 >= limit*int64(percent)
+}
+
+func (s *Service) quotaFor(env, region, bucket string) *config.QuotaConfig {
+	if bc := s.buckets.Lookup(env, region, bucket); bc != nil {
+		return bc.Quota
+	}
+	return nil
+}
+
+// checkQuota rejects req when it would take its bucket over quota. Uploads
+// of unknown size get their body wrapped in a quotaReader that fails once
+// the remaining bytes are used up. Concurrent uploads are checked against
+// the same usage, so a bucket can overshoot by what is in flight.
+func (s *Service) checkQuota(ctx context.Context, req *PutRequest) (*quotaReader, error) {
+	qc := s.quotaFor(req.Env, req.LogicalRegion, req.Bucket)
+	if qc == nil || (qc.MaxBytes <= 0 && qc.MaxObjects <= 0) {
+		return nil, nil
+	}
+	usage, err := s.metaRepo.GetUsage(ctx, req.Env, req.LogicalRegion, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	// overwriting a key replaces its bytes and does not add an object, unless
+	// the bucket keeps the old bytes as a version
+	var prevSize int64
+	exists := false
+	if !s.versioned(req.Env, req.LogicalRegion, req.Bucket) {
+		prev, err := s.metaRepo.GetObject(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key)
+		switch {
+		case err == nil:
+			prevSize, exists = prev.SizeBytes, true
+		case !errors.Is(err, metadata.ErrNotFound):
+			return nil, err
+		}
+	}
+
+	if qc.MaxObjects > 0 && !exists && usage.Objects >= qc.MaxObjects {
+		metrics.QuotaRejectionsTotal.WithLabelValues(req.Env, req.LogicalRegion, req.Bucket, "objects").Inc()
+		return nil, fmt.Errorf("%w: bucket holds %d of %d objects", ErrObjectQuotaExceeded, usage.Objects, qc.MaxObjects)
+	}
+	if qc.MaxBytes <= 0 {
+		return nil, nil
+	}
+	remaining := qc.MaxBytes - usage.Bytes + prevSize
+	if req.Size > remaining || (req.Size < 0 && remaining <= 0) {
+		metrics.QuotaRejectionsTotal.WithLabelValues(req.Env, req.LogicalRegion, req.Bucket, "bytes").Inc()
+		return nil, fmt.Errorf("%w: %d of %d bytes used", ErrStorageQuotaExceeded, usage.Bytes, qc.MaxBytes)
+	}
+	if req.Size >= 0 {
+		return nil, nil
+	}
+	qr := &quotaReader{r: req.Body, remaining: remaining, limit: qc.MaxBytes}
+	req.Body = qr
+	return qr, nil
+}
+
+// quotaReader fails a read once more than remaining bytes have passed.
+type quotaReader struct {
+	r         io.Reader
+	remaining int64
+	limit     int64
+	err       error
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	n, err := q.r.Read(p)
+	q.remaining -= int64(n)
+	if q.remaining < 0 {
+		q.err = fmt.Errorf("%w: upload exceeds the %d byte quota", ErrStorageQuotaExceeded, q.limit)
+		return n, q.err
+	}
+	return n, err
+}
+
+// observeUsage refreshes the quota metrics of a bucket after a write and
+// logs when it crosses its soft limit.
+func (s *Service) observeUsage(ctx context.Context, env, region, bucket string) {
+	qc := s.quotaFor(env, region, bucket)
+	if qc == nil {
+		return
+	}
+	u, err := s.metaRepo.GetUsage(ctx, env, region, bucket)
+	if err != nil {
+		log.Printf("quota: read usage of %s/%s/%s: %v", env, region, bucket, err)
+		return
+	}
+	s.exportQuota(newQuotaStatus(u, qc))
+}
+
+func (s *Service) exportQuota(st *QuotaStatus) {
+	labels := []string{st.Env, st.LogicalRegion, st.Bucket}
+	metrics.BucketUsageBytes.WithLabelValues(labels...).Set(float64(st.Bytes))
+	metrics.BucketUsageObjects.WithLabelValues(labels...).Set(float64(st.Objects))
+	metrics.BucketQuotaBytes.WithLabelValues(labels...).Set(float64(st.MaxBytes))
+	metrics.BucketQuotaObjects.WithLabelValues(labels...).Set(float64(st.MaxObjects))
+	exceeded := 0.0
+	if st.SoftLimitExceeded {
+		exceeded = 1
+	}
+	metrics.BucketQuotaSoftLimitExceeded.WithLabelValues(labels...).Set(exceeded)
+
+	key := st.Env + "/" + st.LogicalRegion + "/" + st.Bucket
+	if _, was := s.softLimited.Load(key); st.SoftLimitExceeded && !was {
+		s.softLimited.Store(key, struct{}{})
+		log.Printf("quota: bucket %s is above %d%% of its quota (%d bytes, %d objects; limits %d bytes, %d objects)",
+			key, st.SoftLimitPercent, st.Bytes, st.Objects, st.MaxBytes, st.MaxObjects)
+	} else if !st.SoftLimitExceeded && was {
+		s.softLimited.Delete(key)
+	}
+}
+
+// Quotas reports usage and quota of every bucket that holds objects.
+func (s *Service) Quotas(ctx context.Context) ([]*QuotaStatus, error) {
+	usage, err := s.metaRepo.ListUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*QuotaStatus, 0, len(usage))
+	for _, u := range usage {
+		out = append(out, newQuotaStatus(u, s.quotaFor(u.Env, u.LogicalRegion, u.Bucket)))
+	}
+	return out, nil
+}
+
+func (s *Service) Quota(ctx context.Context, env, region, bucket string) (*QuotaStatus, error) {
+	u, err := s.metaRepo.GetUsage(ctx, env, region, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return newQuotaStatus(u, s.quotaFor(env, region, bucket)), nil
+}
+
+// RecomputeUsage rebuilds bucket usage from object metadata, correcting any
+// drift in the incremental counters, and refreshes the quota metrics.
+func (s *Service) RecomputeUsage(ctx context.Context) error {
+	if err := s.metaRepo.RecomputeUsage(ctx); err != nil {
+		return err
+	}
+	sts, err := s.Quotas(ctx)
+	if err != nil {
+		return err
+	}
+	for _, st := range sts {
+		s.exportQuota(st)
+	}
+	return nil
+}
+
+// RunUsageRecompute calls RecomputeUsage every interval until ctx is done.
+func (s *Service) RunUsageRecompute(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := s.RecomputeUsage(ctx); err != nil {
+			log.Printf("quota: recompute usage: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
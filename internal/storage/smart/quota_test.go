@@ -0,0 +1,179 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/kenelite/smartstore/internal/config"
+)
+
+func (ts *testService) quota(t *testing.T) *QuotaStatus {
+	t.Helper()
+	st, err := ts.Quota(context.Background(), testEnv, testRegion, testBucket)
+	if err != nil {
+		t.Fatalf("quota: %v", err)
+	}
+	return st
+}
+
+// putChunked uploads data without announcing its size, as a chunked
+// transfer does.
+func (ts *testService) putChunked(key string, data []byte) error {
+	_, err := ts.Put(context.Background(), &PutRequest{
+		Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: key,
+		Size: -1, Body: io.MultiReader(bytes.NewReader(data)),
+	})
+	return err
+}
+
+func TestQuotaLimits(t *testing.T) {
+	type step struct {
+		key  string
+		size int
+		want error
+	}
+	tests := []struct {
+		name   string
+		bucket config.BucketConfig
+		steps  []step
+	}{
+		{
+			name:   "objects",
+			bucket: config.BucketConfig{Quota: &config.QuotaConfig{MaxObjects: 2}},
+			steps: []step{
+				{key: "a", size: 1},
+				{key: "b", size: 1},
+				{key: "c", size: 1, want: ErrObjectQuotaExceeded},
+				{key: "a", size: 5}, // an overwrite adds no object
+			},
+		},
+		{
+			name:   "bytes",
+			bucket: config.BucketConfig{Quota: &config.QuotaConfig{MaxBytes: 10}},
+			steps: []step{
+				{key: "a", size: 6},
+				{key: "b", size: 5, want: ErrStorageQuotaExceeded},
+				{key: "a", size: 10}, // the overwrite frees a's 6 bytes
+				{key: "b", size: 1, want: ErrStorageQuotaExceeded},
+				{key: "a", size: 11, want: ErrStorageQuotaExceeded},
+			},
+		},
+		{
+			name:   "versioned overwrites keep the old bytes",
+			bucket: config.BucketConfig{Versioning: true, Quota: &config.QuotaConfig{MaxObjects: 2, MaxBytes: 10}},
+			steps: []step{
+				{key: "a", size: 6},
+				{key: "a", size: 5, want: ErrStorageQuotaExceeded},
+				{key: "a", size: 4},
+				{key: "a", size: 0, want: ErrObjectQuotaExceeded},
+			},
+		},
+	}
+	for _, tt := range tests {
+		ts := newTestService(t, config.RouteRule{}, tt.bucket)
+		for i, st := range tt.steps {
+			if _, err := ts.put(t, st.key, bytes.Repeat([]byte("x"), st.size)); !errors.Is(err, st.want) {
+				t.Errorf("%s: step %d, put %s of %d bytes: err = %v, want %v", tt.name, i, st.key, st.size, err, st.want)
+			}
+		}
+	}
+}
+
+func TestQuotaChunkedUpload(t *testing.T) {
+	ts := newTestService(t, config.RouteRule{}, config.BucketConfig{Quota: &config.QuotaConfig{MaxBytes: 10}})
+	if err := ts.putChunked("a", []byte("12345678")); err != nil {
+		t.Fatalf("chunked put within the quota: %v", err)
+	}
+	objects := ts.objects(t, "primary")
+
+	// the quotaReader cuts the body off once it outgrows what is left
+	if err := ts.putChunked("b", []byte("12345")); !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Errorf("chunked put over the quota: err = %v, want ErrStorageQuotaExceeded", err)
+	}
+	if _, _, err := ts.get(t, "b"); err == nil {
+		t.Error("the cut-off upload was recorded")
+	}
+	if st := ts.quota(t); st.Bytes != 8 || st.Objects != 1 {
+		t.Errorf("usage = %d bytes, %d objects; want a's alone", st.Bytes, st.Objects)
+	}
+	if n := len(ts.objects(t, "primary")); n != len(objects) {
+		t.Errorf("%d objects stored after the cut-off upload, want %d", n, len(objects))
+	}
+
+	if err := ts.putChunked("b", []byte("12")); err != nil {
+		t.Errorf("chunked put filling the quota: %v", err)
+	}
+	// a full bucket turns chunked uploads away before reading them
+	if err := ts.putChunked("c", nil); !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Errorf("chunked put into a full bucket: err = %v, want ErrStorageQuotaExceeded", err)
+	}
+}
+
+func TestQuotaSoftLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		quota   config.QuotaConfig
+		sizes   []int
+		percent int
+		want    []bool // soft limit exceeded after each put
+	}{
+		{name: "bytes", quota: config.QuotaConfig{MaxBytes: 100, SoftLimitPercent: 50}, sizes: []int{40, 9, 1}, percent: 50, want: []bool{false, false, true}},
+		{name: "objects", quota: config.QuotaConfig{MaxObjects: 5}, sizes: []int{1, 1, 1, 1}, percent: defaultSoftLimitPercent, want: []bool{false, false, false, true}},
+	}
+	for _, tt := range tests {
+		ts := newTestService(t, config.RouteRule{}, config.BucketConfig{Quota: &tt.quota})
+		for i, size := range tt.sizes {
+			if _, err := ts.put(t, string(rune('a'+i)), bytes.Repeat([]byte("x"), size)); err != nil {
+				t.Fatalf("%s: put %d: %v", tt.name, i, err)
+			}
+			st := ts.quota(t)
+			if st.SoftLimitPercent != tt.percent || st.SoftLimitExceeded != tt.want[i] {
+				t.Errorf("%s: after put %d soft limit %d%% exceeded %v, want %d%% %v",
+					tt.name, i, st.SoftLimitPercent, st.SoftLimitExceeded, tt.percent, tt.want[i])
+			}
+			if _, logged := ts.softLimited.Load(testEnv + "/" + testRegion + "/" + testBucket); logged != tt.want[i] {
+				t.Errorf("%s: after put %d soft limit logged %v, want %v", tt.name, i, logged, tt.want[i])
+			}
+		}
+
+		// dropping back below the limit clears it
+		ts.delete(t, "a")
+		if st := ts.quota(t); st.SoftLimitExceeded {
+			t.Errorf("%s: soft limit still exceeded at %d bytes, %d objects", tt.name, st.Bytes, st.Objects)
+		}
+		if _, logged := ts.softLimited.Load(testEnv + "/" + testRegion + "/" + testBucket); logged {
+			t.Errorf("%s: soft limit still logged after the delete", tt.name)
+		}
+	}
+}
+
+func TestRecomputeUsage(t *testing.T) {
+	ts := newTestService(t, config.RouteRule{}, config.BucketConfig{Quota: &config.QuotaConfig{MaxBytes: 10}})
+	for _, key := range []string{"a", "b"} {
+		if _, err := ts.put(t, key, []byte("1234")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the memory repository hands out its rows, so changing one behind its
+	// back leaves the counters stale
+	ts.record(t, "b").SizeBytes = 1
+	if st := ts.quota(t); st.Bytes != 8 {
+		t.Fatalf("usage = %d bytes before the recompute, want the stale 8", st.Bytes)
+	}
+	if _, err := ts.put(t, "c", []byte("1234")); !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Fatalf("put against the stale usage: err = %v, want ErrStorageQuotaExceeded", err)
+	}
+
+	if err := ts.RecomputeUsage(context.Background()); err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+	if st := ts.quota(t); st.Bytes != 5 || st.Objects != 2 {
+		t.Errorf("usage = %d bytes, %d objects after the recompute, want 5 and 2", st.Bytes, st.Objects)
+	}
+	if _, err := ts.put(t, "c", []byte("1234")); err != nil {
+		t.Errorf("put after the recompute: %v", err)
+	}
+}
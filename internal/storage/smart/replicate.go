@@ -0,0 +1,248 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+const (
+	replicationBatchSize = 100
+	maxReplicationDelay  = time.Hour // backoff cap between attempts of a failing replica
+)
+
+// enqueueReplication records a PENDING replica of rec's physical object for
+// every replica target of its route and wakes the replication worker.
+// source is the name of the provider that holds the object. Failures are
+// logged: the primary write has succeeded and is not undone.
+func (s *Service) enqueueReplication(ctx context.Context, rec *metadata.ObjectRecord, source string) {
+	if rec.Status != metadata.StatusActive {
+		return // quarantined content stays where it is
+	}
+	targets := s.router.ResolveReplicas(objectstore.RouteKey{
+		Env:           rec.Env,
+		LogicalRegion: rec.LogicalRegion,
+		Bucket:        rec.Bucket,
+		StorageClass:  rec.StorageClass,
+	})
+	if len(targets) == 0 {
+		return
+	}
+	reps := make([]*metadata.ReplicaRecord, 0, len(targets))
+	for _, t := range targets {
+		reps = append(reps, replicaOf(rec, source, t))
+	}
+	if err := s.metaRepo.AddReplicas(ctx, reps); err != nil {
+		log.Printf("replication: enqueue %s/%s: %v", rec.ProviderBucket, rec.PhysicalKey, err)
+		return
+	}
+	s.wakeReplication()
+}
+
+// replicaOf describes the copy of rec's physical object in target.
+func replicaOf(rec *metadata.ObjectRecord, source string, target objectstore.RouteResult) *metadata.ReplicaRecord {
+	return &metadata.ReplicaRecord{
+		Env:                rec.Env,
+		LogicalRegion:      rec.LogicalRegion,
+		Bucket:             rec.Bucket,
+		ObjectKey:          rec.ObjectKey,
+		VersionID:          rec.VersionID,
+		SizeBytes:          rec.SizeBytes,
+		ContentType:        rec.ContentType,
+		StorageClass:       rec.StorageClass,
+		SourceProvider:     source,
+		SourceBucket:       rec.ProviderBucket,
+		PhysicalKey:        rec.PhysicalKey,
+		TargetProvider:     target.ProviderName,
+		TargetProviderType: string(target.ProviderType),
+		TargetRegion:       target.ProviderRegion,
+		TargetBucket:       target.ProviderBucket,
+	}
+}
+
+// wakeReplication nudges the worker without waiting for its next tick.
+func (s *Service) wakeReplication() {
+	select {
+	case s.replicate <- struct{}{}:
+	default:
+	}
+}
+
+// releaseReplicas queues the copies of a released physical object for
+// deletion; the worker removes them from their targets.
+func (s *Service) releaseReplicas(ctx context.Context, rec *metadata.ObjectRecord) {
+	if err := s.metaRepo.MarkReplicasDeleting(ctx, rec.ProviderBucket, rec.PhysicalKey); err != nil {
+		log.Printf("replication: release %s/%s: %v", rec.ProviderBucket, rec.PhysicalKey, err)
+		return
+	}
+	s.wakeReplication()
+}
+
+func replicaLocation(rep *metadata.ReplicaRecord) objectstore.ObjectLocation {
+	return objectstore.ObjectLocation{
+		ProviderType:   objectstore.ProviderType(rep.TargetProviderType),
+		ProviderRegion: rep.TargetRegion,
+		ProviderBucket: rep.TargetBucket,
+		PhysicalKey:    rep.PhysicalKey,
+	}
+}
+
+// Replicate works through the replicas that are due: it copies PENDING and
+// FAILED ones from their source and removes DELETING ones from their target.
+// It returns how many replicas it completed and how many failed.
+func (s *Service) Replicate(ctx context.Context) (done, failed int, err error) {
+	for {
+		jobs, err := s.metaRepo.ListReplicaJobs(ctx, time.Now(), replicationBatchSize)
+		if err != nil {
+			return done, failed, err
+		}
+		progress := false
+		for _, rep := range jobs {
+			if err := s.replicateOne(ctx, rep); err != nil {
+				if ctx.Err() != nil {
+					return done, failed, ctx.Err()
+				}
+				failed++
+				metrics.ReplicationFailuresTotal.WithLabelValues(rep.TargetProvider, rep.TargetBucket).Inc()
+				log.Printf("replication: %s %s/%s to %s/%s: %v", rep.Status, rep.SourceBucket, rep.PhysicalKey,
+					rep.TargetProvider, rep.TargetBucket, err)
+				s.retryLater(ctx, rep, err)
+				continue
+			}
+			done++
+			progress = true
+		}
+		// failed jobs are rescheduled; stop when only those were left
+		if len(jobs) < replicationBatchSize || !progress {
+			return done, failed, nil
+		}
+	}
+}
+
+func (s *Service) replicateOne(ctx context.Context, rep *metadata.ReplicaRecord) error {
+	dst, ok := s.providers.Get(rep.TargetProvider)
+	if !ok {
+		return fmt.Errorf("no backend for provider %s", rep.TargetProvider)
+	}
+	if rep.Status == metadata.ReplicaDeleting {
+		if err := dst.DeleteObject(ctx, replicaLocation(rep)); err != nil && !errors.Is(err, objectstore.ErrObjectNotFound) {
+			return err
+		}
+		if err := s.metaRepo.DeleteReplica(ctx, rep.ID); err != nil && !errors.Is(err, metadata.ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	src, ok := s.providers.Get(rep.SourceProvider)
+	if !ok {
+		return fmt.Errorf("no backend for provider %s", rep.SourceProvider)
+	}
+	body, size, _, err := src.GetObject(ctx, objectstore.ObjectLocation{
+		ProviderBucket: rep.SourceBucket,
+		PhysicalKey:    rep.PhysicalKey,
+	})
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	etag, err := dst.PutObject(ctx, replicaLocation(rep), body, size, objectstore.PutOptions{
+		ContentType:  rep.ContentType,
+		StorageClass: rep.StorageClass,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rep.Status, rep.ETag, rep.LastError, rep.ReplicatedAt = metadata.ReplicaCompleted, etag, "", now
+	rep.Attempts++
+	if err := s.metaRepo.UpdateReplica(ctx, rep); err != nil {
+		if errors.Is(err, metadata.ErrNotFound) {
+			// the source was released during the copy; the DELETING
+			// replica removes it again
+			return nil
+		}
+		return err
+	}
+	metrics.ReplicationLagSeconds.WithLabelValues(rep.TargetProvider, rep.TargetBucket).Observe(now.Sub(rep.CreatedAt).Seconds())
+	return nil
+}
+
+// retryLater records a failed attempt and schedules the next one with
+// exponential backoff.
+func (s *Service) retryLater(ctx context.Context, rep *metadata.ReplicaRecord, cause error) {
+	rep.Attempts++
+	delay := maxReplicationDelay
+	if rep.Attempts < 12 {
+		delay = min(time.Second<<rep.Attempts, maxReplicationDelay)
+	}
+	if rep.Status != metadata.ReplicaDeleting {
+		rep.Status = metadata.ReplicaFailed
+	}
+	rep.LastError = cause.Error()
+	rep.NextAttemptAt = time.Now().Add(delay)
+	if err := s.metaRepo.UpdateReplica(ctx, rep); err != nil && !errors.Is(err, metadata.ErrNotFound) {
+		log.Printf("replication: reschedule replica %d: %v", rep.ID, err)
+	}
+}
+
+// exportReplicationBacklog refreshes the backlog and lag gauges of every
+// replica target.
+func (s *Service) exportReplicationBacklog(ctx context.Context) {
+	backlog, err := s.metaRepo.ReplicationBacklog(ctx)
+	if err != nil {
+		log.Printf("replication: backlog: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, b := range backlog {
+		metrics.ReplicationBacklog.WithLabelValues(b.TargetProvider, b.TargetBucket).Set(float64(b.Pending))
+		lag := 0.0
+		if !b.OldestCreated.IsZero() {
+			lag = now.Sub(b.OldestCreated).Seconds()
+		}
+		metrics.ReplicationOldestPendingSeconds.WithLabelValues(b.TargetProvider, b.TargetBucket).Set(lag)
+	}
+}
+
+// RunReplication calls Replicate every interval, and whenever a write or
+// delete queues work, until ctx is done.
+func (s *Service) RunReplication(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		done, failed, err := s.Replicate(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("replication: %v", err)
+		}
+		if done+failed > 0 {
+			log.Printf("replication: %d done, %d failed", done, failed)
+		}
+		s.exportReplicationBacklog(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-s.replicate:
+		}
+	}
+}
+
+// ListReplicas returns the replicas of the object version req names.
+func (s *Service) ListReplicas(ctx context.Context, req *GetRequest) ([]*metadata.ReplicaRecord, error) {
+	rec, err := s.lookup(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if rec.PhysicalKey == "" {
+		return []*metadata.ReplicaRecord{}, nil
+	}
+	return s.metaRepo.ListReplicas(ctx, rec.ProviderBucket, rec.PhysicalKey)
+}
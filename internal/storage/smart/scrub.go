@@ -0,0 +1,301 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+const (
+	scrubBatchSize   = 500
+	maxScrubFindings = 1000 // findings listed in a report; all are stored
+)
+
+// errNoHealthyCopy means nothing holds a verified copy of a damaged object.
+var errNoHealthyCopy = errors.New("no healthy copy")
+
+type ScrubOptions struct {
+	Verify bool // re-read content and compare it with the recorded checksum
+	Repair bool // rewrite damaged objects from a healthy copy
+}
+
+type ScrubReport struct {
+	StartedAt time.Time                `json:"started_at"`
+	Verify    bool                     `json:"verify"`
+	Repair    bool                     `json:"repair"`
+	Checked   int                      `json:"checked"`
+	Findings  map[string]int           `json:"findings"` // by kind
+	Repaired  int                      `json:"repaired"`
+	Errors    int                      `json:"errors"` // records that could not be checked
+	Entries   []*metadata.ScrubFinding `json:"entries"`
+	Truncated bool                     `json:"truncated"` // more findings than listed
+}
+
+// Scrub walks all metadata records and compares each with its physical
+// object: a missing object, a different size or a drifted ETag is recorded
+// as a finding, and with Verify so is content that no longer hashes to the
+// recorded checksum. With Repair, damaged objects are rewritten from a
+// healthy copy when one exists.
+func (s *Service) Scrub(ctx context.Context, opts ScrubOptions) (*ScrubReport, error) {
+	report := &ScrubReport{
+		StartedAt: time.Now(),
+		Verify:    opts.Verify,
+		Repair:    opts.Repair,
+		Findings:  map[string]int{},
+		Entries:   []*metadata.ScrubFinding{},
+	}
+	var afterID int64
+	for {
+		recs, err := s.metaRepo.ScanObjects(ctx, afterID, scrubBatchSize)
+		if err != nil {
+			return report, err
+		}
+		for _, rec := range recs {
+			afterID = rec.ID
+			if rec.PhysicalKey == "" {
+				continue // delete markers hold no data
+			}
+			if err := s.scrubRecord(ctx, *rec, opts, report); err != nil {
+				if ctx.Err() != nil {
+					return report, ctx.Err()
+				}
+				report.Errors++
+				log.Printf("scrub %s/%s: %v", rec.ProviderBucket, rec.PhysicalKey, err)
+			}
+		}
+		if len(recs) < scrubBatchSize {
+			return report, nil
+		}
+	}
+}
+
+// scrubRecord takes rec by value: the repository may update the record it
+// was scanned from while it is checked.
+func (s *Service) scrubRecord(ctx context.Context, rec metadata.ObjectRecord, opts ScrubOptions, report *ScrubReport) error {
+	backend, err := s.backendFor(&rec)
+	if err != nil {
+		return err
+	}
+	report.Checked++
+	metrics.ScrubObjectsCheckedTotal.Inc()
+
+	var kind, expected, actual string
+	stat, err := backend.StatObject(ctx, locationOf(&rec))
+	switch {
+	case errors.Is(err, objectstore.ErrObjectNotFound):
+		kind = metadata.FindingMissing
+	case err != nil:
+		return err
+	case rec.PackID != 0:
+		// a packed object has only its range of the pack to check
+		if end := rec.PackOffset + rec.SizeBytes; stat.Size < end {
+			kind = metadata.FindingSizeMismatch
+			expected, actual = strconv.FormatInt(end, 10), strconv.FormatInt(stat.Size, 10)
+		}
+	case stat.Size != rec.SizeBytes:
+		kind = metadata.FindingSizeMismatch
+		expected, actual = strconv.FormatInt(rec.SizeBytes, 10), strconv.FormatInt(stat.Size, 10)
+	case rec.ETag != "" && trimETag(stat.ETag) != trimETag(rec.ETag):
+		kind = metadata.FindingETagDrift
+		expected, actual = rec.ETag, stat.ETag
+	}
+	if kind == "" && opts.Verify && rec.Checksum != "" {
+		sum, err := s.hashObject(ctx, backend, &rec)
+		if err != nil {
+			return err
+		}
+		if sum != rec.Checksum {
+			kind = metadata.FindingChecksumMismatch
+			expected, actual = rec.Checksum, sum
+		}
+	}
+	if kind == "" {
+		return nil
+	}
+
+	// the record may have been purged or moved since it was scanned
+	if inUse, err := s.metaRepo.PhysicalKeyInUse(ctx, rec.ProviderBucket, rec.PhysicalKey); err != nil || !inUse {
+		return err
+	}
+	f := &metadata.ScrubFinding{
+		ObjectID:       rec.ID,
+		Env:            rec.Env,
+		LogicalRegion:  rec.LogicalRegion,
+		Bucket:         rec.Bucket,
+		ObjectKey:      rec.ObjectKey,
+		VersionID:      rec.VersionID,
+		ProviderBucket: rec.ProviderBucket,
+		PhysicalKey:    rec.PhysicalKey,
+		Kind:           kind,
+		Expected:       expected,
+		Actual:         actual,
+		DetectedAt:     time.Now(),
+	}
+	// an ETag alone can drift when a provider rewrites an object in place;
+	// there is nothing to restore then
+	if opts.Repair && kind != metadata.FindingETagDrift {
+		if err := s.repairObject(ctx, backend, &rec); err != nil {
+			log.Printf("scrub: cannot repair %s/%s (%s): %v", rec.ProviderBucket, rec.PhysicalKey, kind, err)
+		} else {
+			f.Repaired = true
+			report.Repaired++
+			metrics.ScrubRepairsTotal.WithLabelValues(rec.Env, rec.LogicalRegion, rec.Bucket).Inc()
+		}
+	}
+	log.Printf("scrub: %s %s/%s/%s/%s version %s at %s/%s (expected %q, actual %q, repaired %v)",
+		kind, rec.Env, rec.LogicalRegion, rec.Bucket, rec.ObjectKey, rec.VersionID,
+		rec.ProviderBucket, rec.PhysicalKey, expected, actual, f.Repaired)
+	metrics.ScrubFindingsTotal.WithLabelValues(rec.Env, rec.LogicalRegion, rec.Bucket, kind).Inc()
+	report.Findings[kind]++
+	if len(report.Entries) < maxScrubFindings {
+		report.Entries = append(report.Entries, f)
+	} else {
+		report.Truncated = true
+	}
+	return s.metaRepo.AddScrubFinding(ctx, f)
+}
+
+func trimETag(etag string) string {
+	return strings.Trim(etag, `"`)
+}
+
+func (s *Service) hashObject(ctx context.Context, backend objectstore.ObjectStorage, rec *metadata.ObjectRecord) (string, error) {
+	body, _, _, err := readContent(ctx, backend, locationOf(rec), rec)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// healthyCopy returns the content of rec from a copy that matches its size
+// and checksum: the cache entry of small objects or a completed replica.
+func (s *Service) healthyCopy(ctx context.Context, rec *metadata.ObjectRecord) ([]byte, error) {
+	if rec.IsLatest && rec.Status == metadata.StatusActive && rec.StoreBackend == metadata.StoreRedisObject {
+		data, err := s.cache.GetObject(ctx, s.cacheKey(rec.Env, rec.Bucket, rec.ObjectKey))
+		if err == nil && healthy(rec, data) {
+			return data, nil
+		}
+	}
+	reps, err := s.metaRepo.ListReplicas(ctx, rec.ProviderBucket, rec.PhysicalKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, rep := range reps {
+		if rep.Status != metadata.ReplicaCompleted {
+			continue
+		}
+		backend, ok := s.providers.Get(rep.TargetProvider)
+		if !ok {
+			continue
+		}
+		body, _, _, err := readContent(ctx, backend, replicaLocation(rep), rec)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(body, rec.SizeBytes+1))
+		body.Close()
+		if err == nil && healthy(rec, data) {
+			return data, nil
+		}
+	}
+	return nil, errNoHealthyCopy
+}
+
+func healthy(rec *metadata.ObjectRecord, data []byte) bool {
+	return int64(len(data)) == rec.SizeBytes && (rec.Checksum == "" || checksumOf(data) == rec.Checksum)
+}
+
+// repairObject rewrites the physical object of rec from a healthy copy and
+// records the ETag the provider returns for it. A packed object is written
+// out of its pack instead, which other objects still share.
+func (s *Service) repairObject(ctx context.Context, backend objectstore.ObjectStorage, rec *metadata.ObjectRecord) error {
+	data, err := s.healthyCopy(ctx, rec)
+	if err != nil {
+		return err
+	}
+	if rec.PackID != 0 {
+		return s.unpackObject(ctx, backend, rec, data)
+	}
+	etag, err := backend.PutObject(ctx, locationOf(rec), bytes.NewReader(data), int64(len(data)), objectstore.PutOptions{
+		ContentType:  rec.ContentType,
+		StorageClass: rec.StorageClass,
+	})
+	if err != nil {
+		return err
+	}
+	if etag == rec.ETag {
+		return nil
+	}
+	fixed := *rec
+	fixed.ETag = etag
+	if err := s.metaRepo.Relocate(ctx, &fixed, rec.PhysicalKey); err != nil {
+		return fmt.Errorf("record new etag: %w", err)
+	}
+	return nil
+}
+
+// unpackObject stores data, the content of packed record rec, as an object
+// of its own next to the pack and points the record there.
+func (s *Service) unpackObject(ctx context.Context, backend objectstore.ObjectStorage, rec *metadata.ObjectRecord, data []byte) error {
+	fixed := *rec
+	fixed.PackID, fixed.PackOffset = 0, 0
+	fixed.PhysicalKey = s.buildPhysicalKey(&PutRequest{Env: rec.Env, LogicalRegion: rec.LogicalRegion, Bucket: rec.Bucket, Key: rec.ObjectKey}, newWriteID())
+	etag, err := backend.PutObject(ctx, locationOf(&fixed), bytes.NewReader(data), int64(len(data)), objectstore.PutOptions{
+		ContentType:  rec.ContentType,
+		StorageClass: rec.StorageClass,
+	})
+	if err != nil {
+		return err
+	}
+	fixed.ETag = etag
+	if err := s.metaRepo.Relocate(ctx, &fixed, rec.PhysicalKey); err != nil {
+		_ = backend.DeleteObject(ctx, locationOf(&fixed))
+		return fmt.Errorf("record unpacked object: %w", err)
+	}
+	s.enqueueReplication(ctx, &fixed, s.providerNameOf(&fixed))
+	s.releasePhysical(ctx, rec)
+	return nil
+}
+
+// RunScrub calls Scrub every interval until ctx is done.
+func (s *Service) RunScrub(ctx context.Context, interval time.Duration, opts ScrubOptions) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		report, err := s.Scrub(ctx, opts)
+		if err != nil {
+			log.Printf("scrub: %v", err)
+		}
+		if report != nil {
+			log.Printf("scrub: checked %d, findings %v, repaired %d, errors %d",
+				report.Checked, report.Findings, report.Repaired, report.Errors)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ListScrubFindings returns recorded findings newest first.
+func (s *Service) ListScrubFindings(ctx context.Context, beforeID int64, limit int) ([]*metadata.ScrubFinding, error) {
+	return s.metaRepo.ListScrubFindings(ctx, beforeID, limit)
+}
@@ -0,0 +1,183 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+// overwrite replaces the copy of rec at provider with data.
+func (ts *testService) overwrite(t *testing.T, provider string, rec *metadata.ObjectRecord, data []byte) string {
+	t.Helper()
+	loc := locationOf(rec)
+	loc.ProviderBucket = provider
+	etag, err := ts.mem[provider].PutObject(context.Background(), loc, bytes.NewReader(data), int64(len(data)), objectstore.PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return etag
+}
+
+// rot corrupts the primary's copy of key the way bit rot would: the content
+// changes and the provider's ETag, which the memory adapter derives from
+// the content, is taken to be the recorded one.
+func (ts *testService) rot(t *testing.T, key string) {
+	t.Helper()
+	rec := ts.record(t, key)
+	data, _, err := ts.get(t, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 0xFF
+	fixed := *rec
+	fixed.ETag = ts.overwrite(t, "primary", rec, data)
+	if err := ts.repo.Relocate(context.Background(), &fixed, rec.PhysicalKey); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScrubFindings(t *testing.T) {
+	ts := newTestService(t, config.RouteRule{}, config.BucketConfig{})
+	for _, key := range []string{"ok", "rotten", "missing", "resized", "drifted"} {
+		if _, err := ts.put(t, key, []byte("content of "+key)); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	ts.rot(t, "rotten")
+	if err := ts.mem["primary"].DeleteObject(context.Background(), locationOf(ts.record(t, "missing"))); err != nil {
+		t.Fatal(err)
+	}
+	ts.overwrite(t, "primary", ts.record(t, "resized"), []byte("shorter"))
+	drifted := []byte("content of drifted")
+	drifted[0] = 'C'
+	ts.overwrite(t, "primary", ts.record(t, "drifted"), drifted)
+
+	report, err := ts.Scrub(context.Background(), ScrubOptions{})
+	if err != nil {
+		t.Fatalf("scrub: %v", err)
+	}
+	want := map[string]string{
+		"missing": metadata.FindingMissing,
+		"resized": metadata.FindingSizeMismatch,
+		"drifted": metadata.FindingETagDrift,
+	}
+	if report.Checked != 5 || len(report.Entries) != len(want) || report.Errors != 0 {
+		t.Fatalf("scrub = %+v, want 5 checked and %d findings", report, len(want))
+	}
+	for _, f := range report.Entries {
+		if want[f.ObjectKey] != f.Kind {
+			t.Errorf("%s: finding %s, want %q", f.ObjectKey, f.Kind, want[f.ObjectKey])
+		}
+		if f.Repaired {
+			t.Errorf("%s repaired without Repair", f.ObjectKey)
+		}
+	}
+
+	// only re-reading the content finds the rotten one
+	report, err = ts.Scrub(context.Background(), ScrubOptions{Verify: true})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if report.Findings[metadata.FindingChecksumMismatch] != 1 {
+		t.Fatalf("verify findings = %v, want one checksum mismatch", report.Findings)
+	}
+	for _, f := range report.Entries {
+		if f.Kind == metadata.FindingChecksumMismatch && (f.ObjectKey != "rotten" || f.Expected != ts.record(t, "rotten").Checksum) {
+			t.Errorf("checksum mismatch of %s expecting %s", f.ObjectKey, f.Expected)
+		}
+	}
+
+	// nothing holds a healthy copy to repair from
+	report, err = ts.Scrub(context.Background(), ScrubOptions{Verify: true, Repair: true})
+	if err != nil || report.Repaired != 0 {
+		t.Errorf("repair without copies = %+v, %v; want nothing repaired", report, err)
+	}
+	findings, err := ts.ListScrubFindings(context.Background(), 0, 100)
+	if err != nil || len(findings) != 3+4+4 {
+		t.Errorf("%d findings recorded, %v; want every one of the three runs", len(findings), err)
+	}
+}
+
+func TestScrubRepairFromReplica(t *testing.T) {
+	ts, data := newReplicatedService(t)
+	rec := ts.record(t, "k")
+
+	if err := ts.mem["primary"].DeleteObject(context.Background(), locationOf(rec)); err != nil {
+		t.Fatal(err)
+	}
+	report, err := ts.Scrub(context.Background(), ScrubOptions{Repair: true})
+	if err != nil || report.Findings[metadata.FindingMissing] != 1 || report.Repaired != 1 || !report.Entries[0].Repaired {
+		t.Fatalf("repair of a missing copy = %+v, %v", report, err)
+	}
+	if got, resp, err := ts.get(t, "k"); err != nil || !bytes.Equal(got, data) || resp.ServedFrom != "primary/primary" {
+		t.Errorf("get after repair = %q from %v, %v", got, resp, err)
+	}
+
+	ts.rot(t, "k")
+	report, err = ts.Scrub(context.Background(), ScrubOptions{Verify: true, Repair: true})
+	if err != nil || report.Findings[metadata.FindingChecksumMismatch] != 1 || report.Repaired != 1 {
+		t.Fatalf("repair of rotten content = %+v, %v", report, err)
+	}
+	if got, _, err := ts.get(t, "k"); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("get after repair = %q, %v", got, err)
+	}
+	if rec := ts.record(t, "k"); rec.ETag != etagOf(data) {
+		t.Errorf("record keeps etag %s, want the repaired object's", rec.ETag)
+	}
+	if report, err := ts.Scrub(context.Background(), ScrubOptions{Verify: true}); err != nil || len(report.Entries) != 0 {
+		t.Errorf("scrub after repair = %+v, %v; want no findings", report, err)
+	}
+
+	// a damaged replica is no healthy copy
+	ts.rot(t, "k")
+	ts.overwrite(t, "replica", rec, bytes.Repeat([]byte("x"), len(data)))
+	report, err = ts.Scrub(context.Background(), ScrubOptions{Verify: true, Repair: true})
+	if err != nil || report.Findings[metadata.FindingChecksumMismatch] != 1 || report.Repaired != 0 {
+		t.Errorf("repair from a damaged replica = %+v, %v; want nothing repaired", report, err)
+	}
+}
+
+// A packed object is repaired out of its pack, which others still share.
+func TestScrubRepairPacked(t *testing.T) {
+	ts := newTestService(t, config.RouteRule{Replicas: []config.RouteTarget{target("replica")}}, config.BucketConfig{
+		Pack: &config.PackConfig{MaxBytes: 2 * packEntrySize},
+	})
+	for i, err := range ts.putAll(t, 2) {
+		if err != nil {
+			t.Fatalf("put k%d: %v", i, err)
+		}
+	}
+	if _, failed, err := ts.Replicate(context.Background()); err != nil || failed != 0 {
+		t.Fatalf("replicate: %d failed, %v", failed, err)
+	}
+	old := *ts.record(t, "k1") // the memory repository updates the record in place
+	body, _, _, err := ts.mem["primary"].GetObject(context.Background(), locationOf(&old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack, _ := io.ReadAll(body)
+	body.Close()
+	pack[old.PackOffset] ^= 0xFF
+	ts.overwrite(t, "primary", &old, pack)
+
+	report, err := ts.Scrub(context.Background(), ScrubOptions{Verify: true, Repair: true})
+	if err != nil || report.Findings[metadata.FindingChecksumMismatch] != 1 || report.Repaired != 1 {
+		t.Fatalf("scrub = %+v, %v", report, err)
+	}
+	rec := ts.record(t, "k1")
+	if rec.PackID != 0 || rec.PhysicalKey == old.PhysicalKey {
+		t.Errorf("k1 still in pack %d at %s", rec.PackID, rec.PhysicalKey)
+	}
+	for i := 0; i < 2; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if got, _, err := ts.get(t, key); err != nil || !bytes.Equal(got, packEntry(i)) {
+			t.Errorf("get %s after repair = %q, %v", key, got, err)
+		}
+	}
+}
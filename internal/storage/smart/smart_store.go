@@ -3,12 +3,21 @@ package smart
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/kenelite/smartstore/internal/cache"
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/inspect"
 	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/metrics"
 	"github.com/kenelite/smartstore/internal/storage/objectstore"
 )
 
@@ -18,24 +27,49 @@ type Service struct {
 	router    objectstore.ObjectRoute
 	providers *objectstore.ProviderRegistry
 
+	buckets   config.BucketConfigs  // per logical bucket settings
+	inspector inspect.Inspector     // optional content scanner
+	orphanGC  config.OrphanGCConfig // grace and rate of the orphan GC
+
+	softLimited sync.Map // "env/region/bucket" of buckets above their quota soft limit
+	policies    sync.Map // *config.BucketConfig -> *policy.Policy
+	accessed    sync.Map // "env/region/bucket/key" -> time.Time of the last recorded read
+
+	replicate chan struct{}  // wakes the replication worker
+	health    providerHealth // providers that failed a write recently
+	packer    packer         // open packs of buckets that pack small objects
+
 	smallFileThreshold int64         // bytes, e.g. 1MB
 	cacheTTL           time.Duration // TTL for cached small files
 }
 
+type Option func(*Service)
+
+// WithBucketConfigs sets the per logical bucket settings.
+func WithBucketConfigs(buckets config.BucketConfigs) Option {
+	return func(s *Service) { s.buckets = buckets }
+}
+
 func NewService(
 	cache *cache.RedisCache,
 	repo metadata.Repository,
 	router objectstore.ObjectRoute,
 	registry *objectstore.ProviderRegistry,
+	opts ...Option,
 ) *Service {
-	return &Service{
+	s := &Service{
 		cache:              cache,
 		metaRepo:           repo,
 		router:             router,
 		providers:          registry,
 		smallFileThreshold: 1 * 1024 * 1024,
 		cacheTTL:           24 * time.Hour,
+		replicate:          make(chan struct{}, 1),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 type PutRequest struct {
@@ -47,65 +81,129 @@ type PutRequest struct {
 	Size          int64
 	Body          io.Reader
 	StorageClass  string // HOT/COLD/ARCHIVE
+
+	Lock             *ObjectLock // nil applies the bucket's default retention
+	BypassGovernance bool        // may replace an object under governance retention
+
+	Tags map[string]string // matched by lifecycle rules
 }
 
 type PutResponse struct {
-	ETag    string                `json:"etag"`
-	Backend metadata.StoreBackend `json:"backend"`
-	Size    int64                 `json:"size"`
+	ETag      string                `json:"etag"`
+	Backend   metadata.StoreBackend `json:"backend"`
+	Size      int64                 `json:"size"`
+	VersionID string                `json:"version_id"`
 }
 
 func (s *Service) Put(ctx context.Context, req *PutRequest) (*PutResponse, error) {
 	if req.StorageClass == "" {
 		req.StorageClass = "HOT"
 	}
+	pr, err := s.checkPolicy(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkOverwrite(ctx, req); err != nil {
+		return nil, err
+	}
+	if err := s.runWriteHooks(ctx, req); err != nil {
+		return nil, err
+	}
+	qr, err := s.checkQuota(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	sc := s.startScan(ctx, req)
+
+	var resp *PutResponse
 	if req.Size > 0 && req.Size <= s.smallFileThreshold {
-		return s.putSmall(ctx, req)
+		resp, err = s.putSmall(ctx, req, sc)
+	} else {
+		resp, err = s.putLarge(ctx, req, sc)
 	}
-	return s.putLarge(ctx, req)
+	if err != nil {
+		if pr != nil && pr.Err != nil {
+			return nil, pr.Err
+		}
+		if qr != nil && qr.err != nil {
+			// report the quota rather than however the provider wrapped it
+			metrics.QuotaRejectionsTotal.WithLabelValues(req.Env, req.LogicalRegion, req.Bucket, "bytes").Inc()
+			return nil, qr.err
+		}
+		if errors.Is(err, ErrQuarantined) {
+			// quarantined objects are recorded and count against the quota
+			s.observeUsage(ctx, req.Env, req.LogicalRegion, req.Bucket)
+		}
+		return nil, err
+	}
+	s.observeUsage(ctx, req.Env, req.LogicalRegion, req.Bucket)
+	return resp, nil
 }
 
-func (s *Service) putSmall(ctx context.Context, req *PutRequest) (*PutResponse, error) {
+func (s *Service) putSmall(ctx context.Context, req *PutRequest, sc *scan) (*PutResponse, error) {
 	buf := new(bytes.Buffer)
 	n, err := io.Copy(buf, req.Body)
+	status, scanErr := sc.finish(err)
 	if err != nil {
 		return nil, err
 	}
+	if scanErr != nil {
+		return nil, scanErr
+	}
 	data := buf.Bytes()
 	cacheKey := s.cacheKey(req.Env, req.Bucket, req.Key)
 
-	// 1. write to cache
-	if err := s.cache.SetObject(ctx, cacheKey, data, s.cacheTTL); err != nil {
+	// 1. write to cache; quarantined content must not be served from it
+	if status == metadata.StatusQuarantined {
+		_ = s.cache.Del(ctx, cacheKey)
+	} else if err := s.cache.SetObject(ctx, cacheKey, data, s.cacheTTL); err != nil {
 		// TODO: log warning
 	}
 
 	// 2. route to provider
-	route, err := s.router.ResolveRoute(objectstore.RouteKey{
+	routeKey := objectstore.RouteKey{
 		Env:           req.Env,
 		LogicalRegion: req.LogicalRegion,
 		Bucket:        req.Bucket,
 		StorageClass:  req.StorageClass,
-	})
+	}
+	route, err := s.router.ResolveRoute(routeKey)
 	if err != nil {
 		return nil, err
 	}
 
-	backend, ok := s.providers.Get(route.ProviderName)
-	if !ok {
-		return nil, fmt.Errorf("no backend for provider %s", route.ProviderName)
-	}
-
-	loc := objectstore.ObjectLocation{
-		ProviderType:   route.ProviderType,
-		ProviderRegion: route.ProviderRegion,
-		ProviderBucket: route.ProviderBucket,
-		PhysicalKey:    s.buildPhysicalKey(req),
-	}
-
-	etag, err := backend.PutObject(ctx, loc, bytes.NewReader(data), n, objectstore.PutOptions{
+	versionID := newWriteID()
+	physicalKey := s.buildPhysicalKey(req, versionID)
+	checksum := checksumOf(data)
+	opts := objectstore.PutOptions{
 		ContentType:  req.ContentType,
 		StorageClass: req.StorageClass,
-	})
+	}
+	var etag string
+	var qw *quorumWrite
+	var pw *packWrite
+	pc := s.packConfig(req.Env, req.LogicalRegion, req.Bucket)
+	switch {
+	case s.dedups(req.Env, req.LogicalRegion, req.Bucket):
+		contentKey := s.buildContentKey(req, checksum)
+		route, etag, qw, err = s.putContent(ctx, routeKey, route, contentKey, bytes.NewReader(data), n, opts)
+		if errors.Is(err, metadata.ErrRefRetired) {
+			// the stored copy of the content is being deleted; keep this
+			// one apart under the write's own key
+			route, etag, qw, err = s.putObject(ctx, routeKey, route, physicalKey, bytes.NewReader(data), n, opts)
+		} else {
+			physicalKey = contentKey
+		}
+	case pc != nil && status == metadata.StatusActive:
+		// quarantined content is kept out of packs, which are replicated whole
+		if pw, err = s.putPacked(routeKey, route, pc, data); err == nil {
+			defer pw.done(context.WithoutCancel(ctx), s)
+			route, physicalKey, etag = pw.pack.stored, pw.pack.physicalKey, etagOf(data)
+			metrics.PackedObjectsTotal.WithLabelValues(req.Env, req.LogicalRegion, req.Bucket).Inc()
+		}
+	default:
+		route, etag, qw, err = s.putObject(ctx, routeKey, route, physicalKey, bytes.NewReader(data), n, opts)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -119,135 +217,200 @@ func (s *Service) putSmall(ctx context.Context, req *PutRequest) (*PutResponse,
 		ContentType:    req.ContentType,
 		StorageClass:   req.StorageClass,
 		StoreBackend:   metadata.StoreRedisObject,
+		ProviderName:   route.ProviderName,
 		ProviderType:   string(route.ProviderType),
 		ProviderRegion: route.ProviderRegion,
 		ProviderBucket: route.ProviderBucket,
-		PhysicalKey:    loc.PhysicalKey,
+		PhysicalKey:    physicalKey,
 		ETag:           etag,
-		Status:         "ACTIVE",
+		Checksum:       checksum,
+		VersionID:      versionID,
+		Status:         status,
+		Tags:           req.Tags,
 	}
-	if err := s.metaRepo.PutObject(ctx, rec); err != nil {
+	if pw != nil {
+		rec.PackID, rec.PackOffset = pw.pack.id, pw.offset
+	}
+	s.applyLock(req, rec)
+	if err := s.commitRecord(ctx, rec); err != nil {
+		s.abandonWrite(ctx, rec, qw)
 		return nil, err
 	}
+	switch {
+	case qw != nil:
+		s.finishQuorum(ctx, qw, rec)
+	case pw == nil: // the pack's replicas cover packed objects
+		s.enqueueReplication(ctx, rec, route.ProviderName)
+	}
+	if status == metadata.StatusQuarantined {
+		return nil, fmt.Errorf("%w: %s", ErrQuarantined, sc.verdict.Signature)
+	}
 
 	return &PutResponse{
-		ETag:    etag,
-		Backend: rec.StoreBackend,
-		Size:    n,
+		ETag:      etag,
+		Backend:   rec.StoreBackend,
+		Size:      n,
+		VersionID: versionID,
 	}, nil
 }
 
-func (s *Service) putLarge(ctx context.Context, req *PutRequest) (*PutResponse, error) {
+func (s *Service) putLarge(ctx context.Context, req *PutRequest, sc *scan) (*PutResponse, error) {
 	// Stream to object storage without caching.
-	route, err := s.router.ResolveRoute(objectstore.RouteKey{
+	routeKey := objectstore.RouteKey{
 		Env:           req.Env,
 		LogicalRegion: req.LogicalRegion,
 		Bucket:        req.Bucket,
 		StorageClass:  req.StorageClass,
-	})
+	}
+	route, err := s.router.ResolveRoute(routeKey)
 	if err != nil {
 		return nil, err
 	}
-	backend, ok := s.providers.Get(route.ProviderName)
-	if !ok {
-		return nil, fmt.Errorf("no backend for provider %s", route.ProviderName)
-	}
-	loc := objectstore.ObjectLocation{
-		ProviderType:   route.ProviderType,
-		ProviderRegion: route.ProviderRegion,
-		ProviderBucket: route.ProviderBucket,
-		PhysicalKey:    s.buildPhysicalKey(req),
-	}
-	etag, err := backend.PutObject(ctx, loc, req.Body, req.Size, objectstore.PutOptions{
+	versionID := newWriteID()
+	physicalKey := s.buildPhysicalKey(req, versionID)
+	sum := sha256.New()
+	body := &countingReader{r: io.TeeReader(req.Body, sum)}
+	route, etag, qw, err := s.putObject(ctx, routeKey, route, physicalKey, body, req.Size, objectstore.PutOptions{
 		ContentType:  req.ContentType,
 		StorageClass: req.StorageClass,
 	})
+	status, scanErr := sc.finish(err)
 	if err != nil {
 		return nil, err
 	}
+	if scanErr != nil {
+		// fail closed: nothing references the uploaded object
+		s.discardObject(ctx, route, physicalKey, qw)
+		return nil, scanErr
+	}
+	if status == metadata.StatusQuarantined {
+		_ = s.cache.Del(ctx, s.cacheKey(req.Env, req.Bucket, req.Key))
+	}
+	checksum := hex.EncodeToString(sum.Sum(nil))
+	// the content key is known only now; quorum writes keep their key
+	if qw == nil && s.dedups(req.Env, req.LogicalRegion, req.Bucket) {
+		contentKey := s.buildContentKey(req, checksum)
+		if cetag, err := s.adoptContent(ctx, req, route, physicalKey, contentKey, body.n, objectstore.PutOptions{
+			ContentType:  req.ContentType,
+			StorageClass: req.StorageClass,
+		}); err != nil {
+			log.Printf("dedup: %s/%s stays unshared: %v", route.ProviderBucket, physicalKey, err)
+		} else {
+			physicalKey, etag = contentKey, cetag
+		}
+	}
 
 	rec := &metadata.ObjectRecord{
 		Env:            req.Env,
 		LogicalRegion:  req.LogicalRegion,
 		Bucket:         req.Bucket,
 		ObjectKey:      req.Key,
-		SizeBytes:      req.Size,
+		SizeBytes:      body.n, // req.Size is -1 for chunked uploads
 		ContentType:    req.ContentType,
 		StorageClass:   req.StorageClass,
 		StoreBackend:   metadata.StoreObjectOnly,
+		ProviderName:   route.ProviderName,
 		ProviderType:   string(route.ProviderType),
 		ProviderRegion: route.ProviderRegion,
 		ProviderBucket: route.ProviderBucket,
-		PhysicalKey:    loc.PhysicalKey,
+		PhysicalKey:    physicalKey,
 		ETag:           etag,
-		Status:         "ACTIVE",
+		Checksum:       checksum,
+		VersionID:      versionID,
+		Status:         status,
+		Tags:           req.Tags,
 	}
-	if err := s.metaRepo.PutObject(ctx, rec); err != nil {
+	s.applyLock(req, rec)
+	if err := s.commitRecord(ctx, rec); err != nil {
+		s.abandonWrite(ctx, rec, qw)
 		return nil, err
 	}
+	if qw != nil {
+		s.finishQuorum(ctx, qw, rec)
+	} else {
+		s.enqueueReplication(ctx, rec, route.ProviderName)
+	}
+	if status == metadata.StatusQuarantined {
+		return nil, fmt.Errorf("%w: %s", ErrQuarantined, sc.verdict.Signature)
+	}
 
 	return &PutResponse{
-		ETag:    etag,
-		Backend: rec.StoreBackend,
-		Size:    req.Size,
+		ETag:      etag,
+		Backend:   rec.StoreBackend,
+		Size:      body.n,
+		VersionID: versionID,
 	}, nil
 }
 
+// checksumOf is the hex SHA-256 recorded as ObjectRecord.Checksum.
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
 type GetRequest struct {
 	Env           string
 	LogicalRegion string
 	Bucket        string
 	Key           string
+	VersionID     string // empty for the latest version
 }
 
 type GetResponse struct {
 	Size        int64
 	ContentType string
+	ETag        string
 	Body        io.ReadCloser
+	ServedFrom  string // "cache" or the "provider/bucket" the content was read from
 }
 
 func (s *Service) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
 	cacheKey := s.cacheKey(req.Env, req.Bucket, req.Key)
+	cached := req.VersionID == "" // the cache only holds latest versions
 
 	// 1. try cache
-	if data, err := s.cache.GetObject(ctx, cacheKey); err == nil && len(data) > 0 {
+	if data, err := s.cache.GetObject(ctx, cacheKey); cached && err == nil && len(data) > 0 {
+		s.recordAccess(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key)
 		return &GetResponse{
 			Size:        int64(len(data)),
 			ContentType: "", // in future we can cache meta as well
 			Body:        io.NopCloser(bytes.NewReader(data)),
+			ServedFrom:  servedFromCache,
 		}, nil
 	}
 
 	// 2. lookup metadata
-	rec, err := s.metaRepo.GetObject(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key)
+	rec, err := s.lookup(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-
-	routeName := rec.ProviderType // using provider type/name; here we treat ProviderType as key
-	backend, ok := s.providers.Get(routeName)
-	if !ok {
-		// fallback: try by provider type if name-based lookup failed
-		backend, ok = s.providers.Get(rec.ProviderBucket)
-		if !ok {
-			return nil, fmt.Errorf("no backend for provider %s", routeName)
-		}
+	if rec.Status == metadata.StatusQuarantined {
+		return nil, ErrObjectQuarantined
 	}
 
-	loc := objectstore.ObjectLocation{
-		ProviderType:   objectstore.ProviderType(rec.ProviderType),
-		ProviderRegion: rec.ProviderRegion,
-		ProviderBucket: rec.ProviderBucket,
-		PhysicalKey:    rec.PhysicalKey,
-	}
-
-	body, size, contentType, err := backend.GetObject(ctx, loc)
+	// falls back to replicas when the primary location fails
+	body, size, contentType, servedFrom, err := s.openObject(ctx, rec)
 	if err != nil {
 		return nil, err
 	}
 
+	if cached {
+		s.recordAccess(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key)
+	}
+
 	// 3. optionally refill cache if small
-	if size > 0 && size <= s.smallFileThreshold {
+	if cached && size > 0 && size <= s.smallFileThreshold {
 		buf := new(bytes.Buffer)
 		if _, err := io.Copy(buf, body); err != nil {
 			body.Close()
@@ -262,7 +425,9 @@ func (s *Service) Get(ctx context.Context, req *GetRequest) (*GetResponse, error
 	return &GetResponse{
 		Size:        size,
 		ContentType: contentType,
+		ETag:        rec.ETag,
 		Body:        body,
+		ServedFrom:  servedFrom,
 	}, nil
 }
 
@@ -270,7 +435,90 @@ func (s *Service) cacheKey(env, bucket, key string) string {
 	return fmt.Sprintf("obj:%s:%s:%s", env, bucket, key)
 }
 
-func (s *Service) buildPhysicalKey(req *PutRequest) string {
-	// Simple physical key: env/logicalRegion/bucket/key
-	return fmt.Sprintf("%s/%s/%s/%s", req.Env, req.LogicalRegion, req.Bucket, req.Key)
+// buildPhysicalKey returns the provider key of one write:
+// env/logicalRegion/bucket/key~writeID. Writes never overwrite each other's
+// objects, so a deleted object in the trash or an older version keeps its
+// content even when the key is uploaded again.
+func (s *Service) buildPhysicalKey(req *PutRequest, writeID string) string {
+	return fmt.Sprintf("%s/%s/%s/%s%s%s", req.Env, req.LogicalRegion, req.Bucket, req.Key, writeIDMarker, writeID)
+}
+
+const writeIDMarker = "~"
+
+// newWriteID is time ordered so provider listings sort writes of a key. It
+// doubles as the version ID of the record.
+func newWriteID() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return fmt.Sprintf("%016x%s", time.Now().UnixNano(), hex.EncodeToString(b[:]))
+}
+
+// commitRecord stores rec as the live record of its key and then removes
+// the physical object of the record it replaced. Versioned buckets keep the
+// replaced record as a noncurrent version instead. Concurrent writers of a
+// key each replace a different record, so none is released twice.
+func (s *Service) commitRecord(ctx context.Context, rec *metadata.ObjectRecord) error {
+	if s.versioned(rec.Env, rec.LogicalRegion, rec.Bucket) {
+		return s.metaRepo.AddVersion(ctx, rec)
+	}
+	prev, err := s.metaRepo.PutObject(ctx, rec)
+	if err != nil {
+		return err
+	}
+	// a rewrite of deduplicated content still drops prev's reference
+	if prev != nil && (prev.PhysicalKey != rec.PhysicalKey || s.contentAddressed(prev)) {
+		s.releasePhysical(ctx, prev)
+	}
+	return nil
+}
+
+// releasePhysical deletes the provider object of a record that is gone from
+// metadata, unless another record still points at it. Objects written
+// before physical keys carried a write ID may be shared with trash entries.
+// Failures are logged; the orphan is left for garbage collection. The last
+// reference to a deduplicated object is retired rather than released, so
+// that an upload of the same content cannot reuse the object while it is
+// deleted.
+func (s *Service) releasePhysical(ctx context.Context, rec *metadata.ObjectRecord) {
+	if s.contentAddressed(rec) {
+		refs, err := s.metaRepo.RetireRef(ctx, rec.ProviderBucket, rec.PhysicalKey)
+		if errors.Is(err, metadata.ErrRefRetired) {
+			return // another release is deleting it
+		}
+		if err != nil {
+			log.Printf("release %s/%s: %v", rec.ProviderBucket, rec.PhysicalKey, err)
+			return
+		}
+		if refs > 0 {
+			return
+		}
+		defer func() {
+			if err := s.metaRepo.DropRef(ctx, rec.ProviderBucket, rec.PhysicalKey); err != nil {
+				log.Printf("release %s/%s: %v", rec.ProviderBucket, rec.PhysicalKey, err)
+			}
+		}()
+	}
+	inUse, err := s.metaRepo.PhysicalKeyInUse(ctx, rec.ProviderBucket, rec.PhysicalKey)
+	if err != nil {
+		log.Printf("release %s/%s: %v", rec.ProviderBucket, rec.PhysicalKey, err)
+		return
+	}
+	if inUse {
+		return
+	}
+	s.releaseReplicas(ctx, rec)
+	backend, err := s.backendFor(rec)
+	if err != nil {
+		log.Printf("release %s/%s: %v", rec.ProviderBucket, rec.PhysicalKey, err)
+		return
+	}
+	if err := backend.DeleteObject(ctx, locationOf(rec)); err != nil && !errors.Is(err, objectstore.ErrObjectNotFound) {
+		log.Printf("release %s/%s: %v", rec.ProviderBucket, rec.PhysicalKey, err)
+		return
+	}
+	if rec.PackID != 0 {
+		if err := s.metaRepo.DeletePack(ctx, rec.PackID); err != nil {
+			log.Printf("release pack %d: %v", rec.PackID, err)
+		}
+	}
 }
@@ -0,0 +1,126 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+const (
+	testEnv    = "dev"
+	testRegion = "r1"
+	testBucket = "b"
+)
+
+// testService is a Service over in-memory metadata and memory providers,
+// each wrapped in a FaultAdapter, for the route's provider, replicas and
+// fallbacks. Provider buckets are named after their providers unless the
+// route names them.
+type testService struct {
+	*Service
+	repo   *metadata.InMemoryRepository
+	faults map[string]*objectstore.FaultAdapter
+	mem    map[string]*objectstore.MemoryAdapter
+}
+
+func newTestService(t *testing.T, route config.RouteRule, bucket config.BucketConfig, opts ...Option) *testService {
+	t.Helper()
+	route.Env, route.LogicalRegion, route.Bucket = testEnv, testRegion, testBucket
+	if route.StorageClass == "" {
+		route.StorageClass = "HOT"
+	}
+	if route.ProviderName == "" {
+		route.ProviderName = "primary"
+	}
+	if route.ProviderBucket == "" {
+		route.ProviderBucket = route.ProviderName
+	}
+	bucket.Bucket = testBucket
+
+	ts := &testService{
+		repo:   metadata.NewInMemoryRepository(),
+		faults: map[string]*objectstore.FaultAdapter{},
+		mem:    map[string]*objectstore.MemoryAdapter{},
+	}
+	cfg := config.ObjectStorageConfig{Routes: []config.RouteRule{route}}
+	reg := objectstore.NewProviderRegistry()
+	names := []string{route.ProviderName}
+	for _, target := range append(append([]config.RouteTarget{}, route.Replicas...), route.Fallbacks...) {
+		names = append(names, target.ProviderName)
+	}
+	for _, name := range names {
+		if _, ok := ts.mem[name]; ok {
+			continue
+		}
+		ts.mem[name] = objectstore.NewMemoryAdapter()
+		ts.faults[name] = objectstore.NewFaultAdapter(ts.mem[name], objectstore.FaultConfig{})
+		reg.Register(name, ts.faults[name])
+		cfg.Providers = append(cfg.Providers, config.ProviderConfig{Name: name, Type: config.ProviderMemory})
+	}
+	opts = append([]Option{WithBucketConfigs(config.BucketConfigs{bucket})}, opts...)
+	ts.Service = NewService(nil, ts.repo, objectstore.NewStaticRouter(cfg), reg, opts...)
+	return ts
+}
+
+func (ts *testService) put(t *testing.T, key string, data []byte) (*PutResponse, error) {
+	t.Helper()
+	return ts.Put(context.Background(), &PutRequest{
+		Env:           testEnv,
+		LogicalRegion: testRegion,
+		Bucket:        testBucket,
+		Key:           key,
+		ContentType:   "application/octet-stream",
+		Size:          int64(len(data)),
+		Body:          bytes.NewReader(data),
+	})
+}
+
+func (ts *testService) get(t *testing.T, key string) ([]byte, *GetResponse, error) {
+	t.Helper()
+	resp, err := ts.Get(context.Background(), &GetRequest{
+		Env:           testEnv,
+		LogicalRegion: testRegion,
+		Bucket:        testBucket,
+		Key:           key,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return data, resp, err
+}
+
+// record returns the latest record of key.
+func (ts *testService) record(t *testing.T, key string) *metadata.ObjectRecord {
+	t.Helper()
+	rec, err := ts.repo.GetObject(context.Background(), testEnv, testRegion, testBucket, key)
+	if err != nil {
+		t.Fatalf("record of %s: %v", key, err)
+	}
+	return rec
+}
+
+// objects returns the physical keys stored in a provider bucket.
+func (ts *testService) objects(t *testing.T, provider string) []string {
+	t.Helper()
+	var keys []string
+	err := ts.mem[provider].ListObjects(context.Background(), objectstore.ObjectLocation{ProviderBucket: provider}, func(o objectstore.ObjectSummary) error {
+		keys = append(keys, o.PhysicalKey)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// target is a RouteTarget whose provider bucket is named after the provider.
+func target(provider string) config.RouteTarget {
+	return config.RouteTarget{ProviderName: provider, ProviderBucket: provider}
+}
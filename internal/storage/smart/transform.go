@@ -0,0 +1,165 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/imaging"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+)
+
+var (
+	ErrTransformNotAllowed = errors.New("image transform not allowed for this bucket")
+	ErrSourceTooLarge      = errors.New("source image too large to transform")
+)
+
+const (
+	defaultMaxTransformSource = 20 * 1024 * 1024
+	defaultVariantTTL         = 24 * time.Hour
+)
+
+// GetTransformed returns a resized/re-encoded variant of an image. Variants
+// are served from Redis, then from a persisted sibling object when the
+// bucket enables it, and only rendered from the source on a miss.
+func (s *Service) GetTransformed(ctx context.Context, req *GetRequest, opts imaging.Options) (*GetResponse, error) {
+	bc := s.buckets.Lookup(req.Env, req.LogicalRegion, req.Bucket)
+	if bc == nil || bc.Transform == nil {
+		return nil, ErrTransformNotAllowed
+	}
+	tc := bc.Transform
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(tc.AllowedSizes, opts.Size()) {
+		return nil, fmt.Errorf("%w: size %s", ErrTransformNotAllowed, opts.Size())
+	}
+
+	rec, err := s.lookup(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Status == metadata.StatusQuarantined {
+		return nil, ErrObjectQuarantined
+	}
+	if opts.Format == "" {
+		// keep the source format when it can be encoded, else fall back to PNG
+		opts.Format, err = imaging.ParseFormat(strings.TrimPrefix(rec.ContentType, "image/"))
+		if err != nil || opts.Format == "" {
+			opts.Format = imaging.FormatPNG
+		}
+	}
+	if len(tc.AllowedFormats) > 0 && !slices.ContainsFunc(tc.AllowedFormats, func(f string) bool {
+		pf, err := imaging.ParseFormat(f)
+		return err == nil && pf == opts.Format
+	}) {
+		return nil, fmt.Errorf("%w: format %s", ErrTransformNotAllowed, opts.Format)
+	}
+
+	contentType := imaging.ContentType(opts.Format)
+	variant := variantName(opts)
+	cacheKey := fmt.Sprintf("img:%s:%s:%s:%s:%s", req.Env, req.Bucket, req.Key, sourceTag(rec), variant)
+	ttl := tc.CacheTTL
+	if ttl == 0 {
+		ttl = defaultVariantTTL
+	}
+
+	// 1. try cache
+	if data, err := s.cache.GetObject(ctx, cacheKey); err == nil && len(data) > 0 {
+		return variantResponse(data, contentType), nil
+	}
+
+	backend, err := s.backendFor(rec)
+	if err != nil {
+		return nil, err
+	}
+	variantLoc := objectstore.ObjectLocation{
+		ProviderType:   objectstore.ProviderType(rec.ProviderType),
+		ProviderRegion: rec.ProviderRegion,
+		ProviderBucket: rec.ProviderBucket,
+		PhysicalKey:    variantPhysicalKey(rec, variant),
+	}
+
+	// 2. try a persisted variant
+	if tc.PersistVariants {
+		if body, _, _, err := backend.GetObject(ctx, variantLoc); err == nil {
+			data, err := io.ReadAll(body)
+			body.Close()
+			if err == nil && len(data) > 0 {
+				_ = s.cache.SetObject(ctx, cacheKey, data, ttl)
+				return variantResponse(data, contentType), nil
+			}
+		}
+	}
+
+	// 3. render from the source
+	maxSource := tc.MaxSourceBytes
+	if maxSource == 0 {
+		maxSource = defaultMaxTransformSource
+	}
+	if rec.SizeBytes > maxSource {
+		return nil, ErrSourceTooLarge
+	}
+	opts.MaxPixels = tc.MaxSourcePixels
+	src, err := s.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Body.Close()
+	data, _, err := imaging.Transform(io.LimitReader(src.Body, maxSource), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = s.cache.SetObject(ctx, cacheKey, data, ttl)
+	if tc.PersistVariants {
+		if _, err := backend.PutObject(ctx, variantLoc, bytes.NewReader(data), int64(len(data)), objectstore.PutOptions{
+			ContentType:  contentType,
+			StorageClass: rec.StorageClass,
+		}); err != nil {
+			log.Printf("persist image variant %s: %v", variantLoc.PhysicalKey, err)
+		}
+	}
+	return variantResponse(data, contentType), nil
+}
+
+func variantResponse(data []byte, contentType string) *GetResponse {
+	return &GetResponse{
+		Size:        int64(len(data)),
+		ContentType: contentType,
+		Body:        io.NopCloser(bytes.NewReader(data)),
+	}
+}
+
+func variantName(opts imaging.Options) string {
+	name := fmt.Sprintf("%s-%s", opts.Size(), opts.Fit)
+	if opts.Quality > 0 {
+		name += fmt.Sprintf("-q%d", opts.Quality)
+	}
+	return name + "." + string(opts.Format)
+}
+
+// sourceTag identifies the source content so an overwrite invalidates
+// cached and persisted variants.
+func sourceTag(rec *metadata.ObjectRecord) string {
+	sum := sha256.Sum256([]byte(rec.PhysicalKey + "\x00" + rec.ETag))
+	return hex.EncodeToString(sum[:6])
+}
+
+// variantPhysicalKeyMarker separates a source physical key from the
+// variants persisted next to it.
+const variantPhysicalKeyMarker = "@variants/"
+
+// variantPhysicalKey is where a persisted variant of rec is stored.
+func variantPhysicalKey(rec *metadata.ObjectRecord, variant string) string {
+	return rec.PhysicalKey + variantPhysicalKeyMarker + sourceTag(rec) + "/" + variant
+}
@@ -0,0 +1,186 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+)
+
+const (
+	defaultTrashRetention = 7 * 24 * time.Hour
+	purgeBatchSize        = 500
+)
+
+func (s *Service) trashRetention(env, region, bucket string) time.Duration {
+	if bc := s.buckets.Lookup(env, region, bucket); bc != nil && bc.Trash != nil {
+		return bc.Trash.Retention
+	}
+	return defaultTrashRetention
+}
+
+// TrashEntry is a deleted object that can still be restored. A key deleted
+// several times has one entry per deletion, told apart by ID.
+type TrashEntry struct {
+	ObjectInfo
+	ID        int64     `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+type TrashListResponse struct {
+	Bucket       string        `json:"bucket"`
+	Prefix       string        `json:"prefix,omitempty"`
+	Entries      []*TrashEntry `json:"entries"`
+	IsTruncated  bool          `json:"is_truncated"`
+	NextMarker   string        `json:"next_marker,omitempty"`
+	NextIDMarker int64         `json:"next_id_marker,omitempty"`
+}
+
+// ListTrash pages through the bucket's deleted objects by key, then
+// deletion. req.StartAfterID continues from a NextIDMarker.
+func (s *Service) ListTrash(ctx context.Context, req *ListRequest) (*TrashListResponse, error) {
+	limit := req.Limit
+	if limit <= 0 || limit > maxListLimit {
+		limit = defaultListLimit
+	}
+	recs, err := s.metaRepo.ListDeleted(ctx, req.Env, req.LogicalRegion, req.Bucket, metadata.ListOptions{
+		Prefix:       req.Prefix,
+		StartAfter:   req.StartAfter,
+		StartAfterID: req.StartAfterID,
+		Limit:        limit + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &TrashListResponse{
+		Bucket:  req.Bucket,
+		Prefix:  req.Prefix,
+		Entries: make([]*TrashEntry, 0, len(recs)),
+	}
+	if len(recs) > limit {
+		recs = recs[:limit]
+		resp.IsTruncated = true
+		resp.NextMarker = recs[limit-1].ObjectKey
+		resp.NextIDMarker = recs[limit-1].ID
+	}
+	for _, rec := range recs {
+		resp.Entries = append(resp.Entries, &TrashEntry{
+			ObjectInfo: *objectInfoFromRecord(rec),
+			ID:         rec.ID,
+			DeletedAt:  rec.DeletedAt,
+			PurgeAt:    rec.PurgeAt,
+		})
+	}
+	return resp, nil
+}
+
+type RestoreRequest struct {
+	Env           string
+	LogicalRegion string
+	Bucket        string
+	Key           string
+	ID            int64 // trash entry; 0 restores the latest deletion of Key
+}
+
+// Restore brings a deleted object back from the trash. It fails with
+// metadata.ErrExists when the key has been uploaded again since, and with a
+// quota error when the bucket has no room left for the object.
+func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*ObjectInfo, error) {
+	trashed, err := s.trashEntry(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.checkQuota(ctx, &PutRequest{
+		Env: req.Env, LogicalRegion: req.LogicalRegion, Bucket: req.Bucket, Key: req.Key, Size: trashed.SizeBytes,
+	}); err != nil {
+		return nil, err
+	}
+	rec, err := s.metaRepo.Restore(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.observeUsage(ctx, req.Env, req.LogicalRegion, req.Bucket)
+	return objectInfoFromRecord(rec), nil
+}
+
+// trashEntry finds the entry req restores. The key's own entries list
+// before those of longer keys it prefixes.
+func (s *Service) trashEntry(ctx context.Context, req *RestoreRequest) (*metadata.ObjectRecord, error) {
+	var found *metadata.ObjectRecord
+	opts := metadata.ListOptions{Prefix: req.Key, Limit: defaultListLimit}
+	for {
+		recs, err := s.metaRepo.ListDeleted(ctx, req.Env, req.LogicalRegion, req.Bucket, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range recs {
+			if rec.ObjectKey != req.Key {
+				return entryOrNotFound(found)
+			}
+			if req.ID == 0 || rec.ID == req.ID {
+				found = rec // entries are ordered by ID, the latest comes last
+			}
+		}
+		if len(recs) < opts.Limit {
+			return entryOrNotFound(found)
+		}
+		last := recs[len(recs)-1]
+		opts.StartAfter, opts.StartAfterID = last.ObjectKey, last.ID
+	}
+}
+
+func entryOrNotFound(rec *metadata.ObjectRecord) (*metadata.ObjectRecord, error) {
+	if rec == nil {
+		return nil, metadata.ErrNotFound
+	}
+	return rec, nil
+}
+
+// PurgeTrash permanently removes deleted objects whose retention has passed
+// and returns how many were purged. The metadata row goes first: a purge
+// racing a restore either loses the row and leaves the object alone, or
+// wins and the restore finds nothing.
+func (s *Service) PurgeTrash(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		recs, err := s.metaRepo.ListPurgeable(ctx, time.Now(), purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		for _, rec := range recs {
+			if err := s.metaRepo.DeleteRecord(ctx, rec.ID); err != nil {
+				if errors.Is(err, metadata.ErrNotFound) {
+					continue // restored meanwhile
+				}
+				return purged, err
+			}
+			s.releasePhysical(ctx, rec)
+			purged++
+		}
+		if len(recs) < purgeBatchSize || ctx.Err() != nil {
+			return purged, ctx.Err()
+		}
+	}
+}
+
+// RunTrashPurge calls PurgeTrash every interval until ctx is done.
+func (s *Service) RunTrashPurge(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if n, err := s.PurgeTrash(ctx); err != nil {
+			log.Printf("trash: purge: %v", err)
+		} else if n > 0 {
+			log.Printf("trash: purged %d object(s)", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+)
+
+func (ts *testService) trash(t *testing.T) []*TrashEntry {
+	t.Helper()
+	resp, err := ts.ListTrash(context.Background(), &ListRequest{Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket})
+	if err != nil {
+		t.Fatalf("list trash: %v", err)
+	}
+	return resp.Entries
+}
+
+func (ts *testService) restore(key string, id int64) (*ObjectInfo, error) {
+	return ts.Restore(context.Background(), &RestoreRequest{Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: key, ID: id})
+}
+
+func TestRestore(t *testing.T) {
+	ts := newTestService(t, config.RouteRule{}, config.BucketConfig{})
+	for _, step := range []struct{ key, data string }{{"k", "v1"}, {"k/sub", "sub"}, {"k", "v2"}} {
+		if _, err := ts.put(t, step.key, []byte(step.data)); err != nil {
+			t.Fatal(err)
+		}
+		ts.delete(t, step.key)
+	}
+
+	entries := ts.trash(t)
+	want := []struct {
+		key  string
+		size int64
+	}{{"k", 2}, {"k", 2}, {"k/sub", 3}}
+	if len(entries) != len(want) {
+		t.Fatalf("%d trash entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Key != want[i].key || e.Size != want[i].size || e.DeletedAt.IsZero() || !e.PurgeAt.After(e.DeletedAt) {
+			t.Errorf("entry %d = %+v, want %s of %d bytes", i, e, want[i].key, want[i].size)
+		}
+	}
+	if entries[0].ID >= entries[1].ID {
+		t.Errorf("entries of k listed as %d, %d; want oldest first", entries[0].ID, entries[1].ID)
+	}
+
+	// without an ID the latest deletion comes back
+	if _, err := ts.restore("k", 0); err != nil {
+		t.Fatalf("restore k: %v", err)
+	}
+	if got, _, err := ts.get(t, "k"); err != nil || string(got) != "v2" {
+		t.Errorf("get after restore = %q, %v; want v2", got, err)
+	}
+	if _, err := ts.restore("k", entries[0].ID); !errors.Is(err, metadata.ErrExists) {
+		t.Errorf("restore over a live key: err = %v, want ErrExists", err)
+	}
+
+	ts.delete(t, "k")
+	if _, err := ts.restore("k", entries[0].ID); err != nil {
+		t.Fatalf("restore of the first deletion: %v", err)
+	}
+	if got, _, err := ts.get(t, "k"); err != nil || string(got) != "v1" {
+		t.Errorf("get after restoring by ID = %q, %v; want v1", got, err)
+	}
+	if _, err := ts.restore("k", entries[2].ID); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("restore of another key's entry: err = %v, want ErrNotFound", err)
+	}
+	if _, err := ts.restore("missing", 0); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("restore of a key never deleted: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRestoreOverQuota(t *testing.T) {
+	tests := []struct {
+		name  string
+		quota config.QuotaConfig
+		want  error
+	}{
+		{name: "objects", quota: config.QuotaConfig{MaxObjects: 1}, want: ErrObjectQuotaExceeded},
+		{name: "bytes", quota: config.QuotaConfig{MaxBytes: 10}, want: ErrStorageQuotaExceeded},
+	}
+	for _, tt := range tests {
+		ts := newTestService(t, config.RouteRule{}, config.BucketConfig{Quota: &tt.quota})
+		if _, err := ts.put(t, "a", []byte("deleted")); err != nil {
+			t.Fatal(err)
+		}
+		ts.delete(t, "a")
+		if _, err := ts.put(t, "b", []byte("in place")); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ts.restore("a", 0); !errors.Is(err, tt.want) {
+			t.Errorf("%s: restore over quota: err = %v, want %v", tt.name, err, tt.want)
+		}
+		if entries := ts.trash(t); len(entries) != 1 {
+			t.Errorf("%s: %d trash entries after the rejected restore, want it kept", tt.name, len(entries))
+		}
+
+		ts.delete(t, "b")
+		if _, err := ts.restore("a", 0); err != nil {
+			t.Errorf("%s: restore once there is room: %v", tt.name, err)
+		}
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	ts := newTestService(t, config.RouteRule{}, config.BucketConfig{Trash: &config.TrashConfig{}})
+	for _, key := range []string{"purged", "kept"} {
+		if _, err := ts.put(t, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	physical := ts.record(t, "purged").PhysicalKey
+	ts.delete(t, "purged")
+
+	n, err := ts.PurgeTrash(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("purge = %d, %v; want 1", n, err)
+	}
+	if entries := ts.trash(t); len(entries) != 0 {
+		t.Errorf("%d trash entries after the purge", len(entries))
+	}
+	objects := ts.objects(t, "primary")
+	for _, key := range objects {
+		if key == physical {
+			t.Errorf("purged object still stored at %s", key)
+		}
+	}
+	if len(objects) != 1 {
+		t.Errorf("%d objects stored, want only kept's", len(objects))
+	}
+	if _, err := ts.restore("purged", 0); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("restore after the purge: err = %v, want ErrNotFound", err)
+	}
+	if n, err := ts.PurgeTrash(context.Background()); err != nil || n != 0 {
+		t.Errorf("second purge = %d, %v; want nothing", n, err)
+	}
+}
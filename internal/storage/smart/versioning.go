@@ -0,0 +1,132 @@
+package smart
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kenelite/smartstore/internal/metadata"
+)
+
+func (s *Service) versioned(env, region, bucket string) bool {
+	bc := s.buckets.Lookup(env, region, bucket)
+	return bc != nil && bc.Versioning
+}
+
+// lookup returns the record req reads: the latest version of the key, or
+// the version named by req.VersionID. Delete markers hold no data and read
+// as not found.
+func (s *Service) lookup(ctx context.Context, req *GetRequest) (*metadata.ObjectRecord, error) {
+	if req.VersionID == "" {
+		return s.metaRepo.GetObject(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key)
+	}
+	rec, err := s.metaRepo.GetObjectVersion(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key, req.VersionID)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Status == metadata.StatusDeleteMarker {
+		return nil, fmt.Errorf("%w: version %s is a delete marker", metadata.ErrNotFound, req.VersionID)
+	}
+	return rec, nil
+}
+
+// DeleteResult names the version a delete created or removed.
+type DeleteResult struct {
+	VersionID    string `json:"version_id,omitempty"`
+	DeleteMarker bool   `json:"delete_marker"`
+}
+
+// deleteVersion removes one version for good, bypassing the trash.
+func (s *Service) deleteVersion(ctx context.Context, req *DeleteRequest) (*DeleteResult, error) {
+	rec, err := s.metaRepo.GetObjectVersion(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key, req.VersionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLocked(rec, req.BypassGovernance, "delete"); err != nil {
+		return nil, err
+	}
+	rec, err = s.metaRepo.DeleteVersion(ctx, req.Env, req.LogicalRegion, req.Bucket, req.Key, req.VersionID)
+	if err != nil {
+		return nil, err
+	}
+	if rec.PhysicalKey != "" {
+		s.releasePhysical(ctx, rec)
+	}
+	_ = s.cache.Del(ctx, s.cacheKey(req.Env, req.Bucket, req.Key))
+	s.observeUsage(ctx, req.Env, req.LogicalRegion, req.Bucket)
+	return &DeleteResult{VersionID: rec.VersionID, DeleteMarker: rec.Status == metadata.StatusDeleteMarker}, nil
+}
+
+// addDeleteMarker hides the key of a versioned bucket behind a delete
+// marker. All versions stay readable by version ID.
+func (s *Service) addDeleteMarker(ctx context.Context, req *DeleteRequest, latest *metadata.ObjectRecord) (*DeleteResult, error) {
+	marker := &metadata.ObjectRecord{
+		Env:           req.Env,
+		LogicalRegion: req.LogicalRegion,
+		Bucket:        req.Bucket,
+		ObjectKey:     req.Key,
+		StorageClass:  latest.StorageClass,
+		StoreBackend:  latest.StoreBackend,
+		VersionID:     newWriteID(),
+		Status:        metadata.StatusDeleteMarker,
+	}
+	if err := s.metaRepo.AddVersion(ctx, marker); err != nil {
+		return nil, err
+	}
+	_ = s.cache.Del(ctx, s.cacheKey(req.Env, req.Bucket, req.Key))
+	return &DeleteResult{VersionID: marker.VersionID, DeleteMarker: true}, nil
+}
+
+// ObjectVersion is one entry of a version listing.
+type ObjectVersion struct {
+	ObjectInfo
+	IsLatest     bool `json:"is_latest"`
+	DeleteMarker bool `json:"delete_marker"`
+}
+
+type VersionListResponse struct {
+	Bucket              string           `json:"bucket"`
+	Prefix              string           `json:"prefix,omitempty"`
+	Versions            []*ObjectVersion `json:"versions"`
+	IsTruncated         bool             `json:"is_truncated"`
+	NextMarker          string           `json:"next_marker,omitempty"`
+	NextVersionIDMarker string           `json:"next_version_id_marker,omitempty"`
+}
+
+// ListVersions pages through every version and delete marker of the
+// bucket by key, newest version first. req.StartAfterVersionID continues
+// from a NextVersionIDMarker.
+func (s *Service) ListVersions(ctx context.Context, req *ListRequest) (*VersionListResponse, error) {
+	limit := req.Limit
+	if limit <= 0 || limit > maxListLimit {
+		limit = defaultListLimit
+	}
+	recs, err := s.metaRepo.ListVersions(ctx, req.Env, req.LogicalRegion, req.Bucket, metadata.ListOptions{
+		Prefix:              req.Prefix,
+		StartAfter:          req.StartAfter,
+		StartAfterVersionID: req.StartAfterVersionID,
+		Limit:               limit + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &VersionListResponse{
+		Bucket:   req.Bucket,
+		Prefix:   req.Prefix,
+		Versions: make([]*ObjectVersion, 0, len(recs)),
+	}
+	if len(recs) > limit {
+		recs = recs[:limit]
+		resp.IsTruncated = true
+		resp.NextMarker = recs[limit-1].ObjectKey
+		resp.NextVersionIDMarker = recs[limit-1].VersionID
+	}
+	for _, rec := range recs {
+		resp.Versions = append(resp.Versions, &ObjectVersion{
+			ObjectInfo:   *objectInfoFromRecord(rec),
+			IsLatest:     rec.IsLatest,
+			DeleteMarker: rec.Status == metadata.StatusDeleteMarker,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,197 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+)
+
+func newVersionedService(t *testing.T, lock *config.ObjectLockConfig) *testService {
+	t.Helper()
+	return newTestService(t, config.RouteRule{}, config.BucketConfig{Versioning: true, ObjectLock: lock})
+}
+
+func (ts *testService) getVersion(t *testing.T, key, versionID string) ([]byte, error) {
+	t.Helper()
+	resp, err := ts.Get(context.Background(), &GetRequest{Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: key, VersionID: versionID})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(resp.Body)
+	return buf.Bytes(), err
+}
+
+func (ts *testService) deleteVersion(t *testing.T, key, versionID string, bypass bool) (*DeleteResult, error) {
+	t.Helper()
+	return ts.Delete(context.Background(), &DeleteRequest{
+		Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: key, VersionID: versionID, BypassGovernance: bypass,
+	})
+}
+
+// versions lists every version of the bucket, newest first within a key.
+func (ts *testService) versions(t *testing.T) []*ObjectVersion {
+	t.Helper()
+	resp, err := ts.ListVersions(context.Background(), &ListRequest{Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket})
+	if err != nil {
+		t.Fatalf("list versions: %v", err)
+	}
+	return resp.Versions
+}
+
+func TestVersioning(t *testing.T) {
+	ts := newVersionedService(t, nil)
+	var ids []string
+	for _, data := range []string{"v1", "v2"} {
+		resp, err := ts.put(t, "k", []byte(data))
+		if err != nil {
+			t.Fatalf("put %s: %v", data, err)
+		}
+		ids = append(ids, resp.VersionID)
+	}
+	if got, _, err := ts.get(t, "k"); err != nil || string(got) != "v2" {
+		t.Errorf("get = %q, %v; want v2", got, err)
+	}
+	for i, id := range ids {
+		if got, err := ts.getVersion(t, "k", id); err != nil || string(got) != []string{"v1", "v2"}[i] {
+			t.Errorf("get version %d = %q, %v", i+1, got, err)
+		}
+	}
+	if _, err := ts.getVersion(t, "k", "no-such-version"); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("get of an unknown version: err = %v, want ErrNotFound", err)
+	}
+
+	// a delete hides the key behind a marker; the versions stay readable
+	res, err := ts.Delete(context.Background(), &DeleteRequest{Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: "k"})
+	if err != nil || !res.DeleteMarker || res.VersionID == "" {
+		t.Fatalf("delete = %+v, %v; want a delete marker", res, err)
+	}
+	marker := res.VersionID
+	if _, _, err := ts.get(t, "k"); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("get behind a delete marker: err = %v, want ErrNotFound", err)
+	}
+	if _, err := ts.getVersion(t, "k", marker); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("get of the delete marker: err = %v, want ErrNotFound", err)
+	}
+	if got, err := ts.getVersion(t, "k", ids[1]); err != nil || string(got) != "v2" {
+		t.Errorf("get v2 behind the marker = %q, %v", got, err)
+	}
+	versions := ts.versions(t)
+	want := []struct {
+		id     string
+		marker bool
+	}{{marker, true}, {ids[1], false}, {ids[0], false}}
+	if len(versions) != len(want) {
+		t.Fatalf("%d versions listed, want %d", len(versions), len(want))
+	}
+	for i, v := range versions {
+		if v.VersionID != want[i].id || v.DeleteMarker != want[i].marker || v.IsLatest != (i == 0) {
+			t.Errorf("version %d = %s marker %v latest %v, want %s marker %v latest %v",
+				i, v.VersionID, v.DeleteMarker, v.IsLatest, want[i].id, want[i].marker, i == 0)
+		}
+	}
+
+	// removing the marker brings the previous version back
+	if res, err := ts.deleteVersion(t, "k", marker, false); err != nil || !res.DeleteMarker {
+		t.Fatalf("delete of the marker = %+v, %v", res, err)
+	}
+	if got, _, err := ts.get(t, "k"); err != nil || string(got) != "v2" {
+		t.Errorf("get after removing the marker = %q, %v; want v2", got, err)
+	}
+
+	// deleting a version removes it and its object for good
+	objects := len(ts.objects(t, "primary"))
+	if res, err := ts.deleteVersion(t, "k", ids[0], false); err != nil || res.DeleteMarker || res.VersionID != ids[0] {
+		t.Fatalf("delete of v1 = %+v, %v", res, err)
+	}
+	if _, err := ts.getVersion(t, "k", ids[0]); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("get of the deleted version: err = %v, want ErrNotFound", err)
+	}
+	if n := len(ts.objects(t, "primary")); n != objects-1 {
+		t.Errorf("%d objects stored after deleting v1, want %d", n, objects-1)
+	}
+	if got, _, err := ts.get(t, "k"); err != nil || string(got) != "v2" {
+		t.Errorf("get after deleting v1 = %q, %v; want v2", got, err)
+	}
+}
+
+func TestListVersionsPaging(t *testing.T) {
+	ts := newVersionedService(t, nil)
+	for _, key := range []string{"a", "a", "b", "a"} {
+		if _, err := ts.put(t, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all := ts.versions(t)
+	if len(all) != 4 {
+		t.Fatalf("%d versions, want 4", len(all))
+	}
+
+	var paged []*ObjectVersion
+	req := &ListRequest{Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Limit: 1}
+	for i := 0; i < 10; i++ {
+		resp, err := ts.ListVersions(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, resp.Versions...)
+		if !resp.IsTruncated {
+			break
+		}
+		req.StartAfter, req.StartAfterVersionID = resp.NextMarker, resp.NextVersionIDMarker
+	}
+	if len(paged) != len(all) {
+		t.Fatalf("paged through %d versions, want %d", len(paged), len(all))
+	}
+	for i := range all {
+		if paged[i].Key != all[i].Key || paged[i].VersionID != all[i].VersionID {
+			t.Errorf("page %d = %s/%s, want %s/%s", i, paged[i].Key, paged[i].VersionID, all[i].Key, all[i].VersionID)
+		}
+	}
+}
+
+func TestDeleteVersionLocked(t *testing.T) {
+	ts := newVersionedService(t, &config.ObjectLockConfig{Mode: metadata.RetentionGovernance, Retention: time.Hour})
+	resp, err := ts.put(t, "k", []byte("retained"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := resp.VersionID
+
+	// a delete marker never removes data, so it is always allowed
+	res, err := ts.Delete(context.Background(), &DeleteRequest{Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: "k"})
+	if err != nil || !res.DeleteMarker {
+		t.Fatalf("delete = %+v, %v; want a delete marker", res, err)
+	}
+	if _, err := ts.deleteVersion(t, "k", id, false); !errors.Is(err, ErrObjectLocked) {
+		t.Errorf("delete of a retained version: err = %v, want ErrObjectLocked", err)
+	}
+
+	// a legal hold holds even against a governance bypass
+	if _, err := ts.SetLegalHold(context.Background(), &LegalHoldRequest{
+		Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: "k", VersionID: id, LegalHold: true,
+	}); err != nil {
+		t.Fatalf("legal hold: %v", err)
+	}
+	if _, err := ts.deleteVersion(t, "k", id, true); !errors.Is(err, ErrObjectLocked) {
+		t.Errorf("delete of a held version with bypass: err = %v, want ErrObjectLocked", err)
+	}
+	if _, err := ts.SetLegalHold(context.Background(), &LegalHoldRequest{
+		Env: testEnv, LogicalRegion: testRegion, Bucket: testBucket, Key: "k", VersionID: id, Admin: true,
+	}); err != nil {
+		t.Fatalf("lift legal hold: %v", err)
+	}
+
+	if _, err := ts.deleteVersion(t, "k", id, true); err != nil {
+		t.Fatalf("delete with a governance bypass: %v", err)
+	}
+	if _, err := ts.getVersion(t, "k", id); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("get of the deleted version: err = %v, want ErrNotFound", err)
+	}
+}
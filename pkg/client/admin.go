@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithAdminToken sets the bearer token sent to the gateway's /admin API.
+func WithAdminToken(token string) Option {
+	return func(c *Client) { c.adminToken = token }
+}
+
+func (c *Client) adminRequest(method, path string) *request {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(c.endpoint.Path, "/") + "/admin/" + path
+	u.RawPath = ""
+	u.RawQuery = ""
+	h := http.Header{}
+	h.Set("Authorization", "Bearer "+c.adminToken)
+	return &request{method: method, url: &u, header: h}
+}
+
+// Route is the provider location a logical bucket and storage class map to.
+type Route struct {
+	ProviderName   string `json:"provider_name"`
+	ProviderType   string `json:"provider_type"`
+	ProviderRegion string `json:"provider_region"`
+	ProviderBucket string `json:"provider_bucket"`
+}
+
+// ResolveRoute asks the gateway which route it would pick for a write.
+func (c *Client) ResolveRoute(ctx context.Context, env, region, bucket, storageClass string) (*Route, error) {
+	req := c.adminRequest(http.MethodGet, "routes/resolve")
+	q := req.url.Query()
+	q.Set("env", env)
+	q.Set("region", region)
+	q.Set("bucket", bucket)
+	q.Set("class", storageClass)
+	req.url.RawQuery = q.Encode()
+
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out Route
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode route response: %w", err)
+	}
+	return &out, nil
+}
+
+// PurgeCache evicts bucket/key from the gateway's small-object cache.
+func (c *Client) PurgeCache(ctx context.Context, bucket, key string) error {
+	resp, err := c.do(ctx, c.adminRequest(http.MethodDelete, strings.Join([]string{"cache", c.env, c.region, bucket, key}, "/")))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// QuotaStatus is a bucket's usage measured against its quota. Max values of
+// zero mean unlimited.
+type QuotaStatus struct {
+	Env               string    `json:"env"`
+	LogicalRegion     string    `json:"logical_region"`
+	Bucket            string    `json:"bucket"`
+	Bytes             int64     `json:"bytes"`
+	Objects           int64     `json:"objects"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	MaxBytes          int64     `json:"max_bytes"`
+	MaxObjects        int64     `json:"max_objects"`
+	SoftLimitPercent  int       `json:"soft_limit_percent"`
+	SoftLimitExceeded bool      `json:"soft_limit_exceeded"`
+}
+
+// Quotas lists usage and quota of every bucket known to the gateway.
+func (c *Client) Quotas(ctx context.Context) ([]QuotaStatus, error) {
+	return c.quotas(ctx, c.adminRequest(http.MethodGet, "quotas"))
+}
+
+// RecomputeQuotas rebuilds bucket usage from object metadata and returns
+// the corrected figures.
+func (c *Client) RecomputeQuotas(ctx context.Context) ([]QuotaStatus, error) {
+	return c.quotas(ctx, c.adminRequest(http.MethodPost, "quotas/recompute"))
+}
+
+func (c *Client) quotas(ctx context.Context, req *request) ([]QuotaStatus, error) {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Buckets []QuotaStatus `json:"buckets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode quotas response: %w", err)
+	}
+	return out.Buckets, nil
+}
+
+// Quota reports usage and quota of one bucket.
+func (c *Client) Quota(ctx context.Context, bucket string) (*QuotaStatus, error) {
+	resp, err := c.do(ctx, c.adminRequest(http.MethodGet, strings.Join([]string{"quotas", c.env, c.region, bucket}, "/")))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out QuotaStatus
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode quota response: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,156 @@
+// Package client is the Go SDK for the SmartStore gateway HTTP API
+// (/v1/{env}/{region}/{bucket}/{key}).
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client talks to a single gateway endpoint, scoped to one env and logical
+// region. It is safe for concurrent use.
+type Client struct {
+	endpoint      *url.URL
+	env           string
+	region        string
+	httpClient    *http.Client
+	maxRetries    int
+	retryBackoff  time.Duration
+	presignSecret string
+	adminToken    string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetries sets how many times a request failing with a 5xx status or a
+// transport error is retried, and the base backoff that doubles per attempt.
+func WithRetries(max int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = max
+		c.retryBackoff = backoff
+	}
+}
+
+// WithPresignSecret sets the key shared with the gateway's
+// http.presign_secret, required by the Presign helpers.
+func WithPresignSecret(secret string) Option {
+	return func(c *Client) { c.presignSecret = secret }
+}
+
+// New creates a client for endpoint (e.g. "http://localhost:8080").
+func New(endpoint, env, region string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("endpoint %q must include scheme and host", endpoint)
+	}
+	if env == "" || region == "" {
+		return nil, errors.New("env and region are required")
+	}
+	c := &Client{
+		endpoint:     u,
+		env:          env,
+		region:       region,
+		httpClient:   http.DefaultClient,
+		maxRetries:   3,
+		retryBackoff: 100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// objectURL builds the URL of bucket/key; an empty key addresses the bucket.
+// Only Path is set so the key is escaped the same way the gateway
+// re-escapes it when checking presigned signatures.
+func (c *Client) objectURL(bucket, key string) *url.URL {
+	segs := []string{c.env, c.region, bucket}
+	if key != "" {
+		segs = append(segs, key)
+	}
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(c.endpoint.Path, "/") + "/v1/" + strings.Join(segs, "/")
+	u.RawPath = ""
+	u.RawQuery = ""
+	return &u
+}
+
+type request struct {
+	method string
+	url    *url.URL
+	header http.Header
+	body   io.Reader
+	size   int64 // -1 when unknown
+}
+
+// do sends r, retrying on transport errors and 5xx responses other than
+// 507, which reports an exhausted bucket quota. A body can
+// only be resent when it implements io.Seeker; otherwise the first failure
+// is returned. Non-2xx responses are converted into *Error.
+func (c *Client) do(ctx context.Context, r *request) (*http.Response, error) {
+	seeker, canSeek := r.body.(io.Seeker)
+	var start int64
+	if canSeek {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			canSeek = false
+		}
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, r.method, r.url.String(), r.body)
+		if err != nil {
+			return nil, err
+		}
+		for k, vs := range r.header {
+			req.Header[k] = vs
+		}
+		if r.body != nil && r.size >= 0 {
+			req.ContentLength = r.size
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err == nil && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		callErr := err
+		retryable := true
+		if err == nil {
+			callErr = errorFromResponse(resp)
+			retryable = resp.StatusCode >= 500 && resp.StatusCode != http.StatusInsufficientStorage
+		}
+		if !retryable || attempt >= c.maxRetries || ctx.Err() != nil {
+			return nil, callErr
+		}
+		if r.body != nil {
+			if !canSeek {
+				return nil, callErr
+			}
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, callErr
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
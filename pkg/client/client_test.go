@@ -0,0 +1,330 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	apihttp "github.com/kenelite/smartstore/internal/api/http"
+	"github.com/kenelite/smartstore/internal/config"
+	"github.com/kenelite/smartstore/internal/metadata"
+	"github.com/kenelite/smartstore/internal/storage/objectstore"
+	"github.com/kenelite/smartstore/internal/storage/smart"
+	"github.com/kenelite/smartstore/pkg/client"
+)
+
+const adminToken = "test-admin-token"
+
+// newTestClient starts a gateway and returns a client for it.
+func newTestClient(t *testing.T, opts ...client.Option) *client.Client {
+	t.Helper()
+	return newClient(t, newTestGateway(t), opts...)
+}
+
+// newTestGateway starts a gateway over in-memory metadata and a memory
+// provider, routing buckets "b" and "limited", and returns its URL.
+func newTestGateway(t *testing.T) string {
+	t.Helper()
+	cfg := config.ObjectStorageConfig{
+		Providers: []config.ProviderConfig{{Name: "mem", Type: config.ProviderMemory}},
+	}
+	for _, bucket := range []string{"b", "limited"} {
+		cfg.Routes = append(cfg.Routes, config.RouteRule{
+			Env: "dev", LogicalRegion: "r1", Bucket: bucket, StorageClass: "HOT",
+			ProviderName: "mem", ProviderBucket: "pb-" + bucket,
+		})
+	}
+	reg := objectstore.NewProviderRegistry()
+	reg.Register("mem", objectstore.NewMemoryAdapter())
+	svc := smart.NewService(nil, metadata.NewInMemoryRepository(), objectstore.NewStaticRouter(cfg), reg,
+		smart.WithBucketConfigs(config.BucketConfigs{
+			{Bucket: "b"},
+			{
+				Bucket: "limited",
+				Quota:  &config.QuotaConfig{MaxObjects: 1},
+				Policy: &config.UploadPolicyConfig{KeyPattern: `[a-z]+`},
+			},
+		}))
+
+	r := chi.NewRouter()
+	apihttp.NewHandler(svc, apihttp.WithAdminToken(adminToken)).RegisterRoutes(r)
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func newClient(t *testing.T, endpoint string, opts ...client.Option) *client.Client {
+	t.Helper()
+	c, err := client.New(endpoint, "dev", "r1", append([]client.Option{client.WithRetries(0, 0)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPutGetHeadDelete(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	body := "hello, smartstore"
+	put, err := c.Put(ctx, "b", "dir/hello.txt", strings.NewReader(body), int64(len(body)), &client.PutOptions{
+		ContentType: "text/plain",
+		Tags:        map[string]string{"team": "core"},
+	})
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if put.Size != int64(len(body)) || put.ETag == "" {
+		t.Fatalf("put result = %+v", put)
+	}
+
+	obj, err := c.Get(ctx, "b", "dir/hello.txt")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, err := io.ReadAll(obj.Body)
+	obj.Body.Close()
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if string(data) != body {
+		t.Errorf("get body = %q, want %q", data, body)
+	}
+	if obj.ContentType != "text/plain" {
+		t.Errorf("get content type = %q", obj.ContentType)
+	}
+
+	info, err := c.Head(ctx, "b", "dir/hello.txt")
+	if err != nil {
+		t.Fatalf("head: %v", err)
+	}
+	if info.Size != int64(len(body)) || info.ContentType != "text/plain" || info.Status != "ACTIVE" {
+		t.Errorf("head = %+v", info)
+	}
+	if info.Tags["team"] != "core" {
+		t.Errorf("head tags = %v", info.Tags)
+	}
+
+	if err := c.Delete(ctx, "b", "dir/hello.txt"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := c.Get(ctx, "b", "dir/hello.txt"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("get after delete: err = %v, want ErrNotFound", err)
+	}
+	if _, err := c.Head(ctx, "b", "dir/hello.txt"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("head after delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("logs/%02d", i)
+		want = append(want, key)
+		if _, err := c.Put(ctx, "b", key, strings.NewReader(key), int64(len(key)), nil); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	if _, err := c.Put(ctx, "b", "other", strings.NewReader("x"), 1, nil); err != nil {
+		t.Fatalf("put other: %v", err)
+	}
+
+	var got []string
+	opts := &client.ListOptions{Prefix: "logs/", Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("list did not finish")
+		}
+		page, err := c.List(ctx, "b", opts)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if len(page.Objects) > 2 {
+			t.Fatalf("page of %d objects, limit 2", len(page.Objects))
+		}
+		for _, obj := range page.Objects {
+			got = append(got, obj.Key)
+		}
+		if !page.IsTruncated {
+			break
+		}
+		opts.Marker = page.NextMarker
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("paged keys = %v, want %v", got, want)
+	}
+
+	var all []string
+	err := c.ListAll(ctx, "b", "", func(obj *client.ObjectInfo) error {
+		all = append(all, obj.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("list all: %v", err)
+	}
+	if len(all) != 6 {
+		t.Errorf("list all = %v, want 6 keys", all)
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	admin := newTestClient(t, client.WithAdminToken(adminToken))
+
+	if _, err := c.Put(ctx, "limited", "first", strings.NewReader("1"), 1, nil); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if _, err := c.Put(ctx, "b", "held", strings.NewReader("1"), 1, nil); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if _, err := c.SetLegalHold(ctx, "b", "held", "", true); err != nil {
+		t.Fatalf("legal hold: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		call   func() error
+		status int
+		code   string
+		is     error
+	}{
+		{
+			name: "missing key",
+			call: func() error {
+				_, err := c.Get(ctx, "b", "missing")
+				return err
+			},
+			status: http.StatusNotFound, code: client.CodeNoSuchKey, is: client.ErrNotFound,
+		},
+		{
+			name: "unknown route",
+			call: func() error {
+				_, err := admin.ResolveRoute(ctx, "dev", "r1", "nope", "HOT")
+				return err
+			},
+			status: http.StatusNotFound, code: client.CodeNoSuchRoute, is: client.ErrNotFound,
+		},
+		{
+			name: "key not allowed",
+			call: func() error {
+				_, err := c.Put(ctx, "limited", "Bad-Key", strings.NewReader("1"), 1, nil)
+				return err
+			},
+			status: http.StatusBadRequest, code: client.CodeInvalidKey, is: client.ErrInvalidRequest,
+		},
+		{
+			name: "object quota",
+			call: func() error {
+				_, err := c.Put(ctx, "limited", "second", strings.NewReader("1"), 1, nil)
+				return err
+			},
+			status: http.StatusForbidden, code: client.CodeObjectQuotaExceeded, is: client.ErrQuotaExceeded,
+		},
+		{
+			name: "legal hold",
+			call: func() error {
+				return c.Delete(ctx, "b", "held")
+			},
+			status: http.StatusForbidden, code: client.CodeObjectLocked, is: client.ErrObjectLocked,
+		},
+		{
+			name: "no admin token",
+			call: func() error {
+				_, err := c.CompactPacks(ctx, true)
+				return err
+			},
+			status: http.StatusUnauthorized, code: client.CodeAccessDenied, is: client.ErrAccessDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			var apiErr *client.Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want *client.Error", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Code != tt.code {
+				t.Errorf("err = %d %s, want %d %s", apiErr.StatusCode, apiErr.Code, tt.status, tt.code)
+			}
+			if !errors.Is(err, tt.is) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.is)
+			}
+		})
+	}
+}
+
+func TestLiftLegalHoldNeedsAdmin(t *testing.T) {
+	ctx := context.Background()
+	gw := newTestGateway(t)
+	c := newClient(t, gw)
+	admin := newClient(t, gw, client.WithAdminToken(adminToken))
+
+	if _, err := c.Put(ctx, "b", "held", strings.NewReader("1"), 1, &client.PutOptions{
+		Lock: &client.ObjectLock{LegalHold: true},
+	}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if _, err := c.SetLegalHold(ctx, "b", "held", "", false); !errors.Is(err, client.ErrAccessDenied) {
+		t.Fatalf("lift without admin token: err = %v, want ErrAccessDenied", err)
+	}
+	if err := c.Delete(ctx, "b", "held"); !errors.Is(err, client.ErrObjectLocked) {
+		t.Fatalf("delete under hold: err = %v, want ErrObjectLocked", err)
+	}
+
+	lock, err := admin.SetLegalHold(ctx, "b", "held", "", false)
+	if err != nil {
+		t.Fatalf("lift with admin token: %v", err)
+	}
+	if lock.LegalHold {
+		t.Errorf("lock after lift = %+v", lock)
+	}
+	if err := c.Delete(ctx, "b", "held"); err != nil {
+		t.Errorf("delete after lift: %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"etag":"e","size":%d}`, len(body))
+	}))
+	defer ts.Close()
+
+	c, err := client.New(ts.URL, "dev", "r1", client.WithRetries(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	put, err := c.Put(context.Background(), "b", "k", strings.NewReader("abc"), 3, nil)
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if calls.Load() != 3 || put.Size != 3 {
+		t.Errorf("calls = %d, size = %d; want 3 calls resending the whole body", calls.Load(), put.Size)
+	}
+
+	calls.Store(0)
+	c, _ = client.New(ts.URL, "dev", "r1", client.WithRetries(1, time.Millisecond))
+	_, err = c.Put(context.Background(), "b", "k", strings.NewReader("abc"), 3, nil)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("err = %v, want 503 after the retries run out", err)
+	}
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Error codes returned by the gateway; they mirror the server's apihttp
+// constants.
+const (
+	CodeNoSuchKey      = "NoSuchKey"
+	CodeNoSuchRoute    = "NoSuchRoute"
+	CodeInvalidRequest = "InvalidRequest"
+	CodeAccessDenied   = "AccessDenied"
+	CodeInternalError  = "InternalError"
+
+	CodeTransformNotAllowed = "TransformNotAllowed"
+	CodeUnsupportedMedia    = "UnsupportedMediaType"
+	CodeEntityTooLarge      = "EntityTooLarge"
+	CodeUploadRejected      = "UploadRejected"
+	CodeQuarantined         = "Quarantined"
+	CodeObjectQuarantined   = "ObjectQuarantined"
+	CodeInspectionFailed    = "InspectionFailed"
+	CodeQuotaExceeded       = "QuotaExceeded"
+	CodeObjectQuotaExceeded = "ObjectQuotaExceeded"
+	CodeEntityTooSmall      = "EntityTooSmall"
+	CodeInvalidKey          = "InvalidKey"
+	CodeObjectExists        = "ObjectExists"
+	CodeObjectLocked        = "ObjectLocked"
+	CodeServiceUnavailable  = "ServiceUnavailable"
+)
+
+// Sentinel errors matched by *Error via errors.Is.
+var (
+	ErrNotFound       = errors.New("smartstore: object not found")
+	ErrInvalidRequest = errors.New("smartstore: invalid request")
+	ErrAccessDenied   = errors.New("smartstore: access denied")
+	ErrQuotaExceeded  = errors.New("smartstore: bucket quota exceeded")
+	ErrObjectExists   = errors.New("smartstore: object already exists")
+	ErrObjectLocked   = errors.New("smartstore: object is locked")
+)
+
+// Error is a non-2xx response from the gateway.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("smartstore: http %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("smartstore: %s (http %d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Code == CodeNoSuchKey || e.Code == CodeNoSuchRoute || e.StatusCode == http.StatusNotFound
+	case ErrInvalidRequest:
+		return e.Code == CodeInvalidRequest || e.Code == CodeInvalidKey || e.Code == CodeEntityTooSmall
+	case ErrAccessDenied:
+		return e.Code == CodeAccessDenied || e.StatusCode == http.StatusForbidden || e.StatusCode == http.StatusUnauthorized
+	case ErrObjectExists:
+		return e.Code == CodeObjectExists
+	case ErrObjectLocked:
+		return e.Code == CodeObjectLocked
+	case ErrQuotaExceeded:
+		return e.Code == CodeQuotaExceeded || e.Code == CodeObjectQuotaExceeded
+	}
+	return false
+}
+
+// errorFromResponse reads and closes resp.Body. HEAD responses carry no body,
+// so only the status code is available for them.
+func errorFromResponse(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	e := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var body struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		e.Message = body.Error
+		e.Code = body.Code
+	}
+	return e
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// OrphanEntry is a provider object no metadata record points to.
+type OrphanEntry struct {
+	Provider       string    `json:"provider"`
+	ProviderBucket string    `json:"provider_bucket"`
+	PhysicalKey    string    `json:"physical_key"`
+	Size           int64     `json:"size"`
+	LastModified   time.Time `json:"last_modified"`
+	Error          string    `json:"error,omitempty"`
+}
+
+type OrphanReport struct {
+	DryRun      bool           `json:"dry_run"`
+	StartedAt   time.Time      `json:"started_at"`
+	Grace       string         `json:"grace"`
+	Listed      int            `json:"listed"`
+	Orphans     int            `json:"orphans"`
+	OrphanBytes int64          `json:"orphan_bytes"`
+	Deleted     int            `json:"deleted"`
+	Failed      int            `json:"failed"`
+	Entries     []*OrphanEntry `json:"entries"`
+	Truncated   bool           `json:"truncated"`
+}
+
+// CollectOrphans asks the gateway to delete provider objects older than its
+// grace period that no metadata points to. With dryRun it only reports
+// them. It needs the admin token.
+func (c *Client) CollectOrphans(ctx context.Context, dryRun bool) (*OrphanReport, error) {
+	req := c.adminRequest(http.MethodPost, "gc/orphans")
+	if dryRun {
+		req.url.RawQuery = "dry_run=true"
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out OrphanReport
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode gc response: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,251 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	ContentType  string            `json:"content_type,omitempty"`
+	StorageClass string            `json:"storage_class"`
+	ETag         string            `json:"etag"`
+	Version      int64             `json:"version"`
+	VersionID    string            `json:"version_id"`
+	LastModified time.Time         `json:"last_modified"`
+	Status       string            `json:"status"` // ACTIVE or QUARANTINED
+	Lock         *ObjectLock       `json:"lock,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+type PutOptions struct {
+	ContentType  string
+	StorageClass string // HOT/COLD/ARCHIVE; the gateway defaults to HOT
+	// Tags are matched by the bucket's lifecycle rules. Copies keep the
+	// source's tags when nil.
+	Tags map[string]string
+
+	// Lock overrides the bucket's default retention for the new object.
+	Lock *ObjectLock
+	// BypassGovernance replaces an object under governance retention. It
+	// needs the admin token.
+	BypassGovernance bool
+}
+
+type PutResult struct {
+	ETag      string `json:"etag"`
+	Backend   string `json:"backend"`
+	Size      int64  `json:"size"`
+	VersionID string `json:"version_id"`
+}
+
+// Put uploads body as bucket/key. size must be the exact body length, or -1
+// to stream with chunked encoding. Retries require body to be an io.Seeker.
+func (c *Client) Put(ctx context.Context, bucket, key string, body io.Reader, size int64, opts *PutOptions) (*PutResult, error) {
+	h := http.Header{}
+	if opts != nil {
+		if opts.ContentType != "" {
+			h.Set("Content-Type", opts.ContentType)
+		}
+		if opts.StorageClass != "" {
+			h.Set("X-Storage-Class", opts.StorageClass)
+		}
+		setLockHeaders(h, opts.Lock)
+		setTaggingHeader(h, opts.Tags)
+		if opts.BypassGovernance {
+			c.setBypass(h)
+		}
+	}
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPut,
+		url:    c.objectURL(bucket, key),
+		header: h,
+		body:   body,
+		size:   size,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out PutResult
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode put response: %w", err)
+	}
+	return &out, nil
+}
+
+// Object is a streamed object body. Callers must close Body.
+type Object struct {
+	Size        int64
+	ContentType string
+	ETag        string
+	Body        io.ReadCloser
+	ServedFrom  string // "cache" or the provider/bucket the gateway read from
+}
+
+func (c *Client) Get(ctx context.Context, bucket, key string) (*Object, error) {
+	return c.get(ctx, bucket, key, "")
+}
+
+func (c *Client) get(ctx context.Context, bucket, key, versionID string) (*Object, error) {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodGet,
+		url:    c.versionURL(bucket, key, versionID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+		ServedFrom:  resp.Header.Get("X-Served-From"),
+		Body:        resp.Body,
+	}, nil
+}
+
+func (c *Client) Head(ctx context.Context, bucket, key string) (*ObjectInfo, error) {
+	return c.head(ctx, bucket, key, "")
+}
+
+func (c *Client) head(ctx context.Context, bucket, key, versionID string) (*ObjectInfo, error) {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodHead,
+		url:    c.versionURL(bucket, key, versionID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	info := &ObjectInfo{
+		Key:          key,
+		Size:         resp.ContentLength,
+		ContentType:  resp.Header.Get("Content-Type"),
+		StorageClass: resp.Header.Get("X-Storage-Class"),
+		ETag:         resp.Header.Get("ETag"),
+		Status:       resp.Header.Get("X-Object-Status"),
+		VersionID:    resp.Header.Get("X-Version-Id"),
+	}
+	info.Version, _ = strconv.ParseInt(resp.Header.Get("X-Object-Version"), 10, 64)
+	info.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	info.Lock = lockFromHeaders(resp.Header)
+	info.Tags = tagsFromHeader(resp.Header)
+	return info, nil
+}
+
+// Delete moves bucket/key to the trash, or in a versioned bucket hides it
+// behind a delete marker.
+func (c *Client) Delete(ctx context.Context, bucket, key string) error {
+	_, err := c.DeleteVersion(ctx, bucket, key, "")
+	return err
+}
+
+type ListOptions struct {
+	Prefix string
+	Marker string // list keys after this one
+	Limit  int
+}
+
+type ListResult struct {
+	Bucket      string        `json:"bucket"`
+	Prefix      string        `json:"prefix,omitempty"`
+	Objects     []*ObjectInfo `json:"objects"`
+	IsTruncated bool          `json:"is_truncated"`
+	NextMarker  string        `json:"next_marker,omitempty"`
+}
+
+// List returns one page of objects. Pass NextMarker back as Marker to fetch
+// the next page while IsTruncated is set.
+func (c *Client) List(ctx context.Context, bucket string, opts *ListOptions) (*ListResult, error) {
+	u := c.objectURL(bucket, "")
+	if opts != nil {
+		q := u.Query()
+		if opts.Prefix != "" {
+			q.Set("prefix", opts.Prefix)
+		}
+		if opts.Marker != "" {
+			q.Set("marker", opts.Marker)
+		}
+		if opts.Limit > 0 {
+			q.Set("limit", strconv.Itoa(opts.Limit))
+		}
+		u.RawQuery = q.Encode()
+	}
+	resp, err := c.do(ctx, &request{method: http.MethodGet, url: u})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out ListResult
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode list response: %w", err)
+	}
+	return &out, nil
+}
+
+// ListAll pages through every object under prefix and calls fn for each.
+func (c *Client) ListAll(ctx context.Context, bucket, prefix string, fn func(*ObjectInfo) error) error {
+	opts := &ListOptions{Prefix: prefix}
+	for {
+		page, err := c.List(ctx, bucket, opts)
+		if err != nil {
+			return err
+		}
+		for _, obj := range page.Objects {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated {
+			return nil
+		}
+		opts.Marker = page.NextMarker
+	}
+}
+
+// Copy copies srcBucket/srcKey to dstBucket/dstKey within the client's env
+// and region. Content type, storage class and tags are kept unless set in
+// opts.
+func (c *Client) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, opts *PutOptions) (*PutResult, error) {
+	h := http.Header{}
+	h.Set("X-Copy-Source", "/"+strings.Join([]string{c.env, c.region, srcBucket, srcKey}, "/"))
+	if opts != nil {
+		if opts.ContentType != "" {
+			h.Set("Content-Type", opts.ContentType)
+		}
+		if opts.StorageClass != "" {
+			h.Set("X-Storage-Class", opts.StorageClass)
+		}
+		setLockHeaders(h, opts.Lock)
+		setTaggingHeader(h, opts.Tags)
+		if opts.BypassGovernance {
+			c.setBypass(h)
+		}
+	}
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPut,
+		url:    c.objectURL(dstBucket, dstKey),
+		header: h,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out PutResult
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode copy response: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PackCompaction is one pack deleted or rewritten by a compaction run.
+type PackCompaction struct {
+	ID             int64  `json:"id"`
+	Env            string `json:"env"`
+	LogicalRegion  string `json:"logical_region"`
+	Bucket         string `json:"bucket"`
+	ProviderBucket string `json:"provider_bucket"`
+	PhysicalKey    string `json:"physical_key"`
+	Action         string `json:"action"` // delete or rewrite
+	SizeBytes      int64  `json:"size"`
+	LiveEntries    int    `json:"live_entries"`
+	LiveBytes      int64  `json:"live_bytes"`
+	NewPackID      int64  `json:"new_pack_id,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+type PackCompactionReport struct {
+	DryRun         bool              `json:"dry_run"`
+	StartedAt      time.Time         `json:"started_at"`
+	Scanned        int               `json:"scanned"`
+	Deleted        int               `json:"deleted"`
+	Rewritten      int               `json:"rewritten"`
+	Failed         int               `json:"failed"`
+	ReclaimedBytes int64             `json:"reclaimed_bytes"`
+	Packs          []*PackCompaction `json:"packs"`
+	Truncated      bool              `json:"truncated"`
+}
+
+// CompactPacks asks the gateway to delete empty packs and rewrite those
+// holding mostly deleted objects now. With dryRun nothing changes and the
+// report lists what would be compacted. It needs the admin token.
+func (c *Client) CompactPacks(ctx context.Context, dryRun bool) (*PackCompactionReport, error) {
+	req := c.adminRequest(http.MethodPost, "packs/compact")
+	if dryRun {
+		req.url.RawQuery = "dry_run=true"
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out PackCompactionReport
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode pack compaction response: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kenelite/smartstore/internal/presign"
+)
+
+var errNoPresignSecret = errors.New("smartstore: presign secret not configured")
+
+// PresignGet returns a URL that downloads bucket/key until ttl elapses.
+func (c *Client) PresignGet(bucket, key string, ttl time.Duration) (string, error) {
+	return c.presign(http.MethodGet, bucket, key, ttl)
+}
+
+// PresignPut returns a URL that uploads bucket/key until ttl elapses.
+func (c *Client) PresignPut(bucket, key string, ttl time.Duration) (string, error) {
+	return c.presign(http.MethodPut, bucket, key, ttl)
+}
+
+func (c *Client) presign(method, bucket, key string, ttl time.Duration) (string, error) {
+	if c.presignSecret == "" {
+		return "", errNoPresignSecret
+	}
+	u := c.objectURL(bucket, key)
+	presign.Sign(c.presignSecret, method, u, time.Now().Add(ttl))
+	return u.String(), nil
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RebalanceMove is one object moved from a fallback back to its route's
+// provider.
+type RebalanceMove struct {
+	Env           string `json:"env"`
+	LogicalRegion string `json:"logical_region"`
+	Bucket        string `json:"bucket"`
+	Key           string `json:"key"`
+	VersionID     string `json:"version_id"`
+	From          string `json:"from"` // provider/bucket
+	To            string `json:"to"`
+	Error         string `json:"error,omitempty"`
+}
+
+type RebalanceReport struct {
+	DryRun    bool             `json:"dry_run"`
+	StartedAt time.Time        `json:"started_at"`
+	Found     int              `json:"found"`
+	Moved     int              `json:"moved"`
+	Skipped   int              `json:"skipped"`
+	Failed    int              `json:"failed"`
+	Moves     []*RebalanceMove `json:"moves"`
+	Truncated bool             `json:"truncated"`
+}
+
+// Rebalance asks the gateway to move objects that writes stored at a
+// fallback back to their route's provider now. With dryRun nothing changes
+// and the report lists what would move. It needs the admin token.
+func (c *Client) Rebalance(ctx context.Context, dryRun bool) (*RebalanceReport, error) {
+	req := c.adminRequest(http.MethodPost, "rebalance/run")
+	if dryRun {
+		req.url.RawQuery = "dry_run=true"
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out RebalanceReport
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode rebalance response: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Replica statuses.
+const (
+	ReplicaPending   = "PENDING"
+	ReplicaCompleted = "COMPLETED"
+	ReplicaFailed    = "FAILED"
+	ReplicaDeleting  = "DELETING"
+)
+
+// Replica is the copy of an object version in one replica target.
+type Replica struct {
+	ID                 int64     `json:"id"`
+	Env                string    `json:"env"`
+	LogicalRegion      string    `json:"logical_region"`
+	Bucket             string    `json:"bucket"`
+	Key                string    `json:"key"`
+	VersionID          string    `json:"version_id"`
+	Size               int64     `json:"size"`
+	ContentType        string    `json:"content_type"`
+	StorageClass       string    `json:"storage_class"`
+	SourceProvider     string    `json:"source_provider"`
+	SourceBucket       string    `json:"source_bucket"`
+	PhysicalKey        string    `json:"physical_key"`
+	TargetProvider     string    `json:"target_provider"`
+	TargetProviderType string    `json:"target_provider_type"`
+	TargetRegion       string    `json:"target_region"`
+	TargetBucket       string    `json:"target_bucket"`
+	Status             string    `json:"status"`
+	ETag               string    `json:"etag,omitempty"`
+	Attempts           int       `json:"attempts"`
+	LastError          string    `json:"last_error,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	NextAttemptAt      time.Time `json:"next_attempt_at"`
+	ReplicatedAt       time.Time `json:"replicated_at,omitempty"`
+}
+
+// ListReplicas reports where an object version has been replicated to.
+// An empty versionID means the latest version. It needs the admin token.
+func (c *Client) ListReplicas(ctx context.Context, bucket, key, versionID string) ([]Replica, error) {
+	req := c.adminRequest(http.MethodGet, strings.Join([]string{"replicas", c.env, c.region, bucket, key}, "/"))
+	if versionID != "" {
+		req.url.RawQuery = url.Values{"versionId": {versionID}}.Encode()
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Replicas []Replica `json:"replicas"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode replicas response: %w", err)
+	}
+	return out.Replicas, nil
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TrashEntry is a deleted object that can still be restored. A key deleted
+// several times has one entry per deletion, told apart by ID.
+type TrashEntry struct {
+	ObjectInfo
+	ID        int64     `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+type TrashListOptions struct {
+	Prefix   string
+	Marker   string // with IDMarker, list entries after this one
+	IDMarker int64
+	Limit    int
+}
+
+type TrashListResult struct {
+	Bucket       string        `json:"bucket"`
+	Prefix       string        `json:"prefix,omitempty"`
+	Entries      []*TrashEntry `json:"entries"`
+	IsTruncated  bool          `json:"is_truncated"`
+	NextMarker   string        `json:"next_marker,omitempty"`
+	NextIDMarker int64         `json:"next_id_marker,omitempty"`
+}
+
+// ListTrash returns one page of the bucket's deleted objects. Pass
+// NextMarker and NextIDMarker back to fetch the next page.
+func (c *Client) ListTrash(ctx context.Context, bucket string, opts *TrashListOptions) (*TrashListResult, error) {
+	u := c.objectURL(bucket, "")
+	q := u.Query()
+	q.Set("trash", "")
+	if opts != nil {
+		if opts.Prefix != "" {
+			q.Set("prefix", opts.Prefix)
+		}
+		if opts.Marker != "" {
+			q.Set("marker", opts.Marker)
+		}
+		if opts.IDMarker != 0 {
+			q.Set("id_marker", strconv.FormatInt(opts.IDMarker, 10))
+		}
+		if opts.Limit > 0 {
+			q.Set("limit", strconv.Itoa(opts.Limit))
+		}
+	}
+	u.RawQuery = q.Encode()
+	resp, err := c.do(ctx, &request{method: http.MethodGet, url: u})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out TrashListResult
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode trash response: %w", err)
+	}
+	return &out, nil
+}
+
+// Restore brings a deleted object back. id selects a trash entry; 0 picks
+// the most recent deletion of key. ErrObjectExists is returned when key has
+// been uploaded again since.
+func (c *Client) Restore(ctx context.Context, bucket, key string, id int64) (*ObjectInfo, error) {
+	u := c.objectURL(bucket, key)
+	q := u.Query()
+	q.Set("restore", "")
+	if id != 0 {
+		q.Set("id", strconv.FormatInt(id, 10))
+	}
+	u.RawQuery = q.Encode()
+	resp, err := c.do(ctx, &request{method: http.MethodPost, url: u})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out ObjectInfo
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode restore response: %w", err)
+	}
+	return &out, nil
+}
+
+// PurgeTrash asks the gateway to remove expired trash entries now and
+// returns how many were purged. It needs the admin token.
+func (c *Client) PurgeTrash(ctx context.Context) (int, error) {
+	resp, err := c.do(ctx, c.adminRequest(http.MethodPost, "trash/purge"))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Purged int `json:"purged"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, fmt.Errorf("decode purge response: %w", err)
+	}
+	return out.Purged, nil
+}
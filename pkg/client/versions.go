@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// versionURL addresses one version of an object; an empty versionID
+// addresses the latest.
+func (c *Client) versionURL(bucket, key, versionID string) *url.URL {
+	u := c.objectURL(bucket, key)
+	if versionID != "" {
+		q := u.Query()
+		q.Set("versionId", versionID)
+		u.RawQuery = q.Encode()
+	}
+	return u
+}
+
+// GetVersion fetches one version of an object. Delete markers read as
+// ErrNotFound.
+func (c *Client) GetVersion(ctx context.Context, bucket, key, versionID string) (*Object, error) {
+	return c.get(ctx, bucket, key, versionID)
+}
+
+// HeadVersion returns the metadata of one version of an object.
+func (c *Client) HeadVersion(ctx context.Context, bucket, key, versionID string) (*ObjectInfo, error) {
+	return c.head(ctx, bucket, key, versionID)
+}
+
+// DeleteResult names the version a delete created or removed.
+type DeleteResult struct {
+	VersionID    string
+	DeleteMarker bool
+}
+
+// DeleteVersion removes one version of an object for good. With an empty
+// versionID it behaves like Delete and reports the delete marker it added
+// in a versioned bucket.
+func (c *Client) DeleteVersion(ctx context.Context, bucket, key, versionID string) (*DeleteResult, error) {
+	return c.deleteVersion(ctx, bucket, key, versionID, false)
+}
+
+func (c *Client) deleteVersion(ctx context.Context, bucket, key, versionID string, bypass bool) (*DeleteResult, error) {
+	h := http.Header{}
+	if bypass {
+		c.setBypass(h)
+	}
+	resp, err := c.do(ctx, &request{
+		method: http.MethodDelete,
+		url:    c.versionURL(bucket, key, versionID),
+		header: h,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return &DeleteResult{
+		VersionID:    resp.Header.Get("X-Version-Id"),
+		DeleteMarker: resp.Header.Get("X-Delete-Marker") == "true",
+	}, nil
+}
+
+// ObjectVersion is one version or delete marker of a key.
+type ObjectVersion struct {
+	ObjectInfo
+	IsLatest     bool `json:"is_latest"`
+	DeleteMarker bool `json:"delete_marker"`
+}
+
+type VersionListOptions struct {
+	Prefix          string
+	Marker          string // with VersionIDMarker, list versions after this one
+	VersionIDMarker string
+	Limit           int
+}
+
+type VersionListResult struct {
+	Bucket              string           `json:"bucket"`
+	Prefix              string           `json:"prefix,omitempty"`
+	Versions            []*ObjectVersion `json:"versions"`
+	IsTruncated         bool             `json:"is_truncated"`
+	NextMarker          string           `json:"next_marker,omitempty"`
+	NextVersionIDMarker string           `json:"next_version_id_marker,omitempty"`
+}
+
+// ListVersions returns one page of the bucket's versions, newest first
+// within a key. Pass NextMarker and NextVersionIDMarker back to fetch the
+// next page.
+func (c *Client) ListVersions(ctx context.Context, bucket string, opts *VersionListOptions) (*VersionListResult, error) {
+	u := c.objectURL(bucket, "")
+	q := u.Query()
+	q.Set("versions", "")
+	if opts != nil {
+		if opts.Prefix != "" {
+			q.Set("prefix", opts.Prefix)
+		}
+		if opts.Marker != "" {
+			q.Set("marker", opts.Marker)
+		}
+		if opts.VersionIDMarker != "" {
+			q.Set("version_id_marker", opts.VersionIDMarker)
+		}
+		if opts.Limit > 0 {
+			q.Set("limit", strconv.Itoa(opts.Limit))
+		}
+	}
+	u.RawQuery = q.Encode()
+	resp, err := c.do(ctx, &request{method: http.MethodGet, url: u})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out VersionListResult
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode versions response: %w", err)
+	}
+	return &out, nil
+}
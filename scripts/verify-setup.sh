@@ -97,8 +97,8 @@ echo -e "${BLUE}7. Checking project structure...${NC}\n"
 
 check_dir "cmd/gateway"
 check_dir "internal"
-check_dir "db"
-check_file "db/schema.sql"
+check_dir "internal/migrate/migrations"
+check_file "internal/migrate/migrations/0001_init.up.sql"
 
 echo ""
 echo -e "${BLUE}8. Checking required commands...${NC}\n"